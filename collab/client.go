@@ -0,0 +1,139 @@
+package collab
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is how long writing a message to a client may take
+	writeWait = 10 * time.Second
+	// pongWait is how long a client may stay silent before it is dropped
+	pongWait = 60 * time.Second
+	// pingPeriod is how often clients are pinged, shorter than pongWait
+	pingPeriod = 50 * time.Second
+	// maxMessageSize caps a message from a client, in bytes
+	maxMessageSize = 1 << 20
+	// sendBuffer is how many messages may queue for a client before it is
+	// considered too slow and dropped
+	sendBuffer = 256
+)
+
+// Client is one connection to a session.
+type Client struct {
+	id          string
+	participant Participant
+	conn        *websocket.Conn
+	send        chan []byte
+	dropOnce    sync.Once
+	// cursor is guarded by the room
+	cursor *Cursor
+}
+
+func newClient(conn *websocket.Conn, participant Participant) *Client {
+	return &Client{
+		participant: participant,
+		conn:        conn,
+		send:        make(chan []byte, sendBuffer),
+	}
+}
+
+// presence describes the client to the others.
+func (c *Client) presence() Presence {
+	return Presence{Client_id: c.id, Participant: c.participant, Cursor: c.cursor}
+}
+
+// enqueue queues data for the client without blocking. A client that can't
+// keep up is disconnected; it will have to rejoin and reload the note.
+func (c *Client) enqueue(data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		c.dropOnce.Do(func() {
+			log.Printf("Dropping slow editing client %v", c.id)
+			c.conn.Close()
+		})
+	}
+}
+
+// disconnect closes the connection once the messages queued before it are
+// written.
+func (c *Client) disconnect() {
+	c.enqueue(nil)
+}
+
+func (c *Client) sendMessage(message *Message) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error encoding message: %v", err.Error())
+		return
+	}
+	c.enqueue(data)
+}
+
+func (c *Client) sendError(message string) {
+	c.sendMessage(&Message{Type: MessageError, Message: message})
+}
+
+// readPump passes the client's messages to the room until the connection
+// closes.
+func (c *Client) readPump(room *Room) {
+	defer c.conn.Close()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("Editing client disconnected: %v", err.Error())
+			}
+			return
+		}
+
+		var message Message
+		if err := json.Unmarshal(data, &message); err != nil {
+			c.sendError("Invalid message: " + err.Error())
+			continue
+		}
+
+		room.handle(c, &message)
+	}
+}
+
+// writePump writes queued messages and pings to the client until the send
+// channel is closed.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok || data == nil {
+				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package collab
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// maxHistory is how many applied operations a document keeps for
+// transforming late client operations. Clients further behind must reload.
+const maxHistory = 2000
+
+// ErrStaleRevision is returned for an operation based on a revision the
+// document no longer keeps the history for.
+var ErrStaleRevision = errors.New("revision is too old, reload the note")
+
+// Document is the authoritative copy of a note being edited in a session.
+// Every applied operation increments its revision. It is not safe for
+// concurrent use; a Room serialises access.
+type Document struct {
+	text     string
+	revision int
+	// history holds the operations that produced revisions
+	// revision-len(history)+1 through revision
+	history []*Operation
+}
+
+// NewDocument starts a document at revision 0 with the given text.
+func NewDocument(text string) *Document {
+	return &Document{text: text}
+}
+
+// Text returns the document's current text.
+func (d *Document) Text() string {
+	return d.text
+}
+
+// Revision returns the number of operations applied so far.
+func (d *Document) Revision() int {
+	return d.revision
+}
+
+// Apply applies an operation made against the given revision. It is first
+// transformed over every operation applied since, and the transformed
+// operation, as applied to the current text, is returned.
+func (d *Document) Apply(revision int, op *Operation) (*Operation, error) {
+	if revision < 0 || revision > d.revision {
+		return nil, fmt.Errorf("unknown revision %d", revision)
+	}
+
+	missed := d.revision - revision
+	if missed > len(d.history) {
+		return nil, ErrStaleRevision
+	}
+
+	for _, concurrent := range d.history[len(d.history)-missed:] {
+		var err error
+		if op, _, err = Transform(op, concurrent); err != nil {
+			return nil, err
+		}
+	}
+
+	if length := utf8.RuneCountInString(d.text); op.BaseLen() != length {
+		return nil, fmt.Errorf("operation applies to texts of %d characters, not %d", op.BaseLen(), length)
+	}
+
+	text, err := op.Apply(d.text)
+	if err != nil {
+		return nil, err
+	}
+
+	d.text = text
+	d.revision++
+	d.history = append(d.history, op)
+	if len(d.history) > maxHistory {
+		d.history = append([]*Operation(nil), d.history[len(d.history)-maxHistory:]...)
+	}
+
+	return op, nil
+}
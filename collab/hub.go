@@ -0,0 +1,169 @@
+package collab
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// Persister loads the notes edited in sessions and saves their snapshots.
+type Persister interface {
+	// Load returns the owner's note as currently stored.
+	Load(ctx context.Context, owner string, fileId string) (*models.File, error)
+	// Save stores text as the note's content, written by authorId, if the
+	// stored version still equals file.Version, and returns the stored note.
+	// It fails with store.ErrVersionConflict otherwise.
+	Save(ctx context.Context, file *models.File, text string, authorId string) (*models.File, error)
+	// Access reports whether the user may still view and edit the note.
+	// Access can be revoked while a session runs, so it is checked on every
+	// snapshot.
+	Access(ctx context.Context, file *models.File, userId string) (canView bool, canEdit bool, err error)
+}
+
+// Checker spell checks the text of a note being edited.
+type Checker func(ctx context.Context, file *models.File, text string) ([]utils.Misspelling, error)
+
+// Config configures a Hub.
+type Config struct {
+	Persister Persister
+	Checker   Checker
+	// SnapshotInterval is how often a session's changes are saved
+	SnapshotInterval time.Duration
+	// SpellcheckDelay is how long a session waits after the last edit
+	// before spell checking the text
+	SpellcheckDelay time.Duration
+}
+
+// Hub keeps one Room per note being edited. Rooms are created when the
+// first client joins and saved and closed when the last one leaves.
+type Hub struct {
+	config Config
+	// mu guards rooms and busy. It is never held while loading or saving.
+	mu    sync.Mutex
+	rooms map[string]*Room
+	// busy has the notes whose room is being opened or saved on closing,
+	// so a note is never loaded while its last session is still being
+	// saved. Joins wait for the channel to close.
+	busy map[string]chan struct{}
+}
+
+// NewHub returns a hub with no sessions.
+func NewHub(config Config) *Hub {
+	return &Hub{
+		config: config,
+		rooms:  make(map[string]*Room),
+		busy:   make(map[string]chan struct{}),
+	}
+}
+
+// Serve runs a client connected over conn in the session of the given
+// note until it disconnects.
+func (h *Hub) Serve(conn *websocket.Conn, file *models.File, participant Participant) {
+	client := newClient(conn, participant)
+
+	room, err := h.join(file, client)
+	if err != nil {
+		log.Printf("Error starting editing session: %v", err.Error())
+		client.sendError("Could not open the note for editing")
+		close(client.send)
+		client.writePump()
+		return
+	}
+
+	// Leave even if handling a message panics, so the room still closes
+	// and saves and the write pump stops
+	defer h.leave(room, client)
+
+	go client.writePump()
+	client.readPump(room)
+}
+
+// join adds the client to the note's room, starting one if needed.
+func (h *Hub) join(file *models.File, client *Client) (*Room, error) {
+	for {
+		h.mu.Lock()
+		room, busy := h.rooms[file.File_id], h.busy[file.File_id]
+		opening := room == nil && busy == nil
+		if opening {
+			busy = make(chan struct{})
+			h.busy[file.File_id] = busy
+		}
+		h.mu.Unlock()
+
+		if room != nil {
+			if room.add(client) {
+				return room, nil
+			}
+			// The last client just left; wait until leave has the room
+			<-room.gone
+			continue
+		}
+		if !opening {
+			<-busy
+			continue
+		}
+
+		room, err := h.open(file)
+
+		h.mu.Lock()
+		delete(h.busy, file.File_id)
+		if err == nil {
+			h.rooms[file.File_id] = room
+		}
+		h.mu.Unlock()
+		close(busy)
+
+		if err != nil {
+			return nil, err
+		}
+		go room.snapshotLoop()
+		if room.add(client) {
+			return room, nil
+		}
+	}
+}
+
+// open starts a room for the note. It loads the note again: the file the
+// client was authorised for may predate the last save of a session that
+// just closed.
+func (h *Hub) open(file *models.File) (*Room, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	stored, err := h.config.Persister.Load(ctx, file.User_id, file.File_id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newRoom(h, stored), nil
+}
+
+// leave removes the client from its room. If it was the last one, the room
+// is closed and saved, with joins to the note waiting until it is.
+func (h *Hub) leave(room *Room, client *Client) {
+	last := room.remove(client)
+	close(client.send)
+	if !last {
+		return
+	}
+
+	busy := make(chan struct{})
+	h.mu.Lock()
+	delete(h.rooms, room.fileId)
+	h.busy[room.fileId] = busy
+	h.mu.Unlock()
+	close(room.gone)
+
+	room.flush()
+
+	h.mu.Lock()
+	delete(h.busy, room.fileId)
+	h.mu.Unlock()
+	close(busy)
+}
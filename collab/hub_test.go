@@ -0,0 +1,191 @@
+package collab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gorilla/websocket"
+)
+
+// storePersister saves sessions straight into a file store. Users in
+// readOnly can't edit and users in revoked can't view either.
+type storePersister struct {
+	files    store.FileStore
+	readOnly *sync.Map
+	revoked  *sync.Map
+}
+
+func (p storePersister) Load(ctx context.Context, owner string, fileId string) (*models.File, error) {
+	return p.files.GetFile(ctx, owner, fileId)
+}
+
+func (p storePersister) Save(ctx context.Context, file *models.File, text string, authorId string) (*models.File, error) {
+	updated := *file
+	updated.File_content = text
+	return p.files.UpdateFile(ctx, &updated, file.Version)
+}
+
+func (p storePersister) Access(ctx context.Context, file *models.File, userId string) (bool, bool, error) {
+	if p.revoked != nil {
+		if _, revoked := p.revoked.Load(userId); revoked {
+			return false, false, nil
+		}
+	}
+	if p.readOnly != nil {
+		if _, readOnly := p.readOnly.Load(userId); readOnly {
+			return true, false, nil
+		}
+	}
+	return true, true, nil
+}
+
+// connect joins the session over a websocket and returns the init message
+func connect(t *testing.T, server *httptest.Server) (*websocket.Conn, *Message) {
+	t.Helper()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Error connecting: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn, expectMessage(t, conn, MessageInit)
+}
+
+// expectMessage reads messages until one of the given type arrives
+func expectMessage(t *testing.T, conn *websocket.Conn, messageType string) *Message {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var message Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("Error waiting for %q: %v", messageType, err)
+		}
+		if message.Type == messageType {
+			return &message
+		}
+	}
+}
+
+func TestHubMergesEditsAndSaves(t *testing.T) {
+	ctx := context.Background()
+	files := store.NewMemoryStores().Files
+	file := &models.File{File_id: "note", User_id: "owner", File_name: "note.md", File_content: "hello world"}
+	if err := files.CreateFile(ctx, file); err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+
+	hub := NewHub(Config{
+		Persister: storePersister{files: files},
+		Checker: func(ctx context.Context, file *models.File, text string) ([]utils.Misspelling, error) {
+			return nil, nil
+		},
+		SnapshotInterval: time.Hour,
+		SpellcheckDelay:  time.Millisecond,
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Serve(conn, file, Participant{User_id: "owner", Can_edit: true})
+	}))
+	defer server.Close()
+
+	first, init := connect(t, server)
+	if *init.Text != "hello world" || init.Revision != 0 {
+		t.Fatalf("Unexpected init %q at %d", *init.Text, init.Revision)
+	}
+	second, _ := connect(t, server)
+	expectMessage(t, first, MessageJoin)
+
+	// Both clients edit revision 0 at once
+	first.WriteJSON(&Message{Type: MessageOp, Revision: 0, Op: (&Operation{}).Retain(5).Insert(",").Retain(6)})
+	second.WriteJSON(&Message{Type: MessageOp, Revision: 0, Op: (&Operation{}).Retain(11).Insert("!")})
+	expectMessage(t, first, MessageAck)
+	expectMessage(t, second, MessageAck)
+
+	// The note changes outside the session before it is saved
+	stored, _ := files.GetFile(ctx, "owner", "note")
+	stored.File_content = "Oh, hello world"
+	if _, err := files.UpdateFile(ctx, stored, stored.Version); err != nil {
+		t.Fatalf("Error updating file: %v", err)
+	}
+
+	first.Close()
+	expectMessage(t, second, MessageLeave)
+	second.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		saved, _ := files.GetFile(ctx, "owner", "note")
+		if saved.File_content == "Oh, hello, world!" {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	saved, _ := files.GetFile(ctx, "owner", "note")
+	t.Errorf("Expected the merged text to be saved, got %q", saved.File_content)
+}
+
+func TestHubRechecksEditAccess(t *testing.T) {
+	ctx := context.Background()
+	files := store.NewMemoryStores().Files
+	file := &models.File{File_id: "note", User_id: "owner", File_name: "note.md", File_content: "hello"}
+	if err := files.CreateFile(ctx, file); err != nil {
+		t.Fatalf("Error creating file: %v", err)
+	}
+
+	readOnly, revoked := &sync.Map{}, &sync.Map{}
+	hub := NewHub(Config{
+		Persister: storePersister{files, readOnly, revoked},
+		Checker: func(ctx context.Context, file *models.File, text string) ([]utils.Misspelling, error) {
+			return nil, nil
+		},
+		SnapshotInterval: 10 * time.Millisecond,
+		SpellcheckDelay:  time.Hour,
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		hub.Serve(conn, file, Participant{User_id: "editor", Can_edit: true})
+	}))
+	defer server.Close()
+
+	conn, _ := connect(t, server)
+	readOnly.Store("editor", true)
+	if message := expectMessage(t, conn, MessageError); !strings.Contains(message.Message, "removed") {
+		t.Fatalf("Expected to be told access was removed, got %q", message.Message)
+	}
+
+	conn.WriteJSON(&Message{Type: MessageOp, Revision: 0, Op: (&Operation{}).Retain(5).Insert("!")})
+	if message := expectMessage(t, conn, MessageError); !strings.Contains(message.Message, "view access") {
+		t.Errorf("Expected the edit to be refused, got %q", message.Message)
+	}
+
+	revoked.Store("editor", true)
+	if message := expectMessage(t, conn, MessageError); !strings.Contains(message.Message, "access to this note was removed") {
+		t.Fatalf("Expected to be told access was removed, got %q", message.Message)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			break
+		}
+	}
+}
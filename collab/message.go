@@ -0,0 +1,68 @@
+package collab
+
+import "go-markdown-parser/utils"
+
+// Participant is a user connected to a session.
+type Participant struct {
+	User_id  string `json:"user_id"`
+	Email    string `json:"email"`
+	Can_edit bool   `json:"can_edit"`
+}
+
+// Cursor is a client's caret and the other end of its selection, in
+// characters. Both are equal when nothing is selected.
+type Cursor struct {
+	Position      int `json:"position"`
+	Selection_end int `json:"selection_end"`
+}
+
+// Presence is a connected client as shown to the others.
+type Presence struct {
+	Client_id string `json:"client_id"`
+	Participant
+	Cursor *Cursor `json:"cursor,omitempty"`
+}
+
+// Message types, sent as Message.Type.
+const (
+	// MessageInit is sent on joining with Revision, Text, Client_id (the
+	// client's own id) and Clients (everyone connected).
+	MessageInit = "init"
+	// MessageOp carries an edit: from a client, Op made at Revision and
+	// optionally the Cursor after it; from the server, another client's Op
+	// as applied at Revision. Changes saved outside the session arrive with
+	// an empty Client_id.
+	MessageOp = "op"
+	// MessageAck confirms the client's last Op was applied as Revision.
+	MessageAck = "ack"
+	// MessageCursor carries a client's Cursor; clients send it without
+	// Client_id.
+	MessageCursor = "cursor"
+	// MessageJoin and MessageLeave announce clients arriving, in Clients,
+	// and going, by Client_id.
+	MessageJoin  = "join"
+	MessageLeave = "leave"
+	// MessageDiagnostics lists the Misspellings in the text at Revision.
+	MessageDiagnostics = "diagnostics"
+	// MessageSaved reports that the text at Revision was stored as the
+	// note's Version.
+	MessageSaved = "saved"
+	// MessageError reports a problem in Message. After an error about an
+	// op, the client should reload the note.
+	MessageError = "error"
+)
+
+// Message is exchanged between clients and the server as JSON. Type selects
+// which fields are set.
+type Message struct {
+	Type         string              `json:"type"`
+	Revision     int                 `json:"revision"`
+	Op           *Operation          `json:"op,omitempty"`
+	Text         *string             `json:"text,omitempty"`
+	Client_id    string              `json:"client_id,omitempty"`
+	Cursor       *Cursor             `json:"cursor,omitempty"`
+	Clients      []Presence          `json:"clients,omitempty"`
+	Misspellings []utils.Misspelling `json:"misspellings,omitempty"`
+	Version      int64               `json:"version,omitempty"`
+	Message      string              `json:"message,omitempty"`
+}
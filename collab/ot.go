@@ -0,0 +1,375 @@
+// Package collab implements real-time collaborative editing of notes with
+// operational transformation. The server holds the authoritative copy of a
+// note being edited; clients send operations against the revision they last
+// saw, and the server transforms them over everything applied since.
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf8"
+
+	"go-markdown-parser/utils"
+)
+
+// component is one step of an operation. Exactly one field is set.
+type component struct {
+	retain int
+	insert string
+	delete int
+}
+
+// Operation transforms a text into another. It walks the text from the
+// start, keeping (retain), removing (delete) or adding (insert) characters.
+// Lengths count Unicode characters (runes), like utils.TextEdit.
+//
+// On the wire an operation is a JSON array in the ot.js format: a positive
+// number retains that many characters, a negative number deletes that many,
+// and a string is inserted.
+type Operation struct {
+	components []component
+	baseLen    int
+	targetLen  int
+}
+
+// BaseLen is the length of the texts the operation applies to.
+func (o *Operation) BaseLen() int {
+	return o.baseLen
+}
+
+// TargetLen is the length of the texts the operation produces.
+func (o *Operation) TargetLen() int {
+	return o.targetLen
+}
+
+// IsNoop reports whether applying the operation leaves every text unchanged.
+func (o *Operation) IsNoop() bool {
+	return len(o.components) == 0 || (len(o.components) == 1 && o.components[0].retain > 0)
+}
+
+// Retain keeps the next n characters.
+func (o *Operation) Retain(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	o.targetLen += n
+
+	if last := len(o.components) - 1; last >= 0 && o.components[last].retain > 0 {
+		o.components[last].retain += n
+		return o
+	}
+	o.components = append(o.components, component{retain: n})
+	return o
+}
+
+// Insert adds text at the current position.
+func (o *Operation) Insert(text string) *Operation {
+	if text == "" {
+		return o
+	}
+	o.targetLen += utf8.RuneCountInString(text)
+
+	last := len(o.components) - 1
+	if last >= 0 && o.components[last].insert != "" {
+		o.components[last].insert += text
+		return o
+	}
+
+	// Inserts go before deletes at the same position, so equal operations
+	// always have the same components.
+	if last >= 0 && o.components[last].delete > 0 {
+		if last > 0 && o.components[last-1].insert != "" {
+			o.components[last-1].insert += text
+			return o
+		}
+		o.components = append(o.components, o.components[last])
+		o.components[last] = component{insert: text}
+		return o
+	}
+
+	o.components = append(o.components, component{insert: text})
+	return o
+}
+
+// Delete removes the next n characters.
+func (o *Operation) Delete(n int) *Operation {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+
+	if last := len(o.components) - 1; last >= 0 && o.components[last].delete > 0 {
+		o.components[last].delete += n
+		return o
+	}
+	o.components = append(o.components, component{delete: n})
+	return o
+}
+
+// Apply runs the operation on text.
+func (o *Operation) Apply(text string) (string, error) {
+	runes := []rune(text)
+	if len(runes) != o.baseLen {
+		return "", fmt.Errorf("operation applies to texts of %d characters, not %d", o.baseLen, len(runes))
+	}
+
+	result := make([]rune, 0, o.targetLen)
+	position := 0
+	for _, c := range o.components {
+		switch {
+		case c.retain > 0:
+			result = append(result, runes[position:position+c.retain]...)
+			position += c.retain
+		case c.insert != "":
+			result = append(result, []rune(c.insert)...)
+		default:
+			position += c.delete
+		}
+	}
+
+	return string(result), nil
+}
+
+// TransformIndex moves a position in a text through the operation, as when
+// a remote edit shifts a cursor. Text inserted at the position pushes it
+// forward.
+func (o *Operation) TransformIndex(index int) int {
+	newIndex := index
+	for _, c := range o.components {
+		switch {
+		case c.retain > 0:
+			index -= c.retain
+		case c.insert != "":
+			newIndex += utf8.RuneCountInString(c.insert)
+		default:
+			newIndex -= min(index, c.delete)
+			index -= c.delete
+		}
+		if index < 0 {
+			break
+		}
+	}
+
+	return newIndex
+}
+
+// Diff returns an operation turning oldText into newText, built from a word
+// diff so unchanged words are retained.
+func Diff(oldText, newText string) *Operation {
+	op := &Operation{}
+	for _, d := range utils.WordDiff(oldText, newText) {
+		switch d.Kind {
+		case utils.DiffEqual:
+			op.Retain(utf8.RuneCountInString(d.Text))
+		case utils.DiffInsert:
+			op.Insert(d.Text)
+		case utils.DiffDelete:
+			op.Delete(utf8.RuneCountInString(d.Text))
+		}
+	}
+
+	return op
+}
+
+// cursor walks the components of an operation, splitting them as needed.
+type cursor struct {
+	components []component
+	next       int
+	current    component
+	ok         bool
+}
+
+func newCursor(o *Operation) *cursor {
+	c := &cursor{components: o.components}
+	c.advance()
+	return c
+}
+
+func (c *cursor) advance() {
+	c.ok = c.next < len(c.components)
+	if c.ok {
+		c.current = c.components[c.next]
+		c.next++
+	}
+}
+
+var errLengthMismatch = errors.New("operations have incompatible lengths")
+
+// Transform takes two operations a and b made concurrently on the same text
+// and returns a' and b' such that applying a then b' gives the same text as
+// applying b then a'. When both insert at the same position, a's text goes
+// first.
+func Transform(a, b *Operation) (*Operation, *Operation, error) {
+	if a.baseLen != b.baseLen {
+		return nil, nil, errLengthMismatch
+	}
+
+	aPrime, bPrime := &Operation{}, &Operation{}
+	ca, cb := newCursor(a), newCursor(b)
+
+	for ca.ok || cb.ok {
+		if ca.ok && ca.current.insert != "" {
+			aPrime.Insert(ca.current.insert)
+			bPrime.Retain(utf8.RuneCountInString(ca.current.insert))
+			ca.advance()
+			continue
+		}
+		if cb.ok && cb.current.insert != "" {
+			aPrime.Retain(utf8.RuneCountInString(cb.current.insert))
+			bPrime.Insert(cb.current.insert)
+			cb.advance()
+			continue
+		}
+		if !ca.ok || !cb.ok {
+			return nil, nil, errLengthMismatch
+		}
+
+		x, y := &ca.current, &cb.current
+		n := min(x.retain+x.delete, y.retain+y.delete)
+
+		switch {
+		case x.retain > 0 && y.retain > 0:
+			aPrime.Retain(n)
+			bPrime.Retain(n)
+		case x.delete > 0 && y.retain > 0:
+			aPrime.Delete(n)
+		case x.retain > 0 && y.delete > 0:
+			bPrime.Delete(n)
+		}
+		// Text deleted by both needs deleting by neither
+
+		consume(ca, n)
+		consume(cb, n)
+	}
+
+	return aPrime, bPrime, nil
+}
+
+// consume uses up n characters of the cursor's current retain or delete.
+func consume(c *cursor, n int) {
+	if c.current.retain > 0 {
+		c.current.retain -= n
+		if c.current.retain == 0 {
+			c.advance()
+		}
+		return
+	}
+
+	c.current.delete -= n
+	if c.current.delete == 0 {
+		c.advance()
+	}
+}
+
+// Compose returns a single operation with the effect of a followed by b.
+func Compose(a, b *Operation) (*Operation, error) {
+	if a.targetLen != b.baseLen {
+		return nil, errLengthMismatch
+	}
+
+	composed := &Operation{}
+	ca, cb := newCursor(a), newCursor(b)
+
+	for ca.ok || cb.ok {
+		if ca.ok && ca.current.delete > 0 {
+			composed.Delete(ca.current.delete)
+			ca.advance()
+			continue
+		}
+		if cb.ok && cb.current.insert != "" {
+			composed.Insert(cb.current.insert)
+			cb.advance()
+			continue
+		}
+		if !ca.ok || !cb.ok {
+			return nil, errLengthMismatch
+		}
+
+		x, y := &ca.current, &cb.current
+		if x.insert != "" {
+			// Text inserted by a, then kept or deleted by b
+			inserted := []rune(x.insert)
+			n := min(len(inserted), y.retain+y.delete)
+			if y.retain > 0 {
+				composed.Insert(string(inserted[:n]))
+			}
+
+			if n == len(inserted) {
+				ca.advance()
+			} else {
+				x.insert = string(inserted[n:])
+			}
+			consume(cb, n)
+			continue
+		}
+
+		n := min(x.retain, y.retain+y.delete)
+		if y.retain > 0 {
+			composed.Retain(n)
+		} else {
+			composed.Delete(n)
+		}
+		consume(ca, n)
+		consume(cb, n)
+	}
+
+	return composed, nil
+}
+
+// MarshalJSON encodes the operation in the ot.js format.
+func (o *Operation) MarshalJSON() ([]byte, error) {
+	encoded := make([]any, 0, len(o.components))
+	for _, c := range o.components {
+		switch {
+		case c.retain > 0:
+			encoded = append(encoded, c.retain)
+		case c.insert != "":
+			encoded = append(encoded, c.insert)
+		default:
+			encoded = append(encoded, -c.delete)
+		}
+	}
+
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON decodes an operation in the ot.js format. Components and
+// the lengths they add up to are bounded by maxTextLength, so the lengths
+// can't overflow.
+func (o *Operation) UnmarshalJSON(data []byte) error {
+	var encoded []any
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+
+	*o = Operation{}
+	for _, item := range encoded {
+		switch value := item.(type) {
+		case string:
+			if utf8.RuneCountInString(value) > maxTextLength {
+				return fmt.Errorf("operation inserts more than %d characters", maxTextLength)
+			}
+			o.Insert(value)
+		case float64:
+			if value != math.Trunc(value) || value == 0 || math.Abs(value) > maxTextLength {
+				return fmt.Errorf("invalid operation component %v", value)
+			}
+			if n := int(value); n > 0 {
+				o.Retain(n)
+			} else {
+				o.Delete(-n)
+			}
+		default:
+			return fmt.Errorf("invalid operation component %v", item)
+		}
+
+		if o.baseLen > maxTextLength || o.targetLen > maxTextLength {
+			return fmt.Errorf("operation spans more than %d characters", maxTextLength)
+		}
+	}
+
+	return nil
+}
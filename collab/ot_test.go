@@ -0,0 +1,148 @@
+package collab
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+// randomOperation returns a random operation that applies to text
+func randomOperation(r *rand.Rand, text string) *Operation {
+	op := &Operation{}
+	remaining := len([]rune(text))
+	alphabet := []string{"a", "b", "é", " ", "\n", "xyz", "日本"}
+
+	for remaining > 0 {
+		n := 1 + r.Intn(remaining)
+		switch r.Intn(3) {
+		case 0:
+			op.Retain(n)
+			remaining -= n
+		case 1:
+			op.Insert(alphabet[r.Intn(len(alphabet))])
+		default:
+			op.Delete(n)
+			remaining -= n
+		}
+	}
+	if r.Intn(2) == 0 {
+		op.Insert(alphabet[r.Intn(len(alphabet))])
+	}
+
+	return op
+}
+
+func TestTransformConverges(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 500; i++ {
+		text := []string{"", "hello", "The qick brown fox", "ça va\nbien"}[i%4]
+		a, b := randomOperation(r, text), randomOperation(r, text)
+
+		aPrime, bPrime, err := Transform(a, b)
+		if err != nil {
+			t.Fatalf("Error transforming: %v", err)
+		}
+
+		afterA, _ := a.Apply(text)
+		afterB, _ := b.Apply(text)
+		left, err := bPrime.Apply(afterA)
+		if err != nil {
+			t.Fatalf("Error applying b': %v", err)
+		}
+		right, err := aPrime.Apply(afterB)
+		if err != nil {
+			t.Fatalf("Error applying a': %v", err)
+		}
+
+		if left != right {
+			t.Fatalf("Transformed operations diverge on %q: %q vs %q", text, left, right)
+		}
+	}
+}
+
+func TestComposeMatchesSequentialApply(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+
+	for i := 0; i < 500; i++ {
+		text := []string{"", "hello", "The qick brown fox", "ça va\nbien"}[i%4]
+		a := randomOperation(r, text)
+		afterA, _ := a.Apply(text)
+		b := randomOperation(r, afterA)
+		want, _ := b.Apply(afterA)
+
+		composed, err := Compose(a, b)
+		if err != nil {
+			t.Fatalf("Error composing: %v", err)
+		}
+		if got, err := composed.Apply(text); err != nil || got != want {
+			t.Fatalf("Composed operation gives %q, %v, want %q", got, err, want)
+		}
+	}
+}
+
+func TestDiffAndTransformIndex(t *testing.T) {
+	op := Diff("The qick fox", "Well, the quick fox")
+	if got, err := op.Apply("The qick fox"); err != nil || got != "Well, the quick fox" {
+		t.Fatalf("Diff applies as %q, %v", got, err)
+	}
+
+	// A cursor before "fox" follows it to its new position
+	if index := op.TransformIndex(9); index != 16 {
+		t.Errorf("Expected the cursor at 16, got %d", index)
+	}
+}
+
+func TestOperationJSON(t *testing.T) {
+	var op Operation
+	if err := json.Unmarshal([]byte(`[3, "ab", -2, 1]`), &op); err != nil {
+		t.Fatalf("Error decoding operation: %v", err)
+	}
+	if op.BaseLen() != 6 || op.TargetLen() != 6 {
+		t.Errorf("Unexpected lengths %d -> %d", op.BaseLen(), op.TargetLen())
+	}
+	if got, _ := op.Apply("abcdef"); got != "abcabf" {
+		t.Errorf("Decoded operation gives %q", got)
+	}
+
+	encoded, _ := json.Marshal(&op)
+	if string(encoded) != `[3,"ab",-2,1]` {
+		t.Errorf("Operation encodes as %s", encoded)
+	}
+
+	if err := json.Unmarshal([]byte(`[1.5]`), &op); err == nil {
+		t.Error("Expected an error for a fractional component")
+	}
+
+	// Lengths that would wrap around to fit a short note
+	huge := `[10, 4611686018427387904, -4611686018427387904, 4611686018427387904, -4611686018427387904]`
+	if err := json.Unmarshal([]byte(huge), &op); err == nil {
+		t.Errorf("Expected an error for oversized components, got lengths %d -> %d", op.BaseLen(), op.TargetLen())
+	}
+	if _, err := NewDocument("0123456789").Apply(0, (&Operation{}).Retain(4)); err == nil {
+		t.Error("Expected an error for an operation on a text of another length")
+	}
+}
+
+func TestDocumentTransformsLateOperations(t *testing.T) {
+	doc := NewDocument("hello world")
+
+	// Two clients edit revision 0 at the same time
+	first := (&Operation{}).Retain(5).Insert(",").Retain(6)
+	second := (&Operation{}).Retain(6).Delete(5).Insert("there")
+
+	if _, err := doc.Apply(0, first); err != nil {
+		t.Fatalf("Error applying first operation: %v", err)
+	}
+	if _, err := doc.Apply(0, second); err != nil {
+		t.Fatalf("Error applying second operation: %v", err)
+	}
+
+	if doc.Text() != "hello, there" || doc.Revision() != 2 {
+		t.Errorf("Expected %q at revision 2, got %q at %d", "hello, there", doc.Text(), doc.Revision())
+	}
+
+	if _, err := doc.Apply(3, first); err == nil {
+		t.Error("Expected an error for a future revision")
+	}
+}
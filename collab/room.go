@@ -0,0 +1,367 @@
+package collab
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+)
+
+// saveTimeout bounds loading and saving a session's note
+const saveTimeout = 10 * time.Second
+
+// maxTextLength caps the length of a note edited in a session, in characters
+const maxTextLength = 1 << 20
+
+// Room is the editing session of one note: its document, the connected
+// clients and the changes not yet saved.
+type Room struct {
+	hub    *Hub
+	fileId string
+	// gone is closed once the hub has let go of the closed room
+	gone chan struct{}
+
+	mu      sync.Mutex
+	doc     *Document
+	clients map[*Client]bool
+	nextId  int
+	closed  bool
+	stop    chan struct{}
+	// file is the note as last loaded or saved
+	file *models.File
+	// unsaved turns the content of file into the document's text
+	unsaved    *Operation
+	lastEditor string
+
+	checkTimer      *time.Timer
+	checkedRevision int
+	misspellings    []utils.Misspelling
+}
+
+func newRoom(hub *Hub, file *models.File) *Room {
+	room := &Room{
+		hub:             hub,
+		fileId:          file.File_id,
+		gone:            make(chan struct{}),
+		doc:             NewDocument(file.File_content),
+		clients:         make(map[*Client]bool),
+		stop:            make(chan struct{}),
+		file:            file,
+		unsaved:         (&Operation{}).Retain(utf8.RuneCountInString(file.File_content)),
+		checkedRevision: -1,
+	}
+	room.scheduleSpellcheck()
+
+	return room
+}
+
+// add welcomes a client and announces it to the others. It returns false
+// if the room has closed.
+func (r *Room) add(client *Client) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return false
+	}
+
+	r.nextId++
+	client.id = strconv.Itoa(r.nextId)
+
+	r.broadcast(&Message{Type: MessageJoin, Revision: r.doc.Revision(), Clients: []Presence{client.presence()}}, nil)
+	r.clients[client] = true
+
+	text := r.doc.Text()
+	init := &Message{
+		Type:      MessageInit,
+		Revision:  r.doc.Revision(),
+		Text:      &text,
+		Client_id: client.id,
+		Clients:   r.presences(),
+	}
+	client.sendMessage(init)
+
+	if r.checkedRevision == r.doc.Revision() {
+		client.sendMessage(&Message{Type: MessageDiagnostics, Revision: r.checkedRevision, Misspellings: r.misspellings})
+	}
+
+	return true
+}
+
+// remove disconnects a client, unless it was already dropped. If the room
+// is left empty, it closes and returns true; its changes are then saved by
+// flush.
+func (r *Room) remove(client *Client) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.drop(client)
+	if len(r.clients) > 0 || r.closed {
+		return false
+	}
+
+	r.closed = true
+	close(r.stop)
+	if r.checkTimer != nil {
+		r.checkTimer.Stop()
+	}
+
+	return true
+}
+
+// drop takes a client out of the room and tells the others.
+func (r *Room) drop(client *Client) {
+	if !r.clients[client] {
+		return
+	}
+
+	delete(r.clients, client)
+	r.broadcast(&Message{Type: MessageLeave, Revision: r.doc.Revision(), Client_id: client.id}, nil)
+}
+
+// flush saves the changes of a closed room.
+func (r *Room) flush() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.save()
+}
+
+// presences lists the connected clients.
+func (r *Room) presences() []Presence {
+	presences := make([]Presence, 0, len(r.clients))
+	for client := range r.clients {
+		presences = append(presences, client.presence())
+	}
+
+	return presences
+}
+
+// broadcast sends a message to every client except one.
+func (r *Room) broadcast(message *Message, except *Client) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("Error encoding message: %v", err.Error())
+		return
+	}
+
+	for client := range r.clients {
+		if client != except {
+			client.enqueue(data)
+		}
+	}
+}
+
+// handle processes a message from a client.
+func (r *Room) handle(client *Client, message *Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch message.Type {
+	case MessageOp:
+		r.applyOp(client, message)
+	case MessageCursor:
+		if message.Cursor != nil {
+			client.cursor = message.Cursor
+			r.broadcast(&Message{Type: MessageCursor, Revision: r.doc.Revision(), Client_id: client.id, Cursor: message.Cursor}, client)
+		}
+	default:
+		client.sendError("Unknown message type " + strconv.Quote(message.Type))
+	}
+}
+
+// applyOp applies a client's edit and relays it to the others.
+func (r *Room) applyOp(client *Client, message *Message) {
+	if !client.participant.Can_edit {
+		client.sendError("You have view access to this note only")
+		return
+	}
+	if message.Op == nil {
+		client.sendError("op is required")
+		return
+	}
+
+	if message.Op.TargetLen() > maxTextLength {
+		client.sendError("The note is too long")
+		return
+	}
+
+	applied, err := r.doc.Apply(message.Revision, message.Op)
+	if err != nil {
+		client.sendError(err.Error())
+		return
+	}
+
+	if r.unsaved, err = Compose(r.unsaved, applied); err != nil {
+		log.Printf("Error tracking unsaved changes: %v", err.Error())
+	}
+	r.lastEditor = client.participant.User_id
+
+	for other := range r.clients {
+		if other != client && other.cursor != nil {
+			other.cursor = &Cursor{
+				Position:      applied.TransformIndex(other.cursor.Position),
+				Selection_end: applied.TransformIndex(other.cursor.Selection_end),
+			}
+		}
+	}
+	if message.Cursor != nil {
+		client.cursor = message.Cursor
+	}
+
+	client.sendMessage(&Message{Type: MessageAck, Revision: r.doc.Revision()})
+	r.broadcast(&Message{Type: MessageOp, Revision: r.doc.Revision(), Op: applied, Client_id: client.id, Cursor: client.cursor}, client)
+
+	r.scheduleSpellcheck()
+}
+
+// scheduleSpellcheck checks the text once edits pause for the spellcheck delay.
+func (r *Room) scheduleSpellcheck() {
+	if r.checkTimer == nil {
+		r.checkTimer = time.AfterFunc(r.hub.config.SpellcheckDelay, r.checkSpelling)
+		return
+	}
+	r.checkTimer.Reset(r.hub.config.SpellcheckDelay)
+}
+
+// checkSpelling spell checks the current text without holding the room, then
+// sends the result unless a newer one was sent meanwhile.
+func (r *Room) checkSpelling() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	file, text, revision := r.file, r.doc.Text(), r.doc.Revision()
+	r.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	misspellings, err := r.hub.config.Checker(ctx, file, text)
+	if err != nil {
+		log.Printf("Live spell check failed: %v", err.Error())
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed || revision <= r.checkedRevision {
+		return
+	}
+	r.checkedRevision = revision
+	r.misspellings = misspellings
+
+	r.broadcast(&Message{Type: MessageDiagnostics, Revision: revision, Misspellings: misspellings}, nil)
+}
+
+// snapshotLoop saves the room's changes periodically until it closes.
+func (r *Room) snapshotLoop() {
+	ticker := time.NewTicker(r.hub.config.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.mu.Lock()
+			r.recheck()
+			r.save()
+			r.mu.Unlock()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// recheck drops the clients who lost access to the note since joining, and
+// makes those who can only view it now viewers.
+func (r *Room) recheck() {
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	for client := range r.clients {
+		canView, canEdit, err := r.hub.config.Persister.Access(ctx, r.file, client.participant.User_id)
+		if err != nil {
+			log.Printf("Error checking access: %v", err.Error())
+			continue
+		}
+
+		switch {
+		case !canView:
+			r.drop(client)
+			client.sendError("Your access to this note was removed")
+			client.disconnect()
+		case !canEdit && client.participant.Can_edit:
+			client.participant.Can_edit = false
+			client.sendError("Your edit access to this note was removed")
+		}
+	}
+}
+
+// save stores the document's text if it changed since the last save. If the
+// note was changed outside the session, that change is merged into the
+// document first, as if a client had made it.
+func (r *Room) save() {
+	if r.unsaved.IsNoop() {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	for attempt := 0; attempt < 3; attempt++ {
+		saved, err := r.hub.config.Persister.Save(ctx, r.file, r.doc.Text(), r.lastEditor)
+		if err == nil {
+			r.file = saved
+			r.unsaved = (&Operation{}).Retain(utf8.RuneCountInString(saved.File_content))
+			r.broadcast(&Message{Type: MessageSaved, Revision: r.doc.Revision(), Version: saved.Version}, nil)
+			return
+		}
+		if !errors.Is(err, store.ErrVersionConflict) {
+			log.Printf("Error saving editing session: %v", err.Error())
+			return
+		}
+
+		if err := r.merge(ctx); err != nil {
+			log.Printf("Error merging outside changes into editing session: %v", err.Error())
+			r.broadcast(&Message{Type: MessageError, Revision: r.doc.Revision(), Message: "The note changed outside this session and could not be saved"}, nil)
+			return
+		}
+	}
+}
+
+// merge applies the changes stored since the note was last loaded or saved
+// to the document and relays them to every client.
+func (r *Room) merge(ctx context.Context) error {
+	stored, err := r.hub.config.Persister.Load(ctx, r.file.User_id, r.file.File_id)
+	if err != nil {
+		return err
+	}
+
+	outside := Diff(r.file.File_content, stored.File_content)
+	outsidePrime, unsavedPrime, err := Transform(outside, r.unsaved)
+	if err != nil {
+		return err
+	}
+
+	applied, err := r.doc.Apply(r.doc.Revision(), outsidePrime)
+	if err != nil {
+		return err
+	}
+
+	r.file = stored
+	r.unsaved = unsavedPrime
+	r.broadcast(&Message{Type: MessageOp, Revision: r.doc.Revision(), Op: applied}, nil)
+	r.scheduleSpellcheck()
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"go-markdown-parser/export"
+	"go-markdown-parser/jobs"
+	"go-markdown-parser/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// accountExports builds account exports in the background, one at a time,
+// and keeps each archive for an hour after it is ready
+var accountExports = jobs.NewManager(1, time.Hour)
+
+// ExportAccount starts a background export of the user's account: a zip of
+// every note of their personal space, trashed ones included, as markdown,
+// with the account and note metadata as JSON. The response is the job to
+// poll; its archive is downloaded once it is done. A user has one export at
+// a time, so asking again returns the one in progress or, once it has
+// finished, starts a fresh one in its place.
+func ExportAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		user, err := userStore.GetUserById(ctx, claims.Uid)
+		if err != nil {
+			respondUserError(c, err)
+			return
+		}
+
+		memberships, err := workspaceStore.ListMemberships(ctx, claims.Uid)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		account := export.Account{
+			User_id:        user.User_id,
+			Created_at:     user.Created_at,
+			Updated_at:     user.Updated_at,
+			Render_options: user.Render_options,
+			Workspaces:     memberships,
+		}
+		if user.Email != nil {
+			account.Email = *user.Email
+		}
+
+		// A user has one export at a time: asking again while one is queued
+		// or running returns it, and otherwise replaces the finished one
+		job, started := accountExports.StartOnce("account_export", claims.Uid, nil, func(progress *jobs.Progress) error {
+			// The same notes GetAllFiles lists in the personal space, plus
+			// the trash, loaded in the background since there may be many
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			files, err := fileStore.ListFiles(ctx, claims.Uid)
+			if err != nil {
+				return err
+			}
+
+			names := make([]string, len(files))
+			for i := range files {
+				names[i] = files[i].Path()
+			}
+			progress.SetItems(names)
+
+			account.Exported_at = time.Now()
+			archive, err := os.CreateTemp("", "account-export-*.zip")
+			if err != nil {
+				return err
+			}
+			err = export.AccountArchive(archive, account, files, func(index int, file *models.File) {
+				progress.Finish(index, jobs.ItemDone, nil, nil)
+			})
+			if closeErr := archive.Close(); err == nil {
+				err = closeErr
+			}
+			if err == nil {
+				err = progress.SetArtifact(&jobs.Artifact{
+					Name:         "notes-export-" + account.Exported_at.Format(time.DateOnly) + ".zip",
+					Content_type: "application/zip",
+					Path:         archive.Name(),
+				})
+			}
+			if err != nil {
+				os.Remove(archive.Name())
+			}
+			return err
+		})
+
+		message := "Export started"
+		if !started {
+			message = "Export already " + job.Status
+		}
+		c.Header("Location", "/api/v1/account/export/"+job.Job_id)
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  http.StatusAccepted,
+			"message": message,
+			"job":     job,
+		})
+	}
+}
+
+// accountExport returns the user's export job named in the path. On failure
+// it writes the error response and returns nil.
+func accountExport(c *gin.Context) *jobs.Job {
+	claims := authenticatedClaims(c)
+	if claims == nil {
+		return nil
+	}
+
+	job, ok := accountExports.Get(claims.Uid, c.Param("job_id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  http.StatusNotFound,
+			"message": "Export not found",
+		})
+		return nil
+	}
+
+	return job
+}
+
+// GetAccountExport returns the progress of an account export
+func GetAccountExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job := accountExport(c)
+		if job == nil {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Export " + job.Status,
+			"job":     job,
+		})
+	}
+}
+
+// DownloadAccountExport downloads the archive of a finished account export
+func DownloadAccountExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job := accountExport(c)
+		if job == nil {
+			return
+		}
+
+		if job.Artifact == nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  http.StatusConflict,
+				"message": "Export is " + job.Status + ", its archive isn't ready",
+				"error":   job.Error,
+			})
+			return
+		}
+
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": job.Artifact.Name}))
+		c.Header("Content-Type", job.Artifact.Content_type)
+		c.File(job.Artifact.Path)
+	}
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authenticatedClaims validates the request's bearer token and returns its
+// claims. On failure it writes a 401 response and returns nil.
+func authenticatedClaims(c *gin.Context) *utils.JwtSignedDetails {
+	authToken := c.GetHeader("Authorization")
+	bearerToken, found := strings.CutPrefix(authToken, "Bearer ")
+
+	// If no token, return unauthorized
+	if !found || bearerToken == "" {
+		log.Printf("Unauthorized. Please login to continue.")
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  http.StatusUnauthorized,
+			"message": "Unauthorized. Please login to continue.",
+		})
+		return nil
+	}
+
+	claims, msg := utils.ValidateToken(bearerToken)
+
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"status":  http.StatusUnauthorized,
+			"message": "Invalid token. Please login to continue",
+			"error":   msg,
+		})
+		return nil
+	}
+
+	return claims
+}
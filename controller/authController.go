@@ -7,18 +7,16 @@ import (
 	"strings"
 	"time"
 
-	"go-markdown-parser/database"
 	"go-markdown-parser/models"
+	"go-markdown-parser/store"
 	"go-markdown-parser/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
 var validate = validator.New()
 
 func SignUpController() gin.HandlerFunc {
@@ -44,15 +42,7 @@ func SignUpController() gin.HandlerFunc {
 		}
 
 		//Check to see if users email exist
-		regexpMatch := bson.M{
-			"$regex": primitive.Regex{
-				Pattern: *user.Email,
-				Options: "i",
-			},
-		}
-		emailCount, emailErr := userCollection.CountDocuments(ctx, bson.M{
-			"email": regexpMatch,
-		})
+		emailCount, emailErr := userStore.CountUsersByEmail(ctx, *user.Email)
 
 		if emailErr != nil {
 			log.Println("Error checking for email: ", emailErr.Error())
@@ -101,7 +91,7 @@ func SignUpController() gin.HandlerFunc {
 		user.Password = &password
 		user.Created_at = created_at
 		user.Updated_at = created_at
-		token, signedToken, err := utils.GenerateAllTokens(user.User_id, *user.Email)
+		token, signedToken, err := utils.GenerateAllTokens(user.User_id, *user.Email, "")
 
 		if err != nil {
 			log.Println("Error generating token: ", err.Error())
@@ -145,7 +135,7 @@ func SignUpController() gin.HandlerFunc {
 			Refresh_token: user.Refresh_token,
 		}
 
-		_, err = userCollection.InsertOne(ctx, newUser)
+		err = userStore.CreateUser(ctx, &newUser)
 
 		//Error messages
 		if err != nil {
@@ -177,7 +167,6 @@ func LogIn() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 
 		var user models.User
-		var retrieveUser models.User
 
 		defer cancel()
 
@@ -196,13 +185,10 @@ func LogIn() gin.HandlerFunc {
 			return
 		}
 
-		err = userCollection.FindOne(ctx,
-			bson.M{
-				"email": user.Email,
-			}).Decode(&retrieveUser)
+		retrieveUser, err := userStore.GetUserByEmail(ctx, *user.Email)
 
 		if err != nil {
-			if err == mongo.ErrNoDocuments {
+			if err == store.ErrNotFound {
 				log.Println("Email not found")
 				c.JSON(
 					http.StatusBadRequest,
@@ -251,9 +237,11 @@ func LogIn() gin.HandlerFunc {
 			)
 			return
 		}
+		// Every login starts in the user's personal space
 		token, refreshToken, err := utils.GenerateAllTokens(
 			retrieveUser.User_id,
 			*retrieveUser.Email,
+			"",
 		)
 
 		if err != nil {
@@ -268,12 +256,7 @@ func LogIn() gin.HandlerFunc {
 			return
 		}
 
-		updatedUser, err := utils.UpdateTokens(token, refreshToken, retrieveUser.User_id)
-
-		updatedUser.Email = retrieveUser.Email
-		updatedUser.User_id = retrieveUser.User_id
-
-		defer cancel()
+		updatedUser, err := userStore.UpdateTokens(ctx, retrieveUser.User_id, token, refreshToken)
 
 		if err != nil {
 			log.Println("Error updating tokens: ", err.Error())
@@ -287,6 +270,9 @@ func LogIn() gin.HandlerFunc {
 			return
 		}
 
+		updatedUser.Email = retrieveUser.Email
+		updatedUser.User_id = retrieveUser.User_id
+
 		log.Println("Tokens updated successfully! login successful")
 		c.JSON(
 			http.StatusOK,
@@ -327,15 +313,11 @@ func AuthenticateUser() gin.HandlerFunc {
 			})
 			return
 		}
-		var user models.User
-
-		err := userCollection.FindOne(ctx, bson.M{
-			"user_id": claims.Uid,
-		}).Decode(&user)
+		user, err := userStore.GetUserById(ctx, claims.Uid)
 
 		if err != nil {
 			log.Printf("Error finding user: %v", err)
-			if err == mongo.ErrNoDocuments {
+			if err == store.ErrNotFound {
 				log.Printf("User not found. Please signup or login to continue.")
 				c.JSON(http.StatusNotFound, gin.H{
 					"status":  http.StatusNotFound,
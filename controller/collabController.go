@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"go-markdown-parser/collab"
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// corsOrigins is read once, when the first live editing connection arrives
+var corsOrigins = sync.OnceValue(utils.GetCorsOrigins)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	// Browsers don't apply CORS to websockets, so allow the same origins here
+	CheckOrigin: func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+
+		parsed, err := url.Parse(origin)
+		if err == nil && parsed.Host == r.Host {
+			return true
+		}
+
+		return slices.Contains(corsOrigins(), origin)
+	},
+}
+
+// collabHub runs the live editing sessions. Sessions are saved every 30
+// seconds and when the last editor leaves.
+var collabHub = collab.NewHub(collab.Config{
+	Persister:        notePersister{},
+	Checker:          checkLiveSpelling,
+	SnapshotInterval: 30 * time.Second,
+	SpellcheckDelay:  500 * time.Millisecond,
+})
+
+// notePersister saves live editing sessions like any other note update:
+// with a version check, a fresh spellcheck summary and a new revision
+type notePersister struct{}
+
+func (notePersister) Load(ctx context.Context, owner string, fileId string) (*models.File, error) {
+	return fileStore.GetFile(ctx, owner, fileId)
+}
+
+func (notePersister) Save(ctx context.Context, file *models.File, text string, authorId string) (*models.File, error) {
+	result, err := checkSpelling(ctx, workspaceSession(file), []byte(text))
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *file
+	updated.File_content = text
+	return saveNote(ctx, &updated, authorId, result.Summary(), func(ctx context.Context, update *models.File) (*models.File, error) {
+		return fileStore.UpdateFile(ctx, update, file.Version)
+	})
+}
+
+// Access checks access as EditNoteLive did on connecting: the note's owner
+// and the members of its workspace can view it, as can users it is shared
+// with, and its owner, workspace editors and users it is shared with for
+// editing can edit it
+func (notePersister) Access(ctx context.Context, file *models.File, userId string) (bool, bool, error) {
+	if file.User_id == userId {
+		return true, true, nil
+	}
+
+	if file.Workspace_id != "" {
+		member, err := workspaceStore.GetMember(ctx, file.Workspace_id, userId)
+		if err == nil && models.RoleAllows(member.Role, models.RoleEditor) {
+			return true, true, nil
+		}
+		if err != nil && err != store.ErrNotFound {
+			return false, false, err
+		}
+		if err == nil {
+			// Viewers may still have been shared the note for editing
+			_, permission, err := sharedFile(ctx, userId, file.File_id)
+			if err != nil {
+				return false, false, err
+			}
+			return true, models.PermissionAllows(permission, models.PermissionEdit), nil
+		}
+	}
+
+	shared, permission, err := sharedFile(ctx, userId, file.File_id)
+	if err != nil {
+		return false, false, err
+	}
+	if shared == nil {
+		return false, false, nil
+	}
+	return models.PermissionAllows(permission, models.PermissionView), models.PermissionAllows(permission, models.PermissionEdit), nil
+}
+
+// checkLiveSpelling spell checks the text of a session, returning every
+// misspelling with its position
+func checkLiveSpelling(ctx context.Context, file *models.File, text string) ([]utils.Misspelling, error) {
+	result, err := checkSpelling(ctx, workspaceSession(file), []byte(text))
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Misspellings(text), nil
+}
+
+// workspaceSession is the session checkSpelling needs to apply the
+// dictionary of the workspace a note belongs to
+func workspaceSession(file *models.File) *session {
+	return &session{JwtSignedDetails: &utils.JwtSignedDetails{Workspace_id: file.Workspace_id}}
+}
+
+// EditNoteLive upgrades the request to a websocket joining the note's live
+// editing session. Browsers can't set headers on websockets, so the token
+// may also be passed as ?token=.
+func EditNoteLive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if token := c.Query("token"); token != "" && c.GetHeader("Authorization") == "" {
+			c.Request.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		file, permission := findAccessibleFile(c, ctx, claims, models.PermissionView)
+		if file == nil {
+			return
+		}
+
+		if file.Trashed() {
+			badRequest(c, "File is in the trash", nil)
+			return
+		}
+
+		participant := collab.Participant{
+			User_id:  claims.Uid,
+			Email:    claims.Email,
+			Can_edit: permission == ownerPermission || models.PermissionAllows(permission, models.PermissionEdit),
+		}
+
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			// The upgrader has already written the error response
+			return
+		}
+
+		collabHub.Serve(conn, file, participant)
+	}
+}
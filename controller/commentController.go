@@ -0,0 +1,418 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxCommentLength caps the length of a comment, in characters
+const maxCommentLength = 5000
+
+// createThreadRequest is the body of POST /api/v1/markdown/files/:file_id/threads.
+// Start and End select the commented text in the note's current markdown,
+// counted in characters. Quote, if sent, must equal that text, so a comment
+// on a note that changed since the client loaded it is refused.
+type createThreadRequest struct {
+	Start *int   `json:"start" binding:"required"`
+	End   *int   `json:"end" binding:"required"`
+	Quote string `json:"quote"`
+	Body  string `json:"body" binding:"required"`
+}
+
+// commentRequest is the body of POST /api/v1/markdown/files/:file_id/threads/:thread_id/comments
+type commentRequest struct {
+	Body string `json:"body" binding:"required"`
+}
+
+// newComment builds a comment by the user, or returns an error message if
+// the body is empty or too long
+func newComment(authorId string, body string) (*models.Comment, string) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, "Comment can't be empty"
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return nil, "Comment is too long"
+	}
+
+	return &models.Comment{
+		Comment_id: primitive.NewObjectID().Hex(),
+		Author_id:  authorId,
+		Body:       body,
+		Created_at: time.Now(),
+	}, ""
+}
+
+// respondThreadError maps store errors from thread operations to HTTP responses
+func respondThreadError(c *gin.Context, err error) {
+	if err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  http.StatusNotFound,
+			"message": "Thread not found",
+		})
+		return
+	}
+
+	respondStoreError(c, err)
+}
+
+// findThread loads the file's thread named by the thread_id path parameter.
+// On failure it writes the error response and returns nil.
+func findThread(c *gin.Context, ctx context.Context, fileId string) *models.Thread {
+	thread, err := commentStore.GetThread(ctx, fileId, c.Param("thread_id"))
+	if err != nil {
+		respondThreadError(c, err)
+		return nil
+	}
+
+	return thread
+}
+
+// currentRevision returns the revision holding the file's current content,
+// which new anchors are positioned against. Notes saved before revisions
+// were kept get one recorded now.
+func currentRevision(ctx context.Context, claims *session, file *models.File) (*models.Revision, error) {
+	revision, err := revisionStore.LatestRevision(ctx, file.File_id)
+	if err == store.ErrNotFound {
+		result, err := checkSpelling(ctx, claims, []byte(file.File_content))
+		if err != nil {
+			return nil, err
+		}
+		return recordRevision(ctx, file, claims.Uid, result.Summary(), "")
+	}
+
+	return revision, err
+}
+
+// reanchorThreads moves the anchors of the file's comment threads onto the
+// content of a newly recorded revision, diffing it against the revision each
+// anchor was placed on. A thread whose text was deleted is marked detached.
+// Failures are logged rather than returned so they never fail a save.
+func reanchorThreads(ctx context.Context, file *models.File, revision *models.Revision) {
+	threads, err := commentStore.ListThreads(ctx, file.File_id)
+	if err != nil {
+		log.Printf("Error re-anchoring comments: %v", err.Error())
+		return
+	}
+
+	// Threads are usually anchored to the same few revisions; diff each once
+	rangeMaps := make(map[string]*utils.RangeMap)
+	content := []rune(revision.Content)
+
+	for _, thread := range threads {
+		anchor := thread.Anchor
+		if anchor.Detached || anchor.Revision_id == revision.Revision_id {
+			continue
+		}
+
+		rangeMap, ok := rangeMaps[anchor.Revision_id]
+		if !ok {
+			base, err := revisionStore.GetRevision(ctx, file.File_id, anchor.Revision_id)
+			if err != nil && err != store.ErrNotFound {
+				log.Printf("Error re-anchoring comments: %v", err.Error())
+				return
+			}
+			if base != nil {
+				rangeMap = utils.NewRangeMap(base.Content, revision.Content)
+			}
+			rangeMaps[anchor.Revision_id] = rangeMap
+		}
+
+		if rangeMap == nil {
+			anchor.Detached = true
+		} else {
+			start, end := rangeMap.Remap(anchor.Start, anchor.End)
+			if start == end {
+				anchor.Detached = true
+			} else {
+				anchor.Start, anchor.End = start, end
+				anchor.Quote = string(content[start:end])
+			}
+		}
+		anchor.Revision_id = revision.Revision_id
+
+		if err := commentStore.UpdateAnchor(ctx, file.File_id, thread.Thread_id, anchor); err != nil {
+			log.Printf("Error re-anchoring comments: %v", err.Error())
+		}
+	}
+}
+
+// GetThreads lists a note's comment threads, oldest first. ?resolved=true or
+// false keeps only resolved or open threads.
+func GetThreads() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		resolved := c.Query("resolved")
+		if resolved != "" && resolved != "true" && resolved != "false" {
+			badRequest(c, "resolved must be true or false", nil)
+			return
+		}
+
+		file, _ := findAccessibleFile(c, ctx, claims, models.PermissionView)
+		if file == nil {
+			return
+		}
+
+		threads, err := commentStore.ListThreads(ctx, file.File_id)
+		if err != nil {
+			log.Printf("Error listing threads: %v", err.Error())
+			respondStoreError(c, err)
+			return
+		}
+
+		if resolved != "" {
+			filtered := []models.Thread{}
+			for _, thread := range threads {
+				if thread.Resolved == (resolved == "true") {
+					filtered = append(filtered, thread)
+				}
+			}
+			threads = filtered
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Threads fetched successfully",
+			"threads": threads,
+		})
+	}
+}
+
+// CreateThread opens a comment thread on a range of a note
+func CreateThread() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		var request createThreadRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		comment, problem := newComment(claims.Uid, request.Body)
+		if comment == nil {
+			badRequest(c, problem, nil)
+			return
+		}
+
+		file, _ := findAccessibleFile(c, ctx, claims, models.PermissionComment)
+		if file == nil {
+			return
+		}
+
+		content := []rune(file.File_content)
+		start, end := *request.Start, *request.End
+		if start < 0 || end <= start || end > len(content) {
+			badRequest(c, "start and end must select text in the note", nil)
+			return
+		}
+
+		quote := string(content[start:end])
+		if request.Quote != "" && request.Quote != quote {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  http.StatusConflict,
+				"message": "The note changed since the text was selected. Reload it and try again.",
+			})
+			return
+		}
+
+		revision, err := currentRevision(ctx, claims, file)
+		if err != nil {
+			log.Printf("Error fetching revision: %v", err.Error())
+			respondStoreError(c, err)
+			return
+		}
+		if revision.Content != file.File_content {
+			c.JSON(http.StatusConflict, gin.H{
+				"status":  http.StatusConflict,
+				"message": "The note is being saved. Try again.",
+			})
+			return
+		}
+
+		docId := primitive.NewObjectID()
+		thread := &models.Thread{
+			ID:        docId,
+			Thread_id: docId.Hex(),
+			File_id:   file.File_id,
+			Author_id: claims.Uid,
+			Anchor: models.Anchor{
+				Start:       start,
+				End:         end,
+				Quote:       quote,
+				Revision_id: revision.Revision_id,
+			},
+			Comments:   []models.Comment{*comment},
+			Created_at: comment.Created_at,
+			Updated_at: comment.Created_at,
+		}
+
+		if err := commentStore.CreateThread(ctx, thread); err != nil {
+			log.Printf("Error creating thread: %v", err.Error())
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "Thread created successfully",
+			"thread":  thread,
+		})
+	}
+}
+
+// ReplyToThread adds a comment to a thread
+func ReplyToThread() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		var request commentRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		comment, problem := newComment(claims.Uid, request.Body)
+		if comment == nil {
+			badRequest(c, problem, nil)
+			return
+		}
+
+		file, _ := findAccessibleFile(c, ctx, claims, models.PermissionComment)
+		if file == nil {
+			return
+		}
+
+		thread, err := commentStore.AddComment(ctx, file.File_id, c.Param("thread_id"), comment)
+		if err != nil {
+			respondThreadError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "Comment added successfully",
+			"comment": comment,
+			"thread":  thread,
+		})
+	}
+}
+
+// setThreadResolved returns a handler that resolves or reopens a thread
+func setThreadResolved(resolved bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		file, _ := findAccessibleFile(c, ctx, claims, models.PermissionComment)
+		if file == nil {
+			return
+		}
+
+		resolvedBy := ""
+		message := "Thread reopened successfully"
+		if resolved {
+			resolvedBy = claims.Uid
+			message = "Thread resolved successfully"
+		}
+
+		thread, err := commentStore.ResolveThread(ctx, file.File_id, c.Param("thread_id"), resolvedBy)
+		if err != nil {
+			respondThreadError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": message,
+			"thread":  thread,
+		})
+	}
+}
+
+// ResolveThread marks a thread as resolved
+func ResolveThread() gin.HandlerFunc {
+	return setThreadResolved(true)
+}
+
+// ReopenThread marks a resolved thread as open again
+func ReopenThread() gin.HandlerFunc {
+	return setThreadResolved(false)
+}
+
+// DeleteThread deletes a thread and its replies. Only the user who opened it
+// or someone who can edit the note may delete it.
+func DeleteThread() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		file, permission := findAccessibleFile(c, ctx, claims, models.PermissionComment)
+		if file == nil {
+			return
+		}
+
+		thread := findThread(c, ctx, file.File_id)
+		if thread == nil {
+			return
+		}
+
+		if thread.Author_id != claims.Uid && permission != ownerPermission && !models.PermissionAllows(permission, models.PermissionEdit) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  http.StatusForbidden,
+				"message": "Only the author or an editor of the note can delete this thread",
+			})
+			return
+		}
+
+		if err := commentStore.DeleteThread(ctx, file.File_id, thread.Thread_id); err != nil {
+			respondThreadError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Thread deleted successfully",
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-markdown-parser/export"
+	"go-markdown-parser/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportRequest is what an export's query parameters ask for
+type exportRequest struct {
+	export.Options
+	// Annotations asks for the misspelled words to be marked, which the
+	// note has to be spell checked for
+	Annotations bool
+}
+
+// exportOptions reads an export's format, toc, page_size and annotations
+// query parameters. On failure it writes the error response and returns
+// false.
+func exportOptions(c *gin.Context) (exportRequest, bool) {
+	var request exportRequest
+
+	request.Format = strings.ToLower(c.DefaultQuery("format", export.FormatHTML))
+	if !slices.Contains(export.Formats(), request.Format) {
+		badRequest(c, "format must be one of "+strings.Join(export.Formats(), ", "), nil)
+		return request, false
+	}
+
+	pageSize, err := export.ParsePageSize(c.Query("page_size"))
+	if err != nil {
+		badRequest(c, "page_size must be A4, A5, Letter or Legal", err)
+		return request, false
+	}
+	request.Page_size = pageSize
+
+	if value := c.Query("toc"); value != "" {
+		if request.Toc, err = strconv.ParseBool(value); err != nil {
+			badRequest(c, "toc must be true or false", err)
+			return request, false
+		}
+	}
+
+	if value := c.Query("annotations"); value != "" {
+		if request.Annotations, err = strconv.ParseBool(value); err != nil {
+			badRequest(c, "annotations must be true or false", err)
+			return request, false
+		}
+	}
+
+	return request, true
+}
+
+// ExportNote downloads a note as standalone HTML, PDF, DOCX or EPUB,
+// rendered with the user's options, optionally with a table of contents and
+// its misspelled words marked
+func ExportNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		request, ok := exportOptions(c)
+		if !ok {
+			return
+		}
+		options := request.Options
+
+		// Notes shared with the user can be exported too
+		file, _ := findAccessibleFile(c, ctx, claims, models.PermissionView)
+		if file == nil {
+			return
+		}
+
+		if options.Render, ok = renderOptions(c, ctx, claims.Uid); !ok {
+			return
+		}
+
+		contents := []byte(file.File_content)
+		if request.Annotations {
+			result, err := checkSpelling(ctx, claims, contents)
+			if err != nil {
+				log.Printf("Spell check failed: %v", err.Error())
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"status":  http.StatusInternalServerError,
+					"message": "Spell check failed: " + err.Error(),
+				})
+				return
+			}
+			options.Misspelled = result.Misspelled
+		}
+
+		name := strings.TrimSuffix(file.File_name, path.Ext(file.File_name))
+		options.Id = file.File_id
+		options.Title = name
+		options.Updated_at = file.Updated_at
+		options.Policy = sanitizePolicy(ctx, claims, file)
+
+		output, err := export.Export(contents, options)
+		if err != nil {
+			log.Printf("Export failed: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Export failed: " + err.Error(),
+			})
+			return
+		}
+
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + output.Extension}))
+		c.Data(http.StatusOK, output.Content_type, output.Content)
+	}
+}
@@ -0,0 +1,601 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// folderNode is one folder in the tree returned by GetAllFiles
+type folderNode struct {
+	Name    string        `json:"name"`
+	Path    string        `json:"path"`
+	Folders []*folderNode `json:"folders"`
+	Files   []treeFile    `json:"files"`
+}
+
+// treeFile is a note listed in the folder tree
+type treeFile struct {
+	File_id    string    `json:"file_id"`
+	File_name  string    `json:"file_name"`
+	Updated_at time.Time `json:"updated_at"`
+}
+
+// moveNoteRequest is the body of POST /api/v1/markdown/files/:file_id/move.
+// Fields left out keep their current value.
+type moveNoteRequest struct {
+	File_name *string `json:"file_name"`
+	Folder    *string `json:"folder"`
+}
+
+// renameFolderRequest is the body of PATCH /api/v1/markdown/folders
+type renameFolderRequest struct {
+	Path     string `json:"path" binding:"required"`
+	New_path string `json:"new_path"`
+}
+
+// buildFolderTree arranges live files into nested folders, sorted by name
+func buildFolderTree(files []models.File) *folderNode {
+	root := &folderNode{Folders: []*folderNode{}, Files: []treeFile{}}
+	folders := map[string]*folderNode{"": root}
+
+	var folderFor func(path string) *folderNode
+	folderFor = func(path string) *folderNode {
+		if node, ok := folders[path]; ok {
+			return node
+		}
+
+		parentPath, name := "", path
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			parentPath, name = path[:i], path[i+1:]
+		}
+
+		node := &folderNode{Name: name, Path: path, Folders: []*folderNode{}, Files: []treeFile{}}
+		parent := folderFor(parentPath)
+		parent.Folders = append(parent.Folders, node)
+		folders[path] = node
+		return node
+	}
+
+	for _, file := range files {
+		if file.Trashed() {
+			continue
+		}
+		node := folderFor(file.Folder)
+		node.Files = append(node.Files, treeFile{
+			File_id:    file.File_id,
+			File_name:  file.File_name,
+			Updated_at: file.Updated_at,
+		})
+	}
+
+	for _, node := range folders {
+		sort.Slice(node.Folders, func(i, j int) bool { return node.Folders[i].Name < node.Folders[j].Name })
+		sort.Slice(node.Files, func(i, j int) bool { return node.Files[i].File_name < node.Files[j].File_name })
+	}
+
+	return root
+}
+
+// listFiles loads all of the user's files. On failure it writes the error
+// response and returns nil.
+func listFiles(c *gin.Context, ctx context.Context, userId string) []models.File {
+	files, err := fileStore.ListFiles(ctx, userId)
+
+	if err != nil {
+		log.Printf("Error fetching files: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Internal server error",
+		})
+		return nil
+	}
+
+	return files
+}
+
+// badRequest writes a 400 response
+func badRequest(c *gin.Context, message string, err error) {
+	response := gin.H{
+		"status":  http.StatusBadRequest,
+		"message": message,
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	c.JSON(http.StatusBadRequest, response)
+}
+
+// MoveNote renames a note and/or moves it to another folder
+func MoveNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		var request moveNoteRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		file := findOwnedFile(c, ctx, claims.Owner)
+		if file == nil {
+			return
+		}
+
+		// Without If-Match the move applies to whatever version is current
+		version, conditional, err := expectedVersion(c, nil)
+		if err != nil {
+			badRequest(c, err.Error(), nil)
+			return
+		}
+		if !conditional {
+			version = file.Version
+		}
+
+		if request.File_name != nil {
+			name, err := store.CleanFileName(*request.File_name)
+			if err != nil {
+				badRequest(c, "Invalid file name", err)
+				return
+			}
+			file.File_name = name
+		}
+
+		if request.Folder != nil {
+			folder, err := store.CleanFolder(*request.Folder)
+			if err != nil {
+				badRequest(c, "Invalid folder", err)
+				return
+			}
+			file.Folder = folder
+		}
+
+		updated, err := fileStore.UpdateFile(ctx, file, version)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		setETag(c, updated)
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "File moved successfully",
+			"file":    updated,
+		})
+	}
+}
+
+// GetTrash lists the user's trashed notes, most recently deleted first
+func GetTrash() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		files := listFiles(c, ctx, claims.Owner)
+		if files == nil {
+			return
+		}
+
+		trashed := []models.File{}
+		for _, file := range files {
+			if file.Trashed() {
+				trashed = append(trashed, file)
+			}
+		}
+		sort.Slice(trashed, func(i, j int) bool {
+			return trashed[i].Deleted_at.After(*trashed[j].Deleted_at)
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Trash fetched successfully",
+			"files":   trashed,
+		})
+	}
+}
+
+// RestoreNote moves a note out of the trash, back to its original folder
+func RestoreNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		file := findOwnedFile(c, ctx, claims.Owner)
+		if file == nil {
+			return
+		}
+
+		if !file.Trashed() {
+			badRequest(c, "File is not in the trash", nil)
+			return
+		}
+
+		file.Deleted_at = nil
+		updated, err := fileStore.UpdateFile(ctx, file, file.Version)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		setETag(c, updated)
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "File restored successfully",
+			"file":    updated,
+		})
+	}
+}
+
+// PurgeNote permanently deletes a note that is in the trash, along with its
+// revisions, comment threads, shares and public links
+func PurgeNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		file := findOwnedFile(c, ctx, claims.Owner)
+		if file == nil {
+			return
+		}
+
+		if !file.Trashed() {
+			badRequest(c, "File is not in the trash", nil)
+			return
+		}
+
+		if err := stores.PurgeFile(ctx, claims.Owner, file.File_id); err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "File deleted successfully",
+		})
+	}
+}
+
+// EmptyTrash permanently deletes every trashed note, as PurgeNote does
+func EmptyTrash() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		files := listFiles(c, ctx, claims.Owner)
+		if files == nil {
+			return
+		}
+
+		deleted := 0
+		for _, file := range files {
+			if !file.Trashed() {
+				continue
+			}
+			if err := stores.PurgeFile(ctx, claims.Owner, file.File_id); err != nil {
+				respondStoreError(c, err)
+				return
+			}
+			deleted++
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Trash emptied successfully",
+			"deleted": deleted,
+		})
+	}
+}
+
+// folderChange is a folder operation: the notes it changes and the folder
+// shares it moves, as they were and as they become. A share whose new
+// folder is the root is revoked, since folder shares never cover the root.
+type folderChange struct {
+	originals []models.File
+	changed   []models.File
+	shares    []models.Share
+	moved     []models.Share
+}
+
+// folderShares returns the owner's shares of the folder and its subfolders,
+// along with each one's folder under to. An empty to revokes them.
+func folderShares(ctx context.Context, ownerId string, from string, to string) ([]models.Share, []models.Share, error) {
+	shares, err := shareStore.ListShares(ctx, ownerId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var originals, moved []models.Share
+	for _, share := range shares {
+		if share.File_id != "" || share.Folder == "" || !store.InFolder(share.Folder, from) {
+			continue
+		}
+
+		originals = append(originals, share)
+		if to != "" {
+			share.Folder = strings.TrimPrefix(to+strings.TrimPrefix(share.Folder, from), "/")
+		} else {
+			share.Folder = ""
+		}
+		moved = append(moved, share)
+	}
+
+	return originals, moved, nil
+}
+
+// updateFolder writes every changed note of a folder operation, then moves
+// or revokes its shares. If one fails, the notes and shares already written
+// are put back as they were and the error is returned with the ids of the
+// notes that couldn't be.
+func updateFolder(ctx context.Context, change *folderChange) ([]string, error) {
+	for i := range change.changed {
+		updated, err := fileStore.UpdateFile(ctx, &change.changed[i], change.changed[i].Version)
+		if err != nil {
+			return undoFolderNotes(change.originals, change.changed[:i]), err
+		}
+		change.changed[i] = *updated
+	}
+
+	for i := range change.shares {
+		err := shareStore.DeleteShare(ctx, change.shares[i].Owner_id, change.shares[i].Share_id)
+		if err == nil && change.moved[i].Folder != "" {
+			_, err = shareStore.SaveShare(ctx, &change.moved[i])
+		}
+		if err != nil {
+			undoFolderShares(change.shares[:i+1], change.moved[:i+1])
+			return undoFolderNotes(change.originals, change.changed), err
+		}
+	}
+
+	return nil, nil
+}
+
+// undoFolderNotes puts the notes already changed back in their original
+// folder and out of the trash, returning the ids of those that couldn't be.
+func undoFolderNotes(originals []models.File, changed []models.File) []string {
+	// The request's context may be what failed, so undo with a fresh one
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var stuck []string
+	for i := range changed {
+		restore := changed[i]
+		restore.Folder = originals[i].Folder
+		restore.Deleted_at = originals[i].Deleted_at
+		if _, err := fileStore.UpdateFile(ctx, &restore, restore.Version); err != nil {
+			log.Printf("Error undoing folder change of %s: %v", restore.File_id, err.Error())
+			stuck = append(stuck, restore.File_id)
+		}
+	}
+
+	return stuck
+}
+
+// undoFolderShares puts back the shares of a folder operation that may have
+// been moved or revoked.
+func undoFolderShares(originals []models.Share, moved []models.Share) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for i := range originals {
+		if moved[i].Folder != "" {
+			err := shareStore.DeleteShare(ctx, moved[i].Owner_id, moved[i].Share_id)
+			if err != nil && err != store.ErrNotFound {
+				log.Printf("Error undoing folder change of share %s: %v", moved[i].Share_id, err.Error())
+				continue
+			}
+		}
+		if _, err := shareStore.SaveShare(ctx, &originals[i]); err != nil {
+			log.Printf("Error undoing folder change of share %s: %v", originals[i].Share_id, err.Error())
+		}
+	}
+}
+
+// respondFolderError responds to a folder operation that failed. stuck lists
+// the notes left changed when it couldn't be undone.
+func respondFolderError(c *gin.Context, err error, stuck []string) {
+	if len(stuck) == 0 {
+		respondStoreError(c, err)
+		return
+	}
+
+	log.Printf("Folder change left %d notes changed: %v", len(stuck), err.Error())
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"status":   http.StatusInternalServerError,
+		"message":  "The folder was only partly changed",
+		"error":    err.Error(),
+		"file_ids": stuck,
+	})
+}
+
+// RenameFolder renames or moves a folder, carrying along every note in it
+// and its subfolders and the shares of them. Nothing is changed if any note would collide with an
+// existing one at its new path, and notes already moved are moved back if
+// another fails to move.
+func RenameFolder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		var request renameFolderRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		from, err := store.CleanFolder(request.Path)
+		if err != nil || from == "" {
+			badRequest(c, "Invalid folder path", err)
+			return
+		}
+
+		to, err := store.CleanFolder(request.New_path)
+		if err != nil {
+			badRequest(c, "Invalid new folder path", err)
+			return
+		}
+
+		if store.InFolder(to, from) {
+			badRequest(c, "A folder can't be moved into itself", nil)
+			return
+		}
+
+		files := listFiles(c, ctx, claims.Owner)
+		if files == nil {
+			return
+		}
+
+		// Work out every note's new path first and check none collide
+		taken := make(map[string]bool)
+		var originals, moving []models.File
+		for _, file := range files {
+			if file.Trashed() {
+				continue
+			}
+			if store.InFolder(file.Folder, from) {
+				originals = append(originals, file)
+				file.Folder = to + strings.TrimPrefix(file.Folder, from)
+				file.Folder = strings.TrimPrefix(file.Folder, "/")
+				moving = append(moving, file)
+			} else {
+				taken[file.Path()] = true
+			}
+		}
+
+		if len(moving) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Folder not found",
+			})
+			return
+		}
+
+		for _, file := range moving {
+			if taken[file.Path()] {
+				respondStoreError(c, store.ErrFileExists)
+				return
+			}
+		}
+
+		shares, moved, err := folderShares(ctx, claims.Owner, from, to)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		change := &folderChange{originals: originals, changed: moving, shares: shares, moved: moved}
+		if stuck, err := updateFolder(ctx, change); err != nil {
+			respondFolderError(c, err, stuck)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Folder renamed successfully",
+			"moved":   len(moving),
+		})
+	}
+}
+
+// DeleteFolder moves every note in a folder and its subfolders to the trash
+// and revokes the shares of them. If one can't be trashed, those already
+// trashed are restored.
+func DeleteFolder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		folder, err := store.CleanFolder(c.Query("path"))
+		if err != nil || folder == "" {
+			badRequest(c, "Invalid folder path", err)
+			return
+		}
+
+		files := listFiles(c, ctx, claims.Owner)
+		if files == nil {
+			return
+		}
+
+		now := time.Now()
+		var originals, trashing []models.File
+		for _, file := range files {
+			if file.Trashed() || !store.InFolder(file.Folder, folder) {
+				continue
+			}
+
+			originals = append(originals, file)
+			file.Deleted_at = &now
+			trashing = append(trashing, file)
+		}
+
+		if len(trashing) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Folder not found",
+			})
+			return
+		}
+
+		shares, revoked, err := folderShares(ctx, claims.Owner, folder, "")
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		change := &folderChange{originals: originals, changed: trashing, shares: shares, moved: revoked}
+		if stuck, err := updateFolder(ctx, change); err != nil {
+			respondFolderError(c, err, stuck)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Folder moved to trash",
+			"trashed": len(trashing),
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"go-markdown-parser/convert"
+	"go-markdown-parser/importer"
+	"go-markdown-parser/jobs"
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// importJobs runs bulk imports in the background, two at a time, and keeps
+// their results for an hour after they finish
+var importJobs = jobs.NewManager(2, time.Hour)
+
+// importResult is the outcome of importing one note. Missing_images are the
+// note's relative image links to files that weren't part of the import.
+type importResult struct {
+	File_id          string   `json:"file_id,omitempty"`
+	Path             string   `json:"path"`
+	Misspelled_count int      `json:"misspelled_count"`
+	Missing_images   []string `json:"missing_images"`
+}
+
+// readImport reads the files of an import request: an archive in the
+// "archive" field, or a directory upload as "files" with their relative
+// paths in matching "paths" fields. On failure it writes the error response
+// and returns nil.
+func readImport(c *gin.Context) []importer.Entry {
+	// Archives compress, so the uncompressed limit also bounds the upload
+	limits := importer.DefaultLimits
+	if c.Request.ContentLength > limits.Max_total_size {
+		respondSpellCheckError(c, utils.ErrRequestTooLarge)
+		return nil
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.Max_total_size)
+
+	reader := importer.NewReader(limits)
+
+	if header, err := c.FormFile("archive"); err == nil {
+		archive, err := header.Open()
+		if err != nil {
+			log.Printf("File open failed: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Could not open archive: " + err.Error(),
+			})
+			return nil
+		}
+		defer archive.Close()
+
+		if err := reader.AddArchive(archive, header.Size); err != nil {
+			badRequest(c, "Invalid archive", err)
+			return nil
+		}
+		return reader.Entries()
+	}
+
+	form, err := c.MultipartForm()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		respondSpellCheckError(c, utils.ErrRequestTooLarge)
+		return nil
+	}
+	if err != nil || len(form.File["files"]) == 0 {
+		badRequest(c, "Upload an archive as archive, or a directory as files and paths", err)
+		return nil
+	}
+
+	paths := form.Value["paths"]
+	for i, header := range form.File["files"] {
+		// Browsers strip folders from file names, so directory uploads send
+		// each file's relative path alongside it
+		name := header.Filename
+		if i < len(paths) && paths[i] != "" {
+			name = paths[i]
+		}
+
+		content, err := header.Open()
+		if err != nil {
+			log.Printf("File open failed: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Could not open file: " + err.Error(),
+			})
+			return nil
+		}
+		err = reader.Add(name, content)
+		content.Close()
+		if err != nil {
+			badRequest(c, "Invalid upload", err)
+			return nil
+		}
+	}
+
+	return reader.Entries()
+}
+
+// importNote converts one imported note to markdown and creates it in the
+// folder it had in the import, under the destination folder. Markdown files
+// are converted from the import's format, if it has one.
+func importNote(claims *session, destination string, from string, entry importer.Entry, files map[string]bool) (*importResult, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result := &importResult{Path: entry.Path, Missing_images: []string{}}
+	if entry.Too_large {
+		return result, jobs.ItemFailed, fmt.Errorf("note is larger than %d bytes", importer.DefaultLimits.Max_note_size)
+	}
+
+	source, encoding, err := utils.DecodeText(entry.Content)
+	if err != nil {
+		return result, jobs.ItemFailed, err
+	}
+
+	format := convert.Detect(entry.Path, "")
+	if format == convert.FormatMarkdown && from != "" {
+		format = from
+	}
+	content, err := convert.Convert(format, source)
+	if err != nil {
+		return result, jobs.ItemFailed, fmt.Errorf("could not convert note: %w", err)
+	}
+	notePath := convert.FileName(entry.Path, format)
+
+	dir, fileName := path.Split(notePath)
+	name, err := store.CleanFileName(fileName)
+	if err != nil {
+		return result, jobs.ItemFailed, err
+	}
+	folder, err := store.CleanFolder(path.Join(destination, dir))
+	if err != nil {
+		return result, jobs.ItemFailed, err
+	}
+	result.Path = path.Join(folder, name)
+	result.Missing_images = importer.MissingImages(notePath, content, files)
+
+	spellcheck, err := checkSpelling(ctx, claims, content)
+	if err != nil {
+		return result, jobs.ItemFailed, fmt.Errorf("spell check failed: %w", err)
+	}
+	result.Misspelled_count = spellcheck.Summary().Misspelled_count
+
+	now := time.Now()
+	docId := primitive.NewObjectID()
+	file := &models.File{
+		ID:                docId,
+		File_id:           docId.Hex(),
+		User_id:           claims.Owner,
+		Workspace_id:      claims.Workspace_id,
+		File_name:         name,
+		Folder:            folder,
+		File_content:      string(content),
+		Original_encoding: encoding,
+		Version:           1,
+		Created_at:        now,
+		Updated_at:        now,
+	}
+
+	// Notes never overwrite existing ones
+	if _, err := saveNote(ctx, file, claims.Uid, spellcheck.Summary(), createFile); errors.Is(err, store.ErrFileExists) {
+		return result, jobs.ItemSkipped, err
+	} else if err != nil {
+		return result, jobs.ItemFailed, err
+	}
+	result.File_id = file.File_id
+
+	return result, jobs.ItemDone, nil
+}
+
+// ImportNotes bulk imports the notes of a zip or tar archive, or of an
+// uploaded directory, into the active space: markdown files, converted from
+// an Obsidian vault or Notion export when from says so, and HTML and
+// reStructuredText files, converted to markdown. Folders are kept, under
+// the optional destination folder, and relative image links are kept as
+// they are. Each note is spell checked and saved in the background; the
+// response is the job to poll for per-file progress and results.
+func ImportNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		destination, err := store.CleanFolder(c.PostForm("folder"))
+		if err != nil {
+			badRequest(c, "Invalid folder", err)
+			return
+		}
+
+		from := strings.ToLower(c.PostForm("from"))
+		if from != "" && from != convert.FormatObsidian && from != convert.FormatNotion {
+			badRequest(c, "from must be obsidian or notion", nil)
+			return
+		}
+
+		entries := readImport(c)
+		if entries == nil {
+			return
+		}
+
+		// Every file of the import counts when checking image links, but
+		// only notes are imported. Links in Notion exports are checked
+		// against the names the files have once their ids are removed.
+		files := make(map[string]bool, len(entries))
+		var notes []importer.Entry
+		var names []string
+		for _, entry := range entries {
+			if from == convert.FormatNotion {
+				files[convert.NotionName(entry.Path)] = true
+			} else {
+				files[entry.Path] = true
+			}
+			if importer.IsNote(entry.Path) {
+				notes = append(notes, entry)
+				names = append(names, entry.Path)
+			}
+		}
+		if len(notes) == 0 {
+			badRequest(c, "The import holds no notes", nil)
+			return
+		}
+
+		job := importJobs.Start("import", claims.Uid, names, func(progress *jobs.Progress) error {
+			for i, entry := range notes {
+				result, status, err := importNote(claims, destination, from, entry, files)
+				progress.Finish(i, status, result, err)
+			}
+			return nil
+		})
+
+		c.Header("Location", "/api/v1/markdown/import/"+job.Job_id)
+		c.JSON(http.StatusAccepted, gin.H{
+			"status":  http.StatusAccepted,
+			"message": "Import started",
+			"job":     job,
+		})
+	}
+}
+
+// GetImportJob returns the progress of an import the user started, with
+// each file's result once it is imported
+func GetImportJob() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		job, ok := importJobs.Get(claims.Uid, c.Param("job_id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Import not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Import " + job.Status,
+			"job":     job,
+		})
+	}
+}
@@ -3,10 +3,11 @@ package controller
 import (
 	"context"
 	"encoding/base64"
-	"go-markdown-parser/database"
+	"errors"
+	"go-markdown-parser/convert"
 	"go-markdown-parser/models"
+	"go-markdown-parser/store"
 	"go-markdown-parser/utils"
-	"io"
 	"log"
 	"net/http"
 	"strings"
@@ -15,12 +16,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sajari/fuzzy"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-var fileCollection *mongo.Collection = database.OpenCollection(database.Client, "file")
-
 // SpellCheckConfig contains configuration parameters for spell checking
 type SpellCheckConfig struct {
 	LevenshteinThreshold int
@@ -59,8 +56,30 @@ func init() {
 
 	// Populate map
 	for _, word := range dictionary {
-		dictionaryMap[strings.ToLower(word)] = true
+		dictionaryMap[utils.DictionaryWord(word)] = true
+	}
+}
+
+// respondSpellCheckError writes a spell check error with its status and
+// code. Other errors are processing errors.
+func respondSpellCheckError(c *gin.Context, err error) {
+	var spellCheckErr *utils.SpellCheckError
+	if !errors.As(err, &spellCheckErr) {
+		spellCheckErr = utils.ErrProcessingFile.Wrap(err)
+	}
+	if spellCheckErr.Status >= http.StatusInternalServerError {
+		log.Printf("Spell check upload failed: %v", err.Error())
+	}
+
+	response := gin.H{
+		"status":  spellCheckErr.Status,
+		"message": spellCheckErr.Message,
+		"code":    spellCheckErr.Code,
+	}
+	if spellCheckErr.Err != nil {
+		response["error"] = spellCheckErr.Err.Error()
 	}
+	c.JSON(spellCheckErr.Status, response)
 }
 
 func SpellCheckMarkdown() gin.HandlerFunc {
@@ -68,25 +87,35 @@ func SpellCheckMarkdown() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
+		// Oversized requests are refused before the body is read, and the
+		// body is cut off at the limit when the declared length is missing
+		limits := utils.DefaultUploadLimits()
+		if c.Request.ContentLength > limits.Max_request_size {
+			respondSpellCheckError(c, utils.ErrRequestTooLarge)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.Max_request_size)
+
 		file, err := c.FormFile("markdownfile")
 		if err != nil {
-			log.Printf("Error getting form file: %v", err.Error())
-			c.JSON(http.StatusBadRequest,
-				gin.H{
-					"message": "Bad Request",
-					"error":   err.Error(),
-				})
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				respondSpellCheckError(c, utils.ErrRequestTooLarge)
+			} else {
+				respondSpellCheckError(c, utils.ErrMissingFile.Wrap(err))
+			}
+			return
+		}
+		if file.Size > limits.Max_file_size {
+			respondSpellCheckError(c, utils.ErrFileTooLarge)
 			return
 		}
 
-		filetype := strings.Split(file.Header.Get("Content-Type"), "/")[1]
-
-		if filetype != "markdown" {
-			log.Printf("Invalid file type: %s", filetype)
-			c.JSON(http.StatusBadRequest,
-				gin.H{
-					"message": "invalid file type. API supports only markdown files `.md`",
-				})
+		// Notes from other tools are converted to markdown. Their format is
+		// detected from the file's name and type unless ?from= names it.
+		format, err := utils.UploadFormat(file.Filename, file.Header.Get("Content-Type"), strings.ToLower(c.Query("from")))
+		if err != nil {
+			respondSpellCheckError(c, err)
 			return
 		}
 
@@ -105,48 +134,67 @@ func SpellCheckMarkdown() gin.HandlerFunc {
 		// Close file after reading
 		defer fileContents.Close()
 
-		// Read file contents
-		contents, err := io.ReadAll(fileContents)
+		// Read file contents as UTF-8 text, whatever their encoding
+		contents, encoding, err := utils.ReadUpload(fileContents, limits)
+		if err != nil {
+			respondSpellCheckError(c, err)
+			return
+		}
 
+		contents, err = convert.Convert(format, contents)
 		if err != nil {
-			log.Printf("File read failed: %v", err.Error())
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"message": "Could not read file: " + err.Error(),
-				})
+			respondSpellCheckError(c, utils.ErrConversion.Wrap(err))
 			return
 		}
-		filename := file.Filename
+		filename := convert.FileName(file.Filename, format)
 
-		//TODO: MOVE ALL THIS TO AFTER ALREADY MAKING THE SPELL CHECK
+		// Uploads with a valid token are saved to the user's active space,
+		// which must allow them to write
+		var claims *session
 		authToken := c.GetHeader("Authorization")
-
-		// If token exist, save the db
-		if authToken != "" {
-			bearerToken := strings.Split(authToken, " ")[1]
-			claims, _ := utils.ValidateToken(bearerToken)
-
-			// If token is valid, save the db
-			if claims != nil {
-				if err := SaveMarkdownFile(ctx, filename, contents, claims.Uid); err != nil {
-					log.Printf("Error saving file: %v", err.Error())
-					c.JSON(http.StatusInternalServerError, gin.H{
-						"message": "Error saving file: " + err.Error(),
-					})
+		if bearerToken, found := strings.CutPrefix(authToken, "Bearer "); found {
+			if tokenClaims, _ := utils.ValidateToken(bearerToken); tokenClaims != nil {
+				if claims = sessionFor(c, ctx, tokenClaims, models.RoleEditor); claims == nil {
 					return
 				}
 			}
 		}
 
+		userId := ""
+		if claims != nil {
+			userId = claims.Uid
+		}
+		options, ok := renderOptions(c, ctx, userId)
+		if !ok {
+			return
+		}
+		theme, ok := documentTheme(c)
+		if !ok {
+			return
+		}
+
+		// Spell check first so the saved revision can record the results
+		result, err := checkSpelling(ctx, claims, contents)
+		if err != nil {
+			respondSpellCheckError(c, utils.ErrProcessingFile.Wrap(err))
+			return
+		}
+
+		// If token is valid, save the db
+		if claims != nil {
+			if _, err := SaveMarkdownFile(ctx, filename, contents, encoding, claims.Uid, claims.Workspace_id, result.Summary()); err != nil {
+				respondSpellCheckError(c, utils.ErrSavingFile.Wrap(err))
+				return
+			}
+		}
+
 		// Process HTML and wrap misspelled words
-		modifiedHTML, err := utils.ProcessMarkdownWithSpellCheck(contents, dictionaryMap, fuzzyModel)
+		modifiedHTML, err := spellCheckedHTML(contents, result, options, utils.DefaultSanitizePolicy())
+		if err == nil {
+			modifiedHTML, err = asDocument(theme, filename, modifiedHTML)
+		}
 		if err != nil {
-			// LOG Error
-			log.Printf("HTML processing failed: %v", err.Error())
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"message": "HTML processing failed: " + err.Error(),
-			})
+			respondSpellCheckError(c, utils.ErrProcessingFile.Wrap(err))
 			return
 		}
 
@@ -156,43 +204,52 @@ func SpellCheckMarkdown() gin.HandlerFunc {
 	}
 }
 
-// GetAllFiles returns all files for a user
+// filesResponse is the body returned by GetAllFiles
+type filesResponse struct {
+	Status      int           `json:"status"`
+	Message     string        `json:"message"`
+	Files       []models.File `json:"files"`
+	Total       int64         `json:"total"`
+	Next_cursor string        `json:"next_cursor,omitempty"`
+	Tree        *folderNode   `json:"tree,omitempty"`
+}
+
+// GetAllFiles returns a user's files outside the trash, both as a flat list
+// and, unless paginated, as a folder tree. Query parameters filter by tag,
+// name prefix, updated date range (from, to) and has_misspellings, set the
+// sort order, paginate with limit and cursor, and drop file contents with
+// content=false.
 // Only authenticated user can see their files
 func GetAllFiles() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		authToken := c.GetHeader("Authorization")
-		// If no token, return unauthorized
-		if authToken == "" {
-			log.Printf("Unauthorized. Please login to continue.")
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
 
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  http.StatusUnauthorized,
-				"message": "Unauthorized. Please login to continue.",
+		query, err := fileQueryFromRequest(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid query parameters",
+				"error":   err.Error(),
 			})
 			return
 		}
 
-		bearerToken := strings.Split(authToken, " ")[1]
-		claims, msg := utils.ValidateToken(bearerToken)
+		page, err := fileStore.FindFiles(ctx, claims.Owner, query)
 
-		if claims == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  http.StatusUnauthorized,
-				"message": "Invalid token. Please login to continue",
-				"error":   msg,
+		if err == store.ErrInvalidCursor {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid query parameters",
+				"error":   err.Error(),
 			})
 			return
 		}
-		userId := claims.Uid
-
-		filter := bson.M{
-			"user_id": userId,
-		}
-
-		cursor, err := fileCollection.Find(ctx, filter)
 
 		if err != nil {
 			log.Printf("Error fetching files: %v", err.Error())
@@ -203,23 +260,20 @@ func GetAllFiles() gin.HandlerFunc {
 			return
 		}
 
-		var files []bson.M
-
-		if err = cursor.All(ctx, &files); err != nil {
-			log.Printf("Error fetching files: %v", err.Error())
+		response := filesResponse{
+			Status:      http.StatusOK,
+			Message:     "Files fetched successfully",
+			Files:       page.Files,
+			Total:       page.Total,
+			Next_cursor: page.Next,
+		}
 
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  http.StatusInternalServerError,
-				"message": "Internal server error",
-			})
-			return
+		// A tree of a single page would be misleading
+		if query.Limit == 0 && query.Cursor == "" {
+			response.Tree = buildFolderTree(page.Files)
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"status":  http.StatusOK,
-			"message": "Files fetched successfully",
-			"files":   files,
-		})
+		c.JSON(http.StatusOK, response)
 	}
 }
 
@@ -228,59 +282,17 @@ func GetFileById() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		authToken := c.GetHeader("Authorization")
-		// If no token, return unauthorized
-		if authToken == "" {
-			log.Printf("Unauthorized. Please login to continue.")
-
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  http.StatusUnauthorized,
-				"message": "Unauthorized. Please login to continue.",
-			})
-			return
-		}
-
-		bearerToken := strings.Split(authToken, " ")[1]
-		claims, msg := utils.ValidateToken(bearerToken)
-
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
 		if claims == nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"status":  http.StatusUnauthorized,
-				"message": "Invalid token. Please login to continue",
-				"error":   msg,
-			})
 			return
 		}
 
-		fileId := c.Param("file_id")
-		userId := claims.Uid
-
-		filter := bson.M{
-			"user_id": userId,
-			"file_id": fileId,
-		}
-
-		var file models.File
-
-		err := fileCollection.FindOne(ctx, filter).Decode(&file)
-
-		if err != nil {
-			log.Printf("Error fetching file: %v", err.Error())
-			if err == mongo.ErrNoDocuments {
-				log.Printf("File not found")
-				c.JSON(http.StatusNotFound, gin.H{
-					"status":  http.StatusNotFound,
-					"message": "File not found",
-				})
-				return
-			}
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"status":  http.StatusInternalServerError,
-				"message": "Internal server error",
-				"error":   err.Error(),
-			})
+		// Notes shared with the user are readable too
+		file, permission := findAccessibleFile(c, ctx, claims, models.PermissionView)
+		if file == nil {
 			return
 		}
+
 		// Initialize the map
 		responseData := make(bson.M)
 
@@ -290,9 +302,33 @@ func GetFileById() gin.HandlerFunc {
 		responseData["user_id"] = file.User_id
 		responseData["created_at"] = file.Created_at
 		responseData["updated_at"] = file.Updated_at
+		responseData["file_id"] = file.File_id
+		responseData["version"] = file.Version
+		responseData["permission"] = permission
+
+		result, err := checkSpelling(ctx, claims, markdownFileContents)
+		if err != nil {
+			log.Printf("Spell check failed: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"message": "Spell check failed: " + err.Error(),
+			})
+			return
+		}
+
+		options, ok := renderOptions(c, ctx, claims.Uid)
+		if !ok {
+			return
+		}
+		theme, ok := documentTheme(c)
+		if !ok {
+			return
+		}
 
 		// Process HTML and wrap misspelled words
-		modifiedHTML, err := utils.ProcessMarkdownWithSpellCheck(markdownFileContents, dictionaryMap, fuzzyModel)
+		modifiedHTML, err := spellCheckedHTML(markdownFileContents, result, options, sanitizePolicy(ctx, claims, file))
+		if err == nil {
+			modifiedHTML, err = asDocument(theme, file.File_name, modifiedHTML)
+		}
 		if err != nil {
 			// LOG Error
 			log.Printf("HTML processing failed: %v", err.Error())
@@ -306,6 +342,7 @@ func GetFileById() gin.HandlerFunc {
 		htmlBase64 := base64.StdEncoding.EncodeToString([]byte(modifiedHTML))
 		responseData["html_content"] = htmlBase64
 
+		setETag(c, file)
 		c.JSON(http.StatusOK, gin.H{
 			"status":  http.StatusOK,
 			"message": "File fetched successfully",
@@ -314,53 +351,31 @@ func GetFileById() gin.HandlerFunc {
 	}
 }
 
-// SaveMarkdownFile saves or updates a markdown file in the database
-func SaveMarkdownFile(ctx context.Context, filename string, contents []byte, userId string) error {
-	fileFilter := bson.M{
-		"file_name": filename,
-		"user_id":   userId,
+// SaveMarkdownFile saves or updates a markdown file in the configured file store
+// and records the new content as an immutable revision by userId. The file
+// belongs to the workspace when workspaceId is set, otherwise to the user.
+func SaveMarkdownFile(ctx context.Context, filename string, contents []byte, encoding string, userId string, workspaceId string, summary models.SpellcheckSummary) (*models.File, error) {
+	ownerId := userId
+	if workspaceId != "" {
+		ownerId = workspaceId
 	}
 
-	// Prepare the file document
-	now := time.Now()
-	fileDoc := bson.M{
-		"file_name":    filename,
-		"user_id":      userId,
-		"file_content": string(contents),
-		"updated_at":   now,
+	update := &models.File{
+		User_id:           ownerId,
+		Workspace_id:      workspaceId,
+		File_name:         filename,
+		File_content:      string(contents),
+		Original_encoding: encoding,
 	}
 
-	// Update the file
-	result, err := fileCollection.UpdateOne(
-		ctx,
-		fileFilter,
-		bson.M{"$set": fileDoc},
-	)
-
+	file, err := saveNote(ctx, update, userId, summary, fileStore.SaveFile)
 	if err != nil {
-		log.Printf("Error occurred while updating file: %v", err.Error())
-		return err
-	}
-
-	// If no document was updated, create new one
-	if result.MatchedCount == 0 {
-		docId := primitive.NewObjectID()
-		fileDoc["_id"] = docId
-		fileDoc["file_id"] = docId.Hex()
-		fileDoc["created_at"] = now
-
-		_, err := fileCollection.InsertOne(ctx, fileDoc)
-		// If error, return error
-		if err != nil {
-			log.Printf("Failed to create new file: %v", err.Error())
-			return err
-		}
-		log.Printf("New file created successfully")
-	} else {
-		log.Printf("File updated successfully")
+		log.Printf("Error occurred while saving file: %v", err.Error())
+		return nil, err
 	}
 
-	return nil
+	log.Printf("File %s saved successfully", file.File_id)
+	return file, nil
 }
 
 func Ping() gin.HandlerFunc {
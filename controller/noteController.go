@@ -0,0 +1,446 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// createNoteRequest is the body of POST /api/v1/markdown/files
+type createNoteRequest struct {
+	File_name string   `json:"file_name" binding:"required"`
+	Folder    string   `json:"folder"`
+	Content   string   `json:"content"`
+	Tags      []string `json:"tags"`
+}
+
+// replaceNoteRequest is the body of PUT /api/v1/markdown/files/:file_id.
+// Content is required, though it may be empty; File_name is optional and
+// renames the note when set.
+type replaceNoteRequest struct {
+	File_name string  `json:"file_name"`
+	Content   *string `json:"content" binding:"required"`
+	Version   *int64  `json:"version"`
+}
+
+// patchNoteRequest is the body of PATCH /api/v1/markdown/files/:file_id
+type patchNoteRequest struct {
+	Edits   []utils.TextEdit `json:"edits" binding:"required"`
+	Version *int64           `json:"version"`
+}
+
+// setETag exposes the file's version as its ETag
+func setETag(c *gin.Context, file *models.File) {
+	c.Header("ETag", strconv.Quote(strconv.FormatInt(file.Version, 10)))
+}
+
+// expectedVersion reads the version the client last saw, from the If-Match
+// header or the body's version field. ok is false if neither was sent.
+func expectedVersion(c *gin.Context, bodyVersion *int64) (version int64, ok bool, err error) {
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		tag := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+		version, err = strconv.ParseInt(tag, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid If-Match header %q", ifMatch)
+		}
+		return version, true, nil
+	}
+
+	if bodyVersion != nil {
+		return *bodyVersion, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// respondStoreError maps store errors to HTTP responses
+func respondStoreError(c *gin.Context, err error) {
+	switch err {
+	case store.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  http.StatusNotFound,
+			"message": "File not found",
+		})
+	case store.ErrFileExists, store.ErrSlugTaken:
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  http.StatusConflict,
+			"message": err.Error(),
+		})
+	case store.ErrVersionConflict:
+		c.JSON(http.StatusPreconditionFailed, gin.H{
+			"status":  http.StatusPreconditionFailed,
+			"message": "File was modified since it was read. Fetch the latest version and retry.",
+		})
+	default:
+		log.Printf("Storage error: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Internal server error",
+			"error":   err.Error(),
+		})
+	}
+}
+
+// requireVersion returns the expected version for a write. If the client sent
+// none, or an invalid one, it writes the error response and returns false.
+func requireVersion(c *gin.Context, bodyVersion *int64) (int64, bool) {
+	version, ok, err := expectedVersion(c, bodyVersion)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status":  http.StatusBadRequest,
+			"message": err.Error(),
+		})
+		return 0, false
+	}
+
+	if !ok {
+		c.JSON(http.StatusPreconditionRequired, gin.H{
+			"status":  http.StatusPreconditionRequired,
+			"message": "Send the version you are editing in an If-Match header or the `version` field",
+		})
+		return 0, false
+	}
+
+	return version, true
+}
+
+// spellCheckContent spell checks new note content for its revision summary,
+// with the session's workspace dictionary. On failure it writes the error
+// response and returns nil.
+func spellCheckContent(c *gin.Context, ctx context.Context, claims *session, content string) *utils.SpellCheckResult {
+	result, err := checkSpelling(ctx, claims, []byte(content))
+
+	if err != nil {
+		log.Printf("Spell check failed: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Spell check failed: " + err.Error(),
+		})
+		return nil
+	}
+
+	return result
+}
+
+// saveNote sets a note's spellcheck metadata from summary, stores it with
+// write and records the stored content as a revision by authorId. Uploads,
+// imports, edits and live editing sessions all save notes through it.
+// Notes and revisions may live in different backends, so they can't be
+// written together: once the note is stored, a failure to record its
+// revision is logged rather than failing a save that already happened.
+func saveNote(ctx context.Context, file *models.File, authorId string, summary models.SpellcheckSummary, write func(ctx context.Context, file *models.File) (*models.File, error)) (*models.File, error) {
+	saved, _, err := saveRestoredNote(ctx, file, authorId, summary, "", write)
+	return saved, err
+}
+
+// saveRestoredNote is saveNote for content restored from the revision
+// restoredFrom, when set. It also returns the new revision, or nil if it
+// couldn't be recorded.
+func saveRestoredNote(ctx context.Context, file *models.File, authorId string, summary models.SpellcheckSummary, restoredFrom string, write func(ctx context.Context, file *models.File) (*models.File, error)) (*models.File, *models.Revision, error) {
+	applyContentMetadata(file, summary)
+
+	saved, err := write(ctx, file)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	revision, err := recordRevision(ctx, saved, authorId, summary, restoredFrom)
+	if err != nil {
+		log.Printf("Error saving revision of %s, the note is saved without it: %v", saved.File_id, err.Error())
+	}
+
+	return saved, revision, nil
+}
+
+// createFile stores a new note with CreateFile, for saveNote
+func createFile(ctx context.Context, file *models.File) (*models.File, error) {
+	if err := fileStore.CreateFile(ctx, file); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// updateNote writes the changed file and records a revision, then responds
+// with the updated file. The session's user is recorded as the author.
+func updateNote(c *gin.Context, ctx context.Context, claims *session, file *models.File, version int64) {
+	result := spellCheckContent(c, ctx, claims, file.File_content)
+	if result == nil {
+		return
+	}
+
+	updated, err := saveNote(ctx, file, claims.Uid, result.Summary(), func(ctx context.Context, file *models.File) (*models.File, error) {
+		return fileStore.UpdateFile(ctx, file, version)
+	})
+	if err != nil {
+		respondStoreError(c, err)
+		return
+	}
+
+	setETag(c, updated)
+	c.JSON(http.StatusOK, gin.H{
+		"status":     http.StatusOK,
+		"message":    "File updated successfully",
+		"file":       updated,
+		"spellcheck": result.Summary(),
+	})
+}
+
+// CreateNote creates a note from raw markdown text sent as JSON
+func CreateNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		var request createNoteRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		name, err := store.CleanFileName(request.File_name)
+		if err != nil {
+			badRequest(c, "Invalid file name", err)
+			return
+		}
+
+		folder, err := store.CleanFolder(request.Folder)
+		if err != nil {
+			badRequest(c, "Invalid folder", err)
+			return
+		}
+
+		result := spellCheckContent(c, ctx, claims, request.Content)
+		if result == nil {
+			return
+		}
+
+		now := time.Now()
+		docId := primitive.NewObjectID()
+		file := &models.File{
+			ID:           docId,
+			File_id:      docId.Hex(),
+			User_id:      claims.Owner,
+			Workspace_id: claims.Workspace_id,
+			File_name:    name,
+			Folder:       folder,
+			File_content: request.Content,
+			Tags:         utils.NormalizeTags(request.Tags),
+			Version:      1,
+			Created_at:   now,
+			Updated_at:   now,
+		}
+
+		if _, err := saveNote(ctx, file, claims.Uid, result.Summary(), createFile); err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		setETag(c, file)
+		c.Header("Location", "/api/v1/markdown/files/"+file.File_id)
+		c.JSON(http.StatusCreated, gin.H{
+			"status":     http.StatusCreated,
+			"message":    "File created successfully",
+			"file":       file,
+			"spellcheck": result.Summary(),
+		})
+	}
+}
+
+// findEditableFile loads the note named by the file_id path parameter for
+// editing, see findAccessibleFile. Trashed notes have to be restored first.
+// On failure it writes the error response and returns nil.
+func findEditableFile(c *gin.Context, ctx context.Context, claims *session) *models.File {
+	file, _ := findAccessibleFile(c, ctx, claims, models.PermissionEdit)
+	if file == nil {
+		return nil
+	}
+
+	if file.Trashed() {
+		c.JSON(http.StatusConflict, gin.H{
+			"status":  http.StatusConflict,
+			"message": "File is in the trash, restore it to edit it",
+		})
+		return nil
+	}
+
+	return file
+}
+
+// ReplaceNote replaces a note's content, and optionally its name
+func ReplaceNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		var request replaceNoteRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		version, ok := requireVersion(c, request.Version)
+		if !ok {
+			return
+		}
+
+		file := findEditableFile(c, ctx, claims)
+		if file == nil {
+			return
+		}
+
+		file.File_content = *request.Content
+		if request.File_name != "" {
+			name, err := store.CleanFileName(request.File_name)
+			if err != nil {
+				badRequest(c, "Invalid file name", err)
+				return
+			}
+			file.File_name = name
+		}
+
+		updateNote(c, ctx, claims, file, version)
+	}
+}
+
+// PatchNote applies text range edits to a note's content
+func PatchNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		var request patchNoteRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Invalid request body",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		version, ok := requireVersion(c, request.Version)
+		if !ok {
+			return
+		}
+
+		file := findEditableFile(c, ctx, claims)
+		if file == nil {
+			return
+		}
+
+		// Offsets refer to the version the client edited
+		if file.Version != version {
+			respondStoreError(c, store.ErrVersionConflict)
+			return
+		}
+
+		content, err := utils.ApplyTextEdits(file.File_content, request.Edits)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"status":  http.StatusUnprocessableEntity,
+				"message": "Invalid edit",
+				"error":   err.Error(),
+			})
+			return
+		}
+		file.File_content = content
+
+		updateNote(c, ctx, claims, file, version)
+	}
+}
+
+// DeleteNote moves a note to the trash, or deletes it permanently with
+// ?permanent=true. An If-Match header makes the delete conditional.
+func DeleteNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		version, conditional, err := expectedVersion(c, nil)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": err.Error(),
+			})
+			return
+		}
+
+		file := findOwnedFile(c, ctx, claims.Owner)
+		if file == nil {
+			return
+		}
+
+		if conditional && file.Version != version {
+			respondStoreError(c, store.ErrVersionConflict)
+			return
+		}
+
+		// Trashed notes, and ?permanent=true, skip the trash and delete for good
+		if file.Trashed() || c.Query("permanent") == "true" {
+			if err := stores.PurgeFile(ctx, claims.Owner, file.File_id); err != nil {
+				respondStoreError(c, err)
+				return
+			}
+
+			c.JSON(http.StatusOK, gin.H{
+				"status":  http.StatusOK,
+				"message": "File deleted successfully",
+			})
+			return
+		}
+
+		now := time.Now()
+		file.Deleted_at = &now
+		updated, err := fileStore.UpdateFile(ctx, file, file.Version)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "File moved to trash",
+			"file":    updated,
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// renderOptions resolves how to render notes for a request: the server
+// default, replaced by the user's preferences if they set any, then by the
+// extensions, theme, highlight (inline or classes) and hard_wraps query
+// parameters if present. userId may be empty for anonymous requests. On failure it writes
+// the error response and returns false.
+func renderOptions(c *gin.Context, ctx context.Context, userId string) (models.RenderOptions, bool) {
+	options := utils.DefaultRenderOptions()
+
+	if userId != "" {
+		user, err := userStore.GetUserById(ctx, userId)
+		if err != nil && err != store.ErrNotFound {
+			respondUserError(c, err)
+			return options, false
+		}
+		if user != nil && user.Render_options != nil {
+			options = *user.Render_options
+		}
+	}
+
+	if list, ok := c.GetQuery("extensions"); ok {
+		requested, err := utils.ParseRenderExtensions(list)
+		if err != nil {
+			badRequest(c, "Invalid extensions", err)
+			return options, false
+		}
+		requested.Highlight_theme = options.Highlight_theme
+		requested.Highlight_classes = options.Highlight_classes
+		requested.Hard_wraps = options.Hard_wraps
+		options = requested
+	}
+
+	if theme, ok := c.GetQuery("theme"); ok {
+		if !utils.ValidHighlightTheme(theme) {
+			badRequest(c, "Unknown highlight theme "+theme, nil)
+			return options, false
+		}
+		options.Highlight_theme = theme
+	}
+
+	switch c.Query("highlight") {
+	case "":
+	case "inline":
+		options.Highlight_classes = false
+	case "classes":
+		options.Highlight_classes = true
+	default:
+		badRequest(c, "highlight must be inline or classes", nil)
+		return options, false
+	}
+
+	switch c.Query("hard_wraps") {
+	case "":
+	case "true":
+		options.Hard_wraps = true
+	case "false":
+		options.Hard_wraps = false
+	default:
+		badRequest(c, "hard_wraps must be true or false", nil)
+		return options, false
+	}
+
+	return options, true
+}
+
+// spellCheckedHTML renders checked markdown with the given options and
+// sanitize policy and marks its misspelled words. Spell checks render with
+// the server defaults, so other options or policies render the markdown
+// again.
+func spellCheckedHTML(contents []byte, result *utils.SpellCheckResult, options models.RenderOptions, policy *utils.SanitizePolicy) (string, error) {
+	rendered := *result
+
+	if options != utils.DefaultRenderOptions() || policy != utils.DefaultSanitizePolicy() {
+		html, err := utils.RenderMarkdown(contents, options, policy)
+		if err != nil {
+			return "", err
+		}
+		rendered.HTML = html
+	} else {
+		// The checked HTML leaves out the stylesheet, whose words aren't
+		// the note's
+		stylesheet, err := utils.HighlightStylesheet(options)
+		if err != nil {
+			return "", err
+		}
+		rendered.HTML = stylesheet + result.HTML
+	}
+
+	return utils.ProcessSpellCheckResult(&rendered)
+}
+
+// documentTheme resolves how spell-checked HTML is returned: "" for a bare
+// annotated fragment, the default, or the document theme to render a full
+// page with when output=document, named by document_theme. On failure it
+// writes the error response and returns false.
+func documentTheme(c *gin.Context) (string, bool) {
+	switch c.Query("output") {
+	case "", "fragment":
+		return "", true
+	case "document":
+	default:
+		badRequest(c, "output must be fragment or document", nil)
+		return "", false
+	}
+
+	theme := c.DefaultQuery("document_theme", utils.DefaultDocumentTheme)
+	if !utils.ValidDocumentTheme(theme) {
+		badRequest(c, "Unknown document theme "+theme, nil)
+		return "", false
+	}
+
+	return theme, true
+}
+
+// asDocument renders annotated HTML as a page with the theme resolved by
+// documentTheme, or leaves it a fragment when the theme is ""
+func asDocument(theme string, title string, fragment string) (string, error) {
+	if theme == "" {
+		return fragment, nil
+	}
+
+	return utils.RenderDocument(theme, title, fragment)
+}
+
+// sanitizePolicy returns the policy for showing a note to the session: the
+// default for the user's own writing, and the strict one for notes shared
+// from others and workspace notes others have written. A workspace note
+// belongs to the workspace, not to whoever views it, so it only gets the
+// default policy when every revision of it is the viewer's.
+func sanitizePolicy(ctx context.Context, claims *session, file *models.File) *utils.SanitizePolicy {
+	if file.User_id != claims.Owner {
+		return utils.StrictSanitizePolicy()
+	}
+	if file.Workspace_id == "" {
+		return utils.DefaultSanitizePolicy()
+	}
+
+	revisions, err := revisionStore.ListRevisions(ctx, file.File_id)
+	if err != nil {
+		log.Printf("Error listing revisions: %v", err.Error())
+		return utils.StrictSanitizePolicy()
+	}
+	if len(revisions) == 0 {
+		return utils.StrictSanitizePolicy()
+	}
+	for _, revision := range revisions {
+		if revision.Author_id != claims.Uid {
+			return utils.StrictSanitizePolicy()
+		}
+	}
+
+	return utils.DefaultSanitizePolicy()
+}
+
+// GetPreferences returns the user's rendering options and the server default
+func GetPreferences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		user, err := userStore.GetUserById(ctx, claims.Uid)
+		if err != nil {
+			respondUserError(c, err)
+			return
+		}
+
+		respondPreferences(c, "Preferences fetched successfully", user)
+	}
+}
+
+// UpdateRenderOptions sets the extensions used to render the user's notes
+func UpdateRenderOptions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		var request models.RenderOptions
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		if request.Highlight_theme != "" && !utils.ValidHighlightTheme(request.Highlight_theme) {
+			badRequest(c, "Unknown highlight theme "+request.Highlight_theme, nil)
+			return
+		}
+
+		user, err := userStore.UpdateRenderOptions(ctx, claims.Uid, &request)
+		if err != nil {
+			respondUserError(c, err)
+			return
+		}
+
+		respondPreferences(c, "Preferences updated successfully", user)
+	}
+}
+
+// ResetRenderOptions goes back to rendering the user's notes with the
+// server default
+func ResetRenderOptions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		user, err := userStore.UpdateRenderOptions(ctx, claims.Uid, nil)
+		if err != nil {
+			respondUserError(c, err)
+			return
+		}
+
+		respondPreferences(c, "Preferences reset successfully", user)
+	}
+}
+
+// GetHighlightThemes lists the code highlighting themes
+func GetHighlightThemes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Themes fetched successfully",
+			"themes":  utils.HighlightThemes(),
+			"default": utils.DefaultRenderOptions().Highlight_theme,
+		})
+	}
+}
+
+// GetDocumentThemes lists the themes spell-checked notes can be rendered
+// as full pages with
+func GetDocumentThemes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Themes fetched successfully",
+			"themes":  utils.DocumentThemes(),
+			"default": utils.DefaultDocumentTheme,
+		})
+	}
+}
+
+// GetHighlightThemeCSS serves a theme's stylesheet, for code highlighted
+// with CSS classes
+func GetHighlightThemeCSS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		theme := strings.TrimSuffix(c.Param("theme"), ".css")
+
+		css, err := utils.ThemeCSS(theme)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Theme not found",
+			})
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=86400")
+		c.Data(http.StatusOK, "text/css; charset=utf-8", []byte(css))
+	}
+}
+
+// respondUserError writes the response for a failed user lookup or update
+func respondUserError(c *gin.Context, err error) {
+	if err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  http.StatusNotFound,
+			"message": "User not found. Please signup or login to continue.",
+		})
+		return
+	}
+
+	respondStoreError(c, err)
+}
+
+func respondPreferences(c *gin.Context, message string, user *models.User) {
+	options := utils.DefaultRenderOptions()
+	if user.Render_options != nil {
+		options = *user.Render_options
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":         http.StatusOK,
+		"message":        message,
+		"render_options": options,
+		"customized":     user.Render_options != nil,
+		"default":        utils.DefaultRenderOptions(),
+	})
+}
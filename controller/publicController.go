@@ -0,0 +1,235 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// publicPageMaxAge is how long browsers and shared caches may reuse a public
+// page before revalidating it
+const publicPageMaxAge = 5 * time.Minute
+
+// maxSlugLength caps custom and generated slugs
+const maxSlugLength = 80
+
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// setVisibilityRequest is the body of PUT /api/v1/markdown/files/:file_id/visibility.
+// Slug is optional; publishing without one generates it from the note.
+type setVisibilityRequest struct {
+	Visibility string `json:"visibility" binding:"required"`
+	Slug       string `json:"slug"`
+	Version    *int64 `json:"version"`
+}
+
+// slugify turns a note title into a slug: lowercase ASCII letters and
+// digits separated by single hyphens
+func slugify(title string) string {
+	var b strings.Builder
+	hyphen := false
+
+	for _, r := range strings.ToLower(title) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+
+	slug := b.String()
+	if len(slug) > maxSlugLength-7 {
+		slug = strings.TrimRight(slug[:maxSlugLength-7], "-")
+	}
+
+	return slug
+}
+
+// newSlug builds a slug for a note from its title, with a random suffix so
+// notes with the same title don't collide
+func newSlug(file *models.File) (string, error) {
+	page, err := utils.NewPublicPage(file.File_content, strings.TrimSuffix(file.File_name, ".md"))
+	if err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+
+	if slug := slugify(page.Title); slug != "" {
+		return slug + "-" + hex.EncodeToString(suffix), nil
+	}
+	return "note-" + hex.EncodeToString(suffix), nil
+}
+
+// publicBaseUrl is the origin public pages are served from, set by
+// PUBLIC_BASE_URL. Request headers aren't trusted for it, since pages are
+// cached and Host or X-Forwarded-Proto may be forged.
+var publicBaseUrl = sync.OnceValue(func() string {
+	return strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+})
+
+// publicUrl returns the address of a public page, relative to the server
+// unless PUBLIC_BASE_URL is set
+func publicUrl(slug string) string {
+	return publicBaseUrl() + "/p/" + slug
+}
+
+// SetNoteVisibility publishes a note at /p/:slug or makes it private again.
+// A note keeps its slug when made private, so republishing restores the
+// same address.
+func SetNoteVisibility() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		var request setVisibilityRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		if request.Visibility != models.VisibilityPublic && request.Visibility != models.VisibilityPrivate {
+			badRequest(c, "visibility must be public or private", nil)
+			return
+		}
+
+		if request.Slug != "" && (len(request.Slug) > maxSlugLength || !slugPattern.MatchString(request.Slug)) {
+			badRequest(c, "slug may only contain lowercase letters, digits and single hyphens", nil)
+			return
+		}
+
+		file := findOwnedFile(c, ctx, claims.Owner)
+		if file == nil {
+			return
+		}
+
+		if file.Trashed() && request.Visibility == models.VisibilityPublic {
+			badRequest(c, "Restore the note from the trash before publishing it", nil)
+			return
+		}
+
+		// Changing visibility doesn't touch the content, so the version is optional
+		version, conditional, err := expectedVersion(c, request.Version)
+		if err != nil {
+			badRequest(c, err.Error(), nil)
+			return
+		}
+		if !conditional {
+			version = file.Version
+		}
+
+		file.Visibility = request.Visibility
+		if request.Slug != "" {
+			file.Slug = request.Slug
+		}
+		if file.Slug == "" && request.Visibility == models.VisibilityPublic {
+			if file.Slug, err = newSlug(file); err != nil {
+				respondStoreError(c, err)
+				return
+			}
+		}
+
+		updated, err := fileStore.UpdateFile(ctx, file, version)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		response := gin.H{
+			"status":  http.StatusOK,
+			"message": "Visibility updated successfully",
+			"file":    updated,
+		}
+		if updated.Public() {
+			response["url"] = publicUrl(updated.Slug)
+		}
+
+		setETag(c, updated)
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// publicPageError responds to a public page request with a short HTML error
+// page that caches don't keep
+func publicPageError(c *gin.Context, status int, message string) {
+	c.Header("Cache-Control", "no-store")
+	c.Data(status, "text/html; charset=utf-8", []byte("<!DOCTYPE html>\n<title>"+http.StatusText(status)+"</title>\n<p>"+message+"</p>\n"))
+}
+
+// GetPublicPage serves a published note as a standalone HTML page, without
+// authentication or spellcheck markup. Pages are cacheable and revalidated
+// with the note's version as ETag.
+func GetPublicPage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		file, err := fileStore.GetPublicFile(ctx, c.Param("slug"))
+		if err == store.ErrNotFound {
+			publicPageError(c, http.StatusNotFound, "This page doesn't exist or is no longer public.")
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching public file: %v", err.Error())
+			publicPageError(c, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+
+		etag := strconv.Quote(strconv.FormatInt(file.Version, 10))
+		c.Header("ETag", etag)
+		c.Header("Last-Modified", file.Updated_at.UTC().Format(http.TimeFormat))
+		c.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(publicPageMaxAge.Seconds())))
+
+		if c.GetHeader("If-None-Match") == etag {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		page, err := utils.NewPublicPage(file.File_content, strings.TrimSuffix(file.File_name, ".md"))
+		if err != nil {
+			log.Printf("HTML processing failed: %v", err.Error())
+			publicPageError(c, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+		// Without a configured origin the page has no canonical address
+		if publicBaseUrl() != "" {
+			page.Url = publicUrl(file.Slug)
+		}
+		page.Updated_at = file.Updated_at
+
+		html, err := page.Render()
+		if err != nil {
+			log.Printf("HTML processing failed: %v", err.Error())
+			publicPageError(c, http.StatusInternalServerError, "Something went wrong.")
+			return
+		}
+
+		c.Data(http.StatusOK, "text/html; charset=utf-8", html)
+	}
+}
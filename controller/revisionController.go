@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordRevision stores the file's current content as a new immutable revision
+// and moves the note's comment anchors onto it
+func recordRevision(ctx context.Context, file *models.File, authorId string, summary models.SpellcheckSummary, restoredFrom string) (*models.Revision, error) {
+	hash := sha256.Sum256([]byte(file.File_content))
+	docId := primitive.NewObjectID()
+
+	revision := &models.Revision{
+		ID:            docId,
+		Revision_id:   docId.Hex(),
+		File_id:       file.File_id,
+		File_name:     file.File_name,
+		Author_id:     authorId,
+		Content:       file.File_content,
+		Content_hash:  hex.EncodeToString(hash[:]),
+		Spellcheck:    summary,
+		Restored_from: restoredFrom,
+		Created_at:    file.Updated_at,
+	}
+
+	if err := revisionStore.AddRevision(ctx, revision); err != nil {
+		return nil, err
+	}
+
+	reanchorThreads(ctx, file, revision)
+
+	return revision, nil
+}
+
+// findOwnedFile loads the user's file named by the file_id path parameter.
+// On failure it writes the error response and returns nil.
+func findOwnedFile(c *gin.Context, ctx context.Context, userId string) *models.File {
+	file, err := fileStore.GetFile(ctx, userId, c.Param("file_id"))
+
+	if err != nil {
+		log.Printf("Error fetching file: %v", err.Error())
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "File not found",
+			})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Internal server error",
+			"error":   err.Error(),
+		})
+		return nil
+	}
+
+	return file
+}
+
+// findRevision loads one revision of the file. On failure it writes the error
+// response and returns nil.
+func findRevision(c *gin.Context, ctx context.Context, fileId string, revisionId string) *models.Revision {
+	revision, err := revisionStore.GetRevision(ctx, fileId, revisionId)
+
+	if err != nil {
+		log.Printf("Error fetching revision %s: %v", revisionId, err.Error())
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Revision not found",
+			})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Internal server error",
+			"error":   err.Error(),
+		})
+		return nil
+	}
+
+	return revision
+}
+
+// GetFileRevisions lists a file's revisions, newest first, without their content
+func GetFileRevisions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		file, _ := findAccessibleFile(c, ctx, claims, models.PermissionView)
+		if file == nil {
+			return
+		}
+
+		revisions, err := revisionStore.ListRevisions(ctx, file.File_id)
+		if err != nil {
+			log.Printf("Error fetching revisions: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Internal server error",
+			})
+			return
+		}
+
+		for i := range revisions {
+			revisions[i].Content = ""
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":    http.StatusOK,
+			"message":   "Revisions fetched successfully",
+			"revisions": revisions,
+		})
+	}
+}
+
+// GetFileRevision returns a single revision including its content
+func GetFileRevision() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		file, _ := findAccessibleFile(c, ctx, claims, models.PermissionView)
+		if file == nil {
+			return
+		}
+
+		revision := findRevision(c, ctx, file.File_id, c.Param("revision_id"))
+		if revision == nil {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":   http.StatusOK,
+			"message":  "Revision fetched successfully",
+			"revision": revision,
+		})
+	}
+}
+
+// DiffFileRevisions compares two revisions of a file.
+//
+// Query parameters:
+//   - from: the older revision id (required)
+//   - to: the newer revision id, defaults to the current content
+//   - mode: "unified" (default) for a unified diff or "word" for word-level operations
+//   - context: number of context lines in a unified diff, defaults to 3
+func DiffFileRevisions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		file, _ := findAccessibleFile(c, ctx, claims, models.PermissionView)
+		if file == nil {
+			return
+		}
+
+		fromId := c.Query("from")
+		if fromId == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "The `from` revision is required",
+			})
+			return
+		}
+
+		from := findRevision(c, ctx, file.File_id, fromId)
+		if from == nil {
+			return
+		}
+
+		toId, toContent := "current", file.File_content
+		if id := c.Query("to"); id != "" {
+			to := findRevision(c, ctx, file.File_id, id)
+			if to == nil {
+				return
+			}
+			toId, toContent = to.Revision_id, to.Content
+		}
+
+		mode := c.DefaultQuery("mode", "unified")
+		response := gin.H{
+			"status":  http.StatusOK,
+			"message": "Diff computed successfully",
+			"from":    from.Revision_id,
+			"to":      toId,
+			"mode":    mode,
+		}
+
+		switch mode {
+		case "unified":
+			contextLines, err := strconv.Atoi(c.DefaultQuery("context", "3"))
+			if err != nil || contextLines < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"status":  http.StatusBadRequest,
+					"message": "`context` must be a non-negative number",
+				})
+				return
+			}
+			response["diff"] = utils.UnifiedDiff(
+				file.File_name+"@"+from.Revision_id,
+				file.File_name+"@"+toId,
+				from.Content,
+				toContent,
+				contextLines,
+			)
+		case "word":
+			response["diff"] = utils.WordDiff(from.Content, toContent)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"status":  http.StatusBadRequest,
+				"message": "Unsupported diff mode: " + mode,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// RestoreFileRevision makes an old revision's content current again. The
+// restore is itself recorded as a new revision, so no history is lost. Like
+// any edit, it needs the version being replaced in If-Match.
+func RestoreFileRevision() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		version, ok := requireVersion(c, nil)
+		if !ok {
+			return
+		}
+
+		file := findEditableFile(c, ctx, claims)
+		if file == nil {
+			return
+		}
+
+		revision := findRevision(c, ctx, file.File_id, c.Param("revision_id"))
+		if revision == nil {
+			return
+		}
+
+		result, err := checkSpelling(ctx, claims, []byte(revision.Content))
+		if err != nil {
+			log.Printf("Spell check failed: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Spell check failed: " + err.Error(),
+			})
+			return
+		}
+
+		file.File_content = revision.Content
+		restored, newRevision, err := saveRestoredNote(ctx, file, claims.Uid, result.Summary(), revision.Revision_id, func(ctx context.Context, file *models.File) (*models.File, error) {
+			return fileStore.UpdateFile(ctx, file, version)
+		})
+		if err != nil {
+			log.Printf("Error restoring file: %v", err.Error())
+			respondStoreError(c, err)
+			return
+		}
+
+		setETag(c, restored)
+		c.JSON(http.StatusOK, gin.H{
+			"status":   http.StatusOK,
+			"message":  "Revision restored successfully",
+			"file":     restored,
+			"revision": newRevision,
+		})
+	}
+}
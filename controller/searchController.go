@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultSearchLimit is how many results a search returns without ?limit=
+const defaultSearchLimit = 20
+
+// SearchNotes runs a full-text search over the user's notes outside the trash
+func SearchNotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		limit := defaultSearchLimit
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				badRequest(c, "limit must be a positive number", err)
+				return
+			}
+			limit = parsed
+		}
+
+		results, err := searchIndex.Search(ctx, claims.Owner, c.Query("q"), limit)
+		if errors.Is(err, search.ErrInvalidQuery) {
+			badRequest(c, "Invalid search query", err)
+			return
+		}
+		if err != nil {
+			log.Printf("Search failed: %v", err.Error())
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":      http.StatusOK,
+			"message":     "Search completed successfully",
+			"query":       c.Query("q"),
+			"total":       results.Total,
+			"results":     results.Results,
+			"corrections": results.Corrections,
+		})
+	}
+}
@@ -0,0 +1,580 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ownerPermission is reported for notes the user owns, which they can do
+// anything with.
+const ownerPermission = "owner"
+
+// linkPasswordHeader carries the password of a protected public link
+const linkPasswordHeader = "X-Link-Password"
+
+// shareRequest is the body of POST /api/v1/markdown/shares. Exactly one of
+// File_id and Folder is set.
+type shareRequest struct {
+	File_id    string `json:"file_id"`
+	Folder     string `json:"folder"`
+	Email      string `json:"email" binding:"required"`
+	Permission string `json:"permission" binding:"required"`
+}
+
+// linkRequest is the body of POST /api/v1/markdown/files/:file_id/links
+type linkRequest struct {
+	Password   string     `json:"password"`
+	Expires_at *time.Time `json:"expires_at"`
+}
+
+// sharedNote is a note in the "shared with me" list
+type sharedNote struct {
+	File       models.File `json:"file"`
+	Owner_id   string      `json:"owner_id"`
+	Permission string      `json:"permission"`
+}
+
+// linkResponse is a public link as shown to its owner, without the password hash
+type linkResponse struct {
+	models.PublicLink
+	Password_hash string `json:"password_hash,omitempty"`
+	Protected     bool   `json:"protected"`
+	Url           string `json:"url"`
+}
+
+func newLinkResponse(link *models.PublicLink) linkResponse {
+	return linkResponse{
+		PublicLink: *link,
+		Protected:  link.Password_hash != "",
+		Url:        "/api/v1/markdown/public/" + link.Token,
+	}
+}
+
+// sharedFile finds a note of another user shared with userId, directly or
+// through one of its folders, along with the strongest permission granted.
+// It returns a nil file if the note isn't shared with the user.
+func sharedFile(ctx context.Context, userId string, fileId string) (*models.File, string, error) {
+	shares, err := shareStore.ListSharedWith(ctx, userId)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var file *models.File
+	permission := ""
+	for _, share := range shares {
+		if share.File_id != "" && share.File_id != fileId {
+			continue
+		}
+
+		candidate, err := fileStore.GetFile(ctx, share.Owner_id, fileId)
+		if err == store.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		// A folder share never covers the root, whatever was stored
+		if share.File_id == "" && (share.Folder == "" || !store.InFolder(candidate.Folder, share.Folder)) {
+			continue
+		}
+
+		file = candidate
+		if permission == "" || models.PermissionAllows(share.Permission, permission) {
+			permission = share.Permission
+		}
+	}
+
+	// Trashed notes are only visible to their owner
+	if file != nil && file.Trashed() {
+		return nil, "", nil
+	}
+
+	return file, permission, nil
+}
+
+// findAccessibleFile loads the file named by the file_id path parameter if
+// it belongs to the session's space and the user's role there grants the
+// needed permission, or if it was shared with the user with at least that
+// permission. It also returns the user's permission. On failure it writes
+// the error response and returns nil.
+func findAccessibleFile(c *gin.Context, ctx context.Context, claims *session, need string) (*models.File, string) {
+	file, err := fileStore.GetFile(ctx, claims.Owner, c.Param("file_id"))
+	permission := claims.permission()
+
+	if err == store.ErrNotFound {
+		file, permission, err = sharedFile(ctx, claims.Uid, c.Param("file_id"))
+	}
+
+	if err != nil {
+		log.Printf("Error fetching file: %v", err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status":  http.StatusInternalServerError,
+			"message": "Internal server error",
+			"error":   err.Error(),
+		})
+		return nil, ""
+	}
+
+	if file == nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  http.StatusNotFound,
+			"message": "File not found",
+		})
+		return nil, ""
+	}
+
+	if permission != ownerPermission && !models.PermissionAllows(permission, need) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  http.StatusForbidden,
+			"message": "You have " + permission + " access to this note only",
+		})
+		return nil, ""
+	}
+
+	return file, permission
+}
+
+// newLinkToken returns a random, URL-safe public link token
+func newLinkToken() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// ShareNote grants another user, found by email, access to a note or folder
+func ShareNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		var request shareRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		if !models.ValidPermission(request.Permission) {
+			badRequest(c, "permission must be view, comment or edit", nil)
+			return
+		}
+
+		folder, err := store.CleanFolder(request.Folder)
+		if err != nil {
+			badRequest(c, "Invalid folder", err)
+			return
+		}
+
+		// Checked once cleaned, since a folder like "/" is the whole space
+		if (request.File_id == "") == (folder == "") {
+			badRequest(c, "Share either a file_id or a folder other than the root", nil)
+			return
+		}
+
+		if request.File_id != "" {
+			if _, err := fileStore.GetFile(ctx, claims.Owner, request.File_id); err != nil {
+				respondStoreError(c, err)
+				return
+			}
+		}
+
+		grantee, err := userStore.GetUserByEmail(ctx, request.Email)
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "No user with this email",
+			})
+			return
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		if grantee.User_id == claims.Uid {
+			badRequest(c, "You can't share a note with yourself", nil)
+			return
+		}
+
+		docId := primitive.NewObjectID()
+		share, err := shareStore.SaveShare(ctx, &models.Share{
+			ID:         docId,
+			Share_id:   docId.Hex(),
+			Owner_id:   claims.Owner,
+			File_id:    request.File_id,
+			Folder:     folder,
+			Grantee_id: grantee.User_id,
+			Permission: request.Permission,
+			Created_at: time.Now(),
+		})
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "Shared successfully",
+			"share":   share,
+		})
+	}
+}
+
+// GetShares lists the shares the user has granted
+func GetShares() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		shares, err := shareStore.ListShares(ctx, claims.Owner)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Shares fetched successfully",
+			"shares":  shares,
+		})
+	}
+}
+
+// DeleteShare revokes a share the user granted
+func DeleteShare() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		if err := shareStore.DeleteShare(ctx, claims.Owner, c.Param("share_id")); err != nil {
+			if err == store.ErrNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"status":  http.StatusNotFound,
+					"message": "Share not found",
+				})
+				return
+			}
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Share revoked successfully",
+		})
+	}
+}
+
+// GetSharedWithMe lists the notes other users have shared with the user,
+// directly or through a folder, without their content
+func GetSharedWithMe() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		shares, err := shareStore.ListSharedWith(ctx, claims.Uid)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		notes := []sharedNote{}
+		index := make(map[string]int)
+		add := func(file models.File, share models.Share) {
+			file.File_content = ""
+			if i, ok := index[file.File_id]; ok {
+				if models.PermissionAllows(share.Permission, notes[i].Permission) {
+					notes[i].Permission = share.Permission
+				}
+				return
+			}
+			index[file.File_id] = len(notes)
+			notes = append(notes, sharedNote{File: file, Owner_id: share.Owner_id, Permission: share.Permission})
+		}
+
+		for _, share := range shares {
+			if share.File_id != "" {
+				file, err := fileStore.GetFile(ctx, share.Owner_id, share.File_id)
+				if err == store.ErrNotFound {
+					continue
+				}
+				if err != nil {
+					respondStoreError(c, err)
+					return
+				}
+				if !file.Trashed() {
+					add(*file, share)
+				}
+				continue
+			}
+
+			if share.Folder == "" {
+				continue
+			}
+			page, err := fileStore.FindFiles(ctx, share.Owner_id, store.FileQuery{WithoutContent: true})
+			if err != nil {
+				respondStoreError(c, err)
+				return
+			}
+			for _, file := range page.Files {
+				if store.InFolder(file.Folder, share.Folder) {
+					add(file, share)
+				}
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Shared notes fetched successfully",
+			"files":   notes,
+		})
+	}
+}
+
+// CreatePublicLink creates a read-only public link to one of the user's
+// notes, optionally with an expiry and a password
+func CreatePublicLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		var request linkRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		if request.Expires_at != nil && request.Expires_at.Before(time.Now()) {
+			badRequest(c, "expires_at must be in the future", nil)
+			return
+		}
+
+		file := findOwnedFile(c, ctx, claims.Owner)
+		if file == nil {
+			return
+		}
+
+		token, err := newLinkToken()
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		docId := primitive.NewObjectID()
+		link := &models.PublicLink{
+			ID:         docId,
+			Link_id:    docId.Hex(),
+			Token:      token,
+			Owner_id:   claims.Owner,
+			File_id:    file.File_id,
+			Expires_at: request.Expires_at,
+			Created_at: time.Now(),
+		}
+
+		if request.Password != "" {
+			if link.Password_hash, err = utils.HashPassword(request.Password); err != nil {
+				respondStoreError(c, err)
+				return
+			}
+		}
+
+		if err := shareStore.CreateLink(ctx, link); err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":  http.StatusCreated,
+			"message": "Public link created successfully",
+			"link":    newLinkResponse(link),
+		})
+	}
+}
+
+// GetPublicLinks lists the public links to one of the user's notes
+func GetPublicLinks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		file := findOwnedFile(c, ctx, claims.Owner)
+		if file == nil {
+			return
+		}
+
+		links, err := shareStore.ListLinks(ctx, claims.Owner, file.File_id)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		responses := make([]linkResponse, len(links))
+		for i := range links {
+			responses[i] = newLinkResponse(&links[i])
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Public links fetched successfully",
+			"links":   responses,
+		})
+	}
+}
+
+// DeletePublicLink revokes one of the user's public links
+func DeletePublicLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		if err := shareStore.DeleteLink(ctx, claims.Owner, c.Param("link_id")); err != nil {
+			if err == store.ErrNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"status":  http.StatusNotFound,
+					"message": "Link not found",
+				})
+				return
+			}
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Public link revoked successfully",
+		})
+	}
+}
+
+// GetPublicNote serves a note through a public link, without authentication.
+// Password protected links take the password in the X-Link-Password header,
+// checked before anything else about the link is revealed.
+func GetPublicNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		link, err := shareStore.GetLink(ctx, c.Param("token"))
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "Link not found",
+			})
+			return
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		// The password comes first, so an expired link reveals nothing about
+		// itself to someone without it
+		if link.Password_hash != "" {
+			password := c.GetHeader(linkPasswordHeader)
+			if valid, _ := utils.ConfirmPassword(password, link.Password_hash); password == "" || !valid {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"status":  http.StatusUnauthorized,
+					"message": "This link is password protected. Send the password in the " + linkPasswordHeader + " header.",
+				})
+				return
+			}
+		}
+
+		if link.Expired() {
+			c.JSON(http.StatusGone, gin.H{
+				"status":  http.StatusGone,
+				"message": "This link has expired",
+			})
+			return
+		}
+
+		file, err := fileStore.GetFile(ctx, link.Owner_id, link.File_id)
+		if err == nil && file.Trashed() {
+			err = store.ErrNotFound
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		options, ok := renderOptions(c, ctx, "")
+		if !ok {
+			return
+		}
+
+		html, err := utils.RenderMarkdown([]byte(file.File_content), options, utils.StrictSanitizePolicy())
+		if err != nil {
+			log.Printf("HTML processing failed: %v", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "HTML processing failed: " + err.Error(),
+			})
+			return
+		}
+
+		// Shared caches must not keep password protected notes
+		if link.Password_hash != "" {
+			c.Header("Cache-Control", "private, no-store")
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "File fetched successfully",
+			"file": gin.H{
+				"file_name":    file.File_name,
+				"file_content": file.File_content,
+				"html_content": html,
+				"updated_at":   file.Updated_at,
+			},
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"go-markdown-parser/search"
+	"go-markdown-parser/store"
+)
+
+// Storage backends used by the handlers. They are set once at startup by UseStores.
+var (
+	fileStore      store.FileStore
+	userStore      store.UserStore
+	revisionStore  store.RevisionStore
+	shareStore     store.ShareStore
+	workspaceStore store.WorkspaceStore
+	commentStore   store.CommentStore
+	// searchIndex wraps fileStore, so every write through it is indexed
+	searchIndex *search.FileIndex
+	// stores groups the backends above, for operations spanning several
+	stores *store.Stores
+)
+
+// searchIndexUsers is how many users' search indexes are kept in memory,
+// set by SEARCH_INDEX_USERS
+var searchIndexUsers = sync.OnceValue(func() int {
+	value := os.Getenv("SEARCH_INDEX_USERS")
+	if value == "" {
+		return 500
+	}
+
+	users, err := strconv.Atoi(value)
+	if err != nil || users <= 0 {
+		log.Printf("Invalid SEARCH_INDEX_USERS %q, using 500", value)
+		return 500
+	}
+	return users
+})
+
+// UseStores sets the storage backends the handlers read from and write to.
+func UseStores(backends *store.Stores) {
+	searchIndex = search.NewFileIndex(backends.Files, fuzzyModel, searchIndexUsers())
+	fileStore = searchIndex
+	userStore = backends.Users
+	revisionStore = backends.Revisions
+	shareStore = backends.Shares
+	workspaceStore = backends.Workspaces
+	commentStore = backends.Comments
+
+	stores = &store.Stores{
+		Files:      fileStore,
+		Users:      userStore,
+		Revisions:  revisionStore,
+		Shares:     shareStore,
+		Workspaces: workspaceStore,
+		Comments:   commentStore,
+	}
+}
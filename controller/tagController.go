@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxPageSize caps the limit query parameter of GET /api/v1/markdown/files
+const maxPageSize = 500
+
+// setTagsRequest is the body of PUT /api/v1/markdown/files/:file_id/tags
+type setTagsRequest struct {
+	Tags    []string `json:"tags" binding:"required"`
+	Version *int64   `json:"version"`
+}
+
+// tagCount is one entry of GET /api/v1/markdown/tags
+type tagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// applyContentMetadata updates the metadata derived from a note's content:
+// its misspelled word count and, if the front matter lists any, its tags.
+func applyContentMetadata(file *models.File, summary models.SpellcheckSummary) {
+	file.Misspelled_count = summary.Misspelled_count
+
+	if tags, ok := utils.FrontMatterTags(file.File_content); ok {
+		file.Tags = tags
+	}
+}
+
+// parseDateParam reads a date query parameter as RFC 3339 or YYYY-MM-DD.
+// A bare "to" date covers the whole day.
+func parseDateParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+// fileQueryFromRequest builds a store.FileQuery from the tag, prefix, from,
+// to, has_misspellings, sort, limit, cursor and content query parameters.
+func fileQueryFromRequest(c *gin.Context) (store.FileQuery, error) {
+	var query store.FileQuery
+	var err error
+
+	if tags := utils.NormalizeTags([]string{c.Query("tag")}); len(tags) > 0 {
+		query.Tag = tags[0]
+	}
+	query.Prefix = c.Query("prefix")
+	query.Sort = c.Query("sort")
+	query.Cursor = c.Query("cursor")
+
+	if value := c.Query("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 || query.Limit > maxPageSize {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+	}
+
+	if value := c.Query("content"); value != "" {
+		content, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, err
+		}
+		query.WithoutContent = !content
+	}
+
+	if query.From, err = parseDateParam(c.Query("from"), false); err != nil {
+		return query, err
+	}
+	if query.To, err = parseDateParam(c.Query("to"), true); err != nil {
+		return query, err
+	}
+
+	if value := c.Query("has_misspellings"); value != "" {
+		hasMisspellings, err := strconv.ParseBool(value)
+		if err != nil {
+			return query, err
+		}
+		query.HasMisspellings = &hasMisspellings
+	}
+
+	return query, query.Validate()
+}
+
+// SetNoteTags replaces a note's tags. Notes whose front matter lists tags
+// get them back from the front matter on their next save.
+func SetNoteTags() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleEditor)
+		if claims == nil {
+			return
+		}
+
+		var request setTagsRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		file := findOwnedFile(c, ctx, claims.Owner)
+		if file == nil {
+			return
+		}
+
+		// Tagging doesn't touch the content, so the version is optional
+		version, conditional, err := expectedVersion(c, request.Version)
+		if err != nil {
+			badRequest(c, err.Error(), nil)
+			return
+		}
+		if !conditional {
+			version = file.Version
+		}
+
+		file.Tags = utils.NormalizeTags(request.Tags)
+		updated, err := fileStore.UpdateFile(ctx, file, version)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		setETag(c, updated)
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Tags updated successfully",
+			"file":    updated,
+		})
+	}
+}
+
+// GetTags lists the tags used across the user's notes with how many notes
+// carry each, most used first
+func GetTags() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedSession(c, ctx, models.RoleViewer)
+		if claims == nil {
+			return
+		}
+
+		page, err := fileStore.FindFiles(ctx, claims.Owner, store.FileQuery{WithoutContent: true})
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		counts := make(map[string]int)
+		for _, file := range page.Files {
+			for _, tag := range file.Tags {
+				counts[tag]++
+			}
+		}
+
+		tags := []tagCount{}
+		for tag, count := range counts {
+			tags = append(tags, tagCount{Tag: tag, Count: count})
+		}
+		sort.Slice(tags, func(i, j int) bool {
+			if tags[i].Count != tags[j].Count {
+				return tags[i].Count > tags[j].Count
+			}
+			return tags[i].Tag < tags[j].Tag
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Tags fetched successfully",
+			"tags":    tags,
+		})
+	}
+}
@@ -0,0 +1,650 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+	"go-markdown-parser/utils"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// session is an authenticated request and the space it works in
+type session struct {
+	*utils.JwtSignedDetails
+	// Owner is the id the notes are stored under: the active workspace, or
+	// the user themselves
+	Owner string
+	// Role is the user's role in the active workspace. Users own their
+	// personal space.
+	Role string
+}
+
+// permission returns the note permission the session's role grants on the
+// notes of its space
+func (s *session) permission() string {
+	switch s.Role {
+	case models.RoleOwner:
+		return ownerPermission
+	case models.RoleEditor:
+		return models.PermissionEdit
+	default:
+		return models.PermissionView
+	}
+}
+
+// workspaceRequest is the body of POST and PATCH /api/v1/workspaces
+type workspaceRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// memberRequest is the body of POST /api/v1/workspaces/:workspace_id/members
+type memberRequest struct {
+	Email string `json:"email" binding:"required"`
+	Role  string `json:"role" binding:"required"`
+}
+
+// dictionaryRequest is the body of POST /api/v1/workspaces/:workspace_id/dictionary
+type dictionaryRequest struct {
+	Words []string `json:"words" binding:"required"`
+}
+
+// switchWorkspaceRequest is the body of POST /api/v1/workspaces/switch. An
+// empty Workspace_id switches back to the personal space.
+type switchWorkspaceRequest struct {
+	Workspace_id string `json:"workspace_id"`
+}
+
+// membership is a workspace as listed for one of its members
+type membership struct {
+	Workspace models.Workspace `json:"workspace"`
+	Role      string           `json:"role"`
+}
+
+// authenticatedSession validates the request's bearer token and, when it
+// names a workspace, that the user is still a member of it. It then checks
+// the user's role allows need. On failure it writes the error response and
+// returns nil.
+func authenticatedSession(c *gin.Context, ctx context.Context, need string) *session {
+	claims := authenticatedClaims(c)
+	if claims == nil {
+		return nil
+	}
+
+	return sessionFor(c, ctx, claims, need)
+}
+
+// sessionFor resolves the space of already validated claims, see
+// authenticatedSession
+func sessionFor(c *gin.Context, ctx context.Context, claims *utils.JwtSignedDetails, need string) *session {
+	s := &session{JwtSignedDetails: claims, Owner: claims.Uid, Role: models.RoleOwner}
+
+	if claims.Workspace_id != "" {
+		member, err := workspaceStore.GetMember(ctx, claims.Workspace_id, claims.Uid)
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusForbidden, gin.H{
+				"status":  http.StatusForbidden,
+				"message": "You are not a member of this workspace. Switch workspace to continue.",
+			})
+			return nil
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return nil
+		}
+
+		s.Owner = claims.Workspace_id
+		s.Role = member.Role
+	}
+
+	if !models.RoleAllows(s.Role, need) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  http.StatusForbidden,
+			"message": "Your role in this workspace doesn't allow this",
+		})
+		return nil
+	}
+
+	return s
+}
+
+// findMembership loads the workspace named by the workspace_id path
+// parameter if the user holds at least the needed role in it. On failure it
+// writes the error response and returns nil.
+func findMembership(c *gin.Context, ctx context.Context, userId string, need string) (*models.Workspace, *models.Member) {
+	workspaceId := c.Param("workspace_id")
+
+	member, err := workspaceStore.GetMember(ctx, workspaceId, userId)
+	if err == store.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status":  http.StatusNotFound,
+			"message": "Workspace not found",
+		})
+		return nil, nil
+	}
+	if err != nil {
+		respondStoreError(c, err)
+		return nil, nil
+	}
+
+	if !models.RoleAllows(member.Role, need) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"status":  http.StatusForbidden,
+			"message": "Only a workspace " + need + " can do this",
+		})
+		return nil, nil
+	}
+
+	workspace, err := workspaceStore.GetWorkspace(ctx, workspaceId)
+	if err != nil {
+		respondStoreError(c, err)
+		return nil, nil
+	}
+
+	return workspace, member
+}
+
+// checkSpelling spell checks markdown, accepting the words of the session's
+// workspace dictionary. claims may be nil for anonymous checks.
+func checkSpelling(ctx context.Context, claims *session, contents []byte) (*utils.SpellCheckResult, error) {
+	result, err := utils.CheckMarkdownSpelling(contents, dictionaryMap, fuzzyModel)
+	if err != nil || claims == nil || claims.Workspace_id == "" {
+		return result, err
+	}
+
+	workspace, err := workspaceStore.GetWorkspace(ctx, claims.Workspace_id)
+	if err != nil {
+		return nil, err
+	}
+	result.Ignore(workspace.Dictionary)
+
+	return result, nil
+}
+
+// normalizeWords trims dictionary words to the form they are looked up in,
+// dropping empty ones and any containing whitespace
+func normalizeWords(words []string) ([]string, bool) {
+	normalized := make([]string, 0, len(words))
+	for _, word := range words {
+		word = utils.DictionaryWord(strings.TrimSpace(word))
+		if word == "" {
+			continue
+		}
+		if strings.ContainsAny(word, " \t\r\n") {
+			return nil, false
+		}
+		normalized = append(normalized, word)
+	}
+
+	return normalized, true
+}
+
+// CreateWorkspace creates a workspace owned by the user
+func CreateWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		var request workspaceRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		name := strings.TrimSpace(request.Name)
+		if name == "" {
+			badRequest(c, "name can't be empty", nil)
+			return
+		}
+
+		now := time.Now()
+		docId := primitive.NewObjectID()
+		workspace := &models.Workspace{
+			ID:           docId,
+			Workspace_id: docId.Hex(),
+			Name:         name,
+			Owner_id:     claims.Uid,
+			Dictionary:   []string{},
+			Created_at:   now,
+			Updated_at:   now,
+		}
+
+		if err := workspaceStore.CreateWorkspace(ctx, workspace); err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		if _, err := workspaceStore.SaveMember(ctx, &models.Member{
+			ID:           primitive.NewObjectID(),
+			Workspace_id: workspace.Workspace_id,
+			User_id:      claims.Uid,
+			Role:         models.RoleOwner,
+			Created_at:   now,
+		}); err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"status":    http.StatusCreated,
+			"message":   "Workspace created successfully",
+			"workspace": workspace,
+		})
+	}
+}
+
+// GetWorkspaces lists the workspaces the user is a member of, with their role
+func GetWorkspaces() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		members, err := workspaceStore.ListMemberships(ctx, claims.Uid)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		memberships := make([]membership, 0, len(members))
+		for _, member := range members {
+			workspace, err := workspaceStore.GetWorkspace(ctx, member.Workspace_id)
+			if err == store.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				respondStoreError(c, err)
+				return
+			}
+			memberships = append(memberships, membership{Workspace: *workspace, Role: member.Role})
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":           http.StatusOK,
+			"message":          "Workspaces fetched successfully",
+			"workspaces":       memberships,
+			"active_workspace": claims.Workspace_id,
+		})
+	}
+}
+
+// GetWorkspace returns a workspace and its members
+func GetWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		workspace, member := findMembership(c, ctx, claims.Uid, models.RoleViewer)
+		if workspace == nil {
+			return
+		}
+
+		members, err := workspaceStore.ListMembers(ctx, workspace.Workspace_id)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":    http.StatusOK,
+			"message":   "Workspace fetched successfully",
+			"workspace": workspace,
+			"role":      member.Role,
+			"members":   members,
+		})
+	}
+}
+
+// RenameWorkspace renames a workspace. Only its owners can.
+func RenameWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		var request workspaceRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		name := strings.TrimSpace(request.Name)
+		if name == "" {
+			badRequest(c, "name can't be empty", nil)
+			return
+		}
+
+		workspace, _ := findMembership(c, ctx, claims.Uid, models.RoleOwner)
+		if workspace == nil {
+			return
+		}
+
+		renamed, err := workspaceStore.RenameWorkspace(ctx, workspace.Workspace_id, name)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":    http.StatusOK,
+			"message":   "Workspace renamed successfully",
+			"workspace": renamed,
+		})
+	}
+}
+
+// SaveWorkspaceMember adds a user, found by email, to a workspace or changes
+// their role. Only owners can, and a workspace always keeps one owner.
+func SaveWorkspaceMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		var request memberRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		if !models.ValidRole(request.Role) {
+			badRequest(c, "role must be owner, editor or viewer", nil)
+			return
+		}
+
+		workspace, _ := findMembership(c, ctx, claims.Uid, models.RoleOwner)
+		if workspace == nil {
+			return
+		}
+
+		user, err := userStore.GetUserByEmail(ctx, request.Email)
+		if err == store.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status":  http.StatusNotFound,
+				"message": "No user with this email",
+			})
+			return
+		}
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		if request.Role != models.RoleOwner && !keepsAnOwner(c, ctx, workspace.Workspace_id, user.User_id) {
+			return
+		}
+
+		member, err := workspaceStore.SaveMember(ctx, &models.Member{
+			ID:           primitive.NewObjectID(),
+			Workspace_id: workspace.Workspace_id,
+			User_id:      user.User_id,
+			Role:         request.Role,
+			Created_at:   time.Now(),
+		})
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Member saved successfully",
+			"member":  member,
+		})
+	}
+}
+
+// RemoveWorkspaceMember removes a member from a workspace. Owners can remove
+// anyone; every member can leave.
+func RemoveWorkspaceMember() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		userId := c.Param("user_id")
+		need := models.RoleOwner
+		if userId == claims.Uid {
+			need = models.RoleViewer
+		}
+
+		workspace, _ := findMembership(c, ctx, claims.Uid, need)
+		if workspace == nil {
+			return
+		}
+
+		if !keepsAnOwner(c, ctx, workspace.Workspace_id, userId) {
+			return
+		}
+
+		if err := workspaceStore.RemoveMember(ctx, workspace.Workspace_id, userId); err != nil {
+			if err == store.ErrNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"status":  http.StatusNotFound,
+					"message": "Member not found",
+				})
+				return
+			}
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":  http.StatusOK,
+			"message": "Member removed successfully",
+		})
+	}
+}
+
+// keepsAnOwner checks that the workspace still has an owner if userId stops
+// being one. Otherwise it writes a 409 response and returns false.
+func keepsAnOwner(c *gin.Context, ctx context.Context, workspaceId string, userId string) bool {
+	members, err := workspaceStore.ListMembers(ctx, workspaceId)
+	if err != nil {
+		respondStoreError(c, err)
+		return false
+	}
+
+	for _, member := range members {
+		if member.Role == models.RoleOwner && member.User_id != userId {
+			return true
+		}
+	}
+
+	c.JSON(http.StatusConflict, gin.H{
+		"status":  http.StatusConflict,
+		"message": "A workspace needs at least one owner. Make someone else an owner first.",
+	})
+	return false
+}
+
+// GetWorkspaceDictionary lists the words of a workspace's custom dictionary
+func GetWorkspaceDictionary() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		workspace, _ := findMembership(c, ctx, claims.Uid, models.RoleViewer)
+		if workspace == nil {
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":     http.StatusOK,
+			"message":    "Dictionary fetched successfully",
+			"dictionary": workspace.Dictionary,
+		})
+	}
+}
+
+// AddWorkspaceWords adds words to a workspace's custom dictionary, so the
+// spell check accepts them in the workspace's notes
+func AddWorkspaceWords() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		var request dictionaryRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		words, ok := normalizeWords(request.Words)
+		if !ok {
+			badRequest(c, "Dictionary entries must be single words", nil)
+			return
+		}
+
+		workspace, _ := findMembership(c, ctx, claims.Uid, models.RoleEditor)
+		if workspace == nil {
+			return
+		}
+
+		updated, err := workspaceStore.UpdateDictionary(ctx, workspace.Workspace_id, words, nil)
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":     http.StatusOK,
+			"message":    "Dictionary updated successfully",
+			"dictionary": updated.Dictionary,
+		})
+	}
+}
+
+// RemoveWorkspaceWord removes a word from a workspace's custom dictionary
+func RemoveWorkspaceWord() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		workspace, _ := findMembership(c, ctx, claims.Uid, models.RoleEditor)
+		if workspace == nil {
+			return
+		}
+
+		updated, err := workspaceStore.UpdateDictionary(ctx, workspace.Workspace_id, nil, []string{utils.DictionaryWord(strings.TrimSpace(c.Param("word")))})
+		if err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":     http.StatusOK,
+			"message":    "Dictionary updated successfully",
+			"dictionary": updated.Dictionary,
+		})
+	}
+}
+
+// SwitchWorkspace issues new tokens for working in another workspace, or
+// in the personal space when workspace_id is empty
+func SwitchWorkspace() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		claims := authenticatedClaims(c)
+		if claims == nil {
+			return
+		}
+
+		var request switchWorkspaceRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			badRequest(c, "Invalid request body", err)
+			return
+		}
+
+		role := models.RoleOwner
+		if request.Workspace_id != "" {
+			member, err := workspaceStore.GetMember(ctx, request.Workspace_id, claims.Uid)
+			if err == store.ErrNotFound {
+				c.JSON(http.StatusNotFound, gin.H{
+					"status":  http.StatusNotFound,
+					"message": "Workspace not found",
+				})
+				return
+			}
+			if err != nil {
+				respondStoreError(c, err)
+				return
+			}
+			role = member.Role
+		}
+
+		token, refreshToken, err := utils.GenerateAllTokens(claims.Uid, claims.Email, request.Workspace_id)
+		if err != nil {
+			log.Println("Error generating tokens: ", err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status":  http.StatusInternalServerError,
+				"message": "Error occurred while generating tokens",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if _, err := userStore.UpdateTokens(ctx, claims.Uid, token, refreshToken); err != nil {
+			respondStoreError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":         http.StatusOK,
+			"message":        "Workspace switched successfully",
+			"workspace_id":   request.Workspace_id,
+			"role":           role,
+			"token":          token,
+			"refreshedToken": refreshToken,
+		})
+	}
+}
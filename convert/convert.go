@@ -0,0 +1,97 @@
+// Package convert turns notes written in other formats into markdown, so
+// content migrated from other tools goes through the same spell check and
+// storage as markdown uploads.
+package convert
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// Source formats
+const (
+	// FormatMarkdown is left as it is
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+	// FormatObsidian is markdown from an Obsidian vault, with wikilinks,
+	// embeds, callouts, highlights and comments
+	FormatObsidian = "obsidian"
+	// FormatNotion is markdown exported from Notion, whose file names and
+	// links carry page ids
+	FormatNotion = "notion"
+	FormatRST    = "rst"
+)
+
+// Formats lists the source formats
+func Formats() []string {
+	return []string{FormatMarkdown, FormatHTML, FormatObsidian, FormatNotion, FormatRST}
+}
+
+// extensions maps file name extensions to the format they hold. Obsidian
+// and Notion notes are .md files, so they are only converted when asked.
+var extensions = map[string]string{
+	".md":       FormatMarkdown,
+	".markdown": FormatMarkdown,
+	".html":     FormatHTML,
+	".htm":      FormatHTML,
+	".rst":      FormatRST,
+	".rest":     FormatRST,
+}
+
+// mediaTypes maps declared content types to the format they hold
+var mediaTypes = map[string]string{
+	"text/markdown":            FormatMarkdown,
+	"text/x-markdown":          FormatMarkdown,
+	"text/html":                FormatHTML,
+	"application/xhtml+xml":    FormatHTML,
+	"text/x-rst":               FormatRST,
+	"text/prs.fallenstein.rst": FormatRST,
+	"text/x-restructuredtext":  FormatRST,
+}
+
+// Detect returns the format of a file from its name's extension or, failing
+// that, its declared content type. It returns "" for anything else.
+func Detect(fileName string, contentType string) string {
+	if format, ok := extensions[strings.ToLower(path.Ext(fileName))]; ok {
+		return format
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaTypes[mediaType]
+}
+
+// Convert converts a note from the given format to markdown
+func Convert(format string, source []byte) ([]byte, error) {
+	switch format {
+	case FormatMarkdown:
+		return source, nil
+	case FormatHTML:
+		return fromHTML(source)
+	case FormatObsidian:
+		return fromObsidian(source), nil
+	case FormatNotion:
+		return fromNotion(source), nil
+	case FormatRST:
+		return fromRST(source), nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// FileName returns the name of a converted note: a markdown extension in
+// place of the source format's, and without Notion's page ids
+func FileName(name string, format string) string {
+	switch format {
+	case FormatHTML, FormatRST:
+		return strings.TrimSuffix(name, path.Ext(name)) + ".md"
+	case FormatNotion:
+		return NotionName(name)
+	}
+
+	return name
+}
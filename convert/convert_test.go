@@ -0,0 +1,135 @@
+package convert
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		want        string
+	}{
+		{"notes.md", "application/octet-stream", FormatMarkdown},
+		{"page.HTML", "", FormatHTML},
+		{"guide.rst", "text/plain", FormatRST},
+		{"upload", "text/markdown; charset=utf-8", FormatMarkdown},
+		{"upload", "text/x-rst", FormatRST},
+		{"upload", "text/plain", ""},
+		{"upload", "", ""},
+		{"photo.png", "image/png", ""},
+	}
+
+	for _, test := range tests {
+		if got := Detect(test.name, test.contentType); got != test.want {
+			t.Errorf("Detect(%q, %q) = %q, want %q", test.name, test.contentType, got, test.want)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := map[string][2]string{
+		"page.html": {FormatHTML, "page.md"},
+		"guide.rst": {FormatRST, "guide.md"},
+		"ideas.md":  {FormatObsidian, "ideas.md"},
+		"Trip 0123456789abcdef0123456789abcdef.md": {FormatNotion, "Trip.md"},
+	}
+
+	for name, test := range tests {
+		if got := FileName(name, test[0]); got != test[1] {
+			t.Errorf("FileName(%q, %q) = %q, want %q", name, test[0], got, test[1])
+		}
+	}
+
+	if got := NotionName("Trip 0123456789abcdef0123456789abcdef/Packing fedcba9876543210fedcba9876543210.md"); got != "Trip/Packing.md" {
+		t.Errorf("Expected ids removed from every segment, got %q", got)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		source string
+		want   string
+	}{
+		{
+			"html",
+			FormatHTML,
+			`<html><head><title>T</title><style>p {}</style></head><body>
+<h1>Title <em>here</em></h1>
+<p>Some <strong>bold</strong>, a <a href="https://example.com/a b">link</a> and 1*2_3<br> next</p>
+<ul><li><input type="checkbox" checked> done</li><li>two<ul><li>nested</li></ul></li></ul>
+<pre><code class="language-go">fmt.Println("` + "```" + `")</code></pre>
+<blockquote><p>quote</p><p>more</p></blockquote>
+<table><tr><th>a</th><th>b|c</th></tr><tr><td>1</td></tr></table>
+<script>alert(1)</script><p># not a heading</p><hr></body></html>`,
+			"# Title *here*\n\nSome **bold**, a [link](<https://example.com/a b>) and 1\\*2\\_3\\\nnext\n\n" +
+				"- [x] done\n- two\n  - nested\n\n" +
+				"````go\nfmt.Println(\"```\")\n````\n\n" +
+				"> quote\n>\n> more\n\n" +
+				"| a | b\\|c |\n| --- | --- |\n| 1 |  |\n\n" +
+				"\\# not a heading\n\n---\n",
+		},
+		{
+			"obsidian",
+			FormatObsidian,
+			"See [[Other Note]], [[Other Note#Some Heading|this]], [[#Local]] and [[doc.pdf]].\n" +
+				"![[img/pic.png|300]] ![[Embedded]]\n" +
+				"> [!warning]- Careful now\n> body ==hi there== `[[code]]`\n" +
+				"%% hidden\nstill hidden %%visible\n" +
+				"```\n[[not a link]]\n```\n",
+			"See [Other Note](<Other Note.md>), [this](<Other Note.md#some-heading>), [Local](#local) and [doc.pdf](doc.pdf).\n" +
+				"![](img/pic.png) [Embedded](Embedded.md)\n" +
+				"> **Careful now**\n> body <mark>hi there</mark> `[[code]]`\n" +
+				"\nvisible\n" +
+				"```\n[[not a link]]\n```\n",
+		},
+		{
+			"notion",
+			FormatNotion,
+			"[Packing](Trip%200123456789abcdef0123456789abcdef/Packing%20fedcba9876543210fedcba9876543210.md) [web](https://notion.so/x%20y)\n" +
+				"<aside>\n💡 Remember\n</aside>\n",
+			"[Packing](Trip/Packing.md) [web](https://notion.so/x%20y)\n" +
+				"\n> 💡 Remember\n\n",
+		},
+		{
+			"rst",
+			FormatRST,
+			"=========\n Project\n=========\n\n" +
+				"Intro with *emphasis*, ``code``, :code:`x()`, a `link <https://example.com>`_ and `Python`_.\n\n" +
+				".. _Python: https://python.org\n\n" +
+				"Section\n-------\n\n" +
+				"- item one\n  continued\n- item two\n\n" +
+				"#. first\n#. second\n\n" +
+				"Example::\n\n    x = 1\n\n" +
+				".. code-block:: python\n   :linenos:\n\n   print(\"hi\")\n\n" +
+				".. note::\n   Be careful.\n\n" +
+				".. toctree::\n   intro\n\n" +
+				"Said:\n\n    Quoted text.\n",
+			"# Project\n\n" +
+				"Intro with *emphasis*, `code`, `x()`, a [link](https://example.com) and [Python](https://python.org).\n\n" +
+				"## Section\n\n" +
+				"- item one\n  continued\n- item two\n\n" +
+				"1. first\n1. second\n\n" +
+				"Example:\n\n```\nx = 1\n```\n\n" +
+				"```python\nprint(\"hi\")\n```\n\n" +
+				"> **Note**\n>\n> Be careful.\n\n" +
+				"Said:\n\n> Quoted text.\n",
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Convert(test.format, []byte(test.source))
+		if err != nil {
+			t.Fatalf("%s: error converting: %v", test.name, err)
+		}
+		if string(got) != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+
+	if _, err := Convert("docx", nil); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
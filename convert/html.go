@@ -0,0 +1,406 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// whitespace runs collapse to a single space in HTML text
+var whitespace = regexp.MustCompile(`[ \t\r\n\f]+`)
+
+// markdownSpecial are the characters escaped in HTML text so they aren't
+// read as markdown
+var markdownSpecial = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`,
+)
+
+// fromHTML converts an HTML page or fragment to markdown. Headings,
+// paragraphs, emphasis, links, images, code, lists, task lists, quotes,
+// rules and tables become their markdown equivalents; other elements keep
+// their content, except scripts and styles, which are dropped.
+func fromHTML(source []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+
+	body := findElement(doc, atom.Body)
+	if body == nil {
+		return []byte{}, nil
+	}
+
+	markdown := blocks(body, "\n\n")
+	if markdown == "" {
+		return []byte{}, nil
+	}
+	return []byte(markdown + "\n"), nil
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// isBlock reports whether an element starts a markdown block of its own
+func isBlock(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.P,
+		atom.Pre, atom.Blockquote, atom.Ul, atom.Ol, atom.Hr, atom.Table,
+		atom.Div, atom.Section, atom.Article, atom.Main, atom.Header,
+		atom.Footer, atom.Aside, atom.Nav, atom.Figure, atom.Details,
+		atom.Dl, atom.Dt, atom.Dd, atom.Figcaption, atom.Summary,
+		atom.Script, atom.Style, atom.Noscript, atom.Template:
+		return true
+	}
+	return false
+}
+
+// blocks converts the children of n to markdown blocks joined by sep.
+// Inline content between blocks becomes a paragraph.
+func blocks(n *html.Node, sep string) string {
+	var out []string
+	var inline strings.Builder
+
+	flush := func() {
+		if text := strings.TrimSpace(inline.String()); text != "" {
+			out = append(out, escapeBlockStart(text))
+		}
+		inline.Reset()
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !isBlock(c) {
+			inline.WriteString(inlineText(c))
+			continue
+		}
+
+		flush()
+		if b := block(c); b != "" {
+			out = append(out, b)
+		}
+	}
+	flush()
+
+	return strings.Join(out, sep)
+}
+
+func block(n *html.Node) string {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		text := strings.TrimSpace(children(n))
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\\\n", " ")
+	case atom.P, atom.Dt, atom.Figcaption, atom.Summary:
+		return escapeBlockStart(strings.TrimSpace(children(n)))
+	case atom.Pre:
+		return codeBlock(n)
+	case atom.Blockquote:
+		return prefixLines(blocks(n, "\n\n"), "> ", ">")
+	case atom.Ul, atom.Ol:
+		return list(n)
+	case atom.Hr:
+		return "---"
+	case atom.Table:
+		return table(n)
+	case atom.Dd:
+		return prefixLines(blocks(n, "\n\n"), "  ", "")
+	case atom.Script, atom.Style, atom.Noscript, atom.Template:
+		return ""
+	}
+
+	return blocks(n, "\n\n")
+}
+
+// codeBlock fences a pre element's text, with the language of a
+// language-* or lang-* class on it or its code element
+func codeBlock(n *html.Node) string {
+	language := codeLanguage(n)
+	if code := n.FirstChild; code != nil && code.DataAtom == atom.Code && code.NextSibling == nil {
+		if lang := codeLanguage(code); lang != "" {
+			language = lang
+		}
+	}
+
+	return fenced(language, strings.TrimSuffix(textContent(n), "\n"))
+}
+
+func codeLanguage(n *html.Node) string {
+	for _, class := range strings.Fields(attribute(n, "class")) {
+		for _, prefix := range []string{"language-", "lang-"} {
+			if lang, ok := strings.CutPrefix(class, prefix); ok {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// list converts a list, indenting each item's following lines under its
+// marker. Items holding paragraphs make a loose list.
+func list(n *html.Node) string {
+	var items []string
+	number := 1
+	if start := attribute(n, "start"); start != "" {
+		fmt.Sscan(start, &number)
+	}
+
+	loose := false
+	for li := n.FirstChild; li != nil; li = li.NextSibling {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+
+		sep := "\n"
+		if findInItem(li, atom.P) != nil {
+			sep, loose = "\n\n", true
+		}
+		content := blocks(li, sep)
+		if box := findInItem(li, atom.Input); box != nil && attribute(box, "type") == "checkbox" {
+			if _, checked := attributeValue(box, "checked"); checked {
+				content = "[x] " + content
+			} else {
+				content = "[ ] " + content
+			}
+		}
+
+		indent := strings.Repeat(" ", len(marker))
+		items = append(items, strings.TrimSpace(marker+strings.TrimPrefix(prefixLines(content, indent, ""), indent)))
+	}
+
+	if loose {
+		return strings.Join(items, "\n\n")
+	}
+	return strings.Join(items, "\n")
+}
+
+// findInItem finds an element in a list item, outside its nested lists
+func findInItem(n *html.Node, a atom.Atom) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom == atom.Ul || c.DataAtom == atom.Ol {
+			continue
+		}
+		if c.DataAtom == a {
+			return c
+		}
+		if found := findInItem(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// table converts a table to a GFM table, its first row being the header
+func table(n *html.Node) string {
+	var rows [][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			switch c.DataAtom {
+			case atom.Thead, atom.Tbody, atom.Tfoot:
+				walk(c)
+			case atom.Tr:
+				var row []string
+				for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+					if cell.DataAtom == atom.Th || cell.DataAtom == atom.Td {
+						text := strings.ReplaceAll(strings.TrimSpace(children(cell)), "\\\n", " ")
+						row = append(row, strings.ReplaceAll(text, "|", `\|`))
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+	walk(n)
+
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return ""
+	}
+
+	var out strings.Builder
+	for i, row := range rows {
+		for len(row) < columns {
+			row = append(row, "")
+		}
+		out.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			out.WriteString("|" + strings.Repeat(" --- |", columns) + "\n")
+		}
+	}
+
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// children converts the inline content of n
+func children(n *html.Node) string {
+	var out strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if isBlock(c) {
+			// Blocks inside inline content, like a div in a paragraph,
+			// flow into it
+			out.WriteString(" " + block(c) + " ")
+			continue
+		}
+		out.WriteString(inlineText(c))
+	}
+	return out.String()
+}
+
+func inlineText(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return markdownSpecial.Replace(whitespace.ReplaceAllString(n.Data, " "))
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Strong, atom.B:
+		return wrap(children(n), "**")
+	case atom.Em, atom.I:
+		return wrap(children(n), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return wrap(children(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp:
+		return codeSpan(textContent(n))
+	case atom.Br:
+		// The text after a break starts its line
+		if next := n.NextSibling; next != nil && next.Type == html.TextNode {
+			next.Data = strings.TrimLeft(next.Data, " \t\r\n\f")
+		}
+		return "\\\n"
+	case atom.A:
+		text := strings.TrimSpace(children(n))
+		href := attribute(n, "href")
+		if href == "" {
+			return text
+		}
+		return "[" + text + "](" + destination(href) + ")"
+	case atom.Img:
+		return "![" + markdownSpecial.Replace(attribute(n, "alt")) + "](" + destination(attribute(n, "src")) + ")"
+	case atom.Input:
+		// Task list checkboxes are handled by their list item
+		return ""
+	}
+
+	return children(n)
+}
+
+// blockStart matches text that would start a heading, quote, list or rule
+var blockStart = regexp.MustCompile(`^([#>+-]|\d+[.)])`)
+
+// escapeBlockStart escapes the start of a paragraph that would otherwise
+// be read as another block
+func escapeBlockStart(text string) string {
+	if match := blockStart.FindStringIndex(text); match != nil {
+		return text[:match[1]-1] + `\` + text[match[1]-1:]
+	}
+	return text
+}
+
+// wrap puts markers around text, keeping its surrounding spaces outside
+// them as markdown requires
+func wrap(text string, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+
+	start := text[:strings.Index(text, trimmed)]
+	end := text[len(start)+len(trimmed):]
+	return start + marker + trimmed + marker + end
+}
+
+func codeSpan(code string) string {
+	code = whitespace.ReplaceAllString(code, " ")
+	fence := "`"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
+
+// destination writes a link destination, in angle brackets when it holds
+// spaces or parentheses
+func destination(url string) string {
+	if strings.ContainsAny(url, " ()") {
+		return "<" + strings.ReplaceAll(url, ">", "%3E") + ">"
+	}
+	return url
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var out strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.DataAtom == atom.Br {
+			out.WriteString("\n")
+			continue
+		}
+		out.WriteString(textContent(c))
+	}
+	return out.String()
+}
+
+func attribute(n *html.Node, key string) string {
+	value, _ := attributeValue(n, key)
+	return value
+}
+
+func attributeValue(n *html.Node, key string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+// prefixLines starts every line of text with prefix, or with blank for
+// empty lines
+func prefixLines(text string, prefix string, blank string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = blank
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,86 @@
+package convert
+
+import (
+	"regexp"
+	"strings"
+)
+
+// fence matches the opening or closing line of a fenced code block
+var fence = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+
+// rewriteLines calls rewrite with each line of markdown outside fenced code
+// blocks, replacing the line with its result
+func rewriteLines(source []byte, rewrite func(line string) string) []byte {
+	lines := strings.Split(string(source), "\n")
+	open := ""
+
+	for i, line := range lines {
+		if match := fence.FindStringSubmatch(line); match != nil {
+			rest := strings.TrimSpace(line[len(match[0]):])
+			switch {
+			case open == "":
+				open = match[1]
+				continue
+			case match[1][0] == open[0] && len(match[1]) >= len(open) && rest == "":
+				open = ""
+				continue
+			}
+		}
+		if open != "" {
+			continue
+		}
+
+		lines[i] = rewrite(line)
+	}
+
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// outsideCode calls rewrite with the parts of a line outside code spans
+func outsideCode(line string, rewrite func(text string) string) string {
+	var out strings.Builder
+
+	for {
+		start := strings.Index(line, "`")
+		if start < 0 {
+			break
+		}
+		ticks := len(line[start:]) - len(strings.TrimLeft(line[start:], "`"))
+		closing := strings.Index(line[start+ticks:], line[start:start+ticks])
+		if closing < 0 {
+			break
+		}
+
+		end := start + ticks + closing + ticks
+		out.WriteString(rewrite(line[:start]))
+		out.WriteString(line[start:end])
+		line = line[end:]
+	}
+	out.WriteString(rewrite(line))
+
+	return out.String()
+}
+
+// anchor returns the id goldmark gives a heading, to link to it
+func anchor(heading string) string {
+	var out strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case r == ' ':
+			out.WriteRune('-')
+		case r == '-' || r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r > 0x7f:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// fenced writes a fenced code block, its fence longer than any run of
+// backticks in the code
+func fenced(language string, code string) string {
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + code + "\n" + fence
+}
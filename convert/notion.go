@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// notionId matches the page id Notion adds to the end of exported file and
+// folder names
+var notionId = regexp.MustCompile(` [0-9a-f]{32}(\.[^/.]+)?(/|$)`)
+
+// markdownLink matches inline links and images with a plain destination
+var markdownLink = regexp.MustCompile(`(!?\[[^\]]*\])\(([^()\s]+)\)`)
+
+// NotionName removes Notion's page ids from a file name or path:
+// "Trip 0123456789abcdef0123456789abcdef/Packing 0123....md" becomes
+// "Trip/Packing.md"
+func NotionName(name string) string {
+	return notionId.ReplaceAllString(name, "$1$2")
+}
+
+// fromNotion converts a page of a Notion markdown export: links between
+// pages lose their ids and URL escaping, so they match the imported notes'
+// names, and <aside> callouts become quotes.
+func fromNotion(source []byte) []byte {
+	inAside := false
+
+	return rewriteLines(source, func(line string) string {
+		switch strings.TrimSpace(line) {
+		case "<aside>":
+			inAside = true
+			return ""
+		case "</aside>":
+			inAside = false
+			return ""
+		}
+
+		line = outsideCode(line, func(text string) string {
+			return markdownLink.ReplaceAllStringFunc(text, func(link string) string {
+				match := markdownLink.FindStringSubmatch(link)
+				return match[1] + "(" + notionDestination(match[2]) + ")"
+			})
+		})
+
+		if inAside {
+			return strings.TrimRight("> "+line, " ")
+		}
+		return line
+	})
+}
+
+// notionDestination rewrites a link to another page of the export. Links
+// with a scheme, like web pages, are left alone.
+func notionDestination(link string) string {
+	if parsed, err := url.Parse(link); err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return link
+	}
+
+	unescaped, err := url.PathUnescape(link)
+	if err != nil {
+		return link
+	}
+	return destination(NotionName(unescaped))
+}
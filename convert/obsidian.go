@@ -0,0 +1,126 @@
+package convert
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// wikilink matches Obsidian links and embeds: [[Note]], [[Note#Heading]],
+// [[Note|text]] and ![[image.png|300]]
+var wikilink = regexp.MustCompile(`(!?)\[\[([^\[\]|#]*)(#[^\[\]|]*)?(?:\|([^\[\]]*))?\]\]`)
+
+// callout matches the first line of an Obsidian callout, > [!type] Title,
+// optionally folded with + or -
+var callout = regexp.MustCompile(`^(\s*(?:>\s*)+)\[!([\w-]+)\][+-]?\s*(.*)$`)
+
+// highlight matches ==highlighted text==
+var highlight = regexp.MustCompile(`==([^=\s](?:[^=]*[^=\s])?)==`)
+
+// attachments are the extensions of files links point to as they are;
+// links to anything else point to a note
+var attachments = map[string]bool{
+	".md": true, ".markdown": true, ".pdf": true, ".png": true, ".jpg": true,
+	".jpeg": true, ".gif": true, ".svg": true, ".webp": true, ".bmp": true,
+	".avif": true, ".mp3": true, ".mp4": true, ".webm": true, ".wav": true,
+	".ogg": true, ".canvas": true,
+}
+
+// images are the extensions of embeds that become markdown images
+var images = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".svg": true,
+	".webp": true, ".bmp": true, ".avif": true,
+}
+
+// fromObsidian converts an Obsidian note to markdown: wikilinks become
+// relative links to the notes' files, image embeds become images, callouts
+// become quotes with a bold title, highlights become marks, and %% comments
+// %% are dropped.
+func fromObsidian(source []byte) []byte {
+	inComment := false
+
+	return rewriteLines(source, func(line string) string {
+		line, inComment = dropComments(line, inComment)
+
+		if match := callout.FindStringSubmatch(line); match != nil {
+			title := strings.TrimSpace(match[3])
+			if title == "" {
+				title = calloutTitle(match[2])
+			}
+			line = match[1] + "**" + title + "**"
+		}
+
+		return outsideCode(line, func(text string) string {
+			text = wikilink.ReplaceAllStringFunc(text, func(link string) string {
+				return obsidianLink(wikilink.FindStringSubmatch(link))
+			})
+			return highlight.ReplaceAllString(text, "<mark>$1</mark>")
+		})
+	})
+}
+
+// dropComments removes the parts of a line inside %% comments, which can
+// span lines
+func dropComments(line string, inComment bool) (string, bool) {
+	var out strings.Builder
+	for {
+		marker := strings.Index(line, "%%")
+		if !inComment {
+			if marker < 0 {
+				out.WriteString(line)
+				return out.String(), false
+			}
+			out.WriteString(line[:marker])
+		} else if marker < 0 {
+			return out.String(), true
+		}
+
+		line = line[marker+2:]
+		inComment = !inComment
+	}
+}
+
+func calloutTitle(kind string) string {
+	runes := []rune(strings.ReplaceAll(strings.ToLower(kind), "-", " "))
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func obsidianLink(match []string) string {
+	embed := match[1] == "!"
+	target := strings.TrimSpace(match[2])
+	heading := strings.TrimSpace(strings.TrimPrefix(match[3], "#"))
+	text := strings.TrimSpace(match[4])
+	ext := strings.ToLower(path.Ext(target))
+
+	if embed && images[ext] {
+		// An image embed's text is its size, like 300 or 300x200
+		if strings.Trim(text, "0123456789x") == "" {
+			text = ""
+		}
+		return "![" + text + "](" + destination(target) + ")"
+	}
+
+	if text == "" {
+		switch {
+		case heading == "" || strings.HasPrefix(heading, "^"):
+			text = target
+		case target == "":
+			text = heading
+		default:
+			text = target + " > " + heading
+		}
+	}
+
+	url := target
+	if target != "" && !attachments[ext] {
+		url += ".md"
+	}
+	// Links to block references (#^id) point to the note itself
+	if heading != "" && !strings.HasPrefix(heading, "^") {
+		url += "#" + anchor(heading)
+	}
+
+	return "[" + text + "](" + destination(url) + ")"
+}
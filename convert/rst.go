@@ -0,0 +1,363 @@
+package convert
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rstDirective matches an explicit markup line, .. name:: arguments
+var rstDirective = regexp.MustCompile(`^\.\.\s+([\w:-]+)::\s*(.*)$`)
+
+// rstTarget matches a hyperlink target, .. _name: url
+var rstTarget = regexp.MustCompile(`^\.\.\s+_([^:]+):\s*(\S*)$`)
+
+// rstBullet and rstEnumerated match list items
+var (
+	rstBullet     = regexp.MustCompile(`^(\s*)[-*+•]\s+(.*)$`)
+	rstEnumerated = regexp.MustCompile(`^(\s*)\(?(\d+|#|[a-zA-Z])[.)]\s+(.*)$`)
+)
+
+// rstField matches a field list line, :name: value
+var rstField = regexp.MustCompile(`^:([^:]+):\s*(.*)$`)
+
+// Inline markup
+var (
+	rstLiteral     = regexp.MustCompile("``(.+?)``")
+	rstRole        = regexp.MustCompile(":([\\w:-]+):`([^`]+)`")
+	rstEmbeddedURL = regexp.MustCompile("`([^`<]+?)\\s*<([^`>]+)>`__?")
+	rstReference   = regexp.MustCompile("`([^`]+)`__?")
+	rstDefault     = regexp.MustCompile("`([^`]+)`")
+)
+
+// rstAdmonitions are the directives rendered as quotes with their title
+var rstAdmonitions = map[string]string{
+	"note": "Note", "tip": "Tip", "hint": "Hint", "important": "Important",
+	"warning": "Warning", "caution": "Caution", "attention": "Attention",
+	"danger": "Danger", "error": "Error", "seealso": "See also",
+	"admonition": "",
+}
+
+// rstConverter converts reStructuredText line by line
+type rstConverter struct {
+	lines []string
+	out   []string
+	// levels are the title adornment styles in the order they appeared,
+	// which sets the heading levels
+	levels []string
+	// targets are the URLs of named hyperlink targets
+	targets map[string]string
+}
+
+// fromRST converts reStructuredText to markdown: section titles, lists,
+// literal and code blocks, admonitions, images, links and inline markup.
+// Other directives and comments are dropped.
+func fromRST(source []byte) []byte {
+	text := strings.ReplaceAll(strings.ReplaceAll(string(source), "\r\n", "\n"), "\t", "    ")
+	r := &rstConverter{lines: strings.Split(text, "\n"), targets: make(map[string]string)}
+
+	for _, line := range r.lines {
+		if match := rstTarget.FindStringSubmatch(line); match != nil {
+			r.targets[strings.ToLower(strings.TrimSpace(match[1]))] = match[2]
+		}
+	}
+
+	return []byte(r.convert())
+}
+
+func (r *rstConverter) convert() string {
+	for i := 0; i < len(r.lines); {
+		i = r.line(i)
+	}
+
+	// Collapse runs of blank lines left by dropped markup
+	var out []string
+	for _, line := range r.out {
+		if strings.TrimSpace(line) == "" && (len(out) == 0 || out[len(out)-1] == "") {
+			continue
+		}
+		out = append(out, line)
+	}
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return ""
+	}
+
+	return strings.Join(out, "\n") + "\n"
+}
+
+// line converts the construct starting at line i and returns the index of
+// the line after it
+func (r *rstConverter) line(i int) int {
+	line := r.lines[i]
+	trimmed := strings.TrimSpace(line)
+	next := ""
+	if i+1 < len(r.lines) {
+		next = r.lines[i+1]
+	}
+
+	switch {
+	case trimmed == "":
+		r.out = append(r.out, "")
+		return i + 1
+
+	// A title with an overline and underline
+	case isAdornment(line) && i+2 < len(r.lines) &&
+		strings.TrimSpace(next) != "" && strings.TrimSpace(r.lines[i+2]) == trimmed:
+		r.heading("over"+trimmed[:1], strings.TrimSpace(next))
+		return i + 3
+
+	// A title with an underline
+	case !startsIndented(line) && isAdornment(next) && len(strings.TrimSpace(next)) >= min(len(trimmed), 3) && !isAdornment(line):
+		r.heading(strings.TrimSpace(next)[:1], trimmed)
+		return i + 2
+
+	// A transition
+	case isAdornment(line) && len(trimmed) >= 4:
+		r.out = append(r.out, "", "---", "")
+		return i + 1
+
+	case rstTarget.MatchString(line):
+		return i + 1
+
+	case rstDirective.MatchString(line):
+		match := rstDirective.FindStringSubmatch(line)
+		return r.directive(i, strings.ToLower(match[1]), strings.TrimSpace(match[2]))
+
+	// A comment, with its indented body
+	case strings.HasPrefix(trimmed, ".."):
+		_, end := r.indented(i + 1)
+		return end
+	}
+
+	if match := rstBullet.FindStringSubmatch(line); match != nil {
+		r.out = append(r.out, match[1]+"- "+r.inline(match[2]))
+		return i + 1
+	}
+	if match := rstEnumerated.FindStringSubmatch(line); match != nil && (len(match[2]) > 1 || match[2] == "#" || (match[2][0] >= '0' && match[2][0] <= '9')) {
+		number := match[2]
+		if number == "#" {
+			number = "1"
+		}
+		r.out = append(r.out, match[1]+number+". "+r.inline(match[3]))
+		return i + 1
+	}
+	// Field lists, unlike lines starting with a role, have a space after
+	// the name
+	if match := rstField.FindStringSubmatch(trimmed); match != nil && !startsIndented(line) && !strings.HasPrefix(match[2], "`") {
+		r.out = append(r.out, "**"+match[1]+":** "+r.inline(match[2]))
+		return i + 1
+	}
+
+	// Indented text outside a list is a block quote
+	if startsIndented(line) && !r.inList() {
+		body, end := r.indented(i)
+		for _, quoted := range strings.Split(strings.TrimRight(string(fromRST([]byte(body))), "\n"), "\n") {
+			r.out = append(r.out, strings.TrimRight("> "+quoted, " "))
+		}
+		return end
+	}
+
+	// A paragraph ending in :: introduces a literal block
+	if strings.HasSuffix(trimmed, "::") {
+		text := strings.TrimSuffix(line, "::")
+		if strings.HasSuffix(text, " ") || strings.TrimSpace(text) == "" {
+			text = strings.TrimRight(text, " ")
+		} else {
+			text += ":"
+		}
+		if strings.TrimSpace(text) != "" {
+			r.out = append(r.out, r.inline(text))
+		}
+
+		body, end := r.indented(i + 1)
+		if body != "" {
+			r.out = append(r.out, "", fenced("", body))
+		}
+		return end
+	}
+
+	r.out = append(r.out, r.inline(line))
+	return i + 1
+}
+
+func (r *rstConverter) heading(style string, title string) {
+	level := 0
+	for level < len(r.levels) && r.levels[level] != style {
+		level++
+	}
+	if level == len(r.levels) {
+		r.levels = append(r.levels, style)
+	}
+
+	r.out = append(r.out, "", strings.Repeat("#", min(level+1, 6))+" "+r.inline(title), "")
+}
+
+// directive converts the directive at line i, with its options and body
+func (r *rstConverter) directive(i int, name string, argument string) int {
+	options := make(map[string]string)
+	j := i + 1
+	for ; j < len(r.lines); j++ {
+		match := rstField.FindStringSubmatch(strings.TrimSpace(r.lines[j]))
+		if match == nil || !startsIndented(r.lines[j]) {
+			break
+		}
+		options[match[1]] = match[2]
+	}
+	body, end := r.indented(j)
+
+	switch name {
+	case "code", "code-block", "sourcecode":
+		r.out = append(r.out, "", fenced(argument, body), "")
+	case "image", "figure":
+		r.out = append(r.out, "", "!["+options["alt"]+"]("+destination(argument)+")", "")
+		if name == "figure" && body != "" {
+			r.out = append(r.out, string(fromRST([]byte(body))))
+		}
+	default:
+		title, ok := rstAdmonitions[name]
+		if !ok {
+			// Directives with no markdown equivalent, like toctree, are
+			// dropped
+			return end
+		}
+		if name == "admonition" {
+			title = argument
+		} else if argument != "" {
+			body = argument + "\n" + body
+		}
+
+		r.out = append(r.out, "", "> **"+title+"**", ">")
+		for _, quoted := range strings.Split(strings.TrimRight(string(fromRST([]byte(body))), "\n"), "\n") {
+			r.out = append(r.out, strings.TrimRight("> "+quoted, " "))
+		}
+		r.out = append(r.out, "")
+	}
+
+	return end
+}
+
+// indented returns the indented block starting at line i, without its
+// common indentation, and the index of the line after it. Blank lines
+// inside the block are kept.
+func (r *rstConverter) indented(i int) (string, int) {
+	start := i
+	for start < len(r.lines) && strings.TrimSpace(r.lines[start]) == "" {
+		start++
+	}
+
+	end := start
+	indent := -1
+	for end < len(r.lines) {
+		line := r.lines[end]
+		if strings.TrimSpace(line) == "" {
+			end++
+			continue
+		}
+		if !startsIndented(line) {
+			break
+		}
+		width := len(line) - len(strings.TrimLeft(line, " "))
+		if indent < 0 || width < indent {
+			indent = width
+		}
+		end++
+	}
+	if indent < 0 {
+		return "", start
+	}
+
+	// Trailing blank lines belong after the block
+	for end > start && strings.TrimSpace(r.lines[end-1]) == "" {
+		end--
+	}
+
+	lines := make([]string, 0, end-start)
+	for _, line := range r.lines[start:end] {
+		if len(line) >= indent {
+			line = line[indent:]
+		} else {
+			line = ""
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n"), end
+}
+
+// inList reports whether the last converted block is a list, whose
+// indented lines continue its items
+func (r *rstConverter) inList() bool {
+	for i := len(r.out) - 1; i >= 0; i-- {
+		line := r.out[i]
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if rstBullet.MatchString(line) || rstEnumerated.MatchString(line) || startsIndented(line) {
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// inline converts inline markup. Emphasis and strong emphasis are written
+// the same way in markdown; literals, roles and references are not.
+func (r *rstConverter) inline(text string) string {
+	var literals []string
+	text = rstLiteral.ReplaceAllStringFunc(text, func(literal string) string {
+		literals = append(literals, codeSpan(rstLiteral.FindStringSubmatch(literal)[1]))
+		return "\x00" + strconv.Itoa(len(literals)-1) + "\x00"
+	})
+
+	text = rstRole.ReplaceAllStringFunc(text, func(role string) string {
+		match := rstRole.FindStringSubmatch(role)
+		content := match[2]
+		// Cross-reference roles show their title, :ref:`title <label>`
+		if open := strings.LastIndex(content, "<"); open > 0 && strings.HasSuffix(content, ">") {
+			content = strings.TrimSpace(content[:open])
+		}
+		switch match[1] {
+		case "code", "literal", "samp", "kbd", "file":
+			return codeSpan(content)
+		case "emphasis":
+			return "*" + content + "*"
+		case "strong":
+			return "**" + content + "**"
+		}
+		return content
+	})
+
+	text = rstEmbeddedURL.ReplaceAllString(text, "[$1]($2)")
+	text = rstReference.ReplaceAllStringFunc(text, func(reference string) string {
+		name := rstReference.FindStringSubmatch(reference)[1]
+		if url, ok := r.targets[strings.ToLower(name)]; ok && url != "" {
+			return "[" + name + "](" + destination(url) + ")"
+		}
+		return name
+	})
+	// Interpreted text without a role is usually meant as code
+	text = rstDefault.ReplaceAllString(text, "`$1`")
+
+	for i, literal := range literals {
+		text = strings.Replace(text, "\x00"+strconv.Itoa(i)+"\x00", literal, 1)
+	}
+
+	return text
+}
+
+// isAdornment reports whether a line is one punctuation character repeated,
+// like the underline or overline of a section title
+func isAdornment(line string) bool {
+	line = strings.TrimRight(line, " ")
+	if len(line) < 2 || !strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", rune(line[0])) {
+		return false
+	}
+	return strings.Trim(line, line[:1]) == ""
+}
+
+func startsIndented(line string) bool {
+	return strings.HasPrefix(line, " ")
+}
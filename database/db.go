@@ -11,7 +11,15 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Client is the shared MongoDB client. It is nil until StartDB has been called,
+// so packages that don't use MongoDB (e.g. with the sqlite or memory store) never connect.
+var Client *mongo.Client
+
 func StartDB() *mongo.Client {
+	if Client != nil {
+		return Client
+	}
+
 	err := godotenv.Load(".env")
 
 	if err != nil {
@@ -42,11 +50,10 @@ func StartDB() *mongo.Client {
 	}
 
 	log.Println("Connected to MongoDB Successfully")
+	Client = client
 	return client
 }
 
-var Client *mongo.Client = StartDB()
-
 func OpenCollection(client *mongo.Client, collectionName string) *mongo.Collection {
 	MONGO_DB_NAME := os.Getenv("MONGO_DATABASE_NAME")
 
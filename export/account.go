@@ -0,0 +1,134 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"go-markdown-parser/models"
+)
+
+// Account is the account metadata of an account export, without
+// credentials
+type Account struct {
+	User_id        string                `json:"user_id"`
+	Email          string                `json:"email"`
+	Created_at     time.Time             `json:"created_at"`
+	Updated_at     time.Time             `json:"updated_at"`
+	Render_options *models.RenderOptions `json:"render_options,omitempty"`
+	// Workspaces are the user's memberships; their notes belong to the
+	// workspaces and aren't exported
+	Workspaces  []models.Member `json:"workspaces"`
+	Exported_at time.Time       `json:"exported_at"`
+}
+
+// NoteMetadata describes an exported note. Path is where its markdown is in
+// the archive.
+type NoteMetadata struct {
+	File_id          string     `json:"file_id"`
+	Path             string     `json:"path"`
+	File_name        string     `json:"file_name"`
+	Folder           string     `json:"folder"`
+	Tags             []string   `json:"tags"`
+	Misspelled_count int        `json:"misspelled_count"`
+	Visibility       string     `json:"visibility"`
+	Slug             string     `json:"slug,omitempty"`
+	Version          int64      `json:"version"`
+	Created_at       time.Time  `json:"created_at"`
+	Updated_at       time.Time  `json:"updated_at"`
+	Deleted_at       *time.Time `json:"deleted_at,omitempty"`
+}
+
+// AccountArchive writes a zip of an account's notes as markdown files, in
+// their folders under notes/ or, for trashed ones, trash/, along with
+// account.json and notes.json describing them. written is called after
+// each note is added.
+func AccountArchive(w io.Writer, account Account, files []models.File, written func(index int, file *models.File)) error {
+	archive := zip.NewWriter(w)
+
+	notes := make([]NoteMetadata, 0, len(files))
+	taken := make(map[string]bool, len(files))
+	for i := range files {
+		file := &files[i]
+		name := notePath(file, taken)
+
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: file.Updated_at})
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write([]byte(file.File_content)); err != nil {
+			return err
+		}
+
+		notes = append(notes, NoteMetadata{
+			File_id:          file.File_id,
+			Path:             name,
+			File_name:        file.File_name,
+			Folder:           file.Folder,
+			Tags:             file.Tags,
+			Misspelled_count: file.Misspelled_count,
+			Visibility:       file.Visibility,
+			Slug:             file.Slug,
+			Version:          file.Version,
+			Created_at:       file.Created_at,
+			Updated_at:       file.Updated_at,
+			Deleted_at:       file.Deleted_at,
+		})
+		if written != nil {
+			written(i, file)
+		}
+	}
+
+	if account.Workspaces == nil {
+		account.Workspaces = []models.Member{}
+	}
+	metadata := []struct {
+		name  string
+		value any
+	}{
+		{"account.json", account},
+		{"notes.json", notes},
+	}
+	for _, file := range metadata {
+		content, err := json.MarshalIndent(file.value, "", "  ")
+		if err != nil {
+			return err
+		}
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(content); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// notePath returns a note's path in an account archive, with a markdown
+// extension. The trash may hold several notes of the same path, so later
+// ones have their id added.
+func notePath(file *models.File, taken map[string]bool) string {
+	root := "notes"
+	if file.Trashed() {
+		root = "trash"
+	}
+
+	name := file.File_name
+	ext := path.Ext(name)
+	if !strings.EqualFold(ext, ".md") && !strings.EqualFold(ext, ".markdown") {
+		name, ext = name+".md", ".md"
+	}
+
+	full := path.Join(root, file.Folder, name)
+	if taken[full] {
+		full = strings.TrimSuffix(full, ext) + "-" + file.File_id + ext
+	}
+	taken[full] = true
+
+	return full
+}
@@ -0,0 +1,304 @@
+package export
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go-markdown-parser/utils"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// run is a piece of inline text in one style
+type run struct {
+	text       string
+	bold       bool
+	italic     bool
+	code       bool
+	strike     bool
+	misspelled bool
+	// link is the destination of linked text
+	link string
+}
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	headingBlock
+	codeBlock
+	ruleBlock
+	tableBlock
+)
+
+// block is a unit of layout for the formats drawn from the syntax tree
+// rather than from HTML: a paragraph, heading, code block, rule or table
+type block struct {
+	kind blockKind
+	// level is a heading's level
+	level int
+	// id is a heading's anchor
+	id   string
+	runs []run
+	// code is a code block's text
+	code string
+	// depth is how many lists and definitions the block is nested in
+	depth int
+	// marker starts a list item's first block, like "•" or "3."
+	marker string
+	// quoted blocks are in a blockquote
+	quoted bool
+	// rows are the runs of a table's cells, the header row first
+	rows [][][]run
+}
+
+// heading is a table of contents entry
+type heading struct {
+	level int
+	id    string
+	text  string
+}
+
+// exportWordRegex matches the words spell checking marks, as in utils
+var exportWordRegex = regexp.MustCompile(`\b(\w+)\b`)
+
+// converter flattens a syntax tree into blocks
+type converter struct {
+	source     []byte
+	misspelled map[string][]string
+	hardWraps  bool
+	blocks     []block
+	depth      int
+	quoted     int
+	// marker waits for the next block, the first of a list item
+	marker string
+}
+
+// parseBlocks parses markdown into blocks
+func parseBlocks(source []byte, options Options) []block {
+	c := &converter{source: source, misspelled: options.Misspelled, hardWraps: options.Render.Hard_wraps}
+	c.walk(utils.ParseMarkdown(source, options.Render))
+
+	return c.blocks
+}
+
+// headings lists the headings of blocks, for a table of contents
+func headings(blocks []block) []heading {
+	var entries []heading
+	for _, b := range blocks {
+		if b.kind == headingBlock && b.id != "" {
+			entries = append(entries, heading{level: b.level, id: b.id, text: plainText(b.runs)})
+		}
+	}
+
+	return entries
+}
+
+// plainText joins the text of runs
+func plainText(runs []run) string {
+	var text strings.Builder
+	for _, r := range runs {
+		text.WriteString(r.text)
+	}
+
+	return text.String()
+}
+
+func (c *converter) add(b block) {
+	b.depth = c.depth
+	b.quoted = c.quoted > 0
+	b.marker = c.marker
+	c.marker = ""
+	c.blocks = append(c.blocks, b)
+}
+
+// walk adds the blocks of a node's children
+func (c *converter) walk(parent ast.Node) {
+	for node := parent.FirstChild(); node != nil; node = node.NextSibling() {
+		switch n := node.(type) {
+		case *ast.Heading:
+			b := block{kind: headingBlock, level: n.Level, runs: c.inlines(n, run{})}
+			if id, ok := n.AttributeString("id"); ok {
+				if value, ok := id.([]byte); ok {
+					b.id = string(value)
+				}
+			}
+			c.add(b)
+		case *ast.Paragraph, *ast.TextBlock:
+			c.add(block{kind: paragraphBlock, runs: c.inlines(n, run{})})
+		case *ast.FencedCodeBlock, *ast.CodeBlock, *utils.MathBlock, *utils.Mermaid:
+			c.add(block{kind: codeBlock, code: c.lines(n)})
+		case *ast.ThematicBreak:
+			c.add(block{kind: ruleBlock})
+		case *ast.Blockquote:
+			c.quoted++
+			c.walk(n)
+			c.quoted--
+		case *ast.List:
+			number := n.Start
+			for item := n.FirstChild(); item != nil; item = item.NextSibling() {
+				if n.IsOrdered() {
+					c.marker = strconv.Itoa(number) + "."
+					number++
+				} else {
+					c.marker = "•"
+				}
+				c.depth++
+				c.walk(item)
+				c.depth--
+			}
+		case *east.Table:
+			c.add(block{kind: tableBlock, rows: c.table(n)})
+		case *east.DefinitionTerm:
+			c.add(block{kind: paragraphBlock, runs: c.inlines(n, run{bold: true})})
+		case *east.DefinitionDescription:
+			c.depth++
+			c.walk(n)
+			c.depth--
+		case *east.FootnoteList:
+			c.add(block{kind: ruleBlock})
+			c.walk(n)
+		case *east.Footnote:
+			c.marker = strconv.Itoa(n.Index) + "."
+			c.depth++
+			c.walk(n)
+			c.depth--
+		case *ast.HTMLBlock:
+			// Raw HTML has no place outside HTML documents
+		default:
+			c.walk(n)
+		}
+	}
+}
+
+// lines joins the lines of a code, math or diagram block
+func (c *converter) lines(node ast.Node) string {
+	var text bytes.Buffer
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		text.Write(line.Value(c.source))
+	}
+
+	return strings.TrimRight(strings.ReplaceAll(text.String(), "\t", "    "), "\n")
+}
+
+// table returns the runs of a table's cells, row by row
+func (c *converter) table(table *east.Table) [][][]run {
+	var rows [][][]run
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		style := run{}
+		if _, ok := row.(*east.TableHeader); ok {
+			style.bold = true
+		}
+
+		var cells [][]run
+		for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+			cells = append(cells, c.inlines(cell, style))
+		}
+		rows = append(rows, cells)
+	}
+
+	return rows
+}
+
+// inlines returns the runs of a node's inline children, styled on top of
+// style
+func (c *converter) inlines(parent ast.Node, style run) []run {
+	var runs []run
+	for node := parent.FirstChild(); node != nil; node = node.NextSibling() {
+		switch n := node.(type) {
+		case *ast.Text:
+			runs = c.text(runs, style, string(n.Segment.Value(c.source)))
+			switch {
+			case n.HardLineBreak() || (n.SoftLineBreak() && c.hardWraps):
+				runs = append(runs, withText(style, "\n"))
+			case n.SoftLineBreak():
+				runs = append(runs, withText(style, " "))
+			}
+		case *ast.String:
+			runs = c.text(runs, style, string(n.Value))
+		case *ast.Emphasis:
+			emphasis := style
+			if n.Level >= 2 {
+				emphasis.bold = true
+			} else {
+				emphasis.italic = true
+			}
+			runs = append(runs, c.inlines(n, emphasis)...)
+		case *ast.CodeSpan:
+			code := style
+			code.code = true
+			runs = append(runs, c.inlines(n, code)...)
+		case *ast.Link:
+			link := style
+			link.link = string(n.Destination)
+			runs = append(runs, c.inlines(n, link)...)
+		case *ast.AutoLink:
+			link := style
+			link.link = string(n.URL(c.source))
+			runs = append(runs, withText(link, string(n.Label(c.source))))
+		case *ast.Image:
+			image := style
+			image.italic = true
+			runs = append(runs, c.inlines(n, image)...)
+		case *ast.RawHTML:
+		case *east.Strikethrough:
+			strike := style
+			strike.strike = true
+			runs = append(runs, c.inlines(n, strike)...)
+		case *east.TaskCheckBox:
+			if n.IsChecked {
+				runs = append(runs, withText(style, "[x] "))
+			} else {
+				runs = append(runs, withText(style, "[ ] "))
+			}
+		case *east.FootnoteLink:
+			runs = append(runs, withText(style, "["+strconv.Itoa(n.Index)+"]"))
+		case *east.FootnoteBacklink:
+		case *utils.Math:
+			math := style
+			math.code = true
+			runs = append(runs, withText(math, string(n.Value)))
+		default:
+			runs = append(runs, c.inlines(n, style)...)
+		}
+	}
+
+	return runs
+}
+
+// text adds text in a style, splitting out its misspelled words when
+// annotating. Code holds no prose.
+func (c *converter) text(runs []run, style run, text string) []run {
+	if len(c.misspelled) == 0 || style.code {
+		return append(runs, withText(style, text))
+	}
+
+	last := 0
+	for _, match := range exportWordRegex.FindAllStringIndex(text, -1) {
+		if _, ok := c.misspelled[text[match[0]:match[1]]]; !ok {
+			continue
+		}
+		if match[0] > last {
+			runs = append(runs, withText(style, text[last:match[0]]))
+		}
+		word := withText(style, text[match[0]:match[1]])
+		word.misspelled = true
+		runs = append(runs, word)
+		last = match[1]
+	}
+	if last < len(text) {
+		runs = append(runs, withText(style, text[last:]))
+	}
+
+	return runs
+}
+
+func withText(style run, text string) run {
+	style.text = text
+	return style
+}
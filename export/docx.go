@@ -0,0 +1,323 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// twipsPerMillimetre converts page sizes to Word's twentieths of a point
+const twipsPerMillimetre = 56.6929
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>
+`
+
+const docxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>
+`
+
+const docxCore = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title>%s</dc:title>
+</cp:coreProperties>
+`
+
+const docxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:docDefaults>
+<w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:cs="Calibri"/><w:sz w:val="22"/></w:rPr></w:rPrDefault>
+<w:pPrDefault><w:pPr><w:spacing w:after="160" w:line="276" w:lineRule="auto"/></w:pPr></w:pPrDefault>
+</w:docDefaults>
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>
+<w:style w:type="paragraph" w:styleId="Title"><w:name w:val="Title"/><w:basedOn w:val="Normal"/><w:rPr><w:b/><w:sz w:val="48"/></w:rPr></w:style>
+%s<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/><w:spacing w:after="160" w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="20"/></w:rPr></w:style>
+<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:pPr><w:pBdr><w:left w:val="single" w:sz="18" w:space="8" w:color="D1D9E0"/></w:pBdr></w:pPr><w:rPr><w:color w:val="59636E"/></w:rPr></w:style>
+<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0969DA"/><w:u w:val="single"/></w:rPr></w:style>
+</w:styles>
+`
+
+// docxHeadingSizes are the font sizes of Heading1 to Heading6, in half points
+var docxHeadingSizes = []int{36, 30, 26, 24, 22, 22}
+
+// docxWriter builds the body of a Word document and its hyperlinks
+type docxWriter struct {
+	body bytes.Buffer
+	// links are the targets of external hyperlinks, by relationship id
+	links []string
+	// bookmarks are the bookmark names of heading ids
+	bookmarks map[string]string
+	// bookmarkId numbers the bookmarks written
+	bookmarkId int
+}
+
+// exportDOCX writes the note as a Word document
+func exportDOCX(source []byte, options Options) ([]byte, error) {
+	blocks := parseBlocks(source, options)
+	w := &docxWriter{bookmarks: make(map[string]string)}
+	taken := make(map[string]bool)
+	for i, entry := range headings(blocks) {
+		name := bookmarkName(entry.id)
+		// Shortened names may clash
+		if taken[name] {
+			name = fmt.Sprintf("%s_%d", name[:min(len(name), 34)], i)
+		}
+		taken[name] = true
+		w.bookmarks[entry.id] = name
+	}
+
+	w.paragraph("Title", "", []run{{text: title(options)}})
+	if options.Toc {
+		w.toc(headings(blocks))
+	}
+	for _, b := range blocks {
+		w.block(b)
+	}
+
+	width := math.Round(options.Page_size.Width * twipsPerMillimetre)
+	height := math.Round(options.Page_size.Height * twipsPerMillimetre)
+	fmt.Fprintf(&w.body, `<w:sectPr><w:pgSz w:w="%.0f" w:h="%.0f"/><w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="720" w:footer="720" w:gutter="0"/></w:sectPr>`, width, height)
+
+	var document strings.Builder
+	document.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	document.WriteString(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body>`)
+	document.Write(w.body.Bytes())
+	document.WriteString("</w:body></w:document>\n")
+
+	var rels strings.Builder
+	rels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + "\n")
+	rels.WriteString(`<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` + "\n")
+	for i, link := range w.links {
+		fmt.Fprintf(&rels, `<Relationship Id="rIdLink%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"/>`+"\n", i+1, escapeXML(link))
+	}
+	rels.WriteString("</Relationships>\n")
+
+	var headingStyles strings.Builder
+	for level, size := range docxHeadingSizes {
+		fmt.Fprintf(&headingStyles, `<w:style w:type="paragraph" w:styleId="Heading%d"><w:name w:val="heading %d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="%d"/></w:pPr><w:rPr><w:b/><w:sz w:val="%d"/></w:rPr></w:style>`+"\n", level+1, level+1, level, size)
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxPackageRels},
+		{"docProps/core.xml", fmt.Sprintf(docxCore, escapeXML(title(options)))},
+		{"word/document.xml", document.String()},
+		{"word/styles.xml", fmt.Sprintf(docxStyles, headingStyles.String())},
+		{"word/_rels/document.xml.rels", rels.String()},
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write([]byte(file.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// toc lists the headings as links to their bookmarks
+func (w *docxWriter) toc(entries []heading) {
+	if len(entries) == 0 {
+		return
+	}
+
+	w.paragraph("Heading1", "", []run{{text: "Contents"}})
+	for _, entry := range entries {
+		fmt.Fprintf(&w.body, `<w:p><w:pPr><w:spacing w:after="40"/><w:ind w:left="%d"/></w:pPr>`, (entry.level-1)*360)
+		w.runs([]run{{text: entry.text, link: "#" + entry.id}})
+		w.body.WriteString("</w:p>")
+	}
+}
+
+func (w *docxWriter) block(b block) {
+	switch b.kind {
+	case headingBlock:
+		w.paragraph(fmt.Sprintf("Heading%d", min(b.level, len(docxHeadingSizes))), b.id, b.runs)
+	case paragraphBlock:
+		style := ""
+		if b.quoted {
+			style = "Quote"
+		}
+		w.paragraphIn(style, b, b.runs)
+	case codeBlock:
+		w.paragraphIn("Code", b, []run{{text: b.code, code: true}})
+	case ruleBlock:
+		w.body.WriteString(`<w:p><w:pPr><w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="D1D9E0"/></w:pBdr></w:pPr></w:p>`)
+	case tableBlock:
+		w.table(b.rows)
+	}
+}
+
+// paragraph writes a paragraph in a style, bookmarked as anchor if set
+func (w *docxWriter) paragraph(style string, anchor string, runs []run) {
+	w.body.WriteString("<w:p>")
+	if style != "" {
+		fmt.Fprintf(&w.body, `<w:pPr><w:pStyle w:val="%s"/></w:pPr>`, style)
+	}
+	if name, ok := w.bookmarks[anchor]; ok && anchor != "" {
+		w.bookmarkId++
+		fmt.Fprintf(&w.body, `<w:bookmarkStart w:id="%d" w:name="%s"/>`, w.bookmarkId, name)
+		w.runs(runs)
+		fmt.Fprintf(&w.body, `<w:bookmarkEnd w:id="%d"/>`, w.bookmarkId)
+	} else {
+		w.runs(runs)
+	}
+	w.body.WriteString("</w:p>")
+}
+
+// paragraphIn writes a paragraph indented for its lists, starting with its
+// list marker
+func (w *docxWriter) paragraphIn(style string, b block, runs []run) {
+	w.body.WriteString("<w:p><w:pPr>")
+	if style != "" {
+		fmt.Fprintf(&w.body, `<w:pStyle w:val="%s"/>`, style)
+	}
+	if b.depth > 0 {
+		fmt.Fprintf(&w.body, `<w:tabs><w:tab w:val="left" w:pos="%d"/></w:tabs><w:ind w:left="%d" w:hanging="360"/>`, b.depth*360, b.depth*360)
+	}
+	w.body.WriteString("</w:pPr>")
+	if b.marker != "" {
+		w.runs([]run{{text: b.marker + "\t"}})
+	}
+	w.runs(runs)
+	w.body.WriteString("</w:p>")
+}
+
+// table writes a table with borders, its header row repeated across pages
+func (w *docxWriter) table(rows [][][]run) {
+	w.body.WriteString(`<w:tbl><w:tblPr><w:tblW w:w="5000" w:type="pct"/><w:tblBorders>`)
+	for _, side := range []string{"top", "left", "bottom", "right", "insideH", "insideV"} {
+		fmt.Fprintf(&w.body, `<w:%s w:val="single" w:sz="4" w:space="0" w:color="D1D9E0"/>`, side)
+	}
+	w.body.WriteString(`</w:tblBorders></w:tblPr>`)
+
+	for i, row := range rows {
+		w.body.WriteString("<w:tr>")
+		if i == 0 {
+			w.body.WriteString("<w:trPr><w:tblHeader/></w:trPr>")
+		}
+		for _, cell := range row {
+			w.body.WriteString(`<w:tc><w:p><w:pPr><w:spacing w:after="0"/></w:pPr>`)
+			w.runs(cell)
+			w.body.WriteString("</w:p></w:tc>")
+		}
+		w.body.WriteString("</w:tr>")
+	}
+	w.body.WriteString("</w:tbl><w:p/>")
+}
+
+// runs writes styled runs, linking the linked ones: external links through
+// a relationship, links to headings to their bookmarks
+func (w *docxWriter) runs(runs []run) {
+	for _, r := range runs {
+		if r.link == "" {
+			w.run(r)
+			continue
+		}
+
+		if name, ok := w.bookmarks[strings.TrimPrefix(r.link, "#")]; ok && strings.HasPrefix(r.link, "#") {
+			fmt.Fprintf(&w.body, `<w:hyperlink w:anchor="%s">`, name)
+		} else {
+			w.links = append(w.links, r.link)
+			fmt.Fprintf(&w.body, `<w:hyperlink r:id="rIdLink%d">`, len(w.links))
+		}
+		w.run(r)
+		w.body.WriteString("</w:hyperlink>")
+	}
+}
+
+// run writes one run, with line breaks for its newlines
+func (w *docxWriter) run(r run) {
+	w.body.WriteString("<w:r><w:rPr>")
+	if r.link != "" {
+		w.body.WriteString(`<w:rStyle w:val="Hyperlink"/>`)
+	}
+	if r.code {
+		w.body.WriteString(`<w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/>`)
+	}
+	if r.bold {
+		w.body.WriteString("<w:b/>")
+	}
+	if r.italic {
+		w.body.WriteString("<w:i/>")
+	}
+	if r.strike {
+		w.body.WriteString("<w:strike/>")
+	}
+	if r.misspelled {
+		w.body.WriteString(`<w:u w:val="wave" w:color="D1242F"/>`)
+	}
+	w.body.WriteString("</w:rPr>")
+
+	for i, line := range strings.Split(r.text, "\n") {
+		if i > 0 {
+			w.body.WriteString("<w:br/>")
+		}
+		for j, part := range strings.Split(line, "\t") {
+			if j > 0 {
+				w.body.WriteString("<w:tab/>")
+			}
+			if part != "" {
+				fmt.Fprintf(&w.body, `<w:t xml:space="preserve">%s</w:t>`, escapeXML(part))
+			}
+		}
+	}
+	w.body.WriteString("</w:r>")
+}
+
+// bookmarkName turns a heading id into a Word bookmark name: letters,
+// digits and underscores, starting with a letter, at most 40 characters
+func bookmarkName(id string) string {
+	name := "h_" + strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return r
+		}
+		return '_'
+	}, id)
+
+	if len(name) > 40 {
+		name = name[:40]
+	}
+
+	return name
+}
+
+// escapeXML escapes text for XML content and attributes, leaving out the
+// characters XML can't hold
+func escapeXML(text string) string {
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(strings.Map(func(r rune) rune {
+		if r < ' ' && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, text)))
+
+	return escaped.String()
+}
@@ -0,0 +1,128 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+</rootfiles>
+</container>
+`
+
+const epubPackage = `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="id">%s</dc:identifier>
+<dc:title>%s</dc:title>
+<dc:language>en</dc:language>
+<meta property="dcterms:modified">%s</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="note" href="note.xhtml" media-type="application/xhtml+xml"/>
+</manifest>
+<spine>
+%s<itemref idref="note"/>
+</spine>
+</package>
+`
+
+const epubPage = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" xml:lang="en" lang="en">
+<head>
+<meta charset="utf-8"/>
+<title>%s</title>
+<style>
+pre { white-space: pre-wrap; }
+mark.misspelling { background: none; color: inherit; text-decoration: underline wavy #d1242f; }
+</style>
+</head>
+<body>
+%s</body>
+</html>
+`
+
+// exportEPUB packages the note as an EPUB 3 book of one chapter, with its
+// headings as the navigation document
+func exportEPUB(source []byte, options Options) ([]byte, error) {
+	body, err := renderBody(source, options)
+	if err != nil {
+		return nil, err
+	}
+
+	name := html.EscapeString(title(options))
+	updated := options.Updated_at
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	// The navigation document lists the headings, or just the note
+	nav := "<li><a href=\"note.xhtml\">" + name + "</a></li>\n"
+	if entries := headings(parseBlocks(source, options)); len(entries) > 0 {
+		nav = ""
+		for _, entry := range entries {
+			nav += "<li><a href=\"note.xhtml#" + html.EscapeString(entry.id) + "\">" + html.EscapeString(entry.text) + "</a></li>\n"
+		}
+	}
+	navPage := "<nav epub:type=\"toc\" id=\"toc\">\n<h1>Contents</h1>\n<ol>\n" + nav + "</ol>\n</nav>\n"
+
+	// The navigation document is only read in order for a table of contents
+	spine := ""
+	if options.Toc {
+		spine = "<itemref idref=\"nav\"/>\n"
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"META-INF/container.xml", epubContainer},
+		{"OEBPS/content.opf", fmt.Sprintf(epubPackage, html.EscapeString("urn:note:"+options.Id), name, updated.UTC().Format("2006-01-02T15:04:05Z"), spine)},
+		{"OEBPS/nav.xhtml", fmt.Sprintf(epubPage, name, navPage)},
+		{"OEBPS/note.xhtml", fmt.Sprintf(epubPage, name, xhtml(body))},
+	}
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	// The mimetype comes first, uncompressed, so readers can sniff it
+	mimetype, err := archive.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := mimetype.Write([]byte("application/epub+zip")); err != nil {
+		return nil, err
+	}
+
+	for _, file := range files {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write([]byte(file.content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// xhtml adapts rendered HTML to XHTML. The renderer already closes void
+// elements and quotes attributes; the one named entity it writes isn't
+// known to XML.
+func xhtml(html string) string {
+	return strings.ReplaceAll(html, "&nbsp;", "&#160;")
+}
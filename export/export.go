@@ -0,0 +1,128 @@
+// Package export turns a note's markdown into standalone documents: HTML,
+// PDF, DOCX and EPUB, generated in pure Go from the goldmark syntax tree.
+// It also packages a whole account's notes and metadata as a zip.
+package export
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/utils"
+)
+
+// Export formats
+const (
+	FormatHTML = "html"
+	FormatPDF  = "pdf"
+	FormatDOCX = "docx"
+	FormatEPUB = "epub"
+)
+
+// Formats lists the export formats
+func Formats() []string {
+	return []string{FormatHTML, FormatPDF, FormatDOCX, FormatEPUB}
+}
+
+// PageSize is a page's size in millimetres, for PDF and DOCX
+type PageSize struct {
+	Name   string
+	Width  float64
+	Height float64
+}
+
+var pageSizes = map[string]PageSize{
+	"a4":     {Name: "A4", Width: 210, Height: 297},
+	"a5":     {Name: "A5", Width: 148, Height: 210},
+	"letter": {Name: "Letter", Width: 215.9, Height: 279.4},
+	"legal":  {Name: "Legal", Width: 215.9, Height: 355.6},
+}
+
+// DefaultPageSize is used when none is asked for
+var DefaultPageSize = pageSizes["a4"]
+
+// ParsePageSize looks a page size up by name: A4, A5, Letter or Legal
+func ParsePageSize(name string) (PageSize, error) {
+	if name == "" {
+		return DefaultPageSize, nil
+	}
+
+	size, ok := pageSizes[strings.ToLower(name)]
+	if !ok {
+		return size, fmt.Errorf("unknown page size %q", name)
+	}
+
+	return size, nil
+}
+
+// Options control an export
+type Options struct {
+	// Format is one of the Format constants
+	Format string
+	// Id identifies the note, for EPUB
+	Id    string
+	Title string
+	// Updated_at is when the note last changed, for EPUB
+	Updated_at time.Time
+	// Toc starts the document with a table of contents of its headings
+	Toc bool
+	// Page_size is used by PDF and DOCX, DefaultPageSize when unset
+	Page_size PageSize
+	// Render are the markdown extensions to parse with
+	Render models.RenderOptions
+	// Policy sanitizes the HTML of HTML and EPUB exports
+	Policy *utils.SanitizePolicy
+	// Misspelled, when set, are annotated with their suggestions
+	Misspelled map[string][]string
+}
+
+// Output is an exported document
+type Output struct {
+	Content      []byte
+	Content_type string
+	// Extension is the file name extension, with its dot
+	Extension string
+}
+
+// Export converts markdown to a document in the format the options ask for
+func Export(source []byte, options Options) (*Output, error) {
+	if options.Page_size.Name == "" {
+		options.Page_size = DefaultPageSize
+	}
+	if options.Policy == nil {
+		options.Policy = utils.DefaultSanitizePolicy()
+	}
+	// Tables of contents link to the headings' ids
+	if options.Toc {
+		options.Render.Heading_ids = true
+	}
+
+	var content []byte
+	var err error
+	output := &Output{}
+
+	switch options.Format {
+	case FormatHTML:
+		content, err = exportHTML(source, options)
+		output.Content_type, output.Extension = "text/html; charset=utf-8", ".html"
+	case FormatPDF:
+		content, err = exportPDF(source, options)
+		output.Content_type, output.Extension = "application/pdf", ".pdf"
+	case FormatDOCX:
+		content, err = exportDOCX(source, options)
+		output.Content_type, output.Extension = "application/vnd.openxmlformats-officedocument.wordprocessingml.document", ".docx"
+	case FormatEPUB:
+		content, err = exportEPUB(source, options)
+		output.Content_type, output.Extension = "application/epub+zip", ".epub"
+	default:
+		return nil, fmt.Errorf("unknown export format %q", options.Format)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	output.Content = content
+
+	return output, nil
+}
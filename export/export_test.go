@@ -0,0 +1,175 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/utils"
+)
+
+const note = "# Trip notes\n\nWe went to the *seaside* and sume **rocks**.\n\n## Packing\n\n- towels\n- [sun cream](https://example.com)\n\n| Item | Count |\n|------|------:|\n| hat  | 2     |\n\n```go\nfunc main() {}\n```\n\n> Quoted, with $x^2$ math.\n"
+
+// unzip reads the files of an archive
+func unzip(t *testing.T, content []byte) (map[string]string, []string) {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("Error opening archive: %v", err)
+	}
+
+	files := make(map[string]string)
+	var names []string
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			t.Fatalf("Error opening %s: %v", file.Name, err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		files[file.Name] = string(data)
+		names = append(names, file.Name)
+	}
+
+	return files, names
+}
+
+// wellFormed checks that a part parses as XML
+func wellFormed(t *testing.T, name string, content string) {
+	t.Helper()
+
+	decoder := xml.NewDecoder(strings.NewReader(content))
+	decoder.Strict = true
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			return
+		} else if err != nil {
+			t.Fatalf("%s isn't well-formed XML: %v\n%s", name, err, content)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	options := Options{
+		Id:         "note-1",
+		Title:      "Trip",
+		Toc:        true,
+		Render:     utils.AllRenderOptions(),
+		Misspelled: map[string][]string{"sume": {"sum", "some"}},
+	}
+
+	options.Format = FormatHTML
+	output, err := Export([]byte(note), options)
+	if err != nil {
+		t.Fatalf("Error exporting HTML: %v", err)
+	}
+	html := string(output.Content)
+	for _, want := range []string{"<!DOCTYPE html>", `<a href="#packing">Packing</a>`, `data-word="sume"`, "<table>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected %q in the HTML export:\n%s", want, html)
+		}
+	}
+
+	options.Format = FormatPDF
+	options.Page_size, _ = ParsePageSize("letter")
+	output, err = Export([]byte(note), options)
+	if err != nil {
+		t.Fatalf("Error exporting PDF: %v", err)
+	}
+	if !bytes.HasPrefix(output.Content, []byte("%PDF-")) || output.Content_type != "application/pdf" {
+		t.Errorf("Expected a PDF, got %q", output.Content[:min(len(output.Content), 16)])
+	}
+
+	options.Format = FormatDOCX
+	output, err = Export([]byte(note), options)
+	if err != nil {
+		t.Fatalf("Error exporting DOCX: %v", err)
+	}
+	files, _ := unzip(t, output.Content)
+	for _, name := range []string{"[Content_Types].xml", "word/document.xml", "word/styles.xml", "word/_rels/document.xml.rels"} {
+		wellFormed(t, name, files[name])
+	}
+	document := files["word/document.xml"]
+	for _, want := range []string{`<w:pStyle w:val="Heading2"/>`, `w:anchor="h_packing"`, `<w:u w:val="wave"`, "<w:tbl>", `w:w="12240"`} {
+		if !strings.Contains(document, want) {
+			t.Errorf("Expected %q in the DOCX document:\n%s", want, document)
+		}
+	}
+
+	options.Format = FormatEPUB
+	options.Misspelled = nil
+	output, err = Export([]byte(note), options)
+	if err != nil {
+		t.Fatalf("Error exporting EPUB: %v", err)
+	}
+	files, names := unzip(t, output.Content)
+	if names[0] != "mimetype" || files["mimetype"] != "application/epub+zip" {
+		t.Errorf("Expected the mimetype first, got %v", names)
+	}
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/note.xhtml"} {
+		wellFormed(t, name, files[name])
+	}
+	if strings.Contains(files["OEBPS/note.xhtml"], "data-word") {
+		t.Error("Expected no annotations when not asked for")
+	}
+
+	if _, err := Export([]byte(note), Options{Format: "odt"}); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestAccountArchive(t *testing.T) {
+	trashed := time.Now()
+	files := []models.File{
+		{File_id: "a", File_name: "plan.md", Folder: "work", File_content: "# Plan"},
+		{File_id: "b", File_name: "ideas", File_content: "ideas"},
+		{File_id: "c", File_name: "old.md", File_content: "first", Deleted_at: &trashed},
+		{File_id: "d", File_name: "old.md", File_content: "second", Deleted_at: &trashed},
+	}
+
+	written := 0
+	var buffer bytes.Buffer
+	err := AccountArchive(&buffer, Account{User_id: "u1", Email: "me@example.com"}, files, func(int, *models.File) { written++ })
+	if err != nil {
+		t.Fatalf("Error building archive: %v", err)
+	}
+	if written != len(files) {
+		t.Errorf("Expected progress for %d notes, got %d", len(files), written)
+	}
+
+	archive, _ := unzip(t, buffer.Bytes())
+	want := map[string]string{
+		"notes/work/plan.md": "# Plan",
+		"notes/ideas.md":     "ideas",
+		"trash/old.md":       "first",
+		"trash/old-d.md":     "second",
+	}
+	for name, content := range want {
+		if archive[name] != content {
+			t.Errorf("Expected %s to hold %q, got %q", name, content, archive[name])
+		}
+	}
+
+	var notes []NoteMetadata
+	if err := json.Unmarshal([]byte(archive["notes.json"]), &notes); err != nil {
+		t.Fatalf("Error reading notes.json: %v", err)
+	}
+	if len(notes) != len(files) || notes[3].Path != "trash/old-d.md" || notes[3].Deleted_at == nil {
+		t.Errorf("Unexpected note metadata: %+v", notes)
+	}
+
+	var account Account
+	if err := json.Unmarshal([]byte(archive["account.json"]), &account); err != nil {
+		t.Fatalf("Error reading account.json: %v", err)
+	}
+	if account.Email != "me@example.com" || strings.Contains(archive["account.json"], "password") {
+		t.Errorf("Unexpected account metadata: %s", archive["account.json"])
+	}
+}
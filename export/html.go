@@ -0,0 +1,72 @@
+package export
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"go-markdown-parser/utils"
+)
+
+// renderBody renders the note's sanitized HTML, annotating its misspelled
+// words when asked to
+func renderBody(source []byte, options Options) (string, error) {
+	body, err := utils.RenderMarkdown(source, options.Render, options.Policy)
+	if err != nil {
+		return "", err
+	}
+	if options.Misspelled == nil {
+		return body, nil
+	}
+
+	return utils.ProcessHTML(body, options.Misspelled)
+}
+
+// tocHTML lists the headings as links, indented by level
+func tocHTML(entries []heading) string {
+	if len(entries) == 0 {
+		return ""
+	}
+
+	top := entries[0].level
+	for _, entry := range entries {
+		top = min(top, entry.level)
+	}
+
+	var toc strings.Builder
+	toc.WriteString("<nav class=\"toc\">\n<h2>Contents</h2>\n<ul>\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&toc, "<li style=\"margin-left: %dem\"><a href=\"#%s\">%s</a></li>\n",
+			(entry.level-top)*2, html.EscapeString(entry.id), html.EscapeString(entry.text))
+	}
+	toc.WriteString("</ul>\n</nav>\n")
+
+	return toc.String()
+}
+
+// exportHTML renders the note as a page with the default document theme
+func exportHTML(source []byte, options Options) ([]byte, error) {
+	body, err := renderBody(source, options)
+	if err != nil {
+		return nil, err
+	}
+	if options.Toc {
+		body = tocHTML(headings(parseBlocks(source, options))) + body
+	}
+
+	page, err := utils.RenderDocument(utils.DefaultDocumentTheme, title(options), body)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(page), nil
+}
+
+// title is the document's title, which can't be empty
+func title(options Options) string {
+	if strings.TrimSpace(options.Title) == "" {
+		return "Untitled"
+	}
+
+	return options.Title
+}
@@ -0,0 +1,293 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/gobolditalic"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// PDF layout, in millimetres and points
+const (
+	pdfMargin     = 20.0
+	pdfIndent     = 6.0
+	pdfFontSize   = 11.0
+	pdfCodeSize   = 9.0
+	pdfLineHeight = 5.5
+	pdfCodeHeight = 4.5
+)
+
+// pdfHeadingSizes are the font sizes of headings by level, in points
+var pdfHeadingSizes = []float64{20, 16, 14, 12, 11, 11}
+
+// pdfWriter lays blocks out on PDF pages
+type pdfWriter struct {
+	pdf *fpdf.Fpdf
+	// links are the internal links to headings, by id
+	links map[string]int
+	// outline is the level of the last heading bookmarked
+	outline int
+}
+
+// exportPDF lays the note out as a PDF, with the Go fonts embedded so any
+// text they cover prints
+func exportPDF(source []byte, options Options) ([]byte, error) {
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		UnitStr: "mm",
+		Size:    fpdf.SizeType{Wd: options.Page_size.Width, Ht: options.Page_size.Height},
+	})
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin)
+	pdf.SetTitle(title(options), true)
+
+	fonts := []struct {
+		family string
+		style  string
+		ttf    []byte
+	}{
+		{"sans", "", goregular.TTF}, {"sans", "B", gobold.TTF},
+		{"sans", "I", goitalic.TTF}, {"sans", "BI", gobolditalic.TTF},
+		{"mono", "", gomono.TTF}, {"mono", "B", gomonobold.TTF},
+		{"mono", "I", gomonoitalic.TTF}, {"mono", "BI", gomonobolditalic.TTF},
+	}
+	for _, font := range fonts {
+		pdf.AddUTF8FontFromBytes(font.family, font.style, font.ttf)
+	}
+
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin + 5)
+		pdf.SetFont("sans", "", 8)
+		pdf.SetTextColor(110, 118, 129)
+		pdf.CellFormat(0, 5, fmt.Sprint(pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AddPage()
+
+	blocks := parseBlocks(source, options)
+	w := &pdfWriter{pdf: pdf, links: make(map[string]int)}
+	for _, entry := range headings(blocks) {
+		w.links[entry.id] = pdf.AddLink()
+	}
+
+	w.setFont(run{bold: true}, 24)
+	pdf.MultiCell(0, 10, pdfText(title(options)), "", "L", false)
+	pdf.Ln(4)
+
+	if options.Toc {
+		w.toc(headings(blocks))
+	}
+	for _, b := range blocks {
+		w.block(b)
+	}
+
+	var buffer bytes.Buffer
+	if err := pdf.Output(&buffer); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// toc lists the headings as links to them, indented by level
+func (w *pdfWriter) toc(entries []heading) {
+	if len(entries) == 0 {
+		return
+	}
+
+	top := entries[0].level
+	for _, entry := range entries {
+		top = min(top, entry.level)
+	}
+
+	w.setFont(run{bold: true}, pdfHeadingSizes[1])
+	w.pdf.Write(8, "Contents")
+	w.pdf.Ln(10)
+
+	for _, entry := range entries {
+		w.pdf.SetLeftMargin(pdfMargin + float64(entry.level-top)*pdfIndent)
+		w.pdf.SetX(pdfMargin + float64(entry.level-top)*pdfIndent)
+		w.setFont(run{link: "#"}, pdfFontSize)
+		w.pdf.WriteLinkID(pdfLineHeight, pdfText(entry.text), w.links[entry.id])
+		w.pdf.Ln(pdfLineHeight + 1)
+	}
+	w.pdf.SetLeftMargin(pdfMargin)
+	w.pdf.Ln(6)
+}
+
+func (w *pdfWriter) block(b block) {
+	left := pdfMargin + float64(b.depth)*pdfIndent
+	if b.quoted {
+		left += pdfIndent
+	}
+	w.pdf.SetLeftMargin(left)
+	w.pdf.SetX(left)
+	defer w.pdf.SetLeftMargin(pdfMargin)
+
+	pageWidth, pageHeight := w.pdf.GetPageSize()
+	width := pageWidth - pdfMargin - left
+	startPage, startY := w.pdf.PageNo(), w.pdf.GetY()
+
+	switch b.kind {
+	case headingBlock:
+		size := pdfHeadingSizes[min(b.level, len(pdfHeadingSizes))-1]
+		// Keep headings with what follows them
+		if startY+3*pdfLineHeight > pageHeight-pdfMargin {
+			w.pdf.AddPage()
+		}
+		w.pdf.Ln(2)
+		if link, ok := w.links[b.id]; ok {
+			w.pdf.SetLink(link, w.pdf.GetY(), -1)
+		}
+		level := min(b.level-1, w.outline+1)
+		w.pdf.Bookmark(pdfText(plainText(b.runs)), level, -1)
+		w.outline = level
+		w.runs(b.runs, size*0.5, run{bold: true}, size)
+		w.pdf.Ln(size*0.5 + 2)
+	case paragraphBlock:
+		if b.marker != "" {
+			w.setFont(run{}, pdfFontSize)
+			w.pdf.SetX(left - pdfIndent + 1)
+			w.pdf.Write(pdfLineHeight, b.marker)
+			w.pdf.SetX(left)
+		}
+		w.runs(b.runs, pdfLineHeight, run{}, pdfFontSize)
+		w.pdf.Ln(pdfLineHeight + 2)
+	case codeBlock:
+		w.setFont(run{code: true}, pdfCodeSize)
+		w.pdf.SetFillColor(246, 248, 250)
+		w.pdf.MultiCell(width, pdfCodeHeight, pdfText(b.code), "", "L", true)
+		w.pdf.Ln(3)
+	case ruleBlock:
+		w.pdf.SetDrawColor(209, 217, 224)
+		w.pdf.Line(left, startY+2, pageWidth-pdfMargin, startY+2)
+		w.pdf.Ln(5)
+	case tableBlock:
+		w.table(b.rows, left, width)
+	}
+
+	// Quotes are marked by a bar down their left
+	if b.quoted && w.pdf.PageNo() == startPage {
+		w.pdf.SetDrawColor(209, 217, 224)
+		w.pdf.SetLineWidth(0.8)
+		w.pdf.Line(left-pdfIndent/2, startY, left-pdfIndent/2, w.pdf.GetY()-2)
+		w.pdf.SetLineWidth(0.2)
+	}
+}
+
+// table draws a table with columns of equal width, breaking pages between
+// rows
+func (w *pdfWriter) table(rows [][][]run, left float64, width float64) {
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return
+	}
+	columnWidth := width / float64(columns)
+	_, pageHeight := w.pdf.GetPageSize()
+	w.pdf.SetDrawColor(209, 217, 224)
+
+	for i, row := range rows {
+		style := run{bold: i == 0}
+		w.setFont(style, pdfFontSize)
+
+		lines := 1
+		for _, cell := range row {
+			lines = max(lines, len(w.pdf.SplitText(pdfText(plainText(cell)), columnWidth)))
+		}
+		height := float64(lines)*pdfLineHeight + 2
+
+		if w.pdf.GetY()+height > pageHeight-pdfMargin {
+			w.pdf.AddPage()
+		}
+		y := w.pdf.GetY()
+
+		for j := 0; j < columns; j++ {
+			x := left + float64(j)*columnWidth
+			w.pdf.Rect(x, y, columnWidth, height, "D")
+			if j < len(row) {
+				w.pdf.SetXY(x, y+1)
+				w.pdf.MultiCell(columnWidth, pdfLineHeight, pdfText(plainText(row[j])), "", "L", false)
+			}
+		}
+		w.pdf.SetXY(left, y+height)
+	}
+	w.pdf.Ln(4)
+}
+
+// runs writes styled runs as flowing text, styled on top of base
+func (w *pdfWriter) runs(runs []run, height float64, base run, size float64) {
+	for _, r := range runs {
+		r.bold = r.bold || base.bold
+		r.italic = r.italic || base.italic
+		w.setFont(r, size)
+
+		text := pdfText(r.text)
+		link, internal := w.links[strings.TrimPrefix(r.link, "#")]
+		switch {
+		case internal && strings.HasPrefix(r.link, "#"):
+			w.pdf.WriteLinkID(height, text, link)
+		case r.link != "":
+			w.pdf.WriteLinkString(height, text, r.link)
+		default:
+			w.pdf.Write(height, text)
+		}
+	}
+	w.pdf.SetTextColor(31, 35, 40)
+}
+
+// setFont switches to a run's font and colour
+func (w *pdfWriter) setFont(r run, size float64) {
+	family := "sans"
+	if r.code {
+		family = "mono"
+		size *= 0.9
+	}
+
+	style := ""
+	if r.bold {
+		style += "B"
+	}
+	if r.italic {
+		style += "I"
+	}
+	if r.link != "" || r.misspelled {
+		style += "U"
+	}
+	if r.strike {
+		style += "S"
+	}
+	w.pdf.SetFont(family, style, size)
+
+	switch {
+	case r.misspelled:
+		w.pdf.SetTextColor(209, 36, 47)
+	case r.link != "":
+		w.pdf.SetTextColor(9, 105, 218)
+	default:
+		w.pdf.SetTextColor(31, 35, 40)
+	}
+}
+
+// pdfText replaces the characters the embedded fonts can't be indexed by,
+// those outside the Basic Multilingual Plane, and tabs
+func pdfText(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t':
+			return ' '
+		case r > 0xFFFF:
+			return '?'
+		}
+		return r
+	}, text)
+}
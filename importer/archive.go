@@ -0,0 +1,207 @@
+// Package importer reads archives and directory uploads of notes for bulk
+// import, keeping their folder structure and checking the relative image
+// links between their files.
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"go-markdown-parser/convert"
+)
+
+// Limits bound what an import reads, so a small archive can't expand into
+// more than the server is willing to hold
+type Limits struct {
+	// Max_files is the most files, of any kind, an import may hold
+	Max_files int
+	// Max_note_size is the largest note imported, in bytes
+	Max_note_size int64
+	// Max_total_size is the most uncompressed bytes read, in bytes
+	Max_total_size int64
+}
+
+// DefaultLimits are the limits of imports through the API
+var DefaultLimits = Limits{
+	Max_files:      1000,
+	Max_note_size:  2 << 20,
+	Max_total_size: 64 << 20,
+}
+
+// ErrUnsupportedArchive is returned for archives that are neither zip nor
+// tar, optionally gzipped
+var ErrUnsupportedArchive = errors.New("unsupported archive, expected zip, tar or tar.gz")
+
+// Entry is a file of an import. Path is slash separated and relative to the
+// archive's root. Content is only kept for notes; other files, like images,
+// are listed so links to them can be checked.
+type Entry struct {
+	Path    string
+	Content []byte
+	// Too_large is set for notes over Max_note_size, whose content isn't
+	// read
+	Too_large bool
+}
+
+// IsNote reports whether a file is a note: markdown, or a format converted
+// to markdown, like HTML or reStructuredText
+func IsNote(name string) bool {
+	return convert.Detect(name, "") != ""
+}
+
+// Reader collects the entries of an import within its limits
+type Reader struct {
+	limits  Limits
+	total   int64
+	entries []Entry
+}
+
+// NewReader returns a reader enforcing the limits
+func NewReader(limits Limits) *Reader {
+	return &Reader{limits: limits}
+}
+
+// Entries returns the files read so far
+func (r *Reader) Entries() []Entry {
+	return r.entries
+}
+
+// Add reads one file at the given path. Hidden files and folders, such as
+// .git or the __MACOSX folders of archives made on macOS, are ignored.
+func (r *Reader) Add(name string, content io.Reader) error {
+	name = cleanPath(name)
+	if name == "" || ignored(name) {
+		return nil
+	}
+
+	if len(r.entries) >= r.limits.Max_files {
+		return fmt.Errorf("import holds more than %d files", r.limits.Max_files)
+	}
+
+	entry := Entry{Path: name}
+	if IsNote(name) {
+		data, err := io.ReadAll(io.LimitReader(content, r.limits.Max_note_size+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) > r.limits.Max_note_size {
+			entry.Too_large = true
+			data = nil
+		}
+		entry.Content = data
+		r.total += int64(len(data))
+	} else {
+		// Only the size of other files matters
+		n, err := io.Copy(io.Discard, io.LimitReader(content, r.limits.Max_total_size-r.total+1))
+		if err != nil {
+			return err
+		}
+		r.total += n
+	}
+
+	if r.total > r.limits.Max_total_size {
+		return fmt.Errorf("import is larger than %d bytes uncompressed", r.limits.Max_total_size)
+	}
+	r.entries = append(r.entries, entry)
+
+	return nil
+}
+
+// AddArchive reads every file of a zip, tar or gzipped tar archive
+func (r *Reader) AddArchive(archive io.ReaderAt, size int64) error {
+	var magic [4]byte
+	n, _ := archive.ReadAt(magic[:], 0)
+
+	switch {
+	case n == 4 && string(magic[:]) == "PK\x03\x04", n == 4 && string(magic[:]) == "PK\x05\x06":
+		return r.addZip(archive, size)
+	case n >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(io.NewSectionReader(archive, 0, size))
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		return r.addTar(gz)
+	case isTar(archive):
+		return r.addTar(io.NewSectionReader(archive, 0, size))
+	}
+
+	return ErrUnsupportedArchive
+}
+
+func (r *Reader) addZip(archive io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zr.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+
+		content, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = r.Add(file.Name, content)
+		content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Reader) addTar(archive io.Reader) error {
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := r.Add(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// isTar reports whether the archive has the magic of a POSIX or GNU tar
+// header
+func isTar(archive io.ReaderAt) bool {
+	var magic [5]byte
+	n, _ := archive.ReadAt(magic[:], 257)
+	return n == len(magic) && bytes.Equal(magic[:], []byte("ustar"))
+}
+
+// cleanPath makes an archive path slash separated and relative to the
+// root. Cleaning it as an absolute path stops ".." segments escaping the
+// root.
+func cleanPath(name string) string {
+	name = strings.ReplaceAll(name, `\`, "/")
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func ignored(name string) bool {
+	for _, segment := range strings.Split(name, "/") {
+		if strings.HasPrefix(segment, ".") || segment == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,126 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var archiveFiles = []struct {
+	name    string
+	content string
+}{
+	{"notes/trip.md", "# Trip\n\n![beach](images/beach.png) ![map](../map.png) <img src=\"gone.jpg\">\n"},
+	{"notes/images/beach.png", "png"},
+	{"readme.markdown", "[home](https://example.com) ![logo](https://example.com/logo.png)\n"},
+	{"__MACOSX/notes/._trip.md", "resource fork"},
+	{"notes/.DS_Store", "finder"},
+	{"../escape.md", "outside"},
+}
+
+func zipArchive(t *testing.T) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, file := range archiveFiles {
+		writer, err := archive.Create(file.name)
+		if err != nil {
+			t.Fatalf("Error creating %s: %v", file.name, err)
+		}
+		writer.Write([]byte(file.content))
+	}
+	archive.Close()
+
+	return buffer.Bytes()
+}
+
+func tarGzArchive(t *testing.T) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(gz)
+	archive.WriteHeader(&tar.Header{Name: "notes/", Typeflag: tar.TypeDir, Mode: 0o755})
+	for _, file := range archiveFiles {
+		header := &tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(file.content))}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatalf("Error adding %s: %v", file.name, err)
+		}
+		archive.Write([]byte(file.content))
+	}
+	archive.Close()
+	gz.Close()
+
+	return buffer.Bytes()
+}
+
+func TestAddArchive(t *testing.T) {
+	want := []string{"notes/trip.md", "notes/images/beach.png", "readme.markdown", "escape.md"}
+
+	for name, content := range map[string][]byte{"zip": zipArchive(t), "tar.gz": tarGzArchive(t)} {
+		reader := NewReader(DefaultLimits)
+		if err := reader.AddArchive(bytes.NewReader(content), int64(len(content))); err != nil {
+			t.Fatalf("%s: error reading archive: %v", name, err)
+		}
+
+		var paths []string
+		for _, entry := range reader.Entries() {
+			paths = append(paths, entry.Path)
+			if !IsNote(entry.Path) && entry.Content != nil {
+				t.Errorf("%s: kept the content of %s", name, entry.Path)
+			}
+		}
+		if !reflect.DeepEqual(paths, want) {
+			t.Errorf("%s: got paths %q, want %q", name, paths, want)
+		}
+	}
+
+	reader := NewReader(DefaultLimits)
+	if err := reader.AddArchive(strings.NewReader("plain text"), 10); err != ErrUnsupportedArchive {
+		t.Errorf("Expected ErrUnsupportedArchive, got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	reader := NewReader(Limits{Max_files: 2, Max_note_size: 4, Max_total_size: 10})
+
+	if err := reader.Add("big.md", strings.NewReader("too long")); err != nil {
+		t.Fatalf("Error adding a large note: %v", err)
+	}
+	if entry := reader.Entries()[0]; !entry.Too_large || entry.Content != nil {
+		t.Errorf("Expected a large note to be flagged without content, got %+v", entry)
+	}
+
+	if err := reader.Add("image.png", strings.NewReader("more than ten bytes")); err == nil {
+		t.Error("Expected the total size limit to be enforced")
+	}
+
+	reader = NewReader(Limits{Max_files: 1, Max_note_size: 4, Max_total_size: 10})
+	reader.Add("a.md", strings.NewReader("a"))
+	if err := reader.Add("b.md", strings.NewReader("b")); err == nil {
+		t.Error("Expected the file count limit to be enforced")
+	}
+}
+
+func TestMissingImages(t *testing.T) {
+	files := map[string]bool{"notes/trip.md": true, "notes/images/beach.png": true}
+	source := []byte(archiveFiles[0].content)
+
+	missing := MissingImages("notes/trip.md", source, files)
+	if want := []string{"../map.png", "gone.jpg"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("Got missing images %q, want %q", missing, want)
+	}
+
+	if missing := MissingImages("readme.markdown", []byte(archiveFiles[2].content), files); len(missing) != 0 {
+		t.Errorf("Expected URLs to be ignored, got %q", missing)
+	}
+
+	if _, ok := ResolveLink("trip.md", "../../outside.png"); ok {
+		t.Error("Expected links leaving the root not to resolve")
+	}
+}
@@ -0,0 +1,92 @@
+package importer
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/utils"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// imgSource finds the sources of images written as raw HTML
+var imgSource = regexp.MustCompile(`(?i)<img\s[^>]*?src\s*=\s*["']([^"']+)["']`)
+
+// ImageLinks returns the destinations of a note's images, both markdown
+// images and raw HTML img elements, in order of appearance
+func ImageLinks(source []byte) []string {
+	var links []string
+	doc := utils.ParseMarkdown(source, models.RenderOptions{Gfm: true})
+
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *ast.Image:
+			links = append(links, string(node.Destination))
+		case *ast.RawHTML:
+			var raw strings.Builder
+			for i := 0; i < node.Segments.Len(); i++ {
+				segment := node.Segments.At(i)
+				raw.Write(segment.Value(source))
+			}
+			links = append(links, htmlImages(raw.String())...)
+		case *ast.HTMLBlock:
+			var raw strings.Builder
+			for i := 0; i < node.Lines().Len(); i++ {
+				line := node.Lines().At(i)
+				raw.Write(line.Value(source))
+			}
+			links = append(links, htmlImages(raw.String())...)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return links
+}
+
+func htmlImages(raw string) []string {
+	var links []string
+	for _, match := range imgSource.FindAllStringSubmatch(raw, -1) {
+		links = append(links, match[1])
+	}
+	return links
+}
+
+// ResolveLink resolves a link in the note at notePath to the path of the
+// file it points to within the import. It reports false for links that
+// aren't relative paths, like URLs and absolute paths, and for links
+// leaving the import's root.
+func ResolveLink(notePath string, link string) (string, bool) {
+	link = strings.TrimSpace(link)
+	parsed, err := url.Parse(link)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" || parsed.Path == "" || strings.HasPrefix(parsed.Path, "/") {
+		return "", false
+	}
+
+	resolved := path.Join(path.Dir(notePath), parsed.Path)
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", false
+	}
+
+	return resolved, true
+}
+
+// MissingImages returns the relative image links of a note whose targets
+// aren't among the files. Links are kept verbatim in the imported note, so
+// they work again once the images sit next to it.
+func MissingImages(notePath string, source []byte, files map[string]bool) []string {
+	missing := []string{}
+	for _, link := range ImageLinks(source) {
+		target, ok := ResolveLink(notePath, link)
+		if ok && !files[target] {
+			missing = append(missing, link)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,275 @@
+// Package jobs runs long tasks, like bulk imports and account exports, in
+// the background and keeps their per-item progress in memory, and the files
+// they produce on disk, for clients to poll.
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job statuses
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+)
+
+// Item statuses
+const (
+	ItemPending = "pending"
+	ItemDone    = "done"
+	ItemSkipped = "skipped"
+	ItemFailed  = "failed"
+)
+
+// Item is one unit of a job's work, such as a file of an import
+type Item struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Result any    `json:"result,omitempty"`
+}
+
+// Artifact is a file a job produces for the user to download, like an
+// export archive. It is kept on disk at Path, which the manager removes
+// when it forgets the job.
+type Artifact struct {
+	Name         string `json:"name"`
+	Content_type string `json:"content_type"`
+	Size         int64  `json:"size"`
+	Path         string `json:"-"`
+}
+
+// Job is a background task and its progress. Completed counts the items
+// that are no longer pending.
+type Job struct {
+	Job_id      string     `json:"job_id"`
+	Kind        string     `json:"kind"`
+	User_id     string     `json:"user_id"`
+	Status      string     `json:"status"`
+	Total       int        `json:"total"`
+	Completed   int        `json:"completed"`
+	Items       []Item     `json:"items"`
+	Error       string     `json:"error,omitempty"`
+	Artifact    *Artifact  `json:"artifact,omitempty"`
+	Created_at  time.Time  `json:"created_at"`
+	Finished_at *time.Time `json:"finished_at,omitempty"`
+}
+
+// Finished reports whether the job is done or failed
+func (j *Job) Finished() bool {
+	return j.Status == StatusDone || j.Status == StatusFailed
+}
+
+// Task does a job's work, reporting each item's outcome to progress. An
+// error fails the whole job.
+type Task func(progress *Progress) error
+
+// Manager runs jobs a few at a time and forgets them a while after they
+// finish
+type Manager struct {
+	mu        sync.Mutex
+	jobs      map[string]*Job
+	slots     chan struct{}
+	retention time.Duration
+}
+
+// NewManager returns a manager running up to workers jobs at once and
+// keeping finished jobs for retention
+func NewManager(workers int, retention time.Duration) *Manager {
+	return &Manager{
+		jobs:      make(map[string]*Job),
+		slots:     make(chan struct{}, max(workers, 1)),
+		retention: retention,
+	}
+}
+
+// Start queues a job of the given kind for a user, with one pending item
+// per name, and returns a snapshot of it
+func (m *Manager) Start(kind string, userId string, names []string, task Task) *Job {
+	docId := primitive.NewObjectID()
+	job := &Job{
+		Job_id:     docId.Hex(),
+		Kind:       kind,
+		User_id:    userId,
+		Status:     StatusQueued,
+		Total:      len(names),
+		Items:      make([]Item, len(names)),
+		Created_at: time.Now(),
+	}
+	for i, name := range names {
+		job.Items[i] = Item{Name: name, Status: ItemPending}
+	}
+
+	m.mu.Lock()
+	m.prune()
+	m.jobs[job.Job_id] = job
+	snapshot := job.copy()
+	m.mu.Unlock()
+
+	go m.run(job, task)
+
+	return snapshot
+}
+
+// StartOnce returns the user's job of the given kind if one is queued or
+// running. Otherwise it forgets their finished ones, so a user holds at
+// most one, and starts a new one as Start does. The bool reports whether a
+// job was started.
+func (m *Manager) StartOnce(kind string, userId string, names []string, task Task) (*Job, bool) {
+	m.mu.Lock()
+	m.prune()
+	for id, job := range m.jobs {
+		if job.Kind != kind || job.User_id != userId {
+			continue
+		}
+		if !job.Finished() {
+			snapshot := job.copy()
+			m.mu.Unlock()
+			return snapshot, false
+		}
+		m.forget(id)
+	}
+	m.mu.Unlock()
+
+	return m.Start(kind, userId, names, task), true
+}
+
+// Get returns a snapshot of a user's job
+func (m *Manager) Get(userId string, jobId string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	job, ok := m.jobs[jobId]
+	if !ok || job.User_id != userId {
+		return nil, false
+	}
+
+	return job.copy(), true
+}
+
+func (m *Manager) run(job *Job, task Task) {
+	m.slots <- struct{}{}
+	defer func() { <-m.slots }()
+
+	m.mu.Lock()
+	job.Status = StatusRunning
+	m.mu.Unlock()
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("job panicked: %v", r)
+			}
+		}()
+		return task(&Progress{manager: m, job: job})
+	}()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	job.Finished_at = &now
+	job.Status = StatusDone
+	if err != nil {
+		log.Printf("Job %s failed: %v", job.Job_id, err.Error())
+		job.Status = StatusFailed
+		job.Error = err.Error()
+		removeArtifact(job)
+	}
+}
+
+// prune forgets jobs that finished more than the retention ago. The lock
+// must be held.
+func (m *Manager) prune() {
+	for id, job := range m.jobs {
+		if job.Finished_at != nil && time.Since(*job.Finished_at) > m.retention {
+			m.forget(id)
+		}
+	}
+}
+
+// forget drops a job and its artifact. The lock must be held.
+func (m *Manager) forget(id string) {
+	removeArtifact(m.jobs[id])
+	delete(m.jobs, id)
+}
+
+func removeArtifact(job *Job) {
+	if job.Artifact == nil {
+		return
+	}
+	if err := os.Remove(job.Artifact.Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error removing job artifact: %v", err.Error())
+	}
+	job.Artifact = nil
+}
+
+func (j *Job) copy() *Job {
+	snapshot := *j
+	snapshot.Items = append([]Item(nil), j.Items...)
+	return &snapshot
+}
+
+// Progress reports the outcome of a running job's items
+type Progress struct {
+	manager *Manager
+	job     *Job
+}
+
+// SetItems replaces the job's items with one pending item per name, for
+// tasks that only learn what they work on once running.
+func (p *Progress) SetItems(names []string) {
+	p.manager.mu.Lock()
+	defer p.manager.mu.Unlock()
+
+	p.job.Items = make([]Item, len(names))
+	for i, name := range names {
+		p.job.Items[i] = Item{Name: name, Status: ItemPending}
+	}
+	p.job.Total = len(names)
+	p.job.Completed = 0
+}
+
+// Finish records the outcome of the item at index. Items left pending when
+// the task returns stay pending.
+func (p *Progress) Finish(index int, status string, result any, err error) {
+	p.manager.mu.Lock()
+	defer p.manager.mu.Unlock()
+
+	item := &p.job.Items[index]
+	if item.Status == ItemPending {
+		p.job.Completed++
+	}
+	item.Status = status
+	item.Result = result
+	item.Error = ""
+	if err != nil {
+		item.Error = err.Error()
+	}
+}
+
+// SetArtifact records the file the job produced, which the manager owns
+// from then on. It must not change afterwards.
+func (p *Progress) SetArtifact(artifact *Artifact) error {
+	info, err := os.Stat(artifact.Path)
+	if err != nil {
+		return err
+	}
+
+	p.manager.mu.Lock()
+	defer p.manager.mu.Unlock()
+
+	artifact.Size = info.Size()
+	p.job.Artifact = artifact
+	return nil
+}
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// wait polls a job until it finishes
+func wait(t *testing.T, m *Manager, userId string, jobId string) *Job {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, ok := m.Get(userId, jobId)
+		if !ok {
+			t.Fatalf("Job %s not found", jobId)
+		}
+		if job.Finished() {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("Job %s didn't finish", jobId)
+	return nil
+}
+
+func TestManager(t *testing.T) {
+	m := NewManager(1, time.Hour)
+	release := make(chan struct{})
+	artifact := filepath.Join(t.TempDir(), "out.zip")
+	os.WriteFile(artifact, []byte("zip"), 0o600)
+
+	job := m.Start("import", "user-1", []string{"a.md", "b.md"}, func(progress *Progress) error {
+		<-release
+		progress.Finish(0, ItemDone, "a", nil)
+		progress.Finish(1, ItemFailed, nil, errors.New("bad note"))
+		return progress.SetArtifact(&Artifact{Name: "out.zip", Path: artifact})
+	})
+	if job.Status != StatusQueued || job.Total != 2 || job.Items[1].Status != ItemPending {
+		t.Errorf("Unexpected new job: %+v", job)
+	}
+
+	if _, ok := m.Get("user-2", job.Job_id); ok {
+		t.Error("Expected other users not to see the job")
+	}
+
+	close(release)
+	done := wait(t, m, "user-1", job.Job_id)
+	if done.Status != StatusDone || done.Completed != 2 || done.Finished_at == nil {
+		t.Errorf("Unexpected finished job: %+v", done)
+	}
+	if done.Items[0].Result != "a" || done.Items[1].Error != "bad note" {
+		t.Errorf("Unexpected items: %+v", done.Items)
+	}
+	if done.Artifact == nil || done.Artifact.Size != 3 {
+		t.Errorf("Unexpected artifact: %+v", done.Artifact)
+	}
+
+	failed := m.Start("import", "user-1", nil, func(progress *Progress) error {
+		panic("boom")
+	})
+	if job := wait(t, m, "user-1", failed.Job_id); job.Status != StatusFailed || job.Error == "" {
+		t.Errorf("Expected a panicking task to fail its job, got %+v", job)
+	}
+}
+
+func TestStartOnce(t *testing.T) {
+	m := NewManager(1, time.Hour)
+	release := make(chan struct{})
+
+	job, started := m.StartOnce("export", "user-1", nil, func(progress *Progress) error {
+		<-release
+		return errors.New("disk full")
+	})
+	if !started {
+		t.Fatal("Expected the first job to start")
+	}
+	if again, started := m.StartOnce("export", "user-1", nil, nil); started || again.Job_id != job.Job_id {
+		t.Errorf("Expected the running job back, got %+v", again)
+	}
+	if _, started := m.StartOnce("export", "user-2", nil, func(*Progress) error { return nil }); !started {
+		t.Error("Expected another user's job to start")
+	}
+
+	close(release)
+	wait(t, m, "user-1", job.Job_id)
+	retry, started := m.StartOnce("export", "user-1", nil, func(progress *Progress) error {
+		progress.SetItems([]string{"a.md"})
+		progress.Finish(0, ItemDone, nil, nil)
+		return nil
+	})
+	if !started || retry.Job_id == job.Job_id {
+		t.Error("Expected a failed job to be replaced")
+	}
+	if _, ok := m.Get("user-1", job.Job_id); ok {
+		t.Error("Expected the failed job to be forgotten")
+	}
+
+	done := wait(t, m, "user-1", retry.Job_id)
+	if done.Total != 1 || done.Completed != 1 {
+		t.Errorf("Expected the items set by the task, got %+v", done)
+	}
+	again, started := m.StartOnce("export", "user-1", nil, func(*Progress) error { return nil })
+	if !started || again.Job_id == retry.Job_id {
+		t.Error("Expected a finished job to be replaced by a fresh one")
+	}
+}
+
+func TestRetention(t *testing.T) {
+	m := NewManager(1, 0)
+	artifact := filepath.Join(t.TempDir(), "out.zip")
+	os.WriteFile(artifact, []byte("zip"), 0o600)
+	job := m.Start("export", "user-1", nil, func(progress *Progress) error {
+		return progress.SetArtifact(&Artifact{Name: "out.zip", Path: artifact})
+	})
+
+	// A finished job is forgotten, and its artifact removed, once its
+	// retention is over
+	for i := 0; i < 500; i++ {
+		if _, ok := m.Get("user-1", job.Job_id); !ok {
+			if _, err := os.Stat(artifact); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Expected the artifact to be removed, got %v", err)
+			}
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("Expected the finished job to be forgotten")
+}
@@ -3,8 +3,8 @@ package main
 import (
 	"fmt"
 	"go-markdown-parser/controller"
-	"go-markdown-parser/database"
 	"go-markdown-parser/routes"
+	"go-markdown-parser/store"
 	"go-markdown-parser/utils"
 	"log"
 	"os"
@@ -27,7 +27,13 @@ func main() {
 
 	log.Printf("Starting server initialization on port %s", PORT)
 
-	database.StartDB()
+	storeConfig := store.ConfigFromEnv()
+	stores, err := store.Open(storeConfig)
+	if err != nil {
+		log.Fatalf("Failed to open %s store: %v", storeConfig.Backend, err)
+	}
+	controller.UseStores(stores)
+	log.Printf("Using %s store", storeConfig.Backend)
 
 	router := gin.New() // Use New() instead of Default() for cleaner logs
 	router.Use(gin.Recovery())
@@ -36,7 +42,8 @@ func main() {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     utils.GetCorsOrigins(),
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "Accept", "X-Requested-With"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "Accept", "X-Requested-With", "If-Match", "If-None-Match", "X-Link-Password"},
+		ExposeHeaders:    []string{"ETag"},
 		AllowCredentials: true,
 	}))
 
@@ -44,6 +51,7 @@ func main() {
 	router.GET("/ping", controller.Ping())
 	routes.AuthRoutes(router)
 	routes.MarkdownParserRoutes(router)
+	routes.WorkspaceRoutes(router)
 
 	serverAddr := fmt.Sprintf("0.0.0.0:%s", PORT)
 	log.Printf("Server attempting to listen on %s", serverAddr)
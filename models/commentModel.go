@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Anchor ties a comment thread to a range of a note's markdown. Start and End
+// count Unicode characters (runes) in the content of revision Revision_id,
+// and are re-mapped to each new revision as the note is saved.
+type Anchor struct {
+	Start       int    `json:"start"`
+	End         int    `json:"end"`
+	Quote       string `json:"quote"`
+	Revision_id string `json:"revision_id"`
+	// Detached is set once the anchored text has been deleted. Quote keeps
+	// the text as it was last seen.
+	Detached bool `json:"detached"`
+}
+
+// Comment is one message in a thread.
+type Comment struct {
+	Comment_id string    `json:"comment_id"`
+	Author_id  string    `json:"author_id"`
+	Body       string    `json:"body"`
+	Created_at time.Time `json:"created_at"`
+}
+
+// Thread is a discussion on a range of a note. The first comment opens it
+// and the rest are replies, oldest first.
+type Thread struct {
+	ID          primitive.ObjectID `bson:"_id" json:"_id"`
+	Thread_id   string             `json:"thread_id"`
+	File_id     string             `json:"file_id"`
+	Author_id   string             `json:"author_id"`
+	Anchor      Anchor             `json:"anchor"`
+	Comments    []Comment          `json:"comments"`
+	Resolved    bool               `json:"resolved"`
+	Resolved_by string             `json:"resolved_by,omitempty"`
+	Resolved_at *time.Time         `json:"resolved_at,omitempty"`
+	Created_at  time.Time          `json:"created_at"`
+	Updated_at  time.Time          `json:"updated_at"`
+}
@@ -6,11 +6,62 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// File is a user's markdown note. Version is incremented on every write and
+// doubles as the file's ETag for optimistic concurrency.
+//
+// Notes in a workspace belong to the workspace: User_id holds its
+// workspace_id, so every per-owner lookup scopes them to the workspace, and
+// Workspace_id is set too.
+//
+// Folder is the slash-separated folder path the note lives in ("" is the
+// root), and Deleted_at is set while the note is in the trash.
+//
+// Visibility is VisibilityPrivate (or empty) unless the owner published the
+// note, in which case it is served to anyone at /p/<Slug>.
+//
+// Tags come from the note's front matter when it has a tags entry, otherwise
+// they are set through the API. Misspelled_count is recorded by the spell
+// check on every save. Original_encoding is the encoding an uploaded or
+// imported note was converted to UTF-8 from.
 type File struct {
-	ID           primitive.ObjectID `bson:"_id"`
-	User_id      string             `json:"user_id"`
-	File_name    string             `json:"file_name"`
-	File_content string             `json:"file_content"`
-	Created_at   time.Time          `json:"created_at"`
-	Updated_at   time.Time          `json:"updated_at"`
+	ID                primitive.ObjectID `bson:"_id" json:"_id"`
+	File_id           string             `json:"file_id"`
+	User_id           string             `json:"user_id"`
+	Workspace_id      string             `json:"workspace_id,omitempty"`
+	File_name         string             `json:"file_name"`
+	Folder            string             `json:"folder"`
+	File_content      string             `json:"file_content"`
+	Tags              []string           `json:"tags"`
+	Misspelled_count  int                `json:"misspelled_count"`
+	Original_encoding string             `json:"original_encoding,omitempty"`
+	Visibility        string             `json:"visibility"`
+	Slug              string             `json:"slug,omitempty"`
+	Version           int64              `json:"version"`
+	Created_at        time.Time          `json:"created_at"`
+	Updated_at        time.Time          `json:"updated_at"`
+	Deleted_at        *time.Time         `json:"deleted_at,omitempty"`
+}
+
+// Note visibilities
+const (
+	VisibilityPrivate = "private"
+	VisibilityPublic  = "public"
+)
+
+// Trashed reports whether the file is in the trash.
+func (f *File) Trashed() bool {
+	return f.Deleted_at != nil
+}
+
+// Public reports whether the note is published and outside the trash.
+func (f *File) Public() bool {
+	return f.Visibility == VisibilityPublic && f.Slug != "" && !f.Trashed()
+}
+
+// Path returns the note's full path, e.g. "work/ideas/notes.md".
+func (f *File) Path() string {
+	if f.Folder == "" {
+		return f.File_name
+	}
+	return f.Folder + "/" + f.File_name
 }
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Revision is an immutable snapshot of a file's content, written on every save.
+type Revision struct {
+	ID            primitive.ObjectID `bson:"_id" json:"_id"`
+	Revision_id   string             `json:"revision_id"`
+	File_id       string             `json:"file_id"`
+	File_name     string             `json:"file_name"`
+	Author_id     string             `json:"author_id"`
+	Content       string             `json:"content,omitempty"`
+	Content_hash  string             `json:"content_hash"`
+	Spellcheck    SpellcheckSummary  `json:"spellcheck"`
+	Restored_from string             `json:"restored_from,omitempty"`
+	Created_at    time.Time          `json:"created_at"`
+}
+
+// SpellcheckSummary records the spell-check outcome for a revision.
+type SpellcheckSummary struct {
+	Word_count       int      `json:"word_count"`
+	Misspelled_count int      `json:"misspelled_count"`
+	Misspelled_words []string `json:"misspelled_words"`
+}
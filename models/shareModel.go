@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Permissions that can be granted on a shared note or folder. Each one
+// includes the ones before it.
+const (
+	PermissionView    = "view"
+	PermissionComment = "comment"
+	PermissionEdit    = "edit"
+)
+
+// permissionRanks orders the permissions from least to most access.
+var permissionRanks = map[string]int{
+	PermissionView:    1,
+	PermissionComment: 2,
+	PermissionEdit:    3,
+}
+
+// ValidPermission reports whether permission is one that can be granted.
+func ValidPermission(permission string) bool {
+	return permissionRanks[permission] > 0
+}
+
+// PermissionAllows reports whether holding permission grants need.
+func PermissionAllows(permission string, need string) bool {
+	return permissionRanks[permission] > 0 && permissionRanks[permission] >= permissionRanks[need]
+}
+
+// Share grants another user access to one of the owner's notes, or to every
+// note in one of their folders and its subfolders. Exactly one of File_id and
+// Folder is set.
+type Share struct {
+	ID         primitive.ObjectID `bson:"_id" json:"_id"`
+	Share_id   string             `json:"share_id"`
+	Owner_id   string             `json:"owner_id"`
+	File_id    string             `json:"file_id,omitempty"`
+	Folder     string             `json:"folder,omitempty"`
+	Grantee_id string             `json:"grantee_id"`
+	Permission string             `json:"permission"`
+	Created_at time.Time          `json:"created_at"`
+}
+
+// PublicLink gives anyone holding its token read-only access to a note,
+// optionally until Expires_at and behind a password.
+type PublicLink struct {
+	ID            primitive.ObjectID `bson:"_id" json:"_id"`
+	Link_id       string             `json:"link_id"`
+	Token         string             `json:"token"`
+	Owner_id      string             `json:"owner_id"`
+	File_id       string             `json:"file_id"`
+	Password_hash string             `json:"password_hash,omitempty"`
+	Expires_at    *time.Time         `json:"expires_at,omitempty"`
+	Created_at    time.Time          `json:"created_at"`
+}
+
+// Expired reports whether the link can no longer be used.
+func (l *PublicLink) Expired() bool {
+	return l.Expires_at != nil && time.Now().After(*l.Expires_at)
+}
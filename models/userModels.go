@@ -15,4 +15,33 @@ type User struct {
 	Created_at    time.Time          `json:"created_at"`
 	Updated_at    time.Time          `json:"updated_at"`
 	User_id       string             `json:"user_id"`
+	// Render_options are the user's markdown rendering preferences, nil for
+	// the server default
+	Render_options *RenderOptions `json:"render_options,omitempty"`
+}
+
+// RenderOptions selects the goldmark extensions used to render notes as HTML
+type RenderOptions struct {
+	// Gfm enables GitHub Flavored Markdown: tables, strikethrough, task
+	// lists and autolinks
+	Gfm              bool `json:"gfm"`
+	Footnotes        bool `json:"footnotes"`
+	Definition_lists bool `json:"definition_lists"`
+	// Heading_ids gives headings generated ids, for linking to sections
+	Heading_ids bool `json:"heading_ids"`
+	// Math renders $...$ and $$ fenced TeX for KaTeX or MathJax
+	Math bool `json:"math"`
+	// Mermaid renders ```mermaid code blocks as diagrams
+	Mermaid bool `json:"mermaid"`
+	// Highlighting colours fenced code blocks by their language tag
+	Highlighting bool `json:"highlighting"`
+	// Highlight_theme names the chroma style to colour code with, empty
+	// for the server default
+	Highlight_theme string `json:"highlight_theme,omitempty"`
+	// Highlight_classes marks code up with CSS classes instead of inline
+	// styles; the theme's stylesheet must then be included
+	Highlight_classes bool `json:"highlight_classes"`
+	// Hard_wraps renders every newline inside a paragraph as a line break,
+	// instead of CommonMark's soft breaks
+	Hard_wraps bool `json:"hard_wraps"`
 }
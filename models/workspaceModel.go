@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Roles a member can hold in a workspace. Each one includes the ones before it.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// roleRanks orders the roles from least to most access.
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// ValidRole reports whether role is a workspace role.
+func ValidRole(role string) bool {
+	return roleRanks[role] > 0
+}
+
+// RoleAllows reports whether holding role grants need.
+func RoleAllows(role string, need string) bool {
+	return roleRanks[role] > 0 && roleRanks[role] >= roleRanks[need]
+}
+
+// Workspace is a team space whose notes belong to the workspace rather than
+// to one user. Dictionary holds the extra words its members' spell checks
+// accept, lowercase and without duplicates.
+type Workspace struct {
+	ID           primitive.ObjectID `bson:"_id" json:"_id"`
+	Workspace_id string             `json:"workspace_id"`
+	Name         string             `json:"name"`
+	Owner_id     string             `json:"owner_id"`
+	Dictionary   []string           `json:"dictionary"`
+	Created_at   time.Time          `json:"created_at"`
+	Updated_at   time.Time          `json:"updated_at"`
+}
+
+// Member gives a user a role in a workspace.
+type Member struct {
+	ID           primitive.ObjectID `bson:"_id" json:"_id"`
+	Workspace_id string             `json:"workspace_id"`
+	User_id      string             `json:"user_id"`
+	Role         string             `json:"role"`
+	Created_at   time.Time          `json:"created_at"`
+}
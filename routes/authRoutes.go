@@ -12,4 +12,14 @@ func AuthRoutes(router *gin.Engine) {
 
 	// route to authenticate user
 	router.GET("/auth/v1/authenticate", controller.AuthenticateUser())
+
+	// Markdown rendering preferences
+	router.GET("/api/v1/preferences", controller.GetPreferences())
+	router.PUT("/api/v1/preferences/render", controller.UpdateRenderOptions())
+	router.DELETE("/api/v1/preferences/render", controller.ResetRenderOptions())
+
+	// Export of the whole account, built in the background
+	router.POST("/api/v1/account/export", controller.ExportAccount())
+	router.GET("/api/v1/account/export/:job_id", controller.GetAccountExport())
+	router.GET("/api/v1/account/export/:job_id/download", controller.DownloadAccountExport())
 }
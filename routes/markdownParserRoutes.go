@@ -13,4 +13,70 @@ func MarkdownParserRoutes(router *gin.Engine) {
 	router.GET("/api/v1/markdown/files", controller.GetAllFiles())
 	// Get a file by id
 	router.GET("/api/v1/markdown/files/:file_id", controller.GetFileById())
+
+	// Create and edit notes from raw markdown text
+	router.POST("/api/v1/markdown/files", controller.CreateNote())
+	router.PUT("/api/v1/markdown/files/:file_id", controller.ReplaceNote())
+	router.PATCH("/api/v1/markdown/files/:file_id", controller.PatchNote())
+	router.DELETE("/api/v1/markdown/files/:file_id", controller.DeleteNote())
+
+	// Bulk import of archives and directories, in the background
+	router.POST("/api/v1/markdown/import", controller.ImportNotes())
+	router.GET("/api/v1/markdown/import/:job_id", controller.GetImportJob())
+
+	// Revision history of a file
+	router.GET("/api/v1/markdown/files/:file_id/revisions", controller.GetFileRevisions())
+	router.GET("/api/v1/markdown/files/:file_id/revisions/:revision_id", controller.GetFileRevision())
+	router.POST("/api/v1/markdown/files/:file_id/revisions/:revision_id/restore", controller.RestoreFileRevision())
+	router.GET("/api/v1/markdown/files/:file_id/diff", controller.DiffFileRevisions())
+
+	// Download a note as HTML, PDF, DOCX or EPUB
+	router.GET("/api/v1/markdown/files/:file_id/export", controller.ExportNote())
+
+	// Live collaborative editing over a websocket
+	router.GET("/api/v1/markdown/files/:file_id/live", controller.EditNoteLive())
+
+	// Folders, moving notes and the trash
+	router.POST("/api/v1/markdown/files/:file_id/move", controller.MoveNote())
+	router.PATCH("/api/v1/markdown/folders", controller.RenameFolder())
+	router.DELETE("/api/v1/markdown/folders", controller.DeleteFolder())
+	router.GET("/api/v1/markdown/trash", controller.GetTrash())
+	router.POST("/api/v1/markdown/trash/:file_id/restore", controller.RestoreNote())
+	router.DELETE("/api/v1/markdown/trash/:file_id", controller.PurgeNote())
+	router.DELETE("/api/v1/markdown/trash", controller.EmptyTrash())
+
+	// Tags
+	router.PUT("/api/v1/markdown/files/:file_id/tags", controller.SetNoteTags())
+	router.GET("/api/v1/markdown/tags", controller.GetTags())
+
+	// Full-text search
+	router.GET("/api/v1/markdown/search", controller.SearchNotes())
+
+	// Sharing with other users and public links
+	router.POST("/api/v1/markdown/shares", controller.ShareNote())
+	router.GET("/api/v1/markdown/shares", controller.GetShares())
+	router.DELETE("/api/v1/markdown/shares/:share_id", controller.DeleteShare())
+	router.GET("/api/v1/markdown/shared", controller.GetSharedWithMe())
+	router.POST("/api/v1/markdown/files/:file_id/links", controller.CreatePublicLink())
+	router.GET("/api/v1/markdown/files/:file_id/links", controller.GetPublicLinks())
+	router.DELETE("/api/v1/markdown/links/:link_id", controller.DeletePublicLink())
+	router.GET("/api/v1/markdown/public/:token", controller.GetPublicNote())
+
+	// Comment threads anchored to ranges of a note
+	router.GET("/api/v1/markdown/files/:file_id/threads", controller.GetThreads())
+	router.POST("/api/v1/markdown/files/:file_id/threads", controller.CreateThread())
+	router.POST("/api/v1/markdown/files/:file_id/threads/:thread_id/comments", controller.ReplyToThread())
+	router.POST("/api/v1/markdown/files/:file_id/threads/:thread_id/resolve", controller.ResolveThread())
+	router.POST("/api/v1/markdown/files/:file_id/threads/:thread_id/reopen", controller.ReopenThread())
+	router.DELETE("/api/v1/markdown/files/:file_id/threads/:thread_id", controller.DeleteThread())
+
+	// Published notes as standalone pages
+	router.PUT("/api/v1/markdown/files/:file_id/visibility", controller.SetNoteVisibility())
+	router.GET("/p/:slug", controller.GetPublicPage())
+
+	// Code highlighting themes
+	router.GET("/api/v1/highlight/themes", controller.GetHighlightThemes())
+	router.GET("/api/v1/highlight/themes/:theme", controller.GetHighlightThemeCSS())
+	// Themes of spell-checked notes rendered as full pages
+	router.GET("/api/v1/document/themes", controller.GetDocumentThemes())
 }
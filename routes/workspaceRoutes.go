@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"go-markdown-parser/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WorkspaceRoutes(router *gin.Engine) {
+	router.POST("/api/v1/workspaces", controller.CreateWorkspace())
+	router.GET("/api/v1/workspaces", controller.GetWorkspaces())
+	// Issue tokens for another workspace, or the personal space
+	router.POST("/api/v1/workspaces/switch", controller.SwitchWorkspace())
+	router.GET("/api/v1/workspaces/:workspace_id", controller.GetWorkspace())
+	router.PATCH("/api/v1/workspaces/:workspace_id", controller.RenameWorkspace())
+
+	// Members and their roles
+	router.POST("/api/v1/workspaces/:workspace_id/members", controller.SaveWorkspaceMember())
+	router.DELETE("/api/v1/workspaces/:workspace_id/members/:user_id", controller.RemoveWorkspaceMember())
+
+	// The workspace's custom dictionary
+	router.GET("/api/v1/workspaces/:workspace_id/dictionary", controller.GetWorkspaceDictionary())
+	router.POST("/api/v1/workspaces/:workspace_id/dictionary", controller.AddWorkspaceWords())
+	router.DELETE("/api/v1/workspaces/:workspace_id/dictionary/:word", controller.RemoveWorkspaceWord())
+}
@@ -0,0 +1,187 @@
+package search
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+)
+
+// FileIndex wraps a FileStore and keeps a search index of each user's notes
+// in step with it. A user's index is built from the store on their first
+// search and then updated on every write made through the FileIndex. Only
+// the most recently searched users' indexes are kept, and if the store is a
+// store.FileStamper, an index is rebuilt when its stamp shows the user's
+// files were changed outside the app.
+type FileIndex struct {
+	store.FileStore
+
+	mu       sync.Mutex
+	indexes  map[string]*list.Element
+	recent   *list.List // of *userIndex, most recently searched first
+	capacity int
+	stamper  store.FileStamper
+
+	suggester Suggester
+}
+
+type userIndex struct {
+	userId string
+	index  *Index
+	// stamp is the store's stamp of the user's files the index matches
+	stamp string
+}
+
+// NewFileIndex returns files wrapped with a search index keeping the indexes
+// of up to capacity users. suggester is optional, see NewIndex.
+func NewFileIndex(files store.FileStore, suggester Suggester, capacity int) *FileIndex {
+	stamper, _ := files.(store.FileStamper)
+	return &FileIndex{
+		FileStore: files,
+		indexes:   make(map[string]*list.Element),
+		recent:    list.New(),
+		capacity:  max(capacity, 1),
+		stamper:   stamper,
+		suggester: suggester,
+	}
+}
+
+// Search runs a query over the user's notes outside the trash.
+func (f *FileIndex) Search(ctx context.Context, userId string, query string, limit int) (*Results, error) {
+	idx, err := f.index(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return idx.Search(query, limit)
+}
+
+// index returns the user's index, building it on first use or when the
+// user's files changed outside the app. The lock is held while building so
+// that writes made meanwhile are applied after the load.
+func (f *FileIndex) index(ctx context.Context, userId string) (*Index, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stamp, err := f.stamp(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if element, ok := f.indexes[userId]; ok {
+		entry := element.Value.(*userIndex)
+		if entry.stamp == stamp {
+			f.recent.MoveToFront(element)
+			return entry.index, nil
+		}
+		f.forget(element)
+	}
+
+	page, err := f.FileStore.FindFiles(ctx, userId, store.FileQuery{})
+	if err != nil {
+		return nil, err
+	}
+
+	idx := NewIndex(f.suggester)
+	for _, file := range page.Files {
+		idx.Add(documentFor(&file))
+	}
+	f.indexes[userId] = f.recent.PushFront(&userIndex{userId: userId, index: idx, stamp: stamp})
+
+	for f.recent.Len() > f.capacity {
+		f.forget(f.recent.Back())
+	}
+
+	return idx, nil
+}
+
+// stamp returns the store's stamp of the user's files, or "" if the store
+// can't change outside the app.
+func (f *FileIndex) stamp(ctx context.Context, userId string) (string, error) {
+	if f.stamper == nil {
+		return "", nil
+	}
+	return f.stamper.FilesStamp(ctx, userId)
+}
+
+// forget drops an index. The lock must be held.
+func (f *FileIndex) forget(element *list.Element) {
+	delete(f.indexes, element.Value.(*userIndex).userId)
+	f.recent.Remove(element)
+}
+
+// apply changes the user's index after a write, if it has been built, and
+// takes the store's new stamp so the write doesn't force a rebuild.
+func (f *FileIndex) apply(ctx context.Context, userId string, change func(idx *Index)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	element, ok := f.indexes[userId]
+	if !ok {
+		return
+	}
+
+	entry := element.Value.(*userIndex)
+	change(entry.index)
+
+	stamp, err := f.stamp(ctx, userId)
+	if err != nil {
+		f.forget(element)
+		return
+	}
+	entry.stamp = stamp
+}
+
+// update reindexes a written file if its owner's index has been built.
+func (f *FileIndex) update(ctx context.Context, file *models.File) {
+	f.apply(ctx, file.User_id, func(idx *Index) {
+		if file.Trashed() {
+			idx.Remove(file.File_id)
+		} else {
+			idx.Add(documentFor(file))
+		}
+	})
+}
+
+func (f *FileIndex) SaveFile(ctx context.Context, file *models.File) (*models.File, error) {
+	saved, err := f.FileStore.SaveFile(ctx, file)
+	if err == nil {
+		f.update(ctx, saved)
+	}
+	return saved, err
+}
+
+func (f *FileIndex) CreateFile(ctx context.Context, file *models.File) error {
+	err := f.FileStore.CreateFile(ctx, file)
+	if err == nil {
+		f.update(ctx, file)
+	}
+	return err
+}
+
+func (f *FileIndex) UpdateFile(ctx context.Context, file *models.File, expectedVersion int64) (*models.File, error) {
+	updated, err := f.FileStore.UpdateFile(ctx, file, expectedVersion)
+	if err == nil {
+		f.update(ctx, updated)
+	}
+	return updated, err
+}
+
+func (f *FileIndex) DeleteFile(ctx context.Context, userId string, fileId string) error {
+	err := f.FileStore.DeleteFile(ctx, userId, fileId)
+	if err == nil {
+		f.apply(ctx, userId, func(idx *Index) { idx.Remove(fileId) })
+	}
+	return err
+}
+
+func documentFor(file *models.File) Document {
+	return Document{
+		ID:     file.File_id,
+		Name:   file.File_name,
+		Folder: file.Folder,
+		Text:   file.File_content,
+	}
+}
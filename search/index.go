@@ -0,0 +1,212 @@
+// Package search implements full-text search over a user's notes with an
+// in-memory inverted index, so it works the same with every storage backend.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// BM25 ranking parameters
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// nameGap separates the positions of name tokens from content tokens so a
+// phrase never matches across the two.
+const nameGap = 10
+
+// Document is a note as seen by the index.
+type Document struct {
+	ID     string
+	Name   string
+	Folder string
+	Text   string
+}
+
+// token is a normalised word and where it sits in the original text.
+type token struct {
+	term       string
+	start, end int
+}
+
+// document is an indexed Document. Position i of the document refers to
+// tokens[i]; name tokens come first and have no text offsets.
+type document struct {
+	Document
+	tokens     []token
+	nameTokens int
+}
+
+// Index is an inverted index over one user's notes. It is safe for
+// concurrent use.
+type Index struct {
+	mu          sync.RWMutex
+	docs        map[string]*document
+	postings    map[string]map[string][]int
+	totalLength int
+	suggester   Suggester
+}
+
+// Suggester proposes spelling corrections for a word, e.g. *fuzzy.Model.
+type Suggester interface {
+	Suggestions(input string, exhaustive bool) []string
+}
+
+// NewIndex returns an empty index. suggester may be nil, in which case typo
+// tolerance relies on edit distance alone.
+func NewIndex(suggester Suggester) *Index {
+	return &Index{
+		docs:      make(map[string]*document),
+		postings:  make(map[string]map[string][]int),
+		suggester: suggester,
+	}
+}
+
+// tokenize splits text into lowercase words of letters and digits, keeping
+// each word's byte offsets. Apostrophes inside a word are kept.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+
+	isWordRune := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}
+
+	runes := []rune(text)
+	offsets := make([]int, len(runes)+1)
+	offset := 0
+	for i, r := range runes {
+		offsets[i] = offset
+		offset += len(string(r))
+	}
+	offsets[len(runes)] = offset
+
+	for i, r := range runes {
+		inWord := isWordRune(r) ||
+			(start >= 0 && (r == '\'' || r == '’') && i+1 < len(runes) && isWordRune(runes[i+1]))
+
+		if inWord && start < 0 {
+			start = i
+		}
+		if !inWord && start >= 0 {
+			tokens = append(tokens, token{strings.ToLower(string(runes[start:i])), offsets[start], offsets[i]})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{strings.ToLower(string(runes[start:])), offsets[start], offsets[len(runes)]})
+	}
+
+	return tokens
+}
+
+// Add indexes a document, replacing any earlier version with the same ID.
+func (idx *Index) Add(doc Document) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(doc.ID)
+
+	indexed := &document{Document: doc}
+	for _, t := range tokenize(doc.Name) {
+		indexed.tokens = append(indexed.tokens, token{term: t.term, start: -1, end: -1})
+	}
+	indexed.nameTokens = len(indexed.tokens)
+
+	content := tokenize(doc.Text)
+	for i := 0; i < nameGap && len(content) > 0; i++ {
+		indexed.tokens = append(indexed.tokens, token{start: -1, end: -1})
+	}
+	indexed.tokens = append(indexed.tokens, content...)
+
+	for position, t := range indexed.tokens {
+		if t.term == "" {
+			continue
+		}
+		if idx.postings[t.term] == nil {
+			idx.postings[t.term] = make(map[string][]int)
+		}
+		idx.postings[t.term][doc.ID] = append(idx.postings[t.term][doc.ID], position)
+	}
+
+	idx.docs[doc.ID] = indexed
+	idx.totalLength += indexed.length()
+}
+
+// Remove drops a document from the index.
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+
+	for _, t := range doc.tokens {
+		if t.term == "" {
+			continue
+		}
+		delete(idx.postings[t.term], id)
+		if len(idx.postings[t.term]) == 0 {
+			delete(idx.postings, t.term)
+		}
+	}
+
+	idx.totalLength -= doc.length()
+	delete(idx.docs, id)
+}
+
+// Len returns the number of indexed documents.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.docs)
+}
+
+// length is the number of words in the document, for BM25 normalisation.
+func (d *document) length() int {
+	words := 0
+	for _, t := range d.tokens {
+		if t.term != "" {
+			words++
+		}
+	}
+	return words
+}
+
+// bm25 scores a term, or phrase, that occurs frequency times in doc and in
+// docFrequency documents overall.
+func (idx *Index) bm25(doc *document, frequency int, docFrequency int) float64 {
+	n := float64(len(idx.docs))
+	idf := math.Log(1 + (n-float64(docFrequency)+0.5)/(float64(docFrequency)+0.5))
+
+	averageLength := float64(idx.totalLength) / n
+	if averageLength == 0 {
+		averageLength = 1
+	}
+
+	tf := float64(frequency)
+	norm := bm25K1 * (1 - bm25B + bm25B*float64(doc.length())/averageLength)
+	return idf * tf * (bm25K1 + 1) / (tf + norm)
+}
+
+// vocabulary returns every indexed term, sorted.
+func (idx *Index) vocabulary() []string {
+	terms := make([]string, 0, len(idx.postings))
+	for term := range idx.postings {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
@@ -0,0 +1,492 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"go-markdown-parser/utils"
+)
+
+// maxExpansions caps how many indexed terms a prefix or misspelled query
+// term expands to.
+const maxExpansions = 50
+
+// fuzzyWeight scales the score of terms matched through typo tolerance, so
+// exact matches rank first.
+const fuzzyWeight = 0.5
+
+var (
+	// ErrInvalidQuery is wrapped by every error caused by the query itself.
+	ErrInvalidQuery = errors.New("invalid search query")
+	// ErrEmptyQuery is returned for queries without any searchable words.
+	ErrEmptyQuery = fmt.Errorf("%w: nothing to search for", ErrInvalidQuery)
+)
+
+// hit is a document matched by part of a query.
+type hit struct {
+	score     float64
+	positions []int
+}
+
+// node is a parsed query expression.
+type node interface {
+	eval(s *searcher) map[string]*hit
+}
+
+// termNode matches a single word, or every word starting with it.
+type termNode struct {
+	term   string
+	prefix bool
+}
+
+// phraseNode matches words that appear next to each other, in order.
+type phraseNode struct {
+	terms []string
+}
+
+type andNode struct {
+	children []node
+}
+
+type orNode struct {
+	children []node
+}
+
+type notNode struct {
+	child node
+}
+
+// searcher evaluates a query against an index, collecting the spelling
+// corrections it made along the way. The index must be read-locked.
+type searcher struct {
+	idx         *Index
+	corrections map[string]string
+}
+
+// parse parses a search query. Words are ANDed together; OR, NOT (or a
+// leading "-") and parentheses combine them, "double quotes" match a phrase
+// and a trailing * matches any word with that prefix.
+func parse(query string) (node, error) {
+	p := &parser{items: lex(query)}
+
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.items) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, p.items[p.pos].text)
+	}
+	if n == nil {
+		return nil, ErrEmptyQuery
+	}
+
+	return n, nil
+}
+
+type itemKind int
+
+const (
+	itemWord itemKind = iota
+	itemPhrase
+	itemOpen
+	itemClose
+)
+
+type item struct {
+	kind itemKind
+	text string
+}
+
+// lex splits a query into words, quoted phrases and parentheses.
+func lex(query string) []item {
+	var items []item
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			items = append(items, item{itemOpen, "("})
+			i++
+		case r == ')':
+			items = append(items, item{itemClose, ")"})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			items = append(items, item{itemPhrase, string(runes[i+1 : end])})
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()"`, runes[end]) {
+				end++
+			}
+			items = append(items, item{itemWord, string(runes[i:end])})
+			i = end
+		}
+	}
+
+	return items
+}
+
+type parser struct {
+	items []item
+	pos   int
+}
+
+func (p *parser) peek() (item, bool) {
+	if p.pos >= len(p.items) {
+		return item{}, false
+	}
+	return p.items[p.pos], true
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	next, ok := p.peek()
+	return ok && next.kind == itemWord && next.text == keyword
+}
+
+func (p *parser) parseOr() (node, error) {
+	var children []node
+
+	for {
+		child, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if child != nil {
+			children = append(children, child)
+		}
+
+		if !p.isKeyword("OR") {
+			break
+		}
+		p.pos++
+	}
+
+	switch len(children) {
+	case 0:
+		return nil, nil
+	case 1:
+		return children[0], nil
+	default:
+		return &orNode{children}, nil
+	}
+}
+
+func (p *parser) parseAnd() (node, error) {
+	var children []node
+	negated := false
+
+	for {
+		next, ok := p.peek()
+		if !ok || next.kind == itemClose || p.isKeyword("OR") {
+			break
+		}
+		if p.isKeyword("AND") {
+			p.pos++
+			continue
+		}
+
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if child == nil {
+			continue
+		}
+		if _, ok := child.(*notNode); ok {
+			negated = true
+		}
+		children = append(children, child)
+	}
+
+	// A lone NOT still goes through andNode, which supplies the documents
+	// to exclude from.
+	if len(children) == 1 && !negated {
+		return children[0], nil
+	}
+	if len(children) == 0 {
+		return nil, nil
+	}
+	return &andNode{children}, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	next, _ := p.peek()
+
+	if p.isKeyword("NOT") {
+		p.pos++
+		child, err := p.parseUnary()
+		if err != nil || child == nil {
+			return nil, err
+		}
+		return &notNode{child}, nil
+	}
+
+	if next.kind == itemWord && len(next.text) > 1 && strings.HasPrefix(next.text, "-") {
+		p.items[p.pos].text = next.text[1:]
+		child, err := p.parseUnary()
+		if err != nil || child == nil {
+			return nil, err
+		}
+		return &notNode{child}, nil
+	}
+
+	p.pos++
+	switch next.kind {
+	case itemOpen:
+		child, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.kind != itemClose {
+			return nil, fmt.Errorf("%w: missing )", ErrInvalidQuery)
+		}
+		p.pos++
+		return child, nil
+	case itemClose:
+		return nil, fmt.Errorf("%w: unexpected )", ErrInvalidQuery)
+	case itemPhrase:
+		return phrase(next.text, false), nil
+	default:
+		prefix := strings.HasSuffix(next.text, "*")
+		return phrase(strings.TrimRight(next.text, "*"), prefix), nil
+	}
+}
+
+// phrase builds the node for some query text: nothing, a single term, or a
+// phrase when the text holds several words (as in "e-mail").
+func phrase(text string, prefix bool) node {
+	tokens := tokenize(text)
+
+	switch len(tokens) {
+	case 0:
+		return nil
+	case 1:
+		return &termNode{term: tokens[0].term, prefix: prefix}
+	default:
+		terms := make([]string, len(tokens))
+		for i, t := range tokens {
+			terms[i] = t.term
+		}
+		return &phraseNode{terms}
+	}
+}
+
+func (n *termNode) eval(s *searcher) map[string]*hit {
+	weight := 1.0
+	var terms []string
+
+	switch {
+	case n.prefix:
+		for _, term := range s.idx.vocabulary() {
+			if strings.HasPrefix(term, n.term) {
+				terms = append(terms, term)
+				if len(terms) == maxExpansions {
+					break
+				}
+			}
+		}
+	case s.idx.postings[n.term] != nil:
+		terms = []string{n.term}
+	default:
+		terms = s.correct(n.term)
+		weight = fuzzyWeight
+	}
+
+	hits := make(map[string]*hit)
+	for _, term := range terms {
+		postings := s.idx.postings[term]
+		for id, positions := range postings {
+			h := hits[id]
+			if h == nil {
+				h = &hit{}
+				hits[id] = h
+			}
+			h.score += weight * s.idx.bm25(s.idx.docs[id], len(positions), len(postings))
+			h.positions = append(h.positions, positions...)
+		}
+	}
+
+	return hits
+}
+
+// correct finds indexed terms the user probably meant when term isn't
+// indexed at all: dictionary suggestions from the fuzzy model that occur in
+// the notes, and the notes' own words within a small edit distance.
+func (s *searcher) correct(term string) []string {
+	maxDistance := 0
+	switch length := len([]rune(term)); {
+	case length >= 8:
+		maxDistance = 2
+	case length >= 4:
+		maxDistance = 1
+	}
+	if maxDistance == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var terms []string
+
+	if s.idx.suggester != nil {
+		for _, suggestion := range s.idx.suggester.Suggestions(term, false) {
+			suggestion = strings.ToLower(suggestion)
+			if s.idx.postings[suggestion] != nil && !seen[suggestion] {
+				seen[suggestion] = true
+				terms = append(terms, suggestion)
+			}
+		}
+	}
+
+	best := maxDistance + 1
+	var closest []string
+	for _, candidate := range s.idx.vocabulary() {
+		if diff := len(candidate) - len(term); diff > maxDistance || -diff > maxDistance {
+			continue
+		}
+
+		distance := utils.LevenshteinDistance(term, candidate)
+		if distance < best {
+			best, closest = distance, nil
+		}
+		if distance == best {
+			closest = append(closest, candidate)
+		}
+	}
+
+	for _, candidate := range closest {
+		if !seen[candidate] {
+			seen[candidate] = true
+			terms = append(terms, candidate)
+		}
+	}
+
+	if len(terms) > maxExpansions {
+		terms = terms[:maxExpansions]
+	}
+	if len(terms) > 0 {
+		s.corrections[term] = terms[0]
+	}
+
+	return terms
+}
+
+func (n *phraseNode) eval(s *searcher) map[string]*hit {
+	matches := make(map[string][]int)
+
+	for id, starts := range s.idx.postings[n.terms[0]] {
+		var found []int
+
+	starts:
+		for _, start := range starts {
+			for offset, term := range n.terms[1:] {
+				if !containsInt(s.idx.postings[term][id], start+offset+1) {
+					continue starts
+				}
+			}
+			found = append(found, start)
+		}
+
+		if len(found) > 0 {
+			matches[id] = found
+		}
+	}
+
+	hits := make(map[string]*hit)
+	for id, starts := range matches {
+		h := &hit{score: s.idx.bm25(s.idx.docs[id], len(starts), len(matches))}
+		for _, start := range starts {
+			for offset := range n.terms {
+				h.positions = append(h.positions, start+offset)
+			}
+		}
+		hits[id] = h
+	}
+
+	return hits
+}
+
+func (n *andNode) eval(s *searcher) map[string]*hit {
+	var hits map[string]*hit
+	excluded := make(map[string]bool)
+
+	for _, child := range n.children {
+		if not, ok := child.(*notNode); ok {
+			for id := range not.child.eval(s) {
+				excluded[id] = true
+			}
+			continue
+		}
+
+		childHits := child.eval(s)
+		if hits == nil {
+			hits = childHits
+			continue
+		}
+
+		for id, h := range hits {
+			other, ok := childHits[id]
+			if !ok {
+				delete(hits, id)
+				continue
+			}
+			h.score += other.score
+			h.positions = append(h.positions, other.positions...)
+		}
+	}
+
+	// Only negated children: start from every document
+	if hits == nil {
+		hits = make(map[string]*hit)
+		for id := range s.idx.docs {
+			hits[id] = &hit{}
+		}
+	}
+
+	for id := range excluded {
+		delete(hits, id)
+	}
+
+	return hits
+}
+
+func (n *orNode) eval(s *searcher) map[string]*hit {
+	hits := make(map[string]*hit)
+
+	for _, child := range n.children {
+		for id, other := range child.eval(s) {
+			h := hits[id]
+			if h == nil {
+				h = &hit{}
+				hits[id] = h
+			}
+			h.score += other.score
+			h.positions = append(h.positions, other.positions...)
+		}
+	}
+
+	return hits
+}
+
+// eval on its own matches every document not matched by the child. The
+// parser wraps negations in an andNode, which handles them directly.
+func (n *notNode) eval(s *searcher) map[string]*hit {
+	return (&andNode{[]node{n}}).eval(s)
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
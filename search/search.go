@@ -0,0 +1,167 @@
+package search
+
+import (
+	"html"
+	"sort"
+	"strings"
+)
+
+// snippetWords is how many words of context a result snippet shows.
+const snippetWords = 30
+
+// Result is a document matched by a search, best matches first.
+type Result struct {
+	ID     string  `json:"file_id"`
+	Name   string  `json:"file_name"`
+	Folder string  `json:"folder"`
+	Score  float64 `json:"score"`
+	// Snippet is an HTML excerpt of the content around the matches, with
+	// the matched words wrapped in <mark>.
+	Snippet string `json:"snippet"`
+}
+
+// Results holds a page of search results.
+type Results struct {
+	Results []Result `json:"results"`
+	Total   int      `json:"total"`
+	// Corrections maps query words that matched nothing to the indexed word
+	// used in their place.
+	Corrections map[string]string `json:"corrections,omitempty"`
+}
+
+// Search runs a query against the index and returns up to limit results,
+// ranked by BM25 score. A limit of 0 or less returns every match.
+func (idx *Index) Search(query string, limit int) (*Results, error) {
+	root, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	s := &searcher{idx: idx, corrections: make(map[string]string)}
+	hits := root.eval(s)
+
+	results := make([]Result, 0, len(hits))
+	for id, h := range hits {
+		doc := idx.docs[id]
+		results = append(results, Result{
+			ID:     doc.ID,
+			Name:   doc.Name,
+			Folder: doc.Folder,
+			Score:  h.score,
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Name < results[j].Name
+	})
+
+	total := len(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	// Only build snippets for the results being returned
+	for i := range results {
+		results[i].Snippet = idx.docs[results[i].ID].snippet(hits[results[i].ID].positions)
+	}
+
+	return &Results{Results: results, Total: total, Corrections: s.corrections}, nil
+}
+
+// snippet returns an HTML excerpt of the document's content, centred on the
+// window of words holding the most matches, with matches highlighted.
+func (d *document) snippet(positions []int) string {
+	first := d.nameTokens
+	for first < len(d.tokens) && d.tokens[first].start < 0 {
+		first++
+	}
+	if first == len(d.tokens) {
+		return ""
+	}
+
+	matched := make(map[int]bool)
+	var contentHits []int
+	for _, position := range positions {
+		if position >= first && !matched[position] {
+			matched[position] = true
+			contentHits = append(contentHits, position)
+		}
+	}
+	sort.Ints(contentHits)
+
+	// Slide a window over the matches and keep the one covering the most
+	start := first
+	best := 0
+	for i, position := range contentHits {
+		count := 0
+		for _, other := range contentHits[i:] {
+			if other >= position+snippetWords {
+				break
+			}
+			count++
+		}
+		if count > best {
+			best, start = count, position
+		}
+	}
+
+	// Show a little context before the first match
+	if len(contentHits) > 0 {
+		start = max(first, start-snippetWords/4)
+	}
+	end := min(len(d.tokens), start+snippetWords)
+
+	var b strings.Builder
+	if start > first {
+		b.WriteString("… ")
+	}
+
+	offset := d.tokens[start].start
+	for position := start; position < end; position++ {
+		t := d.tokens[position]
+		if !matched[position] {
+			continue
+		}
+		b.WriteString(cleanText(d.Text[offset:t.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(d.Text[t.start:t.end]))
+		b.WriteString("</mark>")
+		offset = t.end
+	}
+
+	// A snippet reaching the end of the note keeps its closing punctuation
+	if end == len(d.tokens) {
+		b.WriteString(cleanText(d.Text[offset:]))
+		return strings.TrimSpace(b.String())
+	}
+
+	b.WriteString(cleanText(d.Text[offset:d.tokens[end-1].end]))
+	return strings.TrimSpace(b.String()) + " …"
+}
+
+// cleanText escapes text for a snippet and collapses runs of whitespace,
+// such as line breaks, into single spaces.
+func cleanText(text string) string {
+	collapsed := strings.Join(strings.Fields(text), " ")
+	if collapsed != "" && strings.TrimLeftFunc(text, isSpace) != text {
+		collapsed = " " + collapsed
+	}
+	if collapsed != "" && strings.TrimRightFunc(text, isSpace) != text {
+		collapsed += " "
+	}
+	if collapsed == "" && text != "" {
+		collapsed = " "
+	}
+
+	return html.EscapeString(collapsed)
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
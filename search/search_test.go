@@ -0,0 +1,172 @@
+package search
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-markdown-parser/models"
+	"go-markdown-parser/store"
+)
+
+func testIndex() *Index {
+	idx := NewIndex(nil)
+	idx.Add(Document{ID: "1", Name: "groceries.md", Text: "Buy apples, bread and oat milk.\n\nRemember the apple pie recipe."})
+	idx.Add(Document{ID: "2", Name: "roadmap.md", Text: "Quarterly roadmap: ship the search feature, then the mobile app."})
+	idx.Add(Document{ID: "3", Name: "recipes.md", Text: "Apple pie: toss the apples in sugar, then add butter, flour and more apples."})
+	return idx
+}
+
+func ids(results *Results) string {
+	var ids []string
+	for _, result := range results.Results {
+		ids = append(ids, result.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestSearchQueries(t *testing.T) {
+	idx := testIndex()
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"apples", "3,1"},
+		{`"apple pie"`, "3,1"},
+		{`"pie apple"`, ""},
+		{"app*", "3,1,2"},
+		{"apple AND flour", "3"},
+		{"bread OR flour", "1,3"},
+		{"apples -butter", "1"},
+		{"NOT apples", "2"},
+		{"(bread OR sugar) butter", "3"},
+		{"roadmap", "2"},
+		{"serach", "2"},
+	}
+
+	for _, test := range tests {
+		results, err := idx.Search(test.query, 0)
+		if err != nil {
+			t.Errorf("Search(%q) failed: %v", test.query, err)
+			continue
+		}
+
+		// Ties and near ties aren't part of the contract; compare as sets
+		// where the expected order isn't meaningful.
+		got := ids(results)
+		if !sameIDs(got, test.want) {
+			t.Errorf("Search(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
+
+func sameIDs(a, b string) bool {
+	split := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, id := range strings.Split(s, ",") {
+			if id != "" {
+				set[id] = true
+			}
+		}
+		return set
+	}
+
+	setA, setB := split(a), split(b)
+	if len(setA) != len(setB) {
+		return false
+	}
+	for id := range setA {
+		if !setB[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSearchRankingAndSnippets(t *testing.T) {
+	idx := testIndex()
+
+	results, err := idx.Search("apples", 1)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+
+	// recipes.md mentions apples twice, groceries.md once
+	if results.Total != 2 || len(results.Results) != 1 || results.Results[0].ID != "3" {
+		t.Fatalf("Expected recipes.md first of 2 results, got %+v", results)
+	}
+
+	snippet := results.Results[0].Snippet
+	if !strings.Contains(snippet, "<mark>apples</mark>") {
+		t.Errorf("Expected the match to be highlighted, got %q", snippet)
+	}
+
+	results, err = idx.Search("serach", 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if results.Corrections["serach"] != "search" {
+		t.Errorf("Expected serach to be corrected to search, got %v", results.Corrections)
+	}
+	if !strings.Contains(results.Results[0].Snippet, "<mark>search</mark>") {
+		t.Errorf("Expected the corrected word to be highlighted, got %q", results.Results[0].Snippet)
+	}
+}
+
+func TestSearchIndexUpdates(t *testing.T) {
+	idx := testIndex()
+
+	idx.Add(Document{ID: "2", Name: "roadmap.md", Text: "Nothing planned <yet> & more."})
+	results, _ := idx.Search("mobile", 0)
+	if results.Total != 0 {
+		t.Errorf("Expected replaced content to be gone from the index, got %+v", results)
+	}
+
+	results, _ = idx.Search("yet", 0)
+	if results.Total != 1 || results.Results[0].Snippet != "Nothing planned &lt;<mark>yet</mark>&gt; &amp; more." {
+		t.Errorf("Expected an escaped snippet, got %+v", results)
+	}
+
+	idx.Remove("2")
+	if idx.Len() != 2 {
+		t.Errorf("Expected 2 documents after remove, got %d", idx.Len())
+	}
+
+	if _, err := idx.Search("  ", 0); err != ErrEmptyQuery {
+		t.Errorf("Expected ErrEmptyQuery, got %v", err)
+	}
+	if _, err := idx.Search("(apples", 0); err == nil {
+		t.Errorf("Expected an error for unbalanced parentheses")
+	}
+}
+
+func TestFileIndex(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	files, err := store.NewFilesystemFileStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFileIndex(files, nil, 1)
+
+	if _, err := f.SaveFile(ctx, &models.File{User_id: "u1", File_name: "plan.md", File_content: "ship apples"}); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := f.Search(ctx, "u1", "apples", 0); results.Total != 1 {
+		t.Errorf("Expected the saved note to be found, got %+v", results)
+	}
+
+	// A note added outside the app, as a git pull would, is picked up
+	os.WriteFile(filepath.Join(root, "u1", "pulled.md"), []byte("more apples"), 0o644)
+	if results, _ := f.Search(ctx, "u1", "apples", 0); results.Total != 2 {
+		t.Errorf("Expected the pulled note to be found, got %+v", results)
+	}
+
+	f.Search(ctx, "u2", "apples", 0)
+	if len(f.indexes) != 1 || f.indexes["u2"] == nil {
+		t.Errorf("Expected only the latest user's index to be kept, got %v", f.indexes)
+	}
+}
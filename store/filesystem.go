@@ -0,0 +1,643 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-markdown-parser/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// metaSuffix is appended to a note's file name to form its metadata sidecar,
+// e.g. notes.md is described by notes.md.meta.json.
+const metaSuffix = ".meta.json"
+
+// trashDir holds trashed notes, one subdirectory per file_id so notes with
+// the same name can sit in the trash together.
+const trashDir = ".trash"
+
+// filesystemFileStore keeps every note as a plain markdown file under
+// <root>/<user_id>/<folder>/<file_name>, next to a JSON sidecar holding the
+// rest of models.File. The tree can be committed and versioned with ordinary
+// git; trashed notes move to <root>/<user_id>/.trash/<file_id>/.
+type filesystemFileStore struct {
+	mu   sync.Mutex
+	root string
+	// slugs maps each slug in use to its note, and fileSlugs each note with
+	// a slug to it, so resolving and checking slugs doesn't walk every
+	// user's tree. They are built on start and kept up to date by writes.
+	slugs     map[string]slugOwner
+	fileSlugs map[string]string
+	// paths maps each note's file_id to where it was last seen on disk, so
+	// a lookup reads that one note. It is built on start, kept up to date
+	// by writes and refreshed by every listing, which picks up moves made
+	// outside the app.
+	paths map[string]string
+}
+
+// slugOwner is the note a slug belongs to
+type slugOwner struct {
+	userId string
+	fileId string
+}
+
+// NewFilesystemFileStore returns a FileStore rooted at the given directory,
+// creating it if needed.
+func NewFilesystemFileStore(root string) (FileStore, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &filesystemFileStore{
+		root:      root,
+		slugs:     make(map[string]slugOwner),
+		fileSlugs: make(map[string]string),
+		paths:     make(map[string]string),
+	}
+
+	files, err := s.listAll()
+	if err != nil {
+		return nil, err
+	}
+	for i := range files {
+		s.indexSlug(&files[i])
+	}
+
+	return s, nil
+}
+
+func (s *filesystemFileStore) SaveFile(ctx context.Context, update *models.File) (*models.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userDir, err := s.userDir(update.User_id)
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := CleanFileName(update.File_name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	file, err := s.readMeta(filepath.Join(userDir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		file = newSavedFile(update, now)
+	} else if err != nil {
+		return nil, err
+	} else {
+		applySave(file, update)
+		file.Version++
+		file.Updated_at = now
+	}
+
+	if err := s.write(userDir, file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (s *filesystemFileStore) GetFile(ctx context.Context, userId string, fileId string) (*models.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.find(userId, fileId)
+}
+
+func (s *filesystemFileStore) ListFiles(ctx context.Context, userId string) ([]models.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list(userId)
+}
+
+func (s *filesystemFileStore) FindFiles(ctx context.Context, userId string, query FileQuery) (*FilePage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := s.list(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.page(files)
+}
+
+func (s *filesystemFileStore) CreateFile(ctx context.Context, file *models.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userDir, err := s.userDir(file.User_id)
+	if err != nil {
+		return err
+	}
+
+	path, err := notePath(userDir, file)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return ErrFileExists
+	}
+
+	return s.write(userDir, file)
+}
+
+func (s *filesystemFileStore) UpdateFile(ctx context.Context, file *models.File, expectedVersion int64) (*models.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userDir, err := s.userDir(file.User_id)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.find(file.User_id, file.File_id)
+	if err != nil {
+		return nil, err
+	}
+	if existing.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	oldPath, err := notePath(userDir, existing)
+	if err != nil {
+		return nil, err
+	}
+	newPath, err := notePath(userDir, file)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.slugTaken(file) {
+		return nil, ErrSlugTaken
+	}
+
+	// Renaming, moving, trashing and restoring all change the note's path.
+	moved := oldPath != newPath
+	if moved {
+		if _, err := os.Stat(newPath); err == nil {
+			return nil, ErrFileExists
+		}
+	}
+
+	updated := *file
+	updated.Version = expectedVersion + 1
+	updated.Updated_at = time.Now()
+
+	if err := s.write(userDir, &updated); err != nil {
+		return nil, err
+	}
+
+	if moved {
+		if err := s.remove(userDir, oldPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return &updated, nil
+}
+
+func (s *filesystemFileStore) DeleteFile(ctx context.Context, userId string, fileId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userDir, err := s.userDir(userId)
+	if err != nil {
+		return err
+	}
+
+	file, err := s.find(userId, fileId)
+	if err != nil {
+		return err
+	}
+
+	path, err := notePath(userDir, file)
+	if err != nil {
+		return err
+	}
+
+	if err := s.remove(userDir, path); err != nil {
+		return err
+	}
+	s.unindexSlug(fileId)
+	delete(s.paths, fileId)
+
+	return nil
+}
+
+func (s *filesystemFileStore) GetPublicFile(ctx context.Context, slug string) (*models.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	owner, ok := s.slugs[slug]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	file, err := s.find(owner.userId, owner.fileId)
+	if err != nil {
+		return nil, err
+	}
+	// The sidecar may have been edited outside the app since it was indexed
+	if file.Slug != slug || !file.Public() {
+		return nil, ErrNotFound
+	}
+
+	return file, nil
+}
+
+// slugTaken reports whether another file, of any user, uses file's slug.
+func (s *filesystemFileStore) slugTaken(file *models.File) bool {
+	owner, ok := s.slugs[file.Slug]
+	return file.Slug != "" && ok && owner.fileId != file.File_id
+}
+
+// indexSlug records the slug a note was written with, replacing the one it
+// had before.
+func (s *filesystemFileStore) indexSlug(file *models.File) {
+	if s.fileSlugs[file.File_id] == file.Slug {
+		return
+	}
+
+	s.unindexSlug(file.File_id)
+	if file.Slug != "" {
+		s.slugs[file.Slug] = slugOwner{userId: file.User_id, fileId: file.File_id}
+		s.fileSlugs[file.File_id] = file.Slug
+	}
+}
+
+// unindexSlug frees the slug of a deleted note.
+func (s *filesystemFileStore) unindexSlug(fileId string) {
+	if slug, ok := s.fileSlugs[fileId]; ok {
+		delete(s.slugs, slug)
+		delete(s.fileSlugs, fileId)
+	}
+}
+
+// FilesStamp hashes the path, size and modification time of everything in
+// the user's tree that list reads, so edits made outside the app change it
+// without any file being read.
+func (s *filesystemFileStore) FilesStamp(ctx context.Context, userId string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	userDir, err := s.userDir(userId)
+	if err != nil {
+		return "", err
+	}
+
+	hash := fnv.New64a()
+	err = filepath.WalkDir(userDir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == userDir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+
+		relative, _ := filepath.Rel(userDir, path)
+		if entry.IsDir() {
+			if path != userDir && strings.HasPrefix(entry.Name(), ".") && relative != trashDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\x00", relative, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return strconv.FormatUint(hash.Sum64(), 16), nil
+}
+
+// listAll reads the notes of every user, to index their slugs and paths on
+// start.
+func (s *filesystemFileStore) listAll() ([]models.File, error) {
+	entries, err := os.ReadDir(s.root)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []models.File{}
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		userFiles, err := s.list(entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, userFiles...)
+	}
+
+	return files, nil
+}
+
+// find returns the user's file with the given id, reading only that note
+// unless it moved outside the app since it was indexed.
+func (s *filesystemFileStore) find(userId string, fileId string) (*models.File, error) {
+	userDir, err := s.userDir(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	path, ok := s.paths[fileId]
+	if !ok || !strings.HasPrefix(path, userDir+string(filepath.Separator)) {
+		return nil, ErrNotFound
+	}
+
+	file, err := s.read(userId, userDir, path)
+	if err == nil && file.File_id == fileId {
+		return file, nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// Something else is at the indexed path now; listing finds where the
+	// note went, if it still exists
+	delete(s.paths, fileId)
+	files, err := s.list(userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if file.File_id == fileId {
+			return &file, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// list reads every note in the user's directory tree, including the trash.
+func (s *filesystemFileStore) list(userId string) ([]models.File, error) {
+	userDir, err := s.userDir(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []models.File{}
+	err = filepath.WalkDir(userDir, func(path string, entry fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == userDir {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+
+		name := entry.Name()
+		relative, _ := filepath.Rel(userDir, path)
+
+		if entry.IsDir() {
+			// Skip hidden directories such as .git, except the trash itself.
+			if path != userDir && strings.HasPrefix(name, ".") && relative != trashDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if strings.HasPrefix(name, ".") || strings.HasSuffix(name, metaSuffix) {
+			return nil
+		}
+
+		file, err := s.read(userId, userDir, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		files = append(files, *file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Created_at.Before(files[j].Created_at)
+	})
+
+	return files, nil
+}
+
+// read reads the note at path in the user's tree and indexes where it is.
+// Live notes take their folder and name from where they sit on disk, so
+// moves made with git are picked up; markdown files added outside the app
+// get a sidecar on first sight. Trashed notes without a sidecar aren't
+// notes and read as not existing.
+func (s *filesystemFileStore) read(userId string, userDir string, path string) (*models.File, error) {
+	relative, err := filepath.Rel(userDir, path)
+	if err != nil {
+		return nil, err
+	}
+	trashed := strings.HasPrefix(relative, trashDir+string(filepath.Separator))
+
+	file, err := s.readMeta(path)
+	if errors.Is(err, fs.ErrNotExist) && !trashed {
+		file, err = s.adopt(path, userId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !trashed {
+		file.Folder = filepath.ToSlash(filepath.Dir(relative))
+		if file.Folder == "." {
+			file.Folder = ""
+		}
+		file.File_name = filepath.Base(path)
+		file.Deleted_at = nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file.File_content = string(contents)
+
+	s.paths[file.File_id] = path
+	return file, nil
+}
+
+// adopt writes a sidecar for a markdown file that doesn't have one yet.
+func (s *filesystemFileStore) adopt(path string, userId string) (*models.File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	docId := primitive.NewObjectID()
+	file := &models.File{
+		ID:         docId,
+		File_id:    docId.Hex(),
+		User_id:    userId,
+		File_name:  filepath.Base(path),
+		Version:    1,
+		Created_at: info.ModTime(),
+		Updated_at: info.ModTime(),
+	}
+
+	if err := s.writeMeta(path, file); err != nil {
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (s *filesystemFileStore) readMeta(path string) (*models.File, error) {
+	data, err := os.ReadFile(path + metaSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var file models.File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid metadata for %s: %w", path, err)
+	}
+
+	return &file, nil
+}
+
+// write stores the note's content and sidecar at the note's path.
+func (s *filesystemFileStore) write(userDir string, file *models.File) error {
+	path, err := notePath(userDir, file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(path, []byte(file.File_content)); err != nil {
+		return err
+	}
+
+	if err := s.writeMeta(path, file); err != nil {
+		return err
+	}
+	s.indexSlug(file)
+	s.paths[file.File_id] = path
+
+	return nil
+}
+
+func (s *filesystemFileStore) writeMeta(path string, file *models.File) error {
+	// The content lives in the markdown file itself.
+	meta := *file
+	meta.File_content = ""
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path+metaSuffix, append(data, '\n'))
+}
+
+// remove deletes a note and its sidecar, then any folders left empty.
+func (s *filesystemFileStore) remove(userDir string, path string) error {
+	for _, p := range []string{path, path + metaSuffix} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	for dir := filepath.Dir(path); dir != userDir && strings.HasPrefix(dir, userDir); dir = filepath.Dir(dir) {
+		// Remove fails on the first non-empty folder, which ends the cleanup.
+		if err := os.Remove(dir); err != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *filesystemFileStore) userDir(userId string) (string, error) {
+	if userId == "" || userId != filepath.Base(userId) || strings.HasPrefix(userId, ".") {
+		return "", fmt.Errorf("invalid user id %q", userId)
+	}
+
+	return filepath.Join(s.root, userId), nil
+}
+
+// notePath returns where the note's markdown file lives on disk.
+func notePath(userDir string, file *models.File) (string, error) {
+	name, err := CleanFileName(file.File_name)
+	if err != nil {
+		return "", err
+	}
+
+	if file.Trashed() {
+		return filepath.Join(userDir, trashDir, file.File_id, name), nil
+	}
+
+	folder, err := CleanFolder(file.Folder)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(userDir, filepath.FromSlash(folder), name), nil
+}
+
+// CleanFileName rejects file names that contain a path, are hidden or would
+// collide with the filesystem store's sidecars.
+func CleanFileName(fileName string) (string, error) {
+	name := filepath.Base(filepath.Clean(fileName))
+	if name != fileName || strings.HasPrefix(name, ".") || strings.HasSuffix(name, metaSuffix) {
+		return "", fmt.Errorf("invalid file name %q", fileName)
+	}
+
+	return name, nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place,
+// so readers and git never see a half-written note.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
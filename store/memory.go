@@ -0,0 +1,683 @@
+package store
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-markdown-parser/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryFileStore keeps files in a map keyed by file_id. It is meant for
+// tests and local development; nothing survives a restart.
+type memoryFileStore struct {
+	mu    sync.RWMutex
+	files map[string]models.File
+}
+
+type memoryUserStore struct {
+	mu    sync.RWMutex
+	users map[string]models.User
+}
+
+// memoryRevisionStore keeps each file's revisions in save order.
+type memoryRevisionStore struct {
+	mu        sync.RWMutex
+	revisions map[string][]models.Revision
+}
+
+type memoryShareStore struct {
+	mu     sync.RWMutex
+	shares []models.Share
+	links  []models.PublicLink
+}
+
+type memoryWorkspaceStore struct {
+	mu         sync.RWMutex
+	workspaces map[string]models.Workspace
+	members    []models.Member
+}
+
+// memoryCommentStore keeps each file's threads in creation order.
+type memoryCommentStore struct {
+	mu      sync.RWMutex
+	threads map[string][]models.Thread
+}
+
+// NewMemoryStores returns empty in-memory stores.
+func NewMemoryStores() *Stores {
+	return &Stores{
+		Files:      &memoryFileStore{files: make(map[string]models.File)},
+		Users:      &memoryUserStore{users: make(map[string]models.User)},
+		Revisions:  &memoryRevisionStore{revisions: make(map[string][]models.Revision)},
+		Shares:     &memoryShareStore{},
+		Workspaces: &memoryWorkspaceStore{workspaces: make(map[string]models.Workspace)},
+		Comments:   &memoryCommentStore{threads: make(map[string][]models.Thread)},
+	}
+}
+
+func (s *memoryFileStore) SaveFile(ctx context.Context, file *models.File) (*models.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range s.files {
+		if existing.User_id == file.User_id && existing.Folder == "" && existing.File_name == file.File_name && !existing.Trashed() {
+			applySave(&existing, file)
+			existing.Version++
+			existing.Updated_at = now
+			s.files[id] = existing
+			return &existing, nil
+		}
+	}
+
+	created := newSavedFile(file, now)
+	s.files[created.File_id] = *created
+
+	return created, nil
+}
+
+func (s *memoryFileStore) GetFile(ctx context.Context, userId string, fileId string) (*models.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	file, ok := s.files[fileId]
+	if !ok || file.User_id != userId {
+		return nil, ErrNotFound
+	}
+
+	return &file, nil
+}
+
+func (s *memoryFileStore) FindFiles(ctx context.Context, userId string, query FileQuery) (*FilePage, error) {
+	files, err := s.ListFiles(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.page(files)
+}
+
+func (s *memoryFileStore) ListFiles(ctx context.Context, userId string) ([]models.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	files := []models.File{}
+	for _, file := range s.files {
+		if file.User_id == userId {
+			files = append(files, file)
+		}
+	}
+
+	// Map iteration order is random; keep listings stable by creation order.
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Created_at.Before(files[j].Created_at)
+	})
+
+	return files, nil
+}
+
+func (s *memoryFileStore) CreateFile(ctx context.Context, file *models.File) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.files {
+		if conflicts(&existing, file) {
+			return ErrFileExists
+		}
+	}
+
+	s.files[file.File_id] = *file
+	return nil
+}
+
+func (s *memoryFileStore) UpdateFile(ctx context.Context, file *models.File, expectedVersion int64) (*models.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.files[file.File_id]
+	if !ok || existing.User_id != file.User_id {
+		return nil, ErrNotFound
+	}
+	if existing.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	for _, other := range s.files {
+		if conflicts(&other, file) {
+			return nil, ErrFileExists
+		}
+		if slugConflicts(&other, file) {
+			return nil, ErrSlugTaken
+		}
+	}
+
+	updated := *file
+	updated.Version = expectedVersion + 1
+	updated.Updated_at = time.Now()
+	s.files[file.File_id] = updated
+
+	return &updated, nil
+}
+
+func (s *memoryFileStore) DeleteFile(ctx context.Context, userId string, fileId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, ok := s.files[fileId]
+	if !ok || file.User_id != userId {
+		return ErrNotFound
+	}
+
+	delete(s.files, fileId)
+	return nil
+}
+
+func (s *memoryFileStore) GetPublicFile(ctx context.Context, slug string) (*models.File, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, file := range s.files {
+		if file.Slug == slug && file.Public() {
+			return &file, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memoryUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[user.User_id] = *user
+	return nil
+}
+
+func (s *memoryUserStore) CountUsersByEmail(ctx context.Context, email string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var count int64
+	for _, user := range s.users {
+		if user.Email != nil && strings.EqualFold(*user.Email, email) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (s *memoryUserStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if user.Email != nil && *user.Email == email {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memoryUserStore) GetUserById(ctx context.Context, userId string) (*models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+func (s *memoryUserStore) UpdateTokens(ctx context.Context, userId string, token string, refreshToken string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Mirror the Mongo upsert: an unknown user id creates a bare record.
+	user, ok := s.users[userId]
+	if !ok {
+		user = models.User{ID: primitive.NewObjectID(), User_id: userId}
+	}
+
+	user.Token = &token
+	user.Refresh_token = &refreshToken
+	user.Updated_at = time.Now()
+	s.users[userId] = user
+
+	return &user, nil
+}
+
+func (s *memoryUserStore) UpdateRenderOptions(ctx context.Context, userId string, options *models.RenderOptions) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	user.Render_options = nil
+	if options != nil {
+		copied := *options
+		user.Render_options = &copied
+	}
+	user.Updated_at = time.Now()
+	s.users[userId] = user
+
+	return &user, nil
+}
+
+func (s *memoryRevisionStore) AddRevision(ctx context.Context, revision *models.Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.revisions[revision.File_id] = append(s.revisions[revision.File_id], *revision)
+	return nil
+}
+
+func (s *memoryRevisionStore) ListRevisions(ctx context.Context, fileId string) ([]models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored := s.revisions[fileId]
+	revisions := make([]models.Revision, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		revisions = append(revisions, stored[i])
+	}
+
+	return revisions, nil
+}
+
+func (s *memoryRevisionStore) DeleteRevisions(ctx context.Context, fileId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.revisions, fileId)
+	return nil
+}
+
+func (s *memoryRevisionStore) GetRevision(ctx context.Context, fileId string, revisionId string) (*models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, revision := range s.revisions[fileId] {
+		if revision.Revision_id == revisionId {
+			return &revision, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memoryRevisionStore) LatestRevision(ctx context.Context, fileId string) (*models.Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored := s.revisions[fileId]
+	if len(stored) == 0 {
+		return nil, ErrNotFound
+	}
+
+	revision := stored[len(stored)-1]
+	return &revision, nil
+}
+
+func (s *memoryShareStore) SaveShare(ctx context.Context, share *models.Share) (*models.Share, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.shares {
+		if sameGrant(&existing, share) {
+			s.shares[i].Permission = share.Permission
+			saved := s.shares[i]
+			return &saved, nil
+		}
+	}
+
+	s.shares = append(s.shares, *share)
+	return share, nil
+}
+
+func (s *memoryShareStore) ListShares(ctx context.Context, ownerId string) ([]models.Share, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shares := []models.Share{}
+	for _, share := range s.shares {
+		if share.Owner_id == ownerId {
+			shares = append(shares, share)
+		}
+	}
+
+	return shares, nil
+}
+
+func (s *memoryShareStore) ListSharedWith(ctx context.Context, granteeId string) ([]models.Share, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	shares := []models.Share{}
+	for _, share := range s.shares {
+		if share.Grantee_id == granteeId {
+			shares = append(shares, share)
+		}
+	}
+
+	return shares, nil
+}
+
+func (s *memoryShareStore) DeleteShare(ctx context.Context, ownerId string, shareId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, share := range s.shares {
+		if share.Owner_id == ownerId && share.Share_id == shareId {
+			s.shares = append(s.shares[:i], s.shares[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryShareStore) DeleteFileShares(ctx context.Context, ownerId string, fileId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shares := s.shares[:0]
+	for _, share := range s.shares {
+		if share.Owner_id != ownerId || share.File_id != fileId {
+			shares = append(shares, share)
+		}
+	}
+	s.shares = shares
+
+	links := s.links[:0]
+	for _, link := range s.links {
+		if link.Owner_id != ownerId || link.File_id != fileId {
+			links = append(links, link)
+		}
+	}
+	s.links = links
+
+	return nil
+}
+
+func (s *memoryShareStore) CreateLink(ctx context.Context, link *models.PublicLink) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.links = append(s.links, *link)
+	return nil
+}
+
+func (s *memoryShareStore) GetLink(ctx context.Context, token string) (*models.PublicLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, link := range s.links {
+		if link.Token == token {
+			return &link, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memoryShareStore) ListLinks(ctx context.Context, ownerId string, fileId string) ([]models.PublicLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	links := []models.PublicLink{}
+	for _, link := range s.links {
+		if link.Owner_id == ownerId && link.File_id == fileId {
+			links = append(links, link)
+		}
+	}
+
+	return links, nil
+}
+
+func (s *memoryShareStore) DeleteLink(ctx context.Context, ownerId string, linkId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, link := range s.links {
+		if link.Owner_id == ownerId && link.Link_id == linkId {
+			s.links = append(s.links[:i], s.links[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryWorkspaceStore) CreateWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.workspaces[workspace.Workspace_id] = *workspace
+	return nil
+}
+
+func (s *memoryWorkspaceStore) GetWorkspace(ctx context.Context, workspaceId string) (*models.Workspace, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	workspace, ok := s.workspaces[workspaceId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &workspace, nil
+}
+
+func (s *memoryWorkspaceStore) RenameWorkspace(ctx context.Context, workspaceId string, name string) (*models.Workspace, error) {
+	return s.update(workspaceId, func(workspace *models.Workspace) {
+		workspace.Name = name
+	})
+}
+
+func (s *memoryWorkspaceStore) UpdateDictionary(ctx context.Context, workspaceId string, add []string, remove []string) (*models.Workspace, error) {
+	return s.update(workspaceId, func(workspace *models.Workspace) {
+		workspace.Dictionary = updateDictionary(workspace.Dictionary, add, remove)
+	})
+}
+
+// update applies change to a workspace under the write lock.
+func (s *memoryWorkspaceStore) update(workspaceId string, change func(*models.Workspace)) (*models.Workspace, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	workspace, ok := s.workspaces[workspaceId]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	change(&workspace)
+	workspace.Updated_at = time.Now()
+	s.workspaces[workspaceId] = workspace
+
+	return &workspace, nil
+}
+
+func (s *memoryWorkspaceStore) SaveMember(ctx context.Context, member *models.Member) (*models.Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, existing := range s.members {
+		if existing.Workspace_id == member.Workspace_id && existing.User_id == member.User_id {
+			s.members[i].Role = member.Role
+			saved := s.members[i]
+			return &saved, nil
+		}
+	}
+
+	s.members = append(s.members, *member)
+	return member, nil
+}
+
+func (s *memoryWorkspaceStore) GetMember(ctx context.Context, workspaceId string, userId string) (*models.Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, member := range s.members {
+		if member.Workspace_id == workspaceId && member.User_id == userId {
+			return &member, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memoryWorkspaceStore) ListMembers(ctx context.Context, workspaceId string) ([]models.Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := []models.Member{}
+	for _, member := range s.members {
+		if member.Workspace_id == workspaceId {
+			members = append(members, member)
+		}
+	}
+
+	return members, nil
+}
+
+func (s *memoryWorkspaceStore) ListMemberships(ctx context.Context, userId string) ([]models.Member, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := []models.Member{}
+	for _, member := range s.members {
+		if member.User_id == userId {
+			members = append(members, member)
+		}
+	}
+
+	return members, nil
+}
+
+func (s *memoryWorkspaceStore) RemoveMember(ctx context.Context, workspaceId string, userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, member := range s.members {
+		if member.Workspace_id == workspaceId && member.User_id == userId {
+			s.members = append(s.members[:i], s.members[i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryCommentStore) CreateThread(ctx context.Context, thread *models.Thread) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.threads[thread.File_id] = append(s.threads[thread.File_id], copyThread(thread))
+	return nil
+}
+
+func (s *memoryCommentStore) GetThread(ctx context.Context, fileId string, threadId string) (*models.Thread, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, thread := range s.threads[fileId] {
+		if thread.Thread_id == threadId {
+			found := copyThread(&thread)
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memoryCommentStore) ListThreads(ctx context.Context, fileId string) ([]models.Thread, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	threads := make([]models.Thread, 0, len(s.threads[fileId]))
+	for _, thread := range s.threads[fileId] {
+		threads = append(threads, copyThread(&thread))
+	}
+
+	return threads, nil
+}
+
+func (s *memoryCommentStore) AddComment(ctx context.Context, fileId string, threadId string, comment *models.Comment) (*models.Thread, error) {
+	return s.update(fileId, threadId, func(thread *models.Thread) {
+		thread.Comments = append(thread.Comments, *comment)
+		thread.Updated_at = comment.Created_at
+	})
+}
+
+func (s *memoryCommentStore) ResolveThread(ctx context.Context, fileId string, threadId string, resolvedBy string) (*models.Thread, error) {
+	return s.update(fileId, threadId, func(thread *models.Thread) {
+		resolveThread(thread, resolvedBy, time.Now())
+	})
+}
+
+func (s *memoryCommentStore) UpdateAnchor(ctx context.Context, fileId string, threadId string, anchor models.Anchor) error {
+	_, err := s.update(fileId, threadId, func(thread *models.Thread) {
+		thread.Anchor = anchor
+	})
+	return err
+}
+
+// update applies change to a stored thread and returns a copy of the result.
+func (s *memoryCommentStore) update(fileId string, threadId string, change func(*models.Thread)) (*models.Thread, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, thread := range s.threads[fileId] {
+		if thread.Thread_id == threadId {
+			updated := copyThread(&thread)
+			change(&updated)
+			s.threads[fileId][i] = updated
+
+			result := copyThread(&updated)
+			return &result, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memoryCommentStore) DeleteThread(ctx context.Context, fileId string, threadId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, thread := range s.threads[fileId] {
+		if thread.Thread_id == threadId {
+			s.threads[fileId] = append(s.threads[fileId][:i], s.threads[fileId][i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryCommentStore) DeleteThreads(ctx context.Context, fileId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.threads, fileId)
+	return nil
+}
+
+// copyThread copies a thread so callers can't modify the stored comments.
+func copyThread(thread *models.Thread) models.Thread {
+	copied := *thread
+	copied.Comments = append([]models.Comment{}, thread.Comments...)
+	return copied
+}
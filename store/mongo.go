@@ -0,0 +1,1031 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go-markdown-parser/database"
+	"go-markdown-parser/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoFileStore struct {
+	collection *mongo.Collection
+}
+
+type mongoUserStore struct {
+	collection *mongo.Collection
+}
+
+type mongoRevisionStore struct {
+	collection *mongo.Collection
+}
+
+type mongoShareStore struct {
+	shares *mongo.Collection
+	links  *mongo.Collection
+}
+
+type mongoWorkspaceStore struct {
+	workspaces *mongo.Collection
+	members    *mongo.Collection
+}
+
+type mongoCommentStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStores connects to MongoDB and returns stores backed by the
+// "file", "user", "revision", "share", "link", "workspace", "member" and
+// "thread" collections, creating their indexes.
+func NewMongoStores() (*Stores, error) {
+	client := database.StartDB()
+
+	files := &mongoFileStore{collection: database.OpenCollection(client, "file")}
+	if err := files.createIndexes(); err != nil {
+		return nil, err
+	}
+
+	shares := &mongoShareStore{
+		shares: database.OpenCollection(client, "share"),
+		links:  database.OpenCollection(client, "link"),
+	}
+	if err := shares.createIndexes(); err != nil {
+		return nil, err
+	}
+
+	workspaces := &mongoWorkspaceStore{
+		workspaces: database.OpenCollection(client, "workspace"),
+		members:    database.OpenCollection(client, "member"),
+	}
+	if err := workspaces.createIndexes(); err != nil {
+		return nil, err
+	}
+
+	comments := &mongoCommentStore{collection: database.OpenCollection(client, "thread")}
+	if err := comments.createIndexes(); err != nil {
+		return nil, err
+	}
+
+	return &Stores{
+		Files:      files,
+		Users:      &mongoUserStore{collection: database.OpenCollection(client, "user")},
+		Revisions:  &mongoRevisionStore{collection: database.OpenCollection(client, "revision")},
+		Shares:     shares,
+		Workspaces: workspaces,
+		Comments:   comments,
+	}, nil
+}
+
+// livePathIndex keeps the paths of a user's live notes unique, so
+// concurrent creates and moves can't both take one. Trashed notes are left
+// out: the trash may hold several notes that had the same path.
+const livePathIndex = "live_path"
+
+// publicSlugIndex keeps slugs unique, so two notes published at once can't
+// both take one. Notes that were never published store an empty slug and
+// are left out.
+const publicSlugIndex = "public_slug"
+
+// replacedFileIndexes are indexes created by earlier versions under the keys
+// of ones that now have other options. They are dropped first, since an
+// index can't be created beside one on the same keys.
+var replacedFileIndexes = []string{"user_id_1_folder_1_file_name_1", "slug_1"}
+
+// createIndexes backs the per-user lookups: by name within a folder, by tag
+// and by date, and the lookup of published notes by slug. Creating an index that already exists is a no-op.
+func (s *mongoFileStore) createIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, name := range replacedFileIndexes {
+		if _, err := s.collection.Indexes().DropOne(ctx, name); err != nil && !indexNotFound(err) {
+			log.Printf("Error dropping file index %v: %v", name, err.Error())
+			return err
+		}
+	}
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "file_id", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "folder", Value: 1}, {Key: "file_name", Value: 1}},
+			Options: options.Index().SetName(livePathIndex).SetUnique(true).
+				SetPartialFilterExpression(bson.M{"deleted_at": bson.M{"$type": "null"}}),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "tags", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: 1}, {Key: "file_id", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "slug", Value: 1}},
+			Options: options.Index().SetName(publicSlugIndex).SetUnique(true).
+				SetPartialFilterExpression(bson.M{"slug": bson.M{"$gt": ""}}),
+		},
+	})
+	if err != nil {
+		log.Printf("Error creating file indexes: %v", err.Error())
+	}
+
+	return err
+}
+
+// indexNotFound reports whether dropping an index failed because it, or its
+// collection, doesn't exist.
+func indexNotFound(err error) bool {
+	var commandErr mongo.CommandError
+	return errors.As(err, &commandErr) && (commandErr.Name == "IndexNotFound" || commandErr.Name == "NamespaceNotFound")
+}
+
+// duplicateKey reports whether err is a write refused by the named unique
+// index.
+func duplicateKey(err error, index string) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "index: "+index+" ")
+}
+
+func (s *mongoFileStore) SaveFile(ctx context.Context, update *models.File) (*models.File, error) {
+	fileFilter := bson.M{
+		"file_name":  update.File_name,
+		"user_id":    update.User_id,
+		"folder":     bson.M{"$in": bson.A{"", nil}},
+		"deleted_at": nil,
+	}
+
+	// Prepare the file document
+	now := time.Now()
+	fileDoc := bson.M{
+		"file_name":         update.File_name,
+		"user_id":           update.User_id,
+		"file_content":      update.File_content,
+		"misspelled_count":  update.Misspelled_count,
+		"original_encoding": update.Original_encoding,
+		"updated_at":        now,
+	}
+	if update.Tags != nil {
+		fileDoc["tags"] = update.Tags
+	}
+
+	// Update the file and return the updated document
+	var file models.File
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		fileFilter,
+		bson.M{"$set": fileDoc, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&file)
+
+	if err == nil {
+		return &file, nil
+	}
+
+	if err != mongo.ErrNoDocuments {
+		log.Printf("Error occurred while updating file: %v", err.Error())
+		return nil, err
+	}
+
+	// If no document was updated, create new one
+	created := newSavedFile(update, now)
+
+	if _, err := s.collection.InsertOne(ctx, created); err != nil {
+		log.Printf("Failed to create new file: %v", err.Error())
+		return nil, err
+	}
+
+	return created, nil
+}
+
+func (s *mongoFileStore) GetFile(ctx context.Context, userId string, fileId string) (*models.File, error) {
+	filter := bson.M{
+		"user_id": userId,
+		"file_id": fileId,
+	}
+
+	var file models.File
+	if err := s.collection.FindOne(ctx, filter).Decode(&file); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+func (s *mongoFileStore) FindFiles(ctx context.Context, userId string, query FileQuery) (*FilePage, error) {
+	cursor, err := query.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"user_id": userId, "deleted_at": nil}
+
+	if query.Tag != "" {
+		filter["tags"] = query.Tag
+	}
+
+	if query.Prefix != "" {
+		filter["file_name"] = bson.M{"$regex": "^" + regexp.QuoteMeta(query.Prefix), "$options": "i"}
+	}
+
+	updated := bson.M{}
+	if !query.From.IsZero() {
+		updated["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		updated["$lte"] = query.To
+	}
+	if len(updated) > 0 {
+		filter["updated_at"] = updated
+	}
+
+	if query.HasMisspellings != nil {
+		if *query.HasMisspellings {
+			filter["misspelled_count"] = bson.M{"$gt": 0}
+		} else {
+			filter["misspelled_count"] = bson.M{"$not": bson.M{"$gt": 0}}
+		}
+	}
+
+	// Names sort case-insensitively, as in the other backends
+	collation := &options.Collation{Locale: "en", Strength: 2}
+
+	total, err := s.collection.CountDocuments(ctx, filter, options.Count().SetCollation(collation))
+	if err != nil {
+		return nil, err
+	}
+
+	field, descending := query.sortField()
+	order, after := 1, "$gt"
+	if descending {
+		order, after = -1, "$lt"
+	}
+	sortKey := map[string]string{"name": "file_name", "created": "created_at", "updated": "updated_at"}[field]
+
+	// Keyset pagination: continue after the cursor's sort value and file_id
+	if cursor != nil {
+		var value interface{} = cursor.Time
+		if field == "name" {
+			value = cursor.Name
+		}
+
+		filter = bson.M{"$and": bson.A{filter, bson.M{"$or": bson.A{
+			bson.M{sortKey: bson.M{after: value}},
+			bson.M{sortKey: value, "file_id": bson.M{after: cursor.ID}},
+		}}}}
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: sortKey, Value: order}, {Key: "file_id", Value: order}}).
+		SetCollation(collation)
+	if query.Limit > 0 {
+		// One extra file tells whether there is a next page
+		findOptions.SetLimit(int64(query.Limit) + 1)
+	}
+	if query.WithoutContent {
+		findOptions.SetProjection(bson.M{"file_content": 0})
+	}
+
+	results, err := s.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &FilePage{Files: []models.File{}, Total: total}
+	if err := results.All(ctx, &page.Files); err != nil {
+		return nil, err
+	}
+
+	if query.Limit > 0 && len(page.Files) > query.Limit {
+		page.Files = page.Files[:query.Limit]
+		page.Next = query.nextCursor(&page.Files[query.Limit-1])
+	}
+
+	return page, nil
+}
+
+func (s *mongoFileStore) ListFiles(ctx context.Context, userId string) ([]models.File, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"user_id": userId})
+	if err != nil {
+		return nil, err
+	}
+
+	files := []models.File{}
+	if err := cursor.All(ctx, &files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func (s *mongoFileStore) CreateFile(ctx context.Context, file *models.File) error {
+	if taken, err := s.fileNameTaken(ctx, file); err != nil {
+		return err
+	} else if taken {
+		return ErrFileExists
+	}
+
+	// The check above leaves a window for concurrent creates that the
+	// index closes
+	_, err := s.collection.InsertOne(ctx, file)
+	if duplicateKey(err, livePathIndex) {
+		return ErrFileExists
+	}
+	if duplicateKey(err, publicSlugIndex) {
+		return ErrSlugTaken
+	}
+	return err
+}
+
+func (s *mongoFileStore) UpdateFile(ctx context.Context, file *models.File, expectedVersion int64) (*models.File, error) {
+	if taken, err := s.fileNameTaken(ctx, file); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrFileExists
+	}
+
+	if file.Slug != "" {
+		count, err := s.collection.CountDocuments(ctx, bson.M{
+			"slug":    file.Slug,
+			"file_id": bson.M{"$ne": file.File_id},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrSlugTaken
+		}
+	}
+
+	filter := bson.M{
+		"user_id": file.User_id,
+		"file_id": file.File_id,
+		"version": expectedVersion,
+	}
+	// Files saved before versioning have no version field and count as 0.
+	if expectedVersion == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+	}
+
+	updated := *file
+	updated.Version = expectedVersion + 1
+	updated.Updated_at = time.Now()
+
+	result, err := s.collection.ReplaceOne(ctx, filter, updated)
+	if duplicateKey(err, livePathIndex) {
+		return nil, ErrFileExists
+	}
+	if duplicateKey(err, publicSlugIndex) {
+		return nil, ErrSlugTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if result.MatchedCount == 0 {
+		// Tell a missing file apart from one that moved on to a newer version.
+		if _, err := s.GetFile(ctx, file.User_id, file.File_id); err != nil {
+			return nil, err
+		}
+		return nil, ErrVersionConflict
+	}
+
+	return &updated, nil
+}
+
+func (s *mongoFileStore) DeleteFile(ctx context.Context, userId string, fileId string) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{
+		"user_id": userId,
+		"file_id": fileId,
+	})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *mongoFileStore) GetPublicFile(ctx context.Context, slug string) (*models.File, error) {
+	var file models.File
+	err := s.collection.FindOne(ctx, bson.M{
+		"slug":       slug,
+		"visibility": models.VisibilityPublic,
+		"deleted_at": nil,
+	}).Decode(&file)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// fileNameTaken reports whether another of the user's live files already
+// uses file's name in the same folder. A trashed file never conflicts.
+func (s *mongoFileStore) fileNameTaken(ctx context.Context, file *models.File) (bool, error) {
+	if file.Trashed() {
+		return false, nil
+	}
+
+	filter := bson.M{
+		"user_id":    file.User_id,
+		"file_name":  file.File_name,
+		"file_id":    bson.M{"$ne": file.File_id},
+		"folder":     file.Folder,
+		"deleted_at": nil,
+	}
+	// Files saved before folders existed have no folder field and live in the root.
+	if file.Folder == "" {
+		filter["folder"] = bson.M{"$in": bson.A{"", nil}}
+	}
+
+	count, err := s.collection.CountDocuments(ctx, filter)
+	return count > 0, err
+}
+
+func (s *mongoUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	_, err := s.collection.InsertOne(ctx, user)
+	return err
+}
+
+func (s *mongoUserStore) CountUsersByEmail(ctx context.Context, email string) (int64, error) {
+	regexpMatch := bson.M{
+		"$regex": primitive.Regex{
+			Pattern: "^" + regexp.QuoteMeta(email) + "$",
+			Options: "i",
+		},
+	}
+
+	return s.collection.CountDocuments(ctx, bson.M{"email": regexpMatch})
+}
+
+func (s *mongoUserStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.findOne(ctx, bson.M{"email": email})
+}
+
+func (s *mongoUserStore) GetUserById(ctx context.Context, userId string) (*models.User, error) {
+	return s.findOne(ctx, bson.M{"user_id": userId})
+}
+
+func (s *mongoUserStore) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := s.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *mongoUserStore) UpdateTokens(ctx context.Context, userId string, token string, refreshToken string) (*models.User, error) {
+	// Initialize the update document
+	updateTokenDocs := bson.D{
+		{
+			Key:   "token",
+			Value: token,
+		},
+		{
+			Key:   "refresh_token",
+			Value: refreshToken,
+		},
+		{
+			Key:   "updated_at",
+			Value: time.Now(),
+		},
+	}
+
+	// Specify options for upsert and to return the updated document
+	opt := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var updatedUser models.User
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"user_id": userId},
+		bson.D{
+			{
+				Key:   "$set",
+				Value: updateTokenDocs,
+			},
+		},
+		opt,
+	).Decode(&updatedUser)
+
+	if err != nil {
+		log.Printf("Error updating token for user %s: %v", userId, err.Error())
+		return nil, err
+	}
+
+	return &updatedUser, nil
+}
+
+func (s *mongoUserStore) UpdateRenderOptions(ctx context.Context, userId string, renderOptions *models.RenderOptions) (*models.User, error) {
+	update := bson.M{"$set": bson.M{"render_options": renderOptions, "updated_at": time.Now()}}
+	if renderOptions == nil {
+		update = bson.M{"$unset": bson.M{"render_options": ""}, "$set": bson.M{"updated_at": time.Now()}}
+	}
+
+	var updatedUser models.User
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"user_id": userId},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updatedUser)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &updatedUser, nil
+}
+
+func (s *mongoRevisionStore) AddRevision(ctx context.Context, revision *models.Revision) error {
+	_, err := s.collection.InsertOne(ctx, revision)
+	return err
+}
+
+func (s *mongoRevisionStore) DeleteRevisions(ctx context.Context, fileId string) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"file_id": fileId})
+	return err
+}
+
+func (s *mongoRevisionStore) ListRevisions(ctx context.Context, fileId string) ([]models.Revision, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+
+	cursor, err := s.collection.Find(ctx, bson.M{"file_id": fileId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions := []models.Revision{}
+	if err := cursor.All(ctx, &revisions); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+func (s *mongoRevisionStore) LatestRevision(ctx context.Context, fileId string) (*models.Revision, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}})
+
+	var revision models.Revision
+	err := s.collection.FindOne(ctx, bson.M{"file_id": fileId}, opts).Decode(&revision)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (s *mongoRevisionStore) GetRevision(ctx context.Context, fileId string, revisionId string) (*models.Revision, error) {
+	filter := bson.M{
+		"file_id":     fileId,
+		"revision_id": revisionId,
+	}
+
+	var revision models.Revision
+	if err := s.collection.FindOne(ctx, filter).Decode(&revision); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+// createIndexes backs share lookups by owner and grantee, and makes link
+// tokens unique.
+func (s *mongoShareStore) createIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := s.shares.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}}},
+		{Keys: bson.D{{Key: "grantee_id", Value: 1}}},
+	})
+	if err == nil {
+		_, err = s.links.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "token", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "file_id", Value: 1}}},
+		})
+	}
+	if err != nil {
+		log.Printf("Error creating share indexes: %v", err.Error())
+	}
+
+	return err
+}
+
+func (s *mongoShareStore) SaveShare(ctx context.Context, share *models.Share) (*models.Share, error) {
+	filter := bson.M{
+		"owner_id":   share.Owner_id,
+		"grantee_id": share.Grantee_id,
+		"file_id":    share.File_id,
+		"folder":     share.Folder,
+	}
+
+	// Keep the id and creation time of an existing grant, updating its permission
+	var saved models.Share
+	err := s.shares.FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{
+			"$set":         bson.M{"permission": share.Permission},
+			"$setOnInsert": bson.M{"_id": share.ID, "share_id": share.Share_id, "created_at": share.Created_at},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+func (s *mongoShareStore) ListShares(ctx context.Context, ownerId string) ([]models.Share, error) {
+	return s.findShares(ctx, bson.M{"owner_id": ownerId})
+}
+
+func (s *mongoShareStore) ListSharedWith(ctx context.Context, granteeId string) ([]models.Share, error) {
+	return s.findShares(ctx, bson.M{"grantee_id": granteeId})
+}
+
+func (s *mongoShareStore) findShares(ctx context.Context, filter bson.M) ([]models.Share, error) {
+	cursor, err := s.shares.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	shares := []models.Share{}
+	if err := cursor.All(ctx, &shares); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+func (s *mongoShareStore) DeleteShare(ctx context.Context, ownerId string, shareId string) error {
+	result, err := s.shares.DeleteOne(ctx, bson.M{"owner_id": ownerId, "share_id": shareId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mongoShareStore) DeleteFileShares(ctx context.Context, ownerId string, fileId string) error {
+	filter := bson.M{"owner_id": ownerId, "file_id": fileId}
+	if _, err := s.shares.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+
+	_, err := s.links.DeleteMany(ctx, filter)
+	return err
+}
+
+func (s *mongoShareStore) CreateLink(ctx context.Context, link *models.PublicLink) error {
+	_, err := s.links.InsertOne(ctx, link)
+	return err
+}
+
+func (s *mongoShareStore) GetLink(ctx context.Context, token string) (*models.PublicLink, error) {
+	var link models.PublicLink
+	if err := s.links.FindOne(ctx, bson.M{"token": token}).Decode(&link); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+func (s *mongoShareStore) ListLinks(ctx context.Context, ownerId string, fileId string) ([]models.PublicLink, error) {
+	cursor, err := s.links.Find(ctx,
+		bson.M{"owner_id": ownerId, "file_id": fileId},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []models.PublicLink{}
+	if err := cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+func (s *mongoShareStore) DeleteLink(ctx context.Context, ownerId string, linkId string) error {
+	result, err := s.links.DeleteOne(ctx, bson.M{"owner_id": ownerId, "link_id": linkId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// createIndexes backs the lookups of workspaces by id and of members by
+// workspace and by user. A user is a member of a workspace at most once.
+func (s *mongoWorkspaceStore) createIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := s.workspaces.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "workspace_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err == nil {
+		_, err = s.members.Indexes().CreateMany(ctx, []mongo.IndexModel{
+			{Keys: bson.D{{Key: "workspace_id", Value: 1}, {Key: "user_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		})
+	}
+	if err != nil {
+		log.Printf("Error creating workspace indexes: %v", err.Error())
+	}
+
+	return err
+}
+
+func (s *mongoWorkspaceStore) CreateWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	_, err := s.workspaces.InsertOne(ctx, workspace)
+	return err
+}
+
+func (s *mongoWorkspaceStore) GetWorkspace(ctx context.Context, workspaceId string) (*models.Workspace, error) {
+	var workspace models.Workspace
+	err := s.workspaces.FindOne(ctx, bson.M{"workspace_id": workspaceId}).Decode(&workspace)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+func (s *mongoWorkspaceStore) RenameWorkspace(ctx context.Context, workspaceId string, name string) (*models.Workspace, error) {
+	return s.update(ctx, workspaceId, bson.M{
+		"$set": bson.M{"name": name, "updated_at": time.Now()},
+	})
+}
+
+func (s *mongoWorkspaceStore) UpdateDictionary(ctx context.Context, workspaceId string, add []string, remove []string) (*models.Workspace, error) {
+	if add == nil {
+		add = []string{}
+	}
+	if remove == nil {
+		remove = []string{}
+	}
+
+	// An update pipeline applies both changes atomically
+	workspace, err := s.update(ctx, workspaceId, bson.A{
+		bson.M{"$set": bson.M{
+			"dictionary": bson.M{"$setDifference": bson.A{
+				bson.M{"$setUnion": bson.A{bson.M{"$ifNull": bson.A{"$dictionary", bson.A{}}}, add}},
+				remove,
+			}},
+			"updated_at": time.Now(),
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	workspace.Dictionary = updateDictionary(workspace.Dictionary, nil, nil)
+	return workspace, nil
+}
+
+// update applies an update document or pipeline to a workspace and returns it.
+func (s *mongoWorkspaceStore) update(ctx context.Context, workspaceId string, update any) (*models.Workspace, error) {
+	var workspace models.Workspace
+	err := s.workspaces.FindOneAndUpdate(
+		ctx,
+		bson.M{"workspace_id": workspaceId},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&workspace)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+func (s *mongoWorkspaceStore) SaveMember(ctx context.Context, member *models.Member) (*models.Member, error) {
+	// Keep the id and join time of an existing member, updating their role
+	var saved models.Member
+	err := s.members.FindOneAndUpdate(
+		ctx,
+		bson.M{"workspace_id": member.Workspace_id, "user_id": member.User_id},
+		bson.M{
+			"$set":         bson.M{"role": member.Role},
+			"$setOnInsert": bson.M{"_id": member.ID, "created_at": member.Created_at},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&saved)
+	if err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+func (s *mongoWorkspaceStore) GetMember(ctx context.Context, workspaceId string, userId string) (*models.Member, error) {
+	var member models.Member
+	err := s.members.FindOne(ctx, bson.M{"workspace_id": workspaceId, "user_id": userId}).Decode(&member)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+func (s *mongoWorkspaceStore) ListMembers(ctx context.Context, workspaceId string) ([]models.Member, error) {
+	return s.findMembers(ctx, bson.M{"workspace_id": workspaceId})
+}
+
+func (s *mongoWorkspaceStore) ListMemberships(ctx context.Context, userId string) ([]models.Member, error) {
+	return s.findMembers(ctx, bson.M{"user_id": userId})
+}
+
+func (s *mongoWorkspaceStore) findMembers(ctx context.Context, filter bson.M) ([]models.Member, error) {
+	cursor, err := s.members.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	members := []models.Member{}
+	if err := cursor.All(ctx, &members); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (s *mongoWorkspaceStore) RemoveMember(ctx context.Context, workspaceId string, userId string) error {
+	result, err := s.members.DeleteOne(ctx, bson.M{"workspace_id": workspaceId, "user_id": userId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// createIndexes backs listing a note's threads and looking one up.
+func (s *mongoCommentStore) createIndexes() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "file_id", Value: 1}, {Key: "thread_id", Value: 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating thread indexes: %v", err.Error())
+	}
+
+	return err
+}
+
+func (s *mongoCommentStore) CreateThread(ctx context.Context, thread *models.Thread) error {
+	_, err := s.collection.InsertOne(ctx, thread)
+	return err
+}
+
+func (s *mongoCommentStore) GetThread(ctx context.Context, fileId string, threadId string) (*models.Thread, error) {
+	var thread models.Thread
+	err := s.collection.FindOne(ctx, bson.M{"file_id": fileId, "thread_id": threadId}).Decode(&thread)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &thread, nil
+}
+
+func (s *mongoCommentStore) ListThreads(ctx context.Context, fileId string) ([]models.Thread, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := s.collection.Find(ctx, bson.M{"file_id": fileId}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := []models.Thread{}
+	if err := cursor.All(ctx, &threads); err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+func (s *mongoCommentStore) AddComment(ctx context.Context, fileId string, threadId string, comment *models.Comment) (*models.Thread, error) {
+	return s.update(ctx, fileId, threadId, bson.M{
+		"$push": bson.M{"comments": comment},
+		"$set":  bson.M{"updated_at": comment.Created_at},
+	})
+}
+
+func (s *mongoCommentStore) ResolveThread(ctx context.Context, fileId string, threadId string, resolvedBy string) (*models.Thread, error) {
+	var resolution models.Thread
+	resolveThread(&resolution, resolvedBy, time.Now())
+
+	return s.update(ctx, fileId, threadId, bson.M{
+		"$set": bson.M{
+			"resolved":    resolution.Resolved,
+			"resolved_by": resolution.Resolved_by,
+			"resolved_at": resolution.Resolved_at,
+			"updated_at":  resolution.Updated_at,
+		},
+	})
+}
+
+func (s *mongoCommentStore) UpdateAnchor(ctx context.Context, fileId string, threadId string, anchor models.Anchor) error {
+	_, err := s.update(ctx, fileId, threadId, bson.M{"$set": bson.M{"anchor": anchor}})
+	return err
+}
+
+// update applies an update document to a thread and returns it.
+func (s *mongoCommentStore) update(ctx context.Context, fileId string, threadId string, update any) (*models.Thread, error) {
+	var thread models.Thread
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"file_id": fileId, "thread_id": threadId},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&thread)
+
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &thread, nil
+}
+
+func (s *mongoCommentStore) DeleteThreads(ctx context.Context, fileId string) error {
+	_, err := s.collection.DeleteMany(ctx, bson.M{"file_id": fileId})
+	return err
+}
+
+func (s *mongoCommentStore) DeleteThread(ctx context.Context, fileId string, threadId string) error {
+	result, err := s.collection.DeleteOne(ctx, bson.M{"file_id": fileId, "thread_id": threadId})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
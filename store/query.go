@@ -0,0 +1,252 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go-markdown-parser/models"
+)
+
+// ErrInvalidCursor is returned for a page cursor that is malformed or was
+// issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// Sort orders accepted by FileQuery. A leading "-" sorts descending.
+var fileSorts = map[string]bool{
+	"name": true, "-name": true,
+	"created": true, "-created": true,
+	"updated": true, "-updated": true,
+}
+
+// FileQuery filters and orders a user's files. Zero values match everything.
+type FileQuery struct {
+	// Tag keeps files carrying this tag.
+	Tag string
+	// Prefix keeps files whose name starts with it, ignoring case.
+	Prefix string
+	// From and To bound updated_at, inclusively.
+	From time.Time
+	To   time.Time
+	// HasMisspellings, when set, keeps files with (true) or without (false)
+	// misspelled words.
+	HasMisspellings *bool
+	// Sort is one of name, created or updated, optionally prefixed with "-"
+	// for descending order. It defaults to "created". Ties are broken by
+	// file_id so pages never overlap.
+	Sort string
+	// Limit caps the number of files returned; 0 returns them all.
+	Limit int
+	// Cursor continues from a previous FilePage's Next.
+	Cursor string
+	// WithoutContent leaves File_content empty, for listings.
+	WithoutContent bool
+}
+
+// FilePage is one page of files matching a FileQuery.
+type FilePage struct {
+	Files []models.File
+	// Total counts every match, across all pages.
+	Total int64
+	// Next is the cursor for the following page, or "" on the last page.
+	Next string
+}
+
+// pageCursor is the position after the last file of a page: the value of
+// its sort field and its file_id.
+type pageCursor struct {
+	Sort string    `json:"s"`
+	Name string    `json:"n,omitempty"`
+	Time time.Time `json:"t,omitempty"`
+	ID   string    `json:"i"`
+}
+
+// Validate checks the query's sort order and date range.
+func (q FileQuery) Validate() error {
+	if q.Sort != "" && !fileSorts[q.Sort] {
+		return fmt.Errorf("invalid sort %q", q.Sort)
+	}
+
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return fmt.Errorf("date range ends before it starts")
+	}
+
+	if q.Limit < 0 {
+		return fmt.Errorf("invalid limit %d", q.Limit)
+	}
+
+	if _, err := q.cursor(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// cursor decodes the query's page cursor, or returns nil for the first page.
+func (q FileQuery) cursor() (*pageCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+
+	if field, _ := q.sortField(); cursor.Sort != field {
+		return nil, ErrInvalidCursor
+	}
+
+	return &cursor, nil
+}
+
+// positionOf returns file's position in the given sort order.
+func positionOf(field string, file *models.File) *pageCursor {
+	cursor := &pageCursor{Sort: field, ID: file.File_id}
+
+	switch field {
+	case "name":
+		cursor.Name = file.File_name
+	case "updated":
+		cursor.Time = file.Updated_at
+	default:
+		cursor.Time = file.Created_at
+	}
+
+	return cursor
+}
+
+// nextCursor encodes the position after file.
+func (q FileQuery) nextCursor(file *models.File) string {
+	field, _ := q.sortField()
+
+	data, _ := json.Marshal(positionOf(field, file))
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Match reports whether a live file satisfies the query's filters.
+func (q FileQuery) Match(file *models.File) bool {
+	if file.Trashed() {
+		return false
+	}
+
+	if q.Tag != "" && !hasTag(file.Tags, q.Tag) {
+		return false
+	}
+
+	if q.Prefix != "" && !strings.HasPrefix(strings.ToLower(file.File_name), strings.ToLower(q.Prefix)) {
+		return false
+	}
+
+	if !q.From.IsZero() && file.Updated_at.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && file.Updated_at.After(q.To) {
+		return false
+	}
+
+	if q.HasMisspellings != nil && (file.Misspelled_count > 0) != *q.HasMisspellings {
+		return false
+	}
+
+	return true
+}
+
+// sortField returns the field to sort by and whether the order is descending.
+func (q FileQuery) sortField() (string, bool) {
+	field := q.Sort
+	if field == "" {
+		field = "created"
+	}
+
+	return strings.TrimPrefix(field, "-"), strings.HasPrefix(field, "-")
+}
+
+// compare orders a file against a cursor position by the sort field, then
+// file_id, ascending.
+func compare(field string, file *models.File, cursor *pageCursor) int {
+	var result int
+
+	switch field {
+	case "name":
+		result = strings.Compare(strings.ToLower(file.File_name), strings.ToLower(cursor.Name))
+	case "updated":
+		result = file.Updated_at.Compare(cursor.Time)
+	default:
+		result = file.Created_at.Compare(cursor.Time)
+	}
+
+	if result == 0 {
+		result = strings.Compare(file.File_id, cursor.ID)
+	}
+	return result
+}
+
+// page filters, sorts and paginates files in memory, for the backends that
+// don't query natively.
+func (q FileQuery) page(files []models.File) (*FilePage, error) {
+	cursor, err := q.cursor()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := []models.File{}
+	for _, file := range files {
+		if q.Match(&file) {
+			matched = append(matched, file)
+		}
+	}
+
+	field, descending := q.sortField()
+	sort.Slice(matched, func(i, j int) bool {
+		result := compare(field, &matched[i], positionOf(field, &matched[j]))
+		if descending {
+			return result > 0
+		}
+		return result < 0
+	})
+
+	page := &FilePage{Files: matched, Total: int64(len(matched))}
+
+	if cursor != nil {
+		start := sort.Search(len(matched), func(i int) bool {
+			result := compare(field, &matched[i], cursor)
+			if descending {
+				return result < 0
+			}
+			return result > 0
+		})
+		page.Files = matched[start:]
+	}
+
+	if q.Limit > 0 && len(page.Files) > q.Limit {
+		page.Files = page.Files[:q.Limit]
+		page.Next = q.nextCursor(&page.Files[q.Limit-1])
+	}
+
+	if q.WithoutContent {
+		for i := range page.Files {
+			page.Files[i].File_content = ""
+		}
+	}
+
+	return page, nil
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
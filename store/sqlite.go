@@ -0,0 +1,1126 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-markdown-parser/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	_ "modernc.org/sqlite"
+)
+
+// The sqlite backend keeps the lookup keys in their own indexed columns and
+// the full document as JSON in `data`, so new model fields need no migration.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS files (
+	file_id   TEXT PRIMARY KEY,
+	user_id   TEXT NOT NULL,
+	file_name TEXT NOT NULL,
+	data      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS files_user_id_file_name ON files (user_id, file_name);
+CREATE INDEX IF NOT EXISTS files_slug ON files (json_extract(data, '$.slug'));
+
+CREATE TABLE IF NOT EXISTS users (
+	user_id TEXT PRIMARY KEY,
+	email   TEXT NOT NULL,
+	data    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS users_email ON users (email COLLATE NOCASE);
+
+CREATE TABLE IF NOT EXISTS revisions (
+	revision_id TEXT PRIMARY KEY,
+	file_id     TEXT NOT NULL,
+	data        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS revisions_file_id ON revisions (file_id);
+
+CREATE TABLE IF NOT EXISTS shares (
+	share_id   TEXT PRIMARY KEY,
+	owner_id   TEXT NOT NULL,
+	grantee_id TEXT NOT NULL,
+	data       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS shares_owner_id ON shares (owner_id);
+CREATE INDEX IF NOT EXISTS shares_grantee_id ON shares (grantee_id);
+
+CREATE TABLE IF NOT EXISTS links (
+	link_id  TEXT PRIMARY KEY,
+	token    TEXT NOT NULL UNIQUE,
+	owner_id TEXT NOT NULL,
+	file_id  TEXT NOT NULL,
+	data     TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS links_owner_id_file_id ON links (owner_id, file_id);
+
+CREATE TABLE IF NOT EXISTS workspaces (
+	workspace_id TEXT PRIMARY KEY,
+	data         TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS members (
+	workspace_id TEXT NOT NULL,
+	user_id      TEXT NOT NULL,
+	data         TEXT NOT NULL,
+	PRIMARY KEY (workspace_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS members_user_id ON members (user_id);
+
+CREATE TABLE IF NOT EXISTS threads (
+	thread_id TEXT PRIMARY KEY,
+	file_id   TEXT NOT NULL,
+	data      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS threads_file_id ON threads (file_id);
+`
+
+type sqliteFileStore struct {
+	db *sql.DB
+}
+
+type sqliteUserStore struct {
+	db *sql.DB
+}
+
+type sqliteRevisionStore struct {
+	db *sql.DB
+}
+
+type sqliteShareStore struct {
+	db *sql.DB
+}
+
+type sqliteWorkspaceStore struct {
+	db *sql.DB
+}
+
+type sqliteCommentStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStores opens (creating if needed) the embedded database at path.
+func NewSQLiteStores(path string) (*Stores, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; serialising connections avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Stores{
+		Files:      &sqliteFileStore{db: db},
+		Users:      &sqliteUserStore{db: db},
+		Revisions:  &sqliteRevisionStore{db: db},
+		Shares:     &sqliteShareStore{db: db},
+		Workspaces: &sqliteWorkspaceStore{db: db},
+		Comments:   &sqliteCommentStore{db: db},
+	}, nil
+}
+
+func (s *sqliteFileStore) SaveFile(ctx context.Context, update *models.File) (*models.File, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var file models.File
+
+	var data string
+	err = tx.QueryRowContext(ctx,
+		`SELECT data FROM files WHERE user_id = ? AND file_name = ?
+		AND COALESCE(json_extract(data, '$.folder'), '') = ''
+		AND json_extract(data, '$.deleted_at') IS NULL`,
+		update.User_id, update.File_name,
+	).Scan(&data)
+
+	switch {
+	case err == sql.ErrNoRows:
+		file = *newSavedFile(update, now)
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal([]byte(data), &file); err != nil {
+			return nil, err
+		}
+		applySave(&file, update)
+		file.Version++
+		file.Updated_at = now
+	}
+
+	if err := putFile(ctx, tx, &file); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+func (s *sqliteFileStore) GetFile(ctx context.Context, userId string, fileId string) (*models.File, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT data FROM files WHERE user_id = ? AND file_id = ?`,
+		userId, fileId,
+	).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file models.File
+	if err := json.Unmarshal([]byte(data), &file); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+func (s *sqliteFileStore) FindFiles(ctx context.Context, userId string, query FileQuery) (*FilePage, error) {
+	files, err := s.ListFiles(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.page(files)
+}
+
+func (s *sqliteFileStore) ListFiles(ctx context.Context, userId string) ([]models.File, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM files WHERE user_id = ? ORDER BY rowid`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := []models.File{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var file models.File
+		if err := json.Unmarshal([]byte(data), &file); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	return files, rows.Err()
+}
+
+func (s *sqliteFileStore) CreateFile(ctx context.Context, file *models.File) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if taken, err := fileNameTaken(ctx, tx, file); err != nil {
+		return err
+	} else if taken {
+		return ErrFileExists
+	}
+
+	if err := putFile(ctx, tx, file); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteFileStore) UpdateFile(ctx context.Context, file *models.File, expectedVersion int64) (*models.File, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var data string
+	err = tx.QueryRowContext(ctx,
+		`SELECT data FROM files WHERE user_id = ? AND file_id = ?`,
+		file.User_id, file.File_id,
+	).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var existing models.File
+	if err := json.Unmarshal([]byte(data), &existing); err != nil {
+		return nil, err
+	}
+	if existing.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+
+	if taken, err := fileNameTaken(ctx, tx, file); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrFileExists
+	}
+
+	if taken, err := slugTaken(ctx, tx, file); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrSlugTaken
+	}
+
+	updated := *file
+	updated.Version = expectedVersion + 1
+	updated.Updated_at = time.Now()
+
+	if err := putFile(ctx, tx, &updated); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+func (s *sqliteFileStore) DeleteFile(ctx context.Context, userId string, fileId string) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM files WHERE user_id = ? AND file_id = ?`,
+		userId, fileId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *sqliteFileStore) GetPublicFile(ctx context.Context, slug string) (*models.File, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT data FROM files WHERE json_extract(data, '$.slug') = ?`,
+		slug,
+	).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file models.File
+	if err := json.Unmarshal([]byte(data), &file); err != nil {
+		return nil, err
+	}
+	if !file.Public() {
+		return nil, ErrNotFound
+	}
+
+	return &file, nil
+}
+
+// fileNameTaken reports whether another of the user's live files already
+// uses file's name in the same folder. A trashed file never conflicts.
+func fileNameTaken(ctx context.Context, tx *sql.Tx, file *models.File) (bool, error) {
+	if file.Trashed() {
+		return false, nil
+	}
+
+	var count int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM files WHERE user_id = ? AND file_name = ? AND file_id != ?
+		AND COALESCE(json_extract(data, '$.folder'), '') = ?
+		AND json_extract(data, '$.deleted_at') IS NULL`,
+		file.User_id, file.File_name, file.File_id, file.Folder,
+	).Scan(&count)
+
+	return count > 0, err
+}
+
+// slugTaken reports whether another file, of any user, uses file's slug.
+func slugTaken(ctx context.Context, tx *sql.Tx, file *models.File) (bool, error) {
+	if file.Slug == "" {
+		return false, nil
+	}
+
+	var count int
+	err := tx.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM files WHERE json_extract(data, '$.slug') = ? AND file_id != ?`,
+		file.Slug, file.File_id,
+	).Scan(&count)
+
+	return count > 0, err
+}
+
+// putFile inserts or replaces the row for file.
+func putFile(ctx context.Context, tx *sql.Tx, file *models.File) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO files (file_id, user_id, file_name, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (file_id) DO UPDATE SET user_id = excluded.user_id, file_name = excluded.file_name, data = excluded.data`,
+		file.File_id, file.User_id, file.File_name, string(data),
+	)
+	return err
+}
+
+func (s *sqliteUserStore) CreateUser(ctx context.Context, user *models.User) error {
+	return s.putUser(ctx, user)
+}
+
+func (s *sqliteUserStore) CountUsersByEmail(ctx context.Context, email string) (int64, error) {
+	var count int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM users WHERE email = ? COLLATE NOCASE`,
+		email,
+	).Scan(&count)
+
+	return count, err
+}
+
+func (s *sqliteUserStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.findOne(ctx, `SELECT data FROM users WHERE email = ?`, email)
+}
+
+func (s *sqliteUserStore) GetUserById(ctx context.Context, userId string) (*models.User, error) {
+	return s.findOne(ctx, `SELECT data FROM users WHERE user_id = ?`, userId)
+}
+
+func (s *sqliteUserStore) UpdateTokens(ctx context.Context, userId string, token string, refreshToken string) (*models.User, error) {
+	user, err := s.GetUserById(ctx, userId)
+	if err == ErrNotFound {
+		// Mirror the Mongo upsert: an unknown user id creates a bare record.
+		user = &models.User{ID: primitive.NewObjectID(), User_id: userId}
+	} else if err != nil {
+		return nil, err
+	}
+
+	user.Token = &token
+	user.Refresh_token = &refreshToken
+	user.Updated_at = time.Now()
+
+	if err := s.putUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *sqliteUserStore) UpdateRenderOptions(ctx context.Context, userId string, options *models.RenderOptions) (*models.User, error) {
+	user, err := s.GetUserById(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Render_options = options
+	user.Updated_at = time.Now()
+
+	if err := s.putUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *sqliteUserStore) findOne(ctx context.Context, query string, arg string) (*models.User, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, query, arg).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *sqliteUserStore) putUser(ctx context.Context, user *models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+
+	email := ""
+	if user.Email != nil {
+		email = *user.Email
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO users (user_id, email, data) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET email = excluded.email, data = excluded.data`,
+		user.User_id, email, string(data),
+	)
+	return err
+}
+
+func (s *sqliteRevisionStore) AddRevision(ctx context.Context, revision *models.Revision) error {
+	data, err := json.Marshal(revision)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO revisions (revision_id, file_id, data) VALUES (?, ?, ?)`,
+		revision.Revision_id, revision.File_id, string(data),
+	)
+	return err
+}
+
+func (s *sqliteRevisionStore) DeleteRevisions(ctx context.Context, fileId string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM revisions WHERE file_id = ?`, fileId)
+	return err
+}
+
+func (s *sqliteRevisionStore) ListRevisions(ctx context.Context, fileId string) ([]models.Revision, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM revisions WHERE file_id = ? ORDER BY rowid DESC`,
+		fileId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []models.Revision{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var revision models.Revision
+		if err := json.Unmarshal([]byte(data), &revision); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *sqliteRevisionStore) LatestRevision(ctx context.Context, fileId string) (*models.Revision, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT data FROM revisions WHERE file_id = ? ORDER BY rowid DESC LIMIT 1`,
+		fileId,
+	).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var revision models.Revision
+	if err := json.Unmarshal([]byte(data), &revision); err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (s *sqliteRevisionStore) GetRevision(ctx context.Context, fileId string, revisionId string) (*models.Revision, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT data FROM revisions WHERE file_id = ? AND revision_id = ?`,
+		fileId, revisionId,
+	).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var revision models.Revision
+	if err := json.Unmarshal([]byte(data), &revision); err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+func (s *sqliteShareStore) SaveShare(ctx context.Context, share *models.Share) (*models.Share, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	existing, err := queryShares(ctx, tx,
+		`SELECT data FROM shares WHERE owner_id = ? AND grantee_id = ?`,
+		share.Owner_id, share.Grantee_id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	saved := *share
+	for _, other := range existing {
+		if sameGrant(&other, share) {
+			saved = other
+			saved.Permission = share.Permission
+		}
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO shares (share_id, owner_id, grantee_id, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (share_id) DO UPDATE SET data = excluded.data`,
+		saved.Share_id, saved.Owner_id, saved.Grantee_id, string(data),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+func (s *sqliteShareStore) ListShares(ctx context.Context, ownerId string) ([]models.Share, error) {
+	return queryShares(ctx, s.db, `SELECT data FROM shares WHERE owner_id = ? ORDER BY rowid`, ownerId)
+}
+
+func (s *sqliteShareStore) ListSharedWith(ctx context.Context, granteeId string) ([]models.Share, error) {
+	return queryShares(ctx, s.db, `SELECT data FROM shares WHERE grantee_id = ? ORDER BY rowid`, granteeId)
+}
+
+func (s *sqliteShareStore) DeleteShare(ctx context.Context, ownerId string, shareId string) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM shares WHERE owner_id = ? AND share_id = ?`,
+		ownerId, shareId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqliteShareStore) DeleteFileShares(ctx context.Context, ownerId string, fileId string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM shares WHERE owner_id = ? AND json_extract(data, '$.file_id') = ?`,
+		ownerId, fileId,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM links WHERE owner_id = ? AND file_id = ?`,
+		ownerId, fileId,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteShareStore) CreateLink(ctx context.Context, link *models.PublicLink) error {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO links (link_id, token, owner_id, file_id, data) VALUES (?, ?, ?, ?, ?)`,
+		link.Link_id, link.Token, link.Owner_id, link.File_id, string(data),
+	)
+	return err
+}
+
+func (s *sqliteShareStore) GetLink(ctx context.Context, token string) (*models.PublicLink, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, `SELECT data FROM links WHERE token = ?`, token).Scan(&data)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var link models.PublicLink
+	if err := json.Unmarshal([]byte(data), &link); err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+func (s *sqliteShareStore) ListLinks(ctx context.Context, ownerId string, fileId string) ([]models.PublicLink, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM links WHERE owner_id = ? AND file_id = ? ORDER BY rowid`,
+		ownerId, fileId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.PublicLink{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var link models.PublicLink
+		if err := json.Unmarshal([]byte(data), &link); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+func (s *sqliteShareStore) DeleteLink(ctx context.Context, ownerId string, linkId string) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM links WHERE owner_id = ? AND link_id = ?`,
+		ownerId, linkId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *sqliteWorkspaceStore) CreateWorkspace(ctx context.Context, workspace *models.Workspace) error {
+	data, err := json.Marshal(workspace)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO workspaces (workspace_id, data) VALUES (?, ?)`,
+		workspace.Workspace_id, string(data),
+	)
+	return err
+}
+
+func (s *sqliteWorkspaceStore) GetWorkspace(ctx context.Context, workspaceId string) (*models.Workspace, error) {
+	return getWorkspace(ctx, s.db, workspaceId)
+}
+
+func (s *sqliteWorkspaceStore) RenameWorkspace(ctx context.Context, workspaceId string, name string) (*models.Workspace, error) {
+	return s.update(ctx, workspaceId, func(workspace *models.Workspace) {
+		workspace.Name = name
+	})
+}
+
+func (s *sqliteWorkspaceStore) UpdateDictionary(ctx context.Context, workspaceId string, add []string, remove []string) (*models.Workspace, error) {
+	return s.update(ctx, workspaceId, func(workspace *models.Workspace) {
+		workspace.Dictionary = updateDictionary(workspace.Dictionary, add, remove)
+	})
+}
+
+// update applies change to a workspace within a transaction.
+func (s *sqliteWorkspaceStore) update(ctx context.Context, workspaceId string, change func(*models.Workspace)) (*models.Workspace, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	workspace, err := getWorkspace(ctx, tx, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+
+	change(workspace)
+	workspace.Updated_at = time.Now()
+
+	data, err := json.Marshal(workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE workspaces SET data = ? WHERE workspace_id = ?`,
+		string(data), workspaceId,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+func (s *sqliteWorkspaceStore) SaveMember(ctx context.Context, member *models.Member) (*models.Member, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	saved := *member
+	members, err := queryMembers(ctx, tx,
+		`SELECT data FROM members WHERE workspace_id = ? AND user_id = ?`,
+		member.Workspace_id, member.User_id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) > 0 {
+		saved = members[0]
+		saved.Role = member.Role
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO members (workspace_id, user_id, data) VALUES (?, ?, ?)
+		ON CONFLICT (workspace_id, user_id) DO UPDATE SET data = excluded.data`,
+		saved.Workspace_id, saved.User_id, string(data),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return &saved, nil
+}
+
+func (s *sqliteWorkspaceStore) GetMember(ctx context.Context, workspaceId string, userId string) (*models.Member, error) {
+	members, err := queryMembers(ctx, s.db,
+		`SELECT data FROM members WHERE workspace_id = ? AND user_id = ?`,
+		workspaceId, userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &members[0], nil
+}
+
+func (s *sqliteWorkspaceStore) ListMembers(ctx context.Context, workspaceId string) ([]models.Member, error) {
+	return queryMembers(ctx, s.db, `SELECT data FROM members WHERE workspace_id = ? ORDER BY rowid`, workspaceId)
+}
+
+func (s *sqliteWorkspaceStore) ListMemberships(ctx context.Context, userId string) ([]models.Member, error) {
+	return queryMembers(ctx, s.db, `SELECT data FROM members WHERE user_id = ? ORDER BY rowid`, userId)
+}
+
+func (s *sqliteWorkspaceStore) RemoveMember(ctx context.Context, workspaceId string, userId string) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM members WHERE workspace_id = ? AND user_id = ?`,
+		workspaceId, userId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// getWorkspace loads one workspace.
+func getWorkspace(ctx context.Context, db queryer, workspaceId string) (*models.Workspace, error) {
+	rows, err := db.QueryContext(ctx, `SELECT data FROM workspaces WHERE workspace_id = ?`, workspaceId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+
+	var data string
+	if err := rows.Scan(&data); err != nil {
+		return nil, err
+	}
+
+	var workspace models.Workspace
+	if err := json.Unmarshal([]byte(data), &workspace); err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// queryMembers runs a query selecting the data column of members.
+func queryMembers(ctx context.Context, db queryer, query string, args ...any) ([]models.Member, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []models.Member{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var member models.Member
+		if err := json.Unmarshal([]byte(data), &member); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryShares runs a query selecting the data column of shares.
+func queryShares(ctx context.Context, db queryer, query string, args ...any) ([]models.Share, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []models.Share{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var share models.Share
+		if err := json.Unmarshal([]byte(data), &share); err != nil {
+			return nil, err
+		}
+		shares = append(shares, share)
+	}
+
+	return shares, rows.Err()
+}
+
+func (s *sqliteCommentStore) CreateThread(ctx context.Context, thread *models.Thread) error {
+	data, err := json.Marshal(thread)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO threads (thread_id, file_id, data) VALUES (?, ?, ?)`,
+		thread.Thread_id, thread.File_id, string(data),
+	)
+	return err
+}
+
+func (s *sqliteCommentStore) GetThread(ctx context.Context, fileId string, threadId string) (*models.Thread, error) {
+	return getThread(ctx, s.db, fileId, threadId)
+}
+
+func (s *sqliteCommentStore) ListThreads(ctx context.Context, fileId string) ([]models.Thread, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT data FROM threads WHERE file_id = ? ORDER BY rowid`,
+		fileId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []models.Thread{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var thread models.Thread
+		if err := json.Unmarshal([]byte(data), &thread); err != nil {
+			return nil, err
+		}
+		threads = append(threads, thread)
+	}
+
+	return threads, rows.Err()
+}
+
+func (s *sqliteCommentStore) AddComment(ctx context.Context, fileId string, threadId string, comment *models.Comment) (*models.Thread, error) {
+	return s.update(ctx, fileId, threadId, func(thread *models.Thread) {
+		thread.Comments = append(thread.Comments, *comment)
+		thread.Updated_at = comment.Created_at
+	})
+}
+
+func (s *sqliteCommentStore) ResolveThread(ctx context.Context, fileId string, threadId string, resolvedBy string) (*models.Thread, error) {
+	return s.update(ctx, fileId, threadId, func(thread *models.Thread) {
+		resolveThread(thread, resolvedBy, time.Now())
+	})
+}
+
+func (s *sqliteCommentStore) UpdateAnchor(ctx context.Context, fileId string, threadId string, anchor models.Anchor) error {
+	_, err := s.update(ctx, fileId, threadId, func(thread *models.Thread) {
+		thread.Anchor = anchor
+	})
+	return err
+}
+
+// update applies change to a thread inside a transaction and returns the result.
+func (s *sqliteCommentStore) update(ctx context.Context, fileId string, threadId string, change func(*models.Thread)) (*models.Thread, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	thread, err := getThread(ctx, tx, fileId, threadId)
+	if err != nil {
+		return nil, err
+	}
+
+	change(thread)
+
+	data, err := json.Marshal(thread)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE threads SET data = ? WHERE thread_id = ?`,
+		string(data), threadId,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return thread, nil
+}
+
+func (s *sqliteCommentStore) DeleteThreads(ctx context.Context, fileId string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM threads WHERE file_id = ?`, fileId)
+	return err
+}
+
+func (s *sqliteCommentStore) DeleteThread(ctx context.Context, fileId string, threadId string) error {
+	result, err := s.db.ExecContext(ctx,
+		`DELETE FROM threads WHERE file_id = ? AND thread_id = ?`,
+		fileId, threadId,
+	)
+	if err != nil {
+		return err
+	}
+
+	if deleted, _ := result.RowsAffected(); deleted == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// getThread loads one of a file's threads.
+func getThread(ctx context.Context, db queryer, fileId string, threadId string) (*models.Thread, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT data FROM threads WHERE file_id = ? AND thread_id = ?`,
+		fileId, threadId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotFound
+	}
+
+	var data string
+	if err := rows.Scan(&data); err != nil {
+		return nil, err
+	}
+
+	var thread models.Thread
+	if err := json.Unmarshal([]byte(data), &thread); err != nil {
+		return nil, err
+	}
+
+	return &thread, nil
+}
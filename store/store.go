@@ -0,0 +1,357 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go-markdown-parser/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when the requested document does not exist.
+	ErrNotFound = errors.New("document not found")
+	// ErrFileExists is returned when creating a file whose name is already taken.
+	ErrFileExists = errors.New("a file with this name already exists")
+	// ErrVersionConflict is returned when a file changed since the version the caller read.
+	ErrVersionConflict = errors.New("file was modified by another request")
+	// ErrSlugTaken is returned when a file's public slug is used by another file.
+	ErrSlugTaken = errors.New("this slug is already in use")
+)
+
+// FileStore persists markdown files. Every lookup is scoped to the owning user.
+// File names are unique within a folder among the files not in the trash.
+type FileStore interface {
+	// SaveFile creates the user's file named file.File_name in the root folder,
+	// or, if one already exists, replaces its content and misspelled count
+	// with file's. Tags are replaced too unless file.Tags is nil.
+	SaveFile(ctx context.Context, file *models.File) (*models.File, error)
+	// GetFile returns the user's file with the given file_id.
+	GetFile(ctx context.Context, userId string, fileId string) (*models.File, error)
+	// ListFiles returns every file owned by the user, including trashed ones.
+	ListFiles(ctx context.Context, userId string) ([]models.File, error)
+	// FindFiles returns a page of the user's files outside the trash that
+	// match query, in the query's sort order.
+	FindFiles(ctx context.Context, userId string, query FileQuery) (*FilePage, error)
+	// CreateFile inserts a new file, failing with ErrFileExists if the user
+	// already has a file with the same name.
+	CreateFile(ctx context.Context, file *models.File) error
+	// UpdateFile writes the file's fields (content, name, folder, tags, trash
+	// state, visibility) if its stored version still equals expectedVersion,
+	// otherwise it fails with ErrVersionConflict. It fails with ErrSlugTaken
+	// if another file, of any user, has the same slug. The version is
+	// incremented and updated_at set on success.
+	UpdateFile(ctx context.Context, file *models.File, expectedVersion int64) (*models.File, error)
+	DeleteFile(ctx context.Context, userId string, fileId string) error
+	// GetPublicFile returns the published file with the given slug, whoever
+	// owns it. Private and trashed files are not found.
+	GetPublicFile(ctx context.Context, slug string) (*models.File, error)
+}
+
+// FileStamper is implemented by file stores whose files can change without
+// going through the app, like the filesystem backend edited with git. A
+// user's stamp changes whenever any of their files do, so caches of their
+// files know to reload.
+type FileStamper interface {
+	FilesStamp(ctx context.Context, userId string) (string, error)
+}
+
+// UserStore persists user accounts and their tokens.
+type UserStore interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	// CountUsersByEmail counts users whose email matches, ignoring case.
+	CountUsersByEmail(ctx context.Context, email string) (int64, error)
+	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserById(ctx context.Context, userId string) (*models.User, error)
+	// UpdateTokens stores a freshly issued token pair and returns the updated user.
+	UpdateTokens(ctx context.Context, userId string, token string, refreshToken string) (*models.User, error)
+	// UpdateRenderOptions stores the user's rendering preferences; nil
+	// clears them.
+	UpdateRenderOptions(ctx context.Context, userId string, options *models.RenderOptions) (*models.User, error)
+}
+
+// RevisionStore persists the immutable revisions written on every file save.
+type RevisionStore interface {
+	AddRevision(ctx context.Context, revision *models.Revision) error
+	// ListRevisions returns the file's revisions, newest first.
+	ListRevisions(ctx context.Context, fileId string) ([]models.Revision, error)
+	GetRevision(ctx context.Context, fileId string, revisionId string) (*models.Revision, error)
+	// LatestRevision returns the file's newest revision.
+	LatestRevision(ctx context.Context, fileId string) (*models.Revision, error)
+	// DeleteRevisions deletes every revision of the file.
+	DeleteRevisions(ctx context.Context, fileId string) error
+}
+
+// ShareStore persists the access owners grant to their notes: shares with
+// other users and public links.
+type ShareStore interface {
+	// SaveShare stores a grant. A grant to the same user on the same note or
+	// folder is replaced, keeping its share_id.
+	SaveShare(ctx context.Context, share *models.Share) (*models.Share, error)
+	// ListShares returns the grants the owner has made, oldest first.
+	ListShares(ctx context.Context, ownerId string) ([]models.Share, error)
+	// ListSharedWith returns the grants made to the user, oldest first.
+	ListSharedWith(ctx context.Context, granteeId string) ([]models.Share, error)
+	DeleteShare(ctx context.Context, ownerId string, shareId string) error
+	CreateLink(ctx context.Context, link *models.PublicLink) error
+	// GetLink returns the public link with the given token.
+	GetLink(ctx context.Context, token string) (*models.PublicLink, error)
+	// ListLinks returns the owner's links to a note, oldest first.
+	ListLinks(ctx context.Context, ownerId string, fileId string) ([]models.PublicLink, error)
+	DeleteLink(ctx context.Context, ownerId string, linkId string) error
+	// DeleteFileShares deletes the owner's shares of and public links to the
+	// file. Folder shares are kept.
+	DeleteFileShares(ctx context.Context, ownerId string, fileId string) error
+}
+
+// WorkspaceStore persists team workspaces and their members.
+type WorkspaceStore interface {
+	CreateWorkspace(ctx context.Context, workspace *models.Workspace) error
+	GetWorkspace(ctx context.Context, workspaceId string) (*models.Workspace, error)
+	RenameWorkspace(ctx context.Context, workspaceId string, name string) (*models.Workspace, error)
+	// UpdateDictionary adds words to and removes words from the workspace's
+	// custom dictionary in one step and returns the updated workspace.
+	UpdateDictionary(ctx context.Context, workspaceId string, add []string, remove []string) (*models.Workspace, error)
+	// SaveMember adds a member, or changes the role of an existing one.
+	SaveMember(ctx context.Context, member *models.Member) (*models.Member, error)
+	GetMember(ctx context.Context, workspaceId string, userId string) (*models.Member, error)
+	// ListMembers returns the workspace's members, oldest first.
+	ListMembers(ctx context.Context, workspaceId string) ([]models.Member, error)
+	// ListMemberships returns the user's memberships, oldest first.
+	ListMemberships(ctx context.Context, userId string) ([]models.Member, error)
+	RemoveMember(ctx context.Context, workspaceId string, userId string) error
+}
+
+// CommentStore persists the comment threads on notes. Threads are looked up
+// by the note's file_id, which is unique across users.
+type CommentStore interface {
+	CreateThread(ctx context.Context, thread *models.Thread) error
+	GetThread(ctx context.Context, fileId string, threadId string) (*models.Thread, error)
+	// ListThreads returns the note's threads, oldest first.
+	ListThreads(ctx context.Context, fileId string) ([]models.Thread, error)
+	// AddComment appends a reply to the thread and returns the updated thread.
+	AddComment(ctx context.Context, fileId string, threadId string, comment *models.Comment) (*models.Thread, error)
+	// ResolveThread marks the thread resolved by the user, or reopens it if
+	// resolvedBy is empty, and returns the updated thread.
+	ResolveThread(ctx context.Context, fileId string, threadId string, resolvedBy string) (*models.Thread, error)
+	// UpdateAnchor replaces the thread's anchor, leaving its comments and
+	// resolution untouched.
+	UpdateAnchor(ctx context.Context, fileId string, threadId string, anchor models.Anchor) error
+	DeleteThread(ctx context.Context, fileId string, threadId string) error
+	// DeleteThreads deletes every thread on the note.
+	DeleteThreads(ctx context.Context, fileId string) error
+}
+
+// resolveThread sets or clears the thread's resolution.
+func resolveThread(thread *models.Thread, resolvedBy string, now time.Time) {
+	thread.Resolved = resolvedBy != ""
+	thread.Resolved_by = resolvedBy
+	thread.Resolved_at = nil
+	if thread.Resolved {
+		thread.Resolved_at = &now
+	}
+	thread.Updated_at = now
+}
+
+// updateDictionary returns words with add added and remove removed, sorted
+// and without duplicates.
+func updateDictionary(words []string, add []string, remove []string) []string {
+	set := make(map[string]bool)
+	for _, word := range words {
+		set[word] = true
+	}
+	for _, word := range add {
+		set[word] = true
+	}
+	for _, word := range remove {
+		delete(set, word)
+	}
+
+	updated := make([]string, 0, len(set))
+	for word := range set {
+		updated = append(updated, word)
+	}
+	sort.Strings(updated)
+
+	return updated
+}
+
+// sameGrant reports whether two shares grant the same user access to the
+// same note or folder.
+func sameGrant(a *models.Share, b *models.Share) bool {
+	return a.Owner_id == b.Owner_id &&
+		a.Grantee_id == b.Grantee_id &&
+		a.File_id == b.File_id &&
+		a.Folder == b.Folder
+}
+
+// CleanFolder normalises a folder path to slash-separated segments without
+// leading or trailing slashes. "" is the root folder. Segments may not be
+// empty, "." or "..", or start with a dot.
+func CleanFolder(folder string) (string, error) {
+	folder = strings.Trim(strings.TrimSpace(folder), "/")
+	if folder == "" {
+		return "", nil
+	}
+
+	segments := strings.Split(folder, "/")
+	for _, segment := range segments {
+		if segment == "" || strings.HasPrefix(segment, ".") || strings.Contains(segment, `\`) {
+			return "", fmt.Errorf("invalid folder path %q", folder)
+		}
+	}
+
+	return strings.Join(segments, "/"), nil
+}
+
+// InFolder reports whether folder is the given folder or one of its subfolders.
+func InFolder(folder string, parent string) bool {
+	return parent == "" || folder == parent || strings.HasPrefix(folder, parent+"/")
+}
+
+// conflicts reports whether two different live files would share a path.
+func conflicts(a *models.File, b *models.File) bool {
+	return a.File_id != b.File_id &&
+		a.User_id == b.User_id &&
+		a.Folder == b.Folder &&
+		a.File_name == b.File_name &&
+		!a.Trashed() && !b.Trashed()
+}
+
+// slugConflicts reports whether two different files use the same slug.
+func slugConflicts(a *models.File, b *models.File) bool {
+	return a.File_id != b.File_id && a.Slug != "" && a.Slug == b.Slug
+}
+
+// newSavedFile builds the file SaveFile creates when none exists yet.
+func newSavedFile(file *models.File, now time.Time) *models.File {
+	docId := primitive.NewObjectID()
+	created := &models.File{
+		ID:           docId,
+		File_id:      docId.Hex(),
+		User_id:      file.User_id,
+		Workspace_id: file.Workspace_id,
+		File_name:    file.File_name,
+		Version:      1,
+		Created_at:   now,
+		Updated_at:   now,
+	}
+	applySave(created, file)
+
+	return created
+}
+
+// applySave copies the fields SaveFile replaces onto an existing file.
+func applySave(existing *models.File, file *models.File) {
+	existing.File_content = file.File_content
+	existing.Misspelled_count = file.Misspelled_count
+	existing.Original_encoding = file.Original_encoding
+	if file.Tags != nil {
+		existing.Tags = file.Tags
+	}
+}
+
+// Stores groups the storage backends used by the handlers.
+type Stores struct {
+	Files      FileStore
+	Users      UserStore
+	Revisions  RevisionStore
+	Shares     ShareStore
+	Workspaces WorkspaceStore
+	Comments   CommentStore
+}
+
+// PurgeFile permanently deletes the user's file along with its revisions,
+// comment threads, shares and public links. Those go first, so a failure
+// leaves the file in place to purge again.
+func (s *Stores) PurgeFile(ctx context.Context, userId string, fileId string) error {
+	if err := s.Revisions.DeleteRevisions(ctx, fileId); err != nil {
+		return err
+	}
+	if err := s.Comments.DeleteThreads(ctx, fileId); err != nil {
+		return err
+	}
+	if err := s.Shares.DeleteFileShares(ctx, userId, fileId); err != nil {
+		return err
+	}
+
+	return s.Files.DeleteFile(ctx, userId, fileId)
+}
+
+// Config selects and configures the storage backend.
+type Config struct {
+	// Backend is one of "mongo", "sqlite" or "memory".
+	Backend string
+	// SQLitePath is the database file used by the sqlite backend.
+	SQLitePath string
+	// FileBackend overrides where notes are kept. "filesystem" writes them as
+	// .md files under FileRoot; empty keeps them in Backend.
+	FileBackend string
+	// FileRoot is the notes directory used by the filesystem file backend.
+	FileRoot string
+}
+
+// ConfigFromEnv reads the storage configuration from the environment.
+// STORE_BACKEND defaults to "mongo", SQLITE_PATH to "data/markdown.db" and
+// FILE_STORE_ROOT to "data/notes". FILE_STORE_BACKEND is unset by default.
+func ConfigFromEnv() Config {
+	config := Config{
+		Backend:     strings.ToLower(os.Getenv("STORE_BACKEND")),
+		SQLitePath:  os.Getenv("SQLITE_PATH"),
+		FileBackend: strings.ToLower(os.Getenv("FILE_STORE_BACKEND")),
+		FileRoot:    os.Getenv("FILE_STORE_ROOT"),
+	}
+
+	if config.Backend == "" {
+		config.Backend = "mongo"
+	}
+
+	if config.SQLitePath == "" {
+		config.SQLitePath = "data/markdown.db"
+	}
+
+	if config.FileRoot == "" {
+		config.FileRoot = "data/notes"
+	}
+
+	return config
+}
+
+// Open creates the stores for the configured backend.
+func Open(config Config) (*Stores, error) {
+	var stores *Stores
+	var err error
+
+	switch config.Backend {
+	case "mongo":
+		stores, err = NewMongoStores()
+	case "sqlite":
+		stores, err = NewSQLiteStores(config.SQLitePath)
+	case "memory":
+		stores = NewMemoryStores()
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", config.Backend)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.FileBackend {
+	case "", config.Backend:
+	case "filesystem":
+		if stores.Files, err = NewFilesystemFileStore(config.FileRoot); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown file store backend %q", config.FileBackend)
+	}
+
+	return stores, nil
+}
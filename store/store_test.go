@@ -0,0 +1,813 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-markdown-parser/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testBackends returns a fresh instance of every backend that runs without
+// external services.
+func testBackends(t *testing.T) map[string]*Stores {
+	sqliteStores, err := NewSQLiteStores(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("Error opening sqlite store: %v", err)
+	}
+
+	filesystemStores := NewMemoryStores()
+	filesystemStores.Files, err = NewFilesystemFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Error opening filesystem store: %v", err)
+	}
+
+	return map[string]*Stores{
+		"memory":     NewMemoryStores(),
+		"sqlite":     sqliteStores,
+		"filesystem": filesystemStores,
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			files := stores.Files
+
+			created, err := files.SaveFile(ctx, &models.File{User_id: "user-1", File_name: "notes.md", File_content: "first", Tags: []string{"draft"}})
+			if err != nil {
+				t.Fatalf("Error saving file: %v", err)
+			}
+
+			// Saving the same name again replaces the content in place.
+			updated, err := files.SaveFile(ctx, &models.File{User_id: "user-1", File_name: "notes.md", File_content: "second"})
+			if err != nil {
+				t.Fatalf("Error updating file: %v", err)
+			}
+			if updated.File_id != created.File_id {
+				t.Errorf("Expected update to keep file_id %s, got %s", created.File_id, updated.File_id)
+			}
+
+			if _, err := files.SaveFile(ctx, &models.File{User_id: "user-2", File_name: "notes.md", File_content: "other user"}); err != nil {
+				t.Fatalf("Error saving file: %v", err)
+			}
+
+			file, err := files.GetFile(ctx, "user-1", created.File_id)
+			if err != nil {
+				t.Fatalf("Error getting file: %v", err)
+			}
+			if file.File_content != "second" {
+				t.Errorf("Expected content 'second', got '%s'", file.File_content)
+			}
+			// Saving without tags keeps the ones already set.
+			if len(file.Tags) != 1 || file.Tags[0] != "draft" {
+				t.Errorf("Expected tags [draft], got %v", file.Tags)
+			}
+
+			if _, err := files.GetFile(ctx, "user-2", created.File_id); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound for another user's file, got %v", err)
+			}
+
+			list, err := files.ListFiles(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("Error listing files: %v", err)
+			}
+			if len(list) != 1 {
+				t.Errorf("Expected 1 file for user-1, got %d", len(list))
+			}
+		})
+	}
+}
+
+func TestFileStoreOptimisticConcurrency(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			files := stores.Files
+
+			id := primitive.NewObjectID()
+			file := &models.File{
+				ID:           id,
+				File_id:      id.Hex(),
+				User_id:      "user-1",
+				File_name:    "draft.md",
+				File_content: "draft",
+				Version:      1,
+			}
+			if err := files.CreateFile(ctx, file); err != nil {
+				t.Fatalf("Error creating file: %v", err)
+			}
+
+			duplicate := *file
+			duplicate.File_id = primitive.NewObjectID().Hex()
+			if err := files.CreateFile(ctx, &duplicate); err != ErrFileExists {
+				t.Errorf("Expected ErrFileExists for a duplicate name, got %v", err)
+			}
+
+			file.File_content = "edited"
+			updated, err := files.UpdateFile(ctx, file, 1)
+			if err != nil {
+				t.Fatalf("Error updating file: %v", err)
+			}
+			if updated.Version != 2 {
+				t.Errorf("Expected version 2 after update, got %d", updated.Version)
+			}
+
+			// A second writer still holding version 1 loses.
+			if _, err := files.UpdateFile(ctx, file, 1); err != ErrVersionConflict {
+				t.Errorf("Expected ErrVersionConflict for a stale version, got %v", err)
+			}
+
+			if err := files.DeleteFile(ctx, "user-1", file.File_id); err != nil {
+				t.Fatalf("Error deleting file: %v", err)
+			}
+			if _, err := files.GetFile(ctx, "user-1", file.File_id); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound after delete, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStoreFoldersAndTrash(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			files := stores.Files
+
+			newFile := func(folder string) *models.File {
+				id := primitive.NewObjectID()
+				return &models.File{
+					ID:        id,
+					File_id:   id.Hex(),
+					User_id:   "user-1",
+					File_name: "notes.md",
+					Folder:    folder,
+					Version:   1,
+				}
+			}
+
+			work, home := newFile("work/meetings"), newFile("home")
+			for _, file := range []*models.File{work, home} {
+				if err := files.CreateFile(ctx, file); err != nil {
+					t.Fatalf("Error creating %s: %v", file.Path(), err)
+				}
+			}
+
+			// Moving onto a live note with the same path is refused.
+			moved := *work
+			moved.Folder = "home"
+			if _, err := files.UpdateFile(ctx, &moved, 1); err != ErrFileExists {
+				t.Errorf("Expected ErrFileExists moving onto home/notes.md, got %v", err)
+			}
+
+			now := time.Now()
+			home.Deleted_at = &now
+			trashed, err := files.UpdateFile(ctx, home, 1)
+			if err != nil {
+				t.Fatalf("Error trashing file: %v", err)
+			}
+
+			// Once home/notes.md is in the trash its path is free again.
+			movedFile, err := files.UpdateFile(ctx, &moved, 1)
+			if err != nil {
+				t.Fatalf("Error moving file: %v", err)
+			}
+			if movedFile.Path() != "home/notes.md" {
+				t.Errorf("Expected home/notes.md after move, got %s", movedFile.Path())
+			}
+
+			// ...so restoring the trashed note now conflicts.
+			trashed.Deleted_at = nil
+			if _, err := files.UpdateFile(ctx, trashed, trashed.Version); err != ErrFileExists {
+				t.Errorf("Expected ErrFileExists restoring over a live note, got %v", err)
+			}
+
+			list, err := files.ListFiles(ctx, "user-1")
+			if err != nil {
+				t.Fatalf("Error listing files: %v", err)
+			}
+			if len(list) != 2 {
+				t.Fatalf("Expected the live and trashed file, got %d files", len(list))
+			}
+			for _, file := range list {
+				if file.File_id == home.File_id && !file.Trashed() {
+					t.Errorf("Expected %s to still be in the trash", file.File_id)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreFindFiles(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			files := stores.Files
+
+			save := func(name string, misspelled int, tags ...string) {
+				file := &models.File{User_id: "user-1", File_name: name, Misspelled_count: misspelled, Tags: tags}
+				if _, err := files.SaveFile(ctx, file); err != nil {
+					t.Fatalf("Error saving %s: %v", name, err)
+				}
+			}
+			save("Recipes.md", 0, "home")
+			save("roadmap.md", 2, "work", "planning")
+			save("standup.md", 1, "work")
+
+			names := func(query FileQuery) string {
+				found, err := files.FindFiles(ctx, "user-1", query)
+				if err != nil {
+					t.Fatalf("Error finding files: %v", err)
+				}
+
+				var names []string
+				for _, file := range found.Files {
+					names = append(names, file.File_name)
+				}
+				return strings.Join(names, ",")
+			}
+
+			yes, no := true, false
+			tests := []struct {
+				query FileQuery
+				want  string
+			}{
+				{FileQuery{Sort: "name"}, "Recipes.md,roadmap.md,standup.md"},
+				{FileQuery{Tag: "work", Sort: "-name"}, "standup.md,roadmap.md"},
+				{FileQuery{Prefix: "r", Sort: "name"}, "Recipes.md,roadmap.md"},
+				{FileQuery{HasMisspellings: &yes, Sort: "name"}, "roadmap.md,standup.md"},
+				{FileQuery{HasMisspellings: &no}, "Recipes.md"},
+				{FileQuery{From: time.Now().Add(time.Hour)}, ""},
+			}
+
+			for _, test := range tests {
+				if got := names(test.query); got != test.want {
+					t.Errorf("FindFiles(%+v) = %q, want %q", test.query, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStorePagination(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			files := stores.Files
+
+			for _, name := range []string{"e.md", "B.md", "d.md", "a.md", "c.md"} {
+				file := &models.File{User_id: "user-1", File_name: name, File_content: "content"}
+				if _, err := files.SaveFile(ctx, file); err != nil {
+					t.Fatalf("Error saving %s: %v", name, err)
+				}
+			}
+
+			for _, sort := range []string{"name", "-name", "created", "-updated"} {
+				query := FileQuery{Sort: sort, Limit: 2, WithoutContent: true}
+				var names []string
+
+				for pages := 0; ; pages++ {
+					page, err := files.FindFiles(ctx, "user-1", query)
+					if err != nil {
+						t.Fatalf("Error finding files: %v", err)
+					}
+					if page.Total != 5 {
+						t.Errorf("Expected a total of 5, got %d", page.Total)
+					}
+
+					for _, file := range page.Files {
+						if file.File_content != "" {
+							t.Errorf("Expected content to be left out, got %q", file.File_content)
+						}
+						names = append(names, file.File_name)
+					}
+
+					if page.Next == "" || pages > 3 {
+						break
+					}
+					query.Cursor = page.Next
+				}
+
+				want := map[string]string{
+					"name":     "a.md,B.md,c.md,d.md,e.md",
+					"-name":    "e.md,d.md,c.md,B.md,a.md",
+					"created":  "e.md,B.md,d.md,a.md,c.md",
+					"-updated": "c.md,a.md,d.md,B.md,e.md",
+				}[sort]
+				if got := strings.Join(names, ","); got != want {
+					t.Errorf("Pages sorted by %s = %q, want %q", sort, got, want)
+				}
+			}
+
+			_, err := files.FindFiles(ctx, "user-1", FileQuery{Sort: "created", Cursor: FileQuery{Sort: "name"}.nextCursor(&models.File{File_id: "x"})})
+			if err != ErrInvalidCursor {
+				t.Errorf("Expected ErrInvalidCursor for a cursor of another sort, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStorePublicFiles(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			files := stores.Files
+
+			note, err := files.SaveFile(ctx, &models.File{User_id: "user-1", File_name: "post.md", File_content: "# Hello"})
+			if err != nil {
+				t.Fatalf("Error saving file: %v", err)
+			}
+			other, err := files.SaveFile(ctx, &models.File{User_id: "user-2", File_name: "post.md", File_content: "# Other"})
+			if err != nil {
+				t.Fatalf("Error saving file: %v", err)
+			}
+
+			// A slug alone doesn't publish the note
+			note.Slug = "hello"
+			if note, err = files.UpdateFile(ctx, note, note.Version); err != nil {
+				t.Fatalf("Error setting slug: %v", err)
+			}
+			if _, err := files.GetPublicFile(ctx, "hello"); err != ErrNotFound {
+				t.Errorf("Expected a private note not to be found, got %v", err)
+			}
+
+			note.Visibility = models.VisibilityPublic
+			if note, err = files.UpdateFile(ctx, note, note.Version); err != nil {
+				t.Fatalf("Error publishing note: %v", err)
+			}
+			public, err := files.GetPublicFile(ctx, "hello")
+			if err != nil {
+				t.Fatalf("Error fetching public note: %v", err)
+			}
+			if public.File_id != note.File_id {
+				t.Errorf("Expected public note %s, got %s", note.File_id, public.File_id)
+			}
+
+			// Slugs are unique across users
+			other.Slug = "hello"
+			if _, err := files.UpdateFile(ctx, other, other.Version); err != ErrSlugTaken {
+				t.Errorf("Expected ErrSlugTaken, got %v", err)
+			}
+
+			now := time.Now()
+			note.Deleted_at = &now
+			if _, err := files.UpdateFile(ctx, note, note.Version); err != nil {
+				t.Fatalf("Error trashing note: %v", err)
+			}
+			if _, err := files.GetPublicFile(ctx, "hello"); err != ErrNotFound {
+				t.Errorf("Expected a trashed note not to be found, got %v", err)
+			}
+		})
+	}
+}
+
+func TestShareStore(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			shares := stores.Shares
+
+			newShare := func(fileId string, folder string, permission string) *models.Share {
+				id := primitive.NewObjectID()
+				return &models.Share{
+					ID:         id,
+					Share_id:   id.Hex(),
+					Owner_id:   "owner",
+					File_id:    fileId,
+					Folder:     folder,
+					Grantee_id: "friend",
+					Permission: permission,
+					Created_at: time.Now(),
+				}
+			}
+
+			first, err := shares.SaveShare(ctx, newShare("file-1", "", models.PermissionView))
+			if err != nil {
+				t.Fatalf("Error saving share: %v", err)
+			}
+
+			// Sharing the same note again changes the permission in place.
+			again, err := shares.SaveShare(ctx, newShare("file-1", "", models.PermissionEdit))
+			if err != nil {
+				t.Fatalf("Error saving share: %v", err)
+			}
+			if again.Share_id != first.Share_id || again.Permission != models.PermissionEdit {
+				t.Errorf("Expected share %s to be upgraded to edit, got %+v", first.Share_id, again)
+			}
+
+			if _, err := shares.SaveShare(ctx, newShare("", "work", models.PermissionComment)); err != nil {
+				t.Fatalf("Error saving folder share: %v", err)
+			}
+
+			granted, err := shares.ListSharedWith(ctx, "friend")
+			if err != nil {
+				t.Fatalf("Error listing shares: %v", err)
+			}
+			if len(granted) != 2 {
+				t.Fatalf("Expected 2 shares, got %+v", granted)
+			}
+
+			if err := shares.DeleteShare(ctx, "someone-else", first.Share_id); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound deleting another owner's share, got %v", err)
+			}
+			if err := shares.DeleteShare(ctx, "owner", first.Share_id); err != nil {
+				t.Fatalf("Error deleting share: %v", err)
+			}
+			if owned, _ := shares.ListShares(ctx, "owner"); len(owned) != 1 {
+				t.Errorf("Expected 1 share left, got %+v", owned)
+			}
+
+			id := primitive.NewObjectID()
+			link := &models.PublicLink{ID: id, Link_id: id.Hex(), Token: "secret-token", Owner_id: "owner", File_id: "file-1", Password_hash: "hash"}
+			if err := shares.CreateLink(ctx, link); err != nil {
+				t.Fatalf("Error creating link: %v", err)
+			}
+
+			found, err := shares.GetLink(ctx, "secret-token")
+			if err != nil || found.Link_id != link.Link_id || found.Password_hash != "hash" {
+				t.Errorf("Expected to find link %s with its password, got %+v, %v", link.Link_id, found, err)
+			}
+			if _, err := shares.GetLink(ctx, "wrong-token"); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound for an unknown token, got %v", err)
+			}
+
+			if err := shares.DeleteLink(ctx, "owner", link.Link_id); err != nil {
+				t.Fatalf("Error deleting link: %v", err)
+			}
+			if links, _ := shares.ListLinks(ctx, "owner", "file-1"); len(links) != 0 {
+				t.Errorf("Expected no links after delete, got %+v", links)
+			}
+		})
+	}
+}
+
+func TestPurgeFile(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			purged, err := stores.Files.SaveFile(ctx, &models.File{User_id: "owner", File_name: "purged.md", File_content: "secret"})
+			if err != nil {
+				t.Fatalf("Error saving file: %v", err)
+			}
+			kept, err := stores.Files.SaveFile(ctx, &models.File{User_id: "owner", File_name: "kept.md", File_content: "public"})
+			if err != nil {
+				t.Fatalf("Error saving file: %v", err)
+			}
+
+			for _, file := range []*models.File{purged, kept} {
+				id := primitive.NewObjectID()
+				if err := stores.Revisions.AddRevision(ctx, &models.Revision{ID: id, Revision_id: id.Hex(), File_id: file.File_id, Content: file.File_content}); err != nil {
+					t.Fatalf("Error adding revision: %v", err)
+				}
+
+				id = primitive.NewObjectID()
+				if err := stores.Comments.CreateThread(ctx, &models.Thread{ID: id, Thread_id: id.Hex(), File_id: file.File_id}); err != nil {
+					t.Fatalf("Error creating thread: %v", err)
+				}
+
+				id = primitive.NewObjectID()
+				if _, err := stores.Shares.SaveShare(ctx, &models.Share{ID: id, Share_id: id.Hex(), Owner_id: "owner", File_id: file.File_id, Grantee_id: "friend", Permission: models.PermissionView}); err != nil {
+					t.Fatalf("Error saving share: %v", err)
+				}
+
+				id = primitive.NewObjectID()
+				if err := stores.Shares.CreateLink(ctx, &models.PublicLink{ID: id, Link_id: id.Hex(), Token: id.Hex(), Owner_id: "owner", File_id: file.File_id}); err != nil {
+					t.Fatalf("Error creating link: %v", err)
+				}
+			}
+			id := primitive.NewObjectID()
+			if _, err := stores.Shares.SaveShare(ctx, &models.Share{ID: id, Share_id: id.Hex(), Owner_id: "owner", Folder: "work", Grantee_id: "friend", Permission: models.PermissionView}); err != nil {
+				t.Fatalf("Error saving folder share: %v", err)
+			}
+
+			if err := stores.PurgeFile(ctx, "owner", purged.File_id); err != nil {
+				t.Fatalf("Error purging file: %v", err)
+			}
+
+			if _, err := stores.Files.GetFile(ctx, "owner", purged.File_id); err != ErrNotFound {
+				t.Errorf("Expected the file to be gone, got %v", err)
+			}
+			for fileId, want := range map[string]int{purged.File_id: 0, kept.File_id: 1} {
+				revisions, _ := stores.Revisions.ListRevisions(ctx, fileId)
+				threads, _ := stores.Comments.ListThreads(ctx, fileId)
+				links, _ := stores.Shares.ListLinks(ctx, "owner", fileId)
+				if len(revisions) != want || len(threads) != want || len(links) != want {
+					t.Errorf("File %s: expected %d of each, got %d revisions, %d threads and %d links", fileId, want, len(revisions), len(threads), len(links))
+				}
+			}
+
+			shares, _ := stores.Shares.ListShares(ctx, "owner")
+			if len(shares) != 2 {
+				t.Fatalf("Expected the other file's share and the folder share to be kept, got %+v", shares)
+			}
+			for _, share := range shares {
+				if share.File_id == purged.File_id {
+					t.Errorf("Expected shares of the purged file to be deleted, got %+v", share)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkspaceStore(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			workspaces := stores.Workspaces
+
+			id := primitive.NewObjectID()
+			workspace := &models.Workspace{ID: id, Workspace_id: id.Hex(), Name: "Team", Owner_id: "alice", Dictionary: []string{"kubernetes"}}
+			if err := workspaces.CreateWorkspace(ctx, workspace); err != nil {
+				t.Fatalf("Error creating workspace: %v", err)
+			}
+
+			updated, err := workspaces.UpdateDictionary(ctx, workspace.Workspace_id, []string{"grpc", "kubernetes", "argo"}, []string{"kubernetes"})
+			if err != nil {
+				t.Fatalf("Error updating dictionary: %v", err)
+			}
+			if strings.Join(updated.Dictionary, ",") != "argo,grpc" {
+				t.Errorf("Expected dictionary argo,grpc, got %v", updated.Dictionary)
+			}
+
+			renamed, err := workspaces.RenameWorkspace(ctx, workspace.Workspace_id, "Platform")
+			if err != nil || renamed.Name != "Platform" || len(renamed.Dictionary) != 2 {
+				t.Errorf("Expected the rename to keep the dictionary, got %+v, %v", renamed, err)
+			}
+			if _, err := workspaces.RenameWorkspace(ctx, "missing", "x"); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound renaming a missing workspace, got %v", err)
+			}
+
+			for _, member := range []models.Member{
+				{ID: primitive.NewObjectID(), Workspace_id: workspace.Workspace_id, User_id: "alice", Role: models.RoleOwner},
+				{ID: primitive.NewObjectID(), Workspace_id: workspace.Workspace_id, User_id: "bob", Role: models.RoleViewer},
+			} {
+				if _, err := workspaces.SaveMember(ctx, &member); err != nil {
+					t.Fatalf("Error saving member: %v", err)
+				}
+			}
+
+			// Saving an existing member changes their role in place
+			promoted, err := workspaces.SaveMember(ctx, &models.Member{ID: primitive.NewObjectID(), Workspace_id: workspace.Workspace_id, User_id: "bob", Role: models.RoleEditor})
+			if err != nil {
+				t.Fatalf("Error saving member: %v", err)
+			}
+			if member, err := workspaces.GetMember(ctx, workspace.Workspace_id, "bob"); err != nil || member.Role != models.RoleEditor || member.ID != promoted.ID {
+				t.Errorf("Expected bob to be an editor, got %+v, %v", member, err)
+			}
+			if members, _ := workspaces.ListMembers(ctx, workspace.Workspace_id); len(members) != 2 {
+				t.Errorf("Expected 2 members, got %+v", members)
+			}
+
+			if err := workspaces.RemoveMember(ctx, workspace.Workspace_id, "bob"); err != nil {
+				t.Fatalf("Error removing member: %v", err)
+			}
+			if _, err := workspaces.GetMember(ctx, workspace.Workspace_id, "bob"); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound for a removed member, got %v", err)
+			}
+			if memberships, _ := workspaces.ListMemberships(ctx, "alice"); len(memberships) != 1 || memberships[0].Role != models.RoleOwner {
+				t.Errorf("Expected alice to own one workspace, got %+v", memberships)
+			}
+		})
+	}
+}
+
+func TestCommentStore(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			comments := stores.Comments
+			now := time.Now().UTC().Truncate(time.Millisecond)
+
+			id := primitive.NewObjectID()
+			thread := &models.Thread{
+				ID:         id,
+				Thread_id:  id.Hex(),
+				File_id:    "file",
+				Author_id:  "alice",
+				Anchor:     models.Anchor{Start: 4, End: 9, Quote: "quick", Revision_id: "r1"},
+				Comments:   []models.Comment{{Comment_id: "c1", Author_id: "alice", Body: "Typo?", Created_at: now}},
+				Created_at: now,
+				Updated_at: now,
+			}
+			if err := comments.CreateThread(ctx, thread); err != nil {
+				t.Fatalf("Error creating thread: %v", err)
+			}
+
+			replied, err := comments.AddComment(ctx, "file", thread.Thread_id, &models.Comment{Comment_id: "c2", Author_id: "bob", Body: "Fixed", Created_at: now})
+			if err != nil {
+				t.Fatalf("Error adding comment: %v", err)
+			}
+			if len(replied.Comments) != 2 || replied.Comments[1].Body != "Fixed" {
+				t.Errorf("Expected the reply after the first comment, got %+v", replied.Comments)
+			}
+
+			resolved, err := comments.ResolveThread(ctx, "file", thread.Thread_id, "bob")
+			if err != nil || !resolved.Resolved || resolved.Resolved_by != "bob" || resolved.Resolved_at == nil {
+				t.Errorf("Expected the thread resolved by bob, got %+v, %v", resolved, err)
+			}
+
+			// Moving the anchor keeps the replies and the resolution
+			anchor := models.Anchor{Start: 10, End: 15, Quote: "quick", Revision_id: "r2"}
+			if err := comments.UpdateAnchor(ctx, "file", thread.Thread_id, anchor); err != nil {
+				t.Fatalf("Error updating anchor: %v", err)
+			}
+			stored, err := comments.GetThread(ctx, "file", thread.Thread_id)
+			if err != nil || stored.Anchor != anchor || len(stored.Comments) != 2 || !stored.Resolved {
+				t.Errorf("Expected the moved anchor with replies and resolution, got %+v, %v", stored, err)
+			}
+
+			reopened, err := comments.ResolveThread(ctx, "file", thread.Thread_id, "")
+			if err != nil || reopened.Resolved || reopened.Resolved_at != nil {
+				t.Errorf("Expected the thread reopened, got %+v, %v", reopened, err)
+			}
+
+			if _, err := comments.GetThread(ctx, "other", thread.Thread_id); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound for a thread on another file, got %v", err)
+			}
+			if threads, _ := comments.ListThreads(ctx, "file"); len(threads) != 1 {
+				t.Errorf("Expected 1 thread, got %+v", threads)
+			}
+
+			if err := comments.DeleteThread(ctx, "file", thread.Thread_id); err != nil {
+				t.Fatalf("Error deleting thread: %v", err)
+			}
+			if err := comments.DeleteThread(ctx, "file", thread.Thread_id); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound deleting a deleted thread, got %v", err)
+			}
+		})
+	}
+}
+
+func TestUserStore(t *testing.T) {
+	for name, stores := range testBackends(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			users := stores.Users
+
+			email := "Someone@Example.com"
+			id := primitive.NewObjectID()
+			user := models.User{ID: id, User_id: id.Hex(), Email: &email}
+
+			if err := users.CreateUser(ctx, &user); err != nil {
+				t.Fatalf("Error creating user: %v", err)
+			}
+
+			count, err := users.CountUsersByEmail(ctx, "someone@example.com")
+			if err != nil {
+				t.Fatalf("Error counting users: %v", err)
+			}
+			if count != 1 {
+				t.Errorf("Expected case-insensitive email count 1, got %d", count)
+			}
+
+			if _, err := users.GetUserByEmail(ctx, email); err != nil {
+				t.Errorf("Error getting user by email: %v", err)
+			}
+
+			updated, err := users.UpdateTokens(ctx, user.User_id, "token", "refresh")
+			if err != nil {
+				t.Fatalf("Error updating tokens: %v", err)
+			}
+			if *updated.Token != "token" || *updated.Refresh_token != "refresh" {
+				t.Errorf("Tokens were not updated: %+v", updated)
+			}
+
+			if _, err := users.GetUserById(ctx, "missing"); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound for missing user, got %v", err)
+			}
+
+			if _, err := users.UpdateRenderOptions(ctx, user.User_id, &models.RenderOptions{Footnotes: true}); err != nil {
+				t.Fatalf("Error updating render options: %v", err)
+			}
+			found, _ := users.GetUserById(ctx, user.User_id)
+			if found.Render_options == nil || !found.Render_options.Footnotes || found.Render_options.Gfm {
+				t.Errorf("Render options were not stored: %+v", found.Render_options)
+			}
+			if found.Token == nil || *found.Token != "token" {
+				t.Errorf("Updating render options lost the tokens: %+v", found)
+			}
+
+			if reset, err := users.UpdateRenderOptions(ctx, user.User_id, nil); err != nil || reset.Render_options != nil {
+				t.Errorf("Expected render options to be cleared, got %+v, %v", reset, err)
+			}
+			if _, err := users.UpdateRenderOptions(ctx, "missing", nil); err != ErrNotFound {
+				t.Errorf("Expected ErrNotFound for missing user, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFilesystemFileStoreAdoptsUntrackedNotes(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	files, err := NewFilesystemFileStore(root)
+	if err != nil {
+		t.Fatalf("Error opening filesystem store: %v", err)
+	}
+
+	// A note committed by someone else shows up without a sidecar.
+	userDir := filepath.Join(root, "user-1")
+	if err := os.MkdirAll(userDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(userDir, "pulled.md"), []byte("# Pulled"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := files.ListFiles(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("Error listing files: %v", err)
+	}
+	if len(list) != 1 || list[0].File_content != "# Pulled" {
+		t.Fatalf("Expected the untracked note to be listed, got %+v", list)
+	}
+
+	if _, err := os.Stat(filepath.Join(userDir, "pulled.md"+metaSuffix)); err != nil {
+		t.Errorf("Expected a sidecar to be written: %v", err)
+	}
+
+	if _, err := files.SaveFile(ctx, &models.File{User_id: "user-1", File_name: "../escape.md", File_content: "x"}); err == nil {
+		t.Errorf("Expected a path traversal file name to be rejected")
+	}
+}
+
+func TestFilesystemFileStoreIndexesSlugsOnStart(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	files, err := NewFilesystemFileStore(root)
+	if err != nil {
+		t.Fatalf("Error opening filesystem store: %v", err)
+	}
+	note, err := files.SaveFile(ctx, &models.File{User_id: "user-1", File_name: "post.md", File_content: "# Hello"})
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+	note.Slug, note.Visibility = "hello", models.VisibilityPublic
+	if _, err := files.UpdateFile(ctx, note, note.Version); err != nil {
+		t.Fatalf("Error publishing note: %v", err)
+	}
+
+	reopened, err := NewFilesystemFileStore(root)
+	if err != nil {
+		t.Fatalf("Error reopening filesystem store: %v", err)
+	}
+	if public, err := reopened.GetPublicFile(ctx, "hello"); err != nil || public.File_id != note.File_id {
+		t.Errorf("Expected the published note after a restart, got %v, %v", public, err)
+	}
+
+	other, _ := reopened.SaveFile(ctx, &models.File{User_id: "user-2", File_name: "post.md", File_content: "# Other"})
+	other.Slug = "hello"
+	if _, err := reopened.UpdateFile(ctx, other, other.Version); err != ErrSlugTaken {
+		t.Errorf("Expected ErrSlugTaken, got %v", err)
+	}
+
+	if err := reopened.DeleteFile(ctx, "user-1", note.File_id); err != nil {
+		t.Fatalf("Error deleting file: %v", err)
+	}
+	if _, err := reopened.UpdateFile(ctx, other, other.Version); err != nil {
+		t.Errorf("Expected a deleted note's slug to be free, got %v", err)
+	}
+}
+
+func TestFilesystemFileStoreFindsMovedNotes(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	files, err := NewFilesystemFileStore(root)
+	if err != nil {
+		t.Fatalf("Error opening filesystem store: %v", err)
+	}
+	note, err := files.SaveFile(ctx, &models.File{User_id: "user-1", File_name: "plan.md", File_content: "# Plan"})
+	if err != nil {
+		t.Fatalf("Error saving file: %v", err)
+	}
+
+	// A git mv moves the note and its sidecar behind the store's back
+	userDir := filepath.Join(root, "user-1")
+	if err := os.MkdirAll(filepath.Join(userDir, "work"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, suffix := range []string{"", metaSuffix} {
+		if err := os.Rename(filepath.Join(userDir, "plan.md"+suffix), filepath.Join(userDir, "work", "plan.md"+suffix)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := files.GetFile(ctx, "user-1", note.File_id)
+	if err != nil || found.Folder != "work" || found.File_content != "# Plan" {
+		t.Errorf("Expected the moved note, got %+v, %v", found, err)
+	}
+
+	if _, err := files.GetFile(ctx, "user-2", note.File_id); err != ErrNotFound {
+		t.Errorf("Expected another user's note not to be found, got %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// DiffOp is one run of a diff: tokens that are equal in both texts, or that
+// were inserted or deleted going from the old text to the new one.
+type DiffOp struct {
+	Kind string `json:"op"`
+	Text string `json:"text"`
+}
+
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// wordDiffRegex splits text into words, runs of whitespace and single symbols
+// so a word diff can be joined back into the original text.
+var wordDiffRegex = regexp.MustCompile(`\s+|[\p{L}\p{N}_']+|[^\s\p{L}\p{N}_']`)
+
+// diffTokens computes the shortest edit script between a and b with Myers'
+// O(ND) algorithm and returns it as per-token operations.
+func diffTokens(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	if max == 0 {
+		return nil
+	}
+
+	offset := max
+	v := make([]int, 2*max+2)
+	var trace [][]int
+
+	// Forward pass: record the furthest reaching path for every edit distance.
+search:
+	for d := 0; d <= max; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Backtrack from the end to recover the edit script in reverse.
+	var reversed []DiffOp
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0 && (x > 0 || y > 0); d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, DiffOp{Kind: DiffEqual, Text: a[x]})
+		}
+
+		if d == 0 {
+			break
+		}
+
+		if x == prevX {
+			y--
+			reversed = append(reversed, DiffOp{Kind: DiffInsert, Text: b[y]})
+		} else {
+			x--
+			reversed = append(reversed, DiffOp{Kind: DiffDelete, Text: a[x]})
+		}
+	}
+
+	ops := make([]DiffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+
+	return ops
+}
+
+// mergeOps joins consecutive operations of the same kind.
+func mergeOps(ops []DiffOp) []DiffOp {
+	var merged []DiffOp
+	for _, op := range ops {
+		if last := len(merged) - 1; last >= 0 && merged[last].Kind == op.Kind {
+			merged[last].Text += op.Text
+			continue
+		}
+		merged = append(merged, op)
+	}
+
+	return merged
+}
+
+// WordDiff compares two texts word by word. Whitespace and punctuation are
+// kept as their own tokens, so joining every equal and insert op rebuilds the
+// new text.
+func WordDiff(oldText, newText string) []DiffOp {
+	ops := diffTokens(
+		wordDiffRegex.FindAllString(oldText, -1),
+		wordDiffRegex.FindAllString(newText, -1),
+	)
+
+	return mergeOps(ops)
+}
+
+// RangeMap maps ranges of one text onto a newer version of it through a word
+// diff. Offsets count runes.
+type RangeMap struct {
+	ops []DiffOp
+}
+
+// NewRangeMap diffs oldText against newText once, for remapping any number
+// of ranges.
+func NewRangeMap(oldText, newText string) *RangeMap {
+	return &RangeMap{ops: WordDiff(oldText, newText)}
+}
+
+// Remap maps the range [start, end) of the old text onto the new text. Text
+// inserted at either edge of the range stays outside it, and a range whose
+// text was replaced covers the replacement. If every character of the range
+// was deleted, the result is an empty range where the text used to be.
+func (m *RangeMap) Remap(start, end int) (int, int) {
+	newStart := remapOffset(m.ops, start, true)
+	newEnd := remapOffset(m.ops, end, false)
+	if newEnd < newStart {
+		newEnd = newStart
+	}
+
+	return newStart, newEnd
+}
+
+// remapOffset maps a rune offset in the old text of a diff to the new text.
+// An offset at a point where text was inserted lands after the insertion if
+// after is set, and before it otherwise. Deleted text directly followed by
+// inserted text counts as replaced, so an end offset inside it lands after
+// the replacement.
+func remapOffset(ops []DiffOp, offset int, after bool) int {
+	oldPos, newPos := 0, 0
+
+	for i, op := range ops {
+		length := utf8.RuneCountInString(op.Text)
+
+		switch op.Kind {
+		case DiffEqual:
+			if offset < oldPos+length || (offset == oldPos+length && !after) {
+				return newPos + offset - oldPos
+			}
+			oldPos += length
+			newPos += length
+		case DiffDelete:
+			replaced := i+1 < len(ops) && ops[i+1].Kind == DiffInsert
+			if replaced && !after && offset > oldPos && offset <= oldPos+length {
+				return newPos + utf8.RuneCountInString(ops[i+1].Text)
+			}
+			if offset < oldPos+length {
+				return newPos
+			}
+			oldPos += length
+		case DiffInsert:
+			if offset == oldPos && !after {
+				return newPos
+			}
+			newPos += length
+		}
+	}
+
+	return newPos
+}
+
+// splitLines splits text into lines, keeping the trailing newline on each.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// UnifiedDiff returns a unified diff of two texts in the format produced by
+// `diff -u`, with the given number of context lines around each change.
+func UnifiedDiff(oldName, newName, oldText, newText string, context int) string {
+	ops := diffTokens(splitLines(oldText), splitLines(newText))
+
+	var out strings.Builder
+	hasChanges := false
+
+	// Walk the script tracking line numbers, flushing a hunk whenever a run of
+	// unchanged lines is longer than twice the context.
+	var hunk []DiffOp
+	oldLine, newLine := 1, 1
+	hunkOld, hunkNew := 1, 1
+	trailingEqual := 0
+
+	flush := func() {
+		// Trim unchanged lines beyond the context at the end of the hunk.
+		if extra := trailingEqual - context; extra > 0 {
+			hunk = hunk[:len(hunk)-extra]
+		}
+
+		oldCount, newCount := 0, 0
+		for _, op := range hunk {
+			if op.Kind != DiffInsert {
+				oldCount++
+			}
+			if op.Kind != DiffDelete {
+				newCount++
+			}
+		}
+
+		if !hasChanges {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+			hasChanges = true
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(hunkOld, oldCount), hunkRange(hunkNew, newCount))
+
+		for _, op := range hunk {
+			prefix := " "
+			switch op.Kind {
+			case DiffInsert:
+				prefix = "+"
+			case DiffDelete:
+				prefix = "-"
+			}
+
+			out.WriteString(prefix + op.Text)
+			if !strings.HasSuffix(op.Text, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		hunk = nil
+	}
+
+	for i, op := range ops {
+		if op.Kind == DiffEqual {
+			if hunk != nil {
+				hunk = append(hunk, op)
+				trailingEqual++
+				if trailingEqual > 2*context {
+					flush()
+				}
+			}
+		} else {
+			if hunk == nil {
+				// Start a new hunk with up to `context` preceding equal lines.
+				start := i
+				for start > 0 && i-start < context && ops[start-1].Kind == DiffEqual {
+					start--
+				}
+				hunk = append(hunk, ops[start:i]...)
+				hunkOld = oldLine - (i - start)
+				hunkNew = newLine - (i - start)
+			}
+			hunk = append(hunk, op)
+			trailingEqual = 0
+		}
+
+		if op.Kind != DiffInsert {
+			oldLine++
+		}
+		if op.Kind != DiffDelete {
+			newLine++
+		}
+	}
+
+	if hunk != nil {
+		flush()
+	}
+
+	return out.String()
+}
+
+// hunkRange formats a hunk header range; empty ranges point at the line before.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
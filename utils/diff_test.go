@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWordDiffRebuildsBothTexts(t *testing.T) {
+	oldText := "The quick brown fox jumps over the lazy dog."
+	newText := "The quick red fox leaped over the lazy dog!"
+
+	ops := WordDiff(oldText, newText)
+
+	var rebuiltOld, rebuiltNew strings.Builder
+	for _, op := range ops {
+		if op.Kind != DiffInsert {
+			rebuiltOld.WriteString(op.Text)
+		}
+		if op.Kind != DiffDelete {
+			rebuiltNew.WriteString(op.Text)
+		}
+	}
+
+	if rebuiltOld.String() != oldText {
+		t.Errorf("Old text not rebuilt: got %q", rebuiltOld.String())
+	}
+	if rebuiltNew.String() != newText {
+		t.Errorf("New text not rebuilt: got %q", rebuiltNew.String())
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	oldText := "one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n"
+	newText := "one\nTWO\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n"
+
+	got := UnifiedDiff("a.md", "b.md", oldText, newText, 1)
+	want := `--- a.md
++++ b.md
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+@@ -10 +10,2 @@
+ ten
++eleven
+`
+
+	if got != want {
+		t.Errorf("Unexpected unified diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	if diff := UnifiedDiff("a.md", "b.md", oldText, oldText, 3); diff != "" {
+		t.Errorf("Expected no diff for identical texts, got:\n%s", diff)
+	}
+}
+
+func TestRangeMapRemap(t *testing.T) {
+	oldText := "Spelling is hard. The qick fox jumps."
+
+	tests := []struct {
+		name       string
+		newText    string
+		start, end int
+		want       string
+	}{
+		{"text inserted before", "Honestly, spelling is hard. The qick fox jumps.", 18, 30, "The qick fox"},
+		{"text changed inside", "Spelling is hard. The quick fox jumps.", 18, 30, "The quick fox"},
+		{"text inserted at the end", "Spelling is hard. The qick fox really jumps.", 22, 26, "qick"},
+		{"word replaced", "Spelling is hard. The quick fox jumps.", 22, 26, "quick"},
+		{"range deleted", "Spelling is hard. The jumps.", 22, 29, ""},
+		{"multibyte text", "Ça: spelling is hard. The qick fox jumps.", 22, 26, "qick"},
+	}
+
+	for _, test := range tests {
+		start, end := NewRangeMap(oldText, test.newText).Remap(test.start, test.end)
+		if got := string([]rune(test.newText)[start:end]); got != test.want {
+			t.Errorf("%s: remapped to %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// DefaultDocumentTheme is used when no document theme is asked for
+const DefaultDocumentTheme = "default"
+
+// Document is what document themes render: an annotated note as a page
+type Document struct {
+	Title string
+	// Body is the annotated HTML fragment
+	Body template.HTML
+	// Scripts load what the note's math and diagrams need
+	Scripts template.HTML
+}
+
+const documentHead = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{.Scripts}}`
+
+// defaultDocumentTheme styles misspellings with a wavy underline and shows
+// their suggestions on hover, without loading anything
+const defaultDocumentTheme = documentHead + `<style>
+body { margin: 0; color: #1f2328; font: 16px/1.6 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; }
+main { max-width: 760px; margin: 0 auto; padding: 32px 24px; }
+pre { padding: 12px; border: 1px solid #d1d9e0; border-radius: 6px; overflow-x: auto; }
+pre:not(.chroma):not([style]) { background: #f6f8fa; }
+code { font: 0.9em ui-monospace, SFMono-Regular, Menlo, monospace; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d1d9e0; padding: 6px 13px; }
+mark.misspelling { position: relative; background: none; color: inherit; text-decoration: underline wavy #d1242f 1px; text-underline-offset: 3px; }
+mark.misspelling .suggestions { display: none; position: absolute; left: 0; top: 100%; z-index: 1; margin: 4px 0 0; padding: 4px 0; min-width: 120px; list-style: none; background: #1f2328; color: #fff; border-radius: 6px; }
+mark.misspelling .suggestions li { padding: 2px 12px; }
+mark.misspelling:hover .suggestions { display: block; }
+</style>
+</head>
+<body>
+<main>
+{{.Body}}
+</main>
+<script>
+for (const mark of document.querySelectorAll("mark.misspelling[data-suggestions]")) {
+  const suggestions = JSON.parse(mark.dataset.suggestions);
+  if (suggestions.length === 0) continue;
+  const list = document.createElement("ul");
+  list.className = "suggestions";
+  for (const suggestion of suggestions) {
+    const item = document.createElement("li");
+    item.textContent = suggestion;
+    list.appendChild(item);
+  }
+  mark.appendChild(list);
+}
+</script>
+</body>
+</html>
+`
+
+// plainDocumentTheme leaves the page to the browser's styles
+const plainDocumentTheme = documentHead + `</head>
+<body>
+{{.Body}}
+</body>
+</html>
+`
+
+// documentThemes are the built-in themes, replaced or added to by the
+// templates in DOCUMENT_THEMES_DIR, read once
+var documentThemes = sync.OnceValue(func() map[string]*template.Template {
+	themes := map[string]*template.Template{
+		DefaultDocumentTheme: template.Must(template.New(DefaultDocumentTheme).Parse(defaultDocumentTheme)),
+		"plain":              template.Must(template.New("plain").Parse(plainDocumentTheme)),
+	}
+
+	dir := os.Getenv("DOCUMENT_THEMES_DIR")
+	if dir == "" {
+		return themes
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		log.Printf("Error listing DOCUMENT_THEMES_DIR %s: %v", dir, err)
+		return themes
+	}
+	for _, path := range paths {
+		theme, err := template.ParseFiles(path)
+		if err != nil {
+			log.Printf("Error parsing document theme %s: %v", path, err)
+			continue
+		}
+		themes[strings.TrimSuffix(filepath.Base(path), ".html")] = theme
+	}
+
+	return themes
+})
+
+// DocumentThemes lists the names of the available document themes. Besides
+// the built-in default and plain themes, each .html file in
+// DOCUMENT_THEMES_DIR is an html/template theme named after the file,
+// executed with a Document.
+func DocumentThemes() []string {
+	names := make([]string, 0, len(documentThemes()))
+	for name := range documentThemes() {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// ValidDocumentTheme reports whether a document theme exists
+func ValidDocumentTheme(name string) bool {
+	_, ok := documentThemes()[name]
+	return ok
+}
+
+// RenderDocument wraps an annotated fragment in a complete HTML page, using
+// the named theme or the default one when theme is ""
+func RenderDocument(theme string, title string, fragment string) (string, error) {
+	if theme == "" {
+		theme = DefaultDocumentTheme
+	}
+
+	page, ok := documentThemes()[theme]
+	if !ok {
+		return "", fmt.Errorf("unknown document theme %q", theme)
+	}
+
+	var buffer bytes.Buffer
+	err := page.Execute(&buffer, Document{
+		Title:   title,
+		Body:    template.HTML(fragment),
+		Scripts: template.HTML(ClientScripts(fragment)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
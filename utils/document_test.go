@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProcessHTMLAnnotatesFragment(t *testing.T) {
+	fragment, err := ProcessHTML("<p>Teh end</p>", map[string][]string{"Teh": {"The", "Ten"}})
+	if err != nil {
+		t.Fatalf("Error processing: %v", err)
+	}
+
+	want := `<p><mark class="misspelling" data-finding-id="f1" data-word="Teh" data-suggestions="[&#34;The&#34;,&#34;Ten&#34;]">Teh</mark> end</p>`
+	if fragment != want {
+		t.Errorf("Expected %s, got %s", want, fragment)
+	}
+
+	page, err := RenderDocument("", "Notes <1>", fragment)
+	if err != nil {
+		t.Fatalf("Error rendering document: %v", err)
+	}
+	for _, want := range []string{"<!DOCTYPE html>", "<title>Notes &lt;1&gt;</title>", "mark.misspelling", fragment} {
+		if !strings.Contains(page, want) {
+			t.Errorf("Expected %q in:\n%s", want, page)
+		}
+	}
+
+	page, err = RenderDocument("plain", "Notes", fragment)
+	if err != nil {
+		t.Fatalf("Error rendering document: %v", err)
+	}
+	if strings.Contains(page, "<style>") || !strings.Contains(page, fragment) {
+		t.Errorf("Expected the plain theme to add no styles in:\n%s", page)
+	}
+
+	if _, err := RenderDocument("missing", "Notes", fragment); err == nil {
+		t.Error("Expected an error for an unknown theme")
+	}
+}
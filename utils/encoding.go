@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Encodings text files are decoded from, as recorded on notes
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF8BOM     = "utf-8-bom"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingWindows1252 = "windows-1252"
+	EncodingLatin1      = "iso-8859-1"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// DecodeText converts text to UTF-8 in Unicode normalization form C and
+// returns the encoding it was in: UTF-8, with or without a byte order mark,
+// UTF-16 of either byte order, with a byte order mark or mostly ASCII, or,
+// for anything else that isn't valid UTF-8, Windows-1252 or Latin-1. UTF-16
+// is decoded before the text is checked for binary content, since its ASCII
+// characters hold NUL bytes.
+func DecodeText(content []byte) ([]byte, string, error) {
+	text, encoding, err := decodeText(content)
+	if err != nil {
+		return nil, encoding, err
+	}
+	return norm.NFC.Bytes(text), encoding, nil
+}
+
+func decodeText(content []byte) ([]byte, string, error) {
+	if bytes.HasPrefix(content, utf8BOM) {
+		content = content[len(utf8BOM):]
+		return content, EncodingUTF8BOM, SniffText(content)
+	}
+
+	if name, decoder := utf16Encoding(content); decoder != nil {
+		decoded, err := decoder.NewDecoder().Bytes(content)
+		if err != nil {
+			return nil, name, ErrInvalidEncoding.Wrap(err)
+		}
+		return decoded, name, SniffText(decoded)
+	}
+
+	if err := sniffBinary(content); err != nil {
+		return nil, "", err
+	}
+	if utf8.Valid(content) {
+		return content, EncodingUTF8, nil
+	}
+
+	name, decoder := EncodingLatin1, encoding.Encoding(charmap.ISO8859_1)
+	if isWindows1252(content) {
+		name, decoder = EncodingWindows1252, charmap.Windows1252
+	}
+	decoded, err := decoder.NewDecoder().Bytes(content)
+	if err != nil {
+		return nil, name, ErrInvalidEncoding.Wrap(err)
+	}
+	return decoded, name, nil
+}
+
+// utf16Encoding returns the UTF-16 encoding of content from its byte order
+// mark or, without one, from NUL bytes filling every other byte as they do
+// in mostly ASCII text
+func utf16Encoding(content []byte) (string, encoding.Encoding) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xff, 0xfe}):
+		return EncodingUTF16LE, unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(content, []byte{0xfe, 0xff}):
+		return EncodingUTF16BE, unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	}
+
+	// A few bytes are too few to tell
+	sample := content[:min(len(content), 4096)&^1]
+	if len(sample) < 8 {
+		return "", nil
+	}
+
+	var even, odd int
+	for i := 0; i < len(sample); i += 2 {
+		if sample[i] == 0 {
+			even++
+		}
+		if sample[i+1] == 0 {
+			odd++
+		}
+	}
+
+	// Binary files have NUL bytes too, but not in one position of nearly
+	// every pair
+	pairs := len(sample) / 2
+	switch {
+	case odd*10 >= pairs*9 && even*10 <= pairs:
+		return EncodingUTF16LE, unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case even*10 >= pairs*9 && odd*10 <= pairs:
+		return EncodingUTF16BE, unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+	return "", nil
+}
+
+// isWindows1252 reports whether 8-bit text is Windows-1252 rather than
+// Latin-1: it uses bytes 0x80 to 0x9f, which Windows-1252 assigns to
+// characters like curly quotes and dashes and Latin-1 to control codes, and
+// none of the five Windows-1252 leaves unassigned
+func isWindows1252(content []byte) bool {
+	found := false
+	for _, b := range content {
+		switch {
+		case b == 0x81 || b == 0x8d || b == 0x8f || b == 0x90 || b == 0x9d:
+			return false
+		case b >= 0x80 && b <= 0x9f:
+			found = true
+		}
+	}
+	return found
+}
+
+// DictionaryWord returns the form of a word dictionaries are keyed by:
+// lowercase and in Unicode normalization form C, so that a word typed with a
+// combining accent matches the same word with a precomposed one
+func DictionaryWord(word string) string {
+	return norm.NFC.String(strings.ToLower(word))
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sajari/fuzzy"
+)
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		want     string
+		encoding string
+		err      error
+	}{
+		{"utf-8", "# Café", "# Café", EncodingUTF8, nil},
+		{"decomposed", "# Cafe\u0301", "# Caf\u00e9", EncodingUTF8, nil},
+		{"utf-8 bom", "\xef\xbb\xbf# Café", "# Café", EncodingUTF8BOM, nil},
+		{"utf-16le bom", "\xff\xfe#\x00 \x00C\x00a\x00f\x00\xe9\x00", "# Café", EncodingUTF16LE, nil},
+		{"utf-16be bom", "\xfe\xff\x00#\x00 \x00C\x00a\x00f\x00\xe9", "# Café", EncodingUTF16BE, nil},
+		{"utf-16le", "#\x00 \x00C\x00a\x00f\x00\xe9\x00 \x00n\x00o\x00t\x00e\x00s\x00", "# Café notes", EncodingUTF16LE, nil},
+		{"windows-1252", "\x93Caf\xe9\x94 \x96 na\xefve", "“Café” – naïve", EncodingWindows1252, nil},
+		{"latin-1", "Caf\xe9 na\xefve", "Café naïve", EncodingLatin1, nil},
+		{"binary", "a\x00\x00\x00b\x00", "", "", ErrBinaryFile},
+		{"png", "\x89PNG\r\n\x1a\n\xe9", "", "", ErrBinaryFile},
+	}
+
+	for _, test := range tests {
+		got, encoding, err := DecodeText([]byte(test.content))
+		if !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+			t.Errorf("%s: error = %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && (string(got) != test.want || encoding != test.encoding) {
+			t.Errorf("%s: got %q in %s, want %q in %s", test.name, got, encoding, test.want, test.encoding)
+		}
+	}
+}
+
+func TestCheckMarkdownSpellingNormalizes(t *testing.T) {
+	if got, want := DictionaryWord("Cafe\u0301"), "caf\u00e9"; got != want {
+		t.Errorf("DictionaryWord = %q, want %q", got, want)
+	}
+
+	words := []string{"caf\u00e9", "cafes", "na\u00efve", "nail", "time"}
+	dictionary := make(map[string]bool, len(words))
+	for _, word := range words {
+		dictionary[word] = true
+	}
+	model := fuzzy.NewModel()
+	model.SetThreshold(1)
+	model.SetDepth(1)
+	model.Train(words)
+
+	// Words split at their combining marks would be corrected
+	for _, part := range []string{"cafe", "nai"} {
+		if len(model.Suggestions(part, false)) == 0 {
+			t.Fatalf("Expected the model to suggest a correction for %q", part)
+		}
+	}
+
+	result, err := CheckMarkdownSpelling([]byte("Cafe\u0301 time, nai\u0308ve"), dictionary, model)
+	if err != nil {
+		t.Fatalf("Error checking spelling: %v", err)
+	}
+	if len(result.Misspelled) != 0 {
+		t.Errorf("Expected decomposed words to match their precomposed forms, got %v in %q", result.Misspelled, result.Tokens)
+	}
+}
@@ -1,9 +1,16 @@
 package utils
 
-import "fmt"
+import (
+	"fmt"
+	"net/http"
+)
 
+// SpellCheckError is an error of the spell check API with a stable Code
+// clients can act on and the HTTP Status it is returned with. Wrapped
+// errors match their sentinel with errors.Is.
 type SpellCheckError struct {
 	Code    string
+	Status  int
 	Message string
 	Err     error
 }
@@ -15,7 +22,32 @@ func (e *SpellCheckError) Error() string {
 	return e.Message
 }
 
+func (e *SpellCheckError) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors by code
+func (e *SpellCheckError) Is(target error) bool {
+	t, ok := target.(*SpellCheckError)
+	return ok && t.Code == e.Code
+}
+
+// Wrap returns a copy of the error caused by err
+func (e *SpellCheckError) Wrap(err error) *SpellCheckError {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
 var (
-	ErrInvalidFile    = &SpellCheckError{Code: "INVALID_FILE", Message: "Invalid file type"}
-	ErrProcessingFile = &SpellCheckError{Code: "PROCESSING_ERROR", Message: "Error processing file"}
+	ErrInvalidFile     = &SpellCheckError{Code: "INVALID_FILE", Status: http.StatusBadRequest, Message: "Invalid file type"}
+	ErrProcessingFile  = &SpellCheckError{Code: "PROCESSING_ERROR", Status: http.StatusInternalServerError, Message: "Error processing file"}
+	ErrMissingFile     = &SpellCheckError{Code: "MISSING_FILE", Status: http.StatusBadRequest, Message: "No file uploaded as markdownfile"}
+	ErrUnsupportedType = &SpellCheckError{Code: "UNSUPPORTED_TYPE", Status: http.StatusUnsupportedMediaType, Message: "Unsupported file type. API supports markdown `.md`, HTML and reStructuredText files, and Obsidian or Notion markdown with ?from="}
+	ErrBinaryFile      = &SpellCheckError{Code: "BINARY_FILE", Status: http.StatusUnsupportedMediaType, Message: "File is binary, not text"}
+	ErrInvalidEncoding = &SpellCheckError{Code: "INVALID_ENCODING", Status: http.StatusBadRequest, Message: "File is not valid text in a supported encoding"}
+	ErrFileTooLarge    = &SpellCheckError{Code: "FILE_TOO_LARGE", Status: http.StatusRequestEntityTooLarge, Message: "File is larger than the upload limit"}
+	ErrRequestTooLarge = &SpellCheckError{Code: "REQUEST_TOO_LARGE", Status: http.StatusRequestEntityTooLarge, Message: "Request is larger than the upload limit"}
+	ErrConversion      = &SpellCheckError{Code: "CONVERSION_ERROR", Status: http.StatusUnprocessableEntity, Message: "Could not convert file to markdown"}
+	ErrSavingFile      = &SpellCheckError{Code: "SAVE_ERROR", Status: http.StatusInternalServerError, Message: "Error saving file"}
 )
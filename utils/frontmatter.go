@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// splitFrontMatter separates a YAML front matter block, fenced by "---"
+// lines at the very start of the note, from the markdown body.
+//
+// Returns:
+//   - string: The YAML between the fences
+//   - bool: Whether the note has front matter
+func splitFrontMatter(content string) (string, bool) {
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	if !strings.HasPrefix(content, "---\n") {
+		return "", false
+	}
+
+	rest := content[len("---\n"):]
+	for offset := 0; offset <= len(rest); {
+		end := strings.IndexByte(rest[offset:], '\n')
+		line := rest[offset:]
+		if end >= 0 {
+			line = rest[offset : offset+end]
+		}
+
+		// Front matter ends with "---" or YAML's "..." document end marker
+		if line == "---" || line == "..." {
+			return rest[:offset], true
+		}
+
+		if end < 0 {
+			break
+		}
+		offset += end + 1
+	}
+
+	return "", false
+}
+
+// FrontMatterTags reads the tags entry of a note's YAML front matter. Tags
+// may be a list or a comma separated string:
+//
+//	---
+//	tags: [work, planning]
+//	---
+//
+// Returns:
+//   - []string: The normalised tags
+//   - bool: Whether the note declares tags at all; false leaves tags to the API
+func FrontMatterTags(content string) ([]string, bool) {
+	frontMatter, ok := splitFrontMatter(content)
+	if !ok {
+		return nil, false
+	}
+
+	var meta struct {
+		Tags interface{} `yaml:"tags"`
+	}
+	if err := yaml.Unmarshal([]byte(frontMatter), &meta); err != nil || meta.Tags == nil {
+		return nil, false
+	}
+
+	var tags []string
+	switch value := meta.Tags.(type) {
+	case string:
+		tags = strings.Split(value, ",")
+	case []interface{}:
+		for _, item := range value {
+			if tag, ok := item.(string); ok {
+				tags = append(tags, tag)
+			}
+		}
+	default:
+		return nil, false
+	}
+
+	return NormalizeTags(tags), true
+}
+
+// NormalizeTags lowercases and trims tags, drops a leading "#" and empty
+// tags, and returns them sorted without duplicates.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	normalized := []string{}
+
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#")))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	sort.Strings(normalized)
+	return normalized
+}
+
+// StripFrontMatter returns the note's markdown without its front matter
+// block, if it has one.
+func StripFrontMatter(content string) string {
+	frontMatter, ok := splitFrontMatter(content)
+	if !ok {
+		return content
+	}
+
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+
+	// Skip the opening fence, the YAML and the closing fence line
+	body := content[len("---\n")+len(frontMatter)+len("---"):]
+	return strings.TrimPrefix(body, "\n")
+}
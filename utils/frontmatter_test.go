@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFrontMatterTags(t *testing.T) {
+	tests := []struct {
+		content string
+		tags    []string
+		ok      bool
+	}{
+		{"---\ntags: [Work, planning, work]\n---\n# Roadmap", []string{"planning", "work"}, true},
+		{"---\r\ntitle: Notes\r\ntags: \"#home, recipes\"\r\n...\r\nbody", []string{"home", "recipes"}, true},
+		{"---\ntags:\n  - a\n  - b\n---\n", []string{"a", "b"}, true},
+		{"---\ntitle: No tags\n---\nbody", nil, false},
+		{"# Just markdown\n---\ntags: [x]\n---\n", nil, false},
+		{"---\ntags: [unclosed\n", nil, false},
+	}
+
+	for _, test := range tests {
+		tags, ok := FrontMatterTags(test.content)
+		if ok != test.ok || !reflect.DeepEqual(tags, test.tags) {
+			t.Errorf("FrontMatterTags(%q) = %v, %v; want %v, %v", test.content, tags, ok, test.tags, test.ok)
+		}
+	}
+}
+
+func TestStripFrontMatter(t *testing.T) {
+	tests := []struct {
+		content string
+		body    string
+	}{
+		{"---\ntags: [work]\n---\n# Roadmap\n", "# Roadmap\n"},
+		{"---\r\ntitle: Notes\r\n...\r\nbody", "body"},
+		{"---\ntitle: Empty\n---", ""},
+		{"# No front matter\n---\n", "# No front matter\n---\n"},
+	}
+
+	for _, test := range tests {
+		if body := StripFrontMatter(test.content); body != test.body {
+			t.Errorf("StripFrontMatter(%q) = %q; want %q", test.content, body, test.body)
+		}
+	}
+}
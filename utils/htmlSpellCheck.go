@@ -2,11 +2,14 @@ package utils
 
 import (
 	"bytes"
+	"encoding/json"
 	"log"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // Add caching for processed words
@@ -15,129 +18,162 @@ import (
 // Use sync.Map for thread-safety if needed
 // var processedWordsCache sync.Map
 
+// wordRegex captures whole words as the tokenizer finds them, so accented
+// and non-Latin words are marked too
+var wordRegex = regexp.MustCompile(wordPattern)
+
+// annotator marks misspelled words, numbering them in document order
+type annotator struct {
+	misspelled map[string][]string
+	findings   int
+}
+
 // WrapMisspelledWordsInNode recursively processes the HTML node tree.
 // For each text node, it checks if any word is misspelled and replaces it by
-// wrapping that word in a <span class="misspelled-word">…</span>.
-func WrapMisspelledWordsInNode(n *html.Node, misspelled map[string][]string) {
-	// Regex to capture whole words if they are not a punctuation mark.
-	var wordRegex = regexp.MustCompile(`\b(\w+)\b`)
+// wrapping that word in a <mark class="misspelling">…</mark> annotated with
+// its finding id and suggestions. The markup is built as nodes, so words and
+// suggestions are always escaped. It returns the number of words marked.
+func WrapMisspelledWordsInNode(n *html.Node, misspelled map[string][]string) int {
+	a := &annotator{misspelled: misspelled}
+	a.wrap(n)
+	return a.findings
+}
+
+func (a *annotator) wrap(n *html.Node) {
+	// Stylesheets, scripts, math and diagrams hold no prose
+	if isNonProse(n) {
+		return
+	}
+
 	// If this is a text node, process its data.
 	if n.Type == html.TextNode {
 		text := n.Data
 		// Skip processing if the text node is empty or only whitespace.
-		if strings.TrimSpace(text) == "" {
+		if n.Parent == nil || strings.TrimSpace(text) == "" {
 			return
 		}
 
-		// Replace any word that is a key in the misspelled map with a <span> tag.
-		newText := wordRegex.ReplaceAllStringFunc(text, func(word string) string {
-			if _, exists := misspelled[word]; exists {
-				validUnorderedListMarkup := `<ul>`
-				for _, correctWord := range misspelled[word] {
-					validUnorderedListMarkup += `<li class='list-disc' >` + correctWord + `</li>`
-				}
-				validUnorderedListMarkup += `</ul>`
-				return `<div class='tooltip'><span class='misspelled-word bg-red-300' data-misspelled-word='` + word + `'>` + word + `</span><div class='tooltip-text'>` + validUnorderedListMarkup + `</div></div>`
+		// Insert the text before each misspelled word, then the word's
+		// markup, before the original text node.
+		last := 0
+		for _, match := range wordRegex.FindAllStringIndex(text, -1) {
+			word := text[match[0]:match[1]]
+			suggestions, exists := a.misspelled[word]
+			if !exists {
+				continue
 			}
-			return word
-		})
-
-		// If no changes were made, there's nothing to do.
-		if newText == text {
-			return
-		}
-
-		// Parse the replacement HTML fragment. The parent of the current node is
-		// used as the context.
-		fragment, err := html.ParseFragment(strings.NewReader(newText), n.Parent)
-		if err != nil {
-			log.Printf("Error parsing fragment: %v", err.Error())
-			return
+			if match[0] > last {
+				n.Parent.InsertBefore(&html.Node{Type: html.TextNode, Data: text[last:match[0]]}, n)
+			}
+			a.findings++
+			n.Parent.InsertBefore(misspelledWordNode(a.findings, word, suggestions), n)
+			last = match[1]
 		}
 
-		// Insert the new nodes before the original text node.
-		for _, newNode := range fragment {
-			n.Parent.InsertBefore(newNode, n)
+		// The original text node keeps what follows the last word
+		if last == len(text) {
+			n.Parent.RemoveChild(n)
+		} else {
+			n.Data = text[last:]
 		}
-		// Remove the original text node.
-		n.Parent.RemoveChild(n)
 	} else {
-		// For non-text nodes, recursively process their children.
-		for c := n.FirstChild; c != nil; c = c.NextSibling {
-			WrapMisspelledWordsInNode(c, misspelled)
+		// For non-text nodes, recursively process their children. Text nodes
+		// may be removed, so the next sibling is taken first.
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			a.wrap(c)
+			c = next
 		}
 	}
 }
 
-// ProcessHTML takes an HTML string and the misspelled words map,
-// processes the document, and returns the modified HTML as a string.
-func ProcessHTML(htmlStr string, misspelled map[string][]string) (string, error) {
+// misspelledWordNode returns the markup of a misspelled word: a mark with
+// the finding's id, the word and its suggestions as a JSON array, for
+// clients and document themes to present
+func misspelledWordNode(finding int, word string, suggestions []string) *html.Node {
+	if suggestions == nil {
+		suggestions = []string{}
+	}
+	suggestionsJSON, _ := json.Marshal(suggestions)
 
-	// Replace \n with <br>
-	var charRegex = regexp.MustCompile(`\n`)
-	htmlStr = charRegex.ReplaceAllString(htmlStr, "<br>")
-
-	// Add style to html head and style the misspelled word span
-	htmlStr = `
-	<head>
-	<script src="https://unpkg.com/@tailwindcss/browser@4"></script>
-	<style>
-		span.misspelled-word {
-		text-decoration: underline; 
-		text-decoration-style: wavy; 
-		text-decoration-color: red;
-		text-decoration-thickness: 1px;text-underline-offset: 3px;
-		}
-		.tooltip {
-			position: relative;
-			display: inline-block;
-			border-bottom: 1px dotted black;
-		}
+	mark := &html.Node{Type: html.ElementNode, Data: "mark", DataAtom: atom.Mark, Attr: []html.Attribute{
+		{Key: "class", Val: "misspelling"},
+		{Key: "data-finding-id", Val: "f" + strconv.Itoa(finding)},
+		{Key: "data-word", Val: word},
+		{Key: "data-suggestions", Val: string(suggestionsJSON)},
+	}}
+	mark.AppendChild(&html.Node{Type: html.TextNode, Data: word})
 
-		.tooltip .tooltip-text {
-			display: none;
-			width: 120px;
-			background-color: black;
-			color: #fff;
-			text-align: center;
-			border-radius: 6px;
-			padding: 5px 0;
-
-			/* Position the tooltip */
-			position: absolute;
-			z-index: 1;
-			/* bottom: -30px; */
-			left: -15px;
-		}
+	return mark
+}
 
-		.tooltip:hover .tooltip-text {
-			display: block;
+// isNonProse reports whether an element's text isn't prose to spell check
+func isNonProse(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if n.Data == "style" || n.Data == "script" {
+		return true
+	}
+
+	for _, attr := range n.Attr {
+		if attr.Key == "class" {
+			for _, class := range strings.Fields(attr.Val) {
+				if class == "math" || class == "mermaid" {
+					return true
+				}
+			}
 		}
+	}
+
+	return false
+}
+
+// parseFragment parses an HTML fragment into the children of a <body>
+func parseFragment(fragment string) (*html.Node, error) {
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), body)
+	if err != nil {
+		return nil, err
+	}
 
-		pre code {
-		  background-color: #f0f0f0;
-  		font-family: "Courier New", Courier, monospace;
-  		padding: 10px;
-  		border: 1px solid #ddd;
-  		display: block;
-  		white-space: pre;
+	for _, node := range nodes {
+		body.AppendChild(node)
+	}
+
+	return body, nil
+}
+
+// renderChildren renders the children of a node parsed by parseFragment
+func renderChildren(parent *html.Node) (string, error) {
+	var buffer bytes.Buffer
+	for node := parent.FirstChild; node != nil; node = node.NextSibling {
+		if err := html.Render(&buffer, node); err != nil {
+			return "", err
 		}
-		</style>
-	</head>` + htmlStr
-	doc, err := html.Parse(strings.NewReader(htmlStr))
+	}
+
+	return buffer.String(), nil
+}
+
+// ProcessHTML takes an HTML fragment and the misspelled words map, marks
+// the misspelled words, and returns the annotated fragment. It carries no
+// styles or scripts; RenderDocument wraps it in a themed page.
+func ProcessHTML(htmlStr string, misspelled map[string][]string) (string, error) {
+	body, err := parseFragment(htmlStr)
 	if err != nil {
 		log.Printf("Error parsing html: %v", err.Error())
 		return "", err
 	}
 
 	// Process the tree to wrap misspelled words.
-	WrapMisspelledWordsInNode(doc, misspelled)
+	WrapMisspelledWordsInNode(body, misspelled)
 
 	// Render the modified node tree back to an HTML string.
-	var buf bytes.Buffer
-	if err := html.Render(&buf, doc); err != nil {
+	annotated, err := renderChildren(body)
+	if err != nil {
 		log.Printf("Error rendering html: %v", err.Error())
 		return "", err
 	}
-	return buf.String(), nil
+	return annotated, nil
 }
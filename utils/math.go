@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindMath is the kind of inline math nodes
+var KindMath = ast.NewNodeKind("Math")
+
+// KindMathBlock is the kind of display math blocks
+var KindMathBlock = ast.NewNodeKind("MathBlock")
+
+// Math is inline TeX math: $...$, or $$...$$ for display style
+type Math struct {
+	ast.BaseInline
+	// Display is set for $$...$$
+	Display bool
+	// Value is the TeX source between the delimiters
+	Value []byte
+}
+
+func (n *Math) Kind() ast.NodeKind {
+	return KindMath
+}
+
+func (n *Math) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Value": string(n.Value)}, nil)
+}
+
+// MathBlock is display math on lines of its own between $$ fences
+type MathBlock struct {
+	ast.BaseBlock
+}
+
+func (n *MathBlock) Kind() ast.NodeKind {
+	return KindMathBlock
+}
+
+func (n *MathBlock) IsRaw() bool {
+	return true
+}
+
+func (n *MathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mathParser parses inline math. Following pandoc, an opening $ must be
+// followed by a non-space and a closing $ preceded by one and not followed
+// by a digit, so prices like $5 and $10 stay text.
+type mathParser struct{}
+
+func (p *mathParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+
+	delimiter := 1
+	if len(line) > 1 && line[1] == '$' {
+		delimiter = 2
+	}
+
+	rest := line[delimiter:]
+	if len(rest) == 0 || util.IsSpace(rest[0]) || rest[0] == '$' {
+		return nil
+	}
+
+	for i := 0; i < len(rest); i++ {
+		switch rest[i] {
+		case '\\':
+			// Skip escaped characters, like \$
+			i++
+		case '\n':
+			return nil
+		case '$':
+			// A $ next to another only closes $$...$$
+			if delimiter == 1 && (rest[i-1] == '$' || (i+1 < len(rest) && rest[i+1] == '$')) {
+				continue
+			}
+			if delimiter == 2 {
+				if i+1 >= len(rest) || rest[i+1] != '$' {
+					continue
+				}
+			} else if i+1 < len(rest) && rest[i+1] >= '0' && rest[i+1] <= '9' {
+				continue
+			}
+			if util.IsSpace(rest[i-1]) {
+				continue
+			}
+
+			block.Advance(delimiter + i + delimiter)
+			return &Math{Display: delimiter == 2, Value: append([]byte(nil), rest[:i]...)}
+		}
+	}
+
+	return nil
+}
+
+// mathBlockParser parses display math between lines holding only $$
+type mathBlockParser struct{}
+
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	if !isMathFence(line) {
+		return nil, parser.NoChildren
+	}
+
+	advanceLine(reader, line, segment)
+	return &MathBlock{}, parser.NoChildren
+}
+
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if line == nil {
+		return parser.Close
+	}
+
+	if isMathFence(line) {
+		advanceLine(reader, line, segment)
+		return parser.Close
+	}
+
+	node.Lines().Append(segment)
+	advanceLine(reader, line, segment)
+	return parser.Continue | parser.NoChildren
+}
+
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// advanceLine moves the reader to the end of the line, before its newline
+func advanceLine(reader text.Reader, line []byte, segment text.Segment) {
+	length := segment.Len()
+	if line[len(line)-1] == '\n' {
+		length--
+	}
+	reader.Advance(length)
+}
+
+// isMathFence reports whether a line holds only $$
+func isMathFence(line []byte) bool {
+	return bytes.Equal(util.TrimRightSpace(util.TrimLeftSpace(line)), []byte("$$"))
+}
+
+// mathRenderer writes math as TeX between \( \) or \[ \] delimiters, in
+// elements classed "math inline" or "math display", for KaTeX's auto-render
+// or MathJax to typeset in the browser
+type mathRenderer struct{}
+
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMath, r.renderMath)
+	reg.Register(KindMathBlock, r.renderMathBlock)
+}
+
+func (r *mathRenderer) renderMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	math := node.(*Math)
+	if math.Display {
+		_, _ = w.WriteString(`<span class="math display">\[`)
+	} else {
+		_, _ = w.WriteString(`<span class="math inline">\(`)
+	}
+	_, _ = w.Write(util.EscapeHTML(math.Value))
+	if math.Display {
+		_, _ = w.WriteString(`\]</span>`)
+	} else {
+		_, _ = w.WriteString(`\)</span>`)
+	}
+
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString(`<div class="math display">\[` + "\n")
+	writeLines(w, source, node)
+	_, _ = w.WriteString(`\]</div>` + "\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+// writeLines writes a block's lines, HTML escaped
+func writeLines(w util.BufWriter, source []byte, node ast.Node) {
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		_, _ = w.Write(util.EscapeHTML(line.Value(source)))
+	}
+}
+
+// mathExtension adds $...$ inline and $$ fenced display math
+type mathExtension struct{}
+
+func (e *mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithInlineParsers(util.Prioritized(&mathParser{}, 150)),
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&mathRenderer{}, 500)))
+}
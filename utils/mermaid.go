@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindMermaid is the kind of Mermaid diagram blocks
+var KindMermaid = ast.NewNodeKind("Mermaid")
+
+// Mermaid is a fenced code block tagged mermaid, holding a diagram's source
+type Mermaid struct {
+	ast.BaseBlock
+}
+
+func (n *Mermaid) Kind() ast.NodeKind {
+	return KindMermaid
+}
+
+func (n *Mermaid) IsRaw() bool {
+	return true
+}
+
+func (n *Mermaid) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mermaidTransformer replaces ```mermaid code blocks with Mermaid nodes,
+// so they are neither highlighted nor shown as code
+type mermaidTransformer struct{}
+
+func (t *mermaidTransformer) Transform(document *ast.Document, reader text.Reader, pc parser.Context) {
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := node.(*ast.FencedCodeBlock); ok && entering {
+			if string(block.Language(reader.Source())) == "mermaid" {
+				blocks = append(blocks, block)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		diagram := &Mermaid{}
+		diagram.SetLines(block.Lines())
+		block.Parent().ReplaceChild(block.Parent(), block, diagram)
+	}
+}
+
+// mermaidRenderer writes diagrams as <pre class="mermaid"> elements for
+// Mermaid to draw in the browser
+type mermaidRenderer struct{}
+
+func (r *mermaidRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMermaid, r.renderMermaid)
+}
+
+func (r *mermaidRenderer) renderMermaid(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+
+	_, _ = w.WriteString(`<pre class="mermaid">`)
+	writeLines(w, source, node)
+	_, _ = w.WriteString("</pre>\n")
+
+	return ast.WalkSkipChildren, nil
+}
+
+// mermaidExtension renders ```mermaid blocks as diagrams
+type mermaidExtension struct{}
+
+func (e *mermaidExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&mermaidTransformer{}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&mermaidRenderer{}, 500)))
+}
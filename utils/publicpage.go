@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bytes"
+	"html/template"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// descriptionLength caps the Open Graph description of a public page, in characters
+const descriptionLength = 200
+
+// PublicPage is a note rendered as a standalone HTML page
+type PublicPage struct {
+	Title       string
+	Description string
+	// Url is the page's absolute address, for og:url
+	Url  string
+	Html template.HTML
+	// Scripts load what the page's math and diagrams need
+	Scripts    template.HTML
+	Updated_at time.Time
+}
+
+var publicPageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- if .Description}}
+<meta name="description" content="{{.Description}}">
+{{- end}}
+<meta property="og:type" content="article">
+<meta property="og:title" content="{{.Title}}">
+{{- if .Description}}
+<meta property="og:description" content="{{.Description}}">
+{{- end}}
+{{- if .Url}}
+<meta property="og:url" content="{{.Url}}">
+<link rel="canonical" href="{{.Url}}">
+{{- end}}
+<meta property="article:modified_time" content="{{.Updated_at.UTC.Format "2006-01-02T15:04:05Z07:00"}}">
+{{.Scripts}}<style>
+body { margin: 0; background: #fff; color: #1f2328; font: 17px/1.65 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; }
+main { max-width: 720px; margin: 0 auto; padding: 48px 24px 96px; }
+h1, h2, h3, h4 { line-height: 1.25; margin: 1.6em 0 0.6em; }
+h1 { font-size: 2em; margin-top: 0; }
+a { color: #0969da; }
+img { max-width: 100%; }
+pre { background: #f6f8fa; padding: 16px; overflow-x: auto; border-radius: 6px; }
+code { font: 0.9em ui-monospace, SFMono-Regular, Menlo, monospace; }
+blockquote { margin: 0; padding: 0 1em; color: #59636e; border-left: 0.25em solid #d1d9e0; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d1d9e0; padding: 6px 13px; }
+hr { border: 0; border-top: 1px solid #d1d9e0; }
+footer { margin-top: 64px; color: #59636e; font-size: 0.85em; }
+</style>
+</head>
+<body>
+<main>
+<article>
+{{.Html}}
+</article>
+<footer>Last updated {{.Updated_at.UTC.Format "2 January 2006"}}</footer>
+</main>
+</body>
+</html>
+`))
+
+// NewPublicPage renders a note's markdown, without its front matter, for
+// its public page. The page is titled by the note's first heading and
+// described by its first paragraph; fallbackTitle is used when the note has
+// no heading.
+func NewPublicPage(content string, fallbackTitle string) (*PublicPage, error) {
+	source := []byte(StripFrontMatter(content))
+
+	// Public pages are anyone's to read
+	html, err := RenderMarkdown(source, DefaultRenderOptions(), StrictSanitizePolicy())
+	if err != nil {
+		return nil, err
+	}
+
+	page := &PublicPage{Title: fallbackTitle, Html: template.HTML(html), Scripts: template.HTML(ClientScripts(html))}
+
+	document := ParseMarkdown(source, DefaultRenderOptions())
+	headingFound := false
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node.Kind() {
+		case ast.KindHeading:
+			if !headingFound {
+				if title := nodeText(node, source); title != "" {
+					page.Title = title
+					headingFound = true
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		case ast.KindParagraph:
+			if page.Description == "" {
+				page.Description = truncate(nodeText(node, source), descriptionLength)
+			}
+			return ast.WalkSkipChildren, nil
+		}
+
+		if headingFound && page.Description != "" {
+			return ast.WalkStop, nil
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return page, nil
+}
+
+// Render writes the page as a complete HTML document
+func (p *PublicPage) Render() ([]byte, error) {
+	var buffer bytes.Buffer
+	if err := publicPageTemplate.Execute(&buffer, p); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// nodeText returns the plain text of an inline markdown node tree, with
+// line breaks and runs of whitespace collapsed into single spaces
+func nodeText(node ast.Node, source []byte) string {
+	var b strings.Builder
+
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// truncate shortens text to at most limit characters, ending on a word
+// boundary with an ellipsis
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	cut := string(runes[:limit-1])
+	if space := strings.LastIndexByte(cut, ' '); space > 0 {
+		cut = cut[:space]
+	}
+
+	return strings.TrimRight(cut, " ,;:.") + "…"
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewPublicPage(t *testing.T) {
+	content := "---\ntags: [blog]\n---\nIntro with *emphasis*\nacross lines.\n\n# The `Real` Title\n\nMore text."
+
+	page, err := NewPublicPage(content, "post.md")
+	if err != nil {
+		t.Fatalf("Error rendering page: %v", err)
+	}
+	if page.Title != "The Real Title" {
+		t.Errorf("Expected the first heading as title, got %q", page.Title)
+	}
+	if page.Description != "Intro with emphasis across lines." {
+		t.Errorf("Expected the first paragraph as description, got %q", page.Description)
+	}
+
+	page, err = NewPublicPage("no heading <here>", "post.md")
+	if err != nil {
+		t.Fatalf("Error rendering page: %v", err)
+	}
+	if page.Title != "post.md" {
+		t.Errorf("Expected the fallback title, got %q", page.Title)
+	}
+
+	html, err := page.Render()
+	if err != nil {
+		t.Fatalf("Error rendering page: %v", err)
+	}
+	if !bytes.Contains(html, []byte(`<meta property="og:title" content="post.md">`)) {
+		t.Errorf("Expected an og:title tag in:\n%s", html)
+	}
+	if bytes.Contains(html, []byte("misspelled")) || bytes.Contains(html, []byte("tags: [blog]")) {
+		t.Errorf("Expected no spellcheck markup or front matter in:\n%s", html)
+	}
+}
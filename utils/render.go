@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go-markdown-parser/models"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Extension names accepted by ParseRenderExtensions
+const (
+	ExtensionGfm             = "gfm"
+	ExtensionFootnotes       = "footnotes"
+	ExtensionDefinitionLists = "definition_lists"
+	ExtensionHeadingIds      = "heading_ids"
+	ExtensionHighlighting    = "highlighting"
+	ExtensionMath            = "math"
+	ExtensionMermaid         = "mermaid"
+)
+
+// fallbackHighlightTheme colours code when HIGHLIGHT_THEME is unset
+const fallbackHighlightTheme = "github"
+
+// renderers caches a goldmark.Markdown per RenderOptions; they are safe for
+// concurrent use and costly to build
+var renderers sync.Map
+
+// defaultRenderOptions is read once from MARKDOWN_EXTENSIONS,
+// HIGHLIGHT_THEME, HIGHLIGHT_CLASSES and HARD_WRAPS
+var defaultRenderOptions = sync.OnceValue(func() models.RenderOptions {
+	options := AllRenderOptions()
+
+	if list, ok := os.LookupEnv("MARKDOWN_EXTENSIONS"); ok {
+		parsed, err := ParseRenderExtensions(list)
+		if err != nil {
+			log.Printf("Error parsing MARKDOWN_EXTENSIONS: %v. Using all extensions", err)
+		} else {
+			options = parsed
+		}
+	}
+
+	options.Highlight_theme = fallbackHighlightTheme
+	if theme := os.Getenv("HIGHLIGHT_THEME"); theme != "" {
+		if ValidHighlightTheme(theme) {
+			options.Highlight_theme = theme
+		} else {
+			log.Printf("Unknown HIGHLIGHT_THEME %q. Using %s", theme, fallbackHighlightTheme)
+		}
+	}
+	options.Highlight_classes = os.Getenv("HIGHLIGHT_CLASSES") == "true"
+	options.Hard_wraps = os.Getenv("HARD_WRAPS") == "true"
+
+	return options
+})
+
+// DefaultRenderOptions returns the server's rendering options. The
+// extensions are set as a comma separated list in MARKDOWN_EXTENSIONS, and
+// all enabled when it is unset. Code is coloured with the HIGHLIGHT_THEME
+// chroma style, using inline styles unless HIGHLIGHT_CLASSES is true.
+// Newlines in paragraphs are soft breaks unless HARD_WRAPS is true.
+func DefaultRenderOptions() models.RenderOptions {
+	return defaultRenderOptions()
+}
+
+// AllRenderOptions enables every extension
+func AllRenderOptions() models.RenderOptions {
+	return models.RenderOptions{Gfm: true, Footnotes: true, Definition_lists: true, Heading_ids: true, Highlighting: true, Math: true, Mermaid: true}
+}
+
+// HighlightThemes lists the names of the available code highlighting themes
+func HighlightThemes() []string {
+	return styles.Names()
+}
+
+// ValidHighlightTheme reports whether a code highlighting theme exists
+func ValidHighlightTheme(name string) bool {
+	_, ok := styles.Registry[name]
+	return ok
+}
+
+// highlightTheme returns the theme options colour code with
+func highlightTheme(options models.RenderOptions) string {
+	if options.Highlight_theme != "" {
+		return options.Highlight_theme
+	}
+
+	return DefaultRenderOptions().Highlight_theme
+}
+
+// HighlightStylesheet returns a <style> element for the CSS classes code
+// highlighted with options uses, or "" when highlighting uses inline
+// styles or is off
+func HighlightStylesheet(options models.RenderOptions) (string, error) {
+	if !options.Highlighting || !options.Highlight_classes {
+		return "", nil
+	}
+
+	css, err := ThemeCSS(highlightTheme(options))
+	if err != nil {
+		return "", err
+	}
+
+	return "<style>\n" + css + "</style>\n", nil
+}
+
+// ThemeCSS returns the stylesheet of a code highlighting theme, for code
+// highlighted with CSS classes
+func ThemeCSS(theme string) (string, error) {
+	if !ValidHighlightTheme(theme) {
+		return "", fmt.Errorf("unknown highlight theme %q", theme)
+	}
+
+	var buffer bytes.Buffer
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buffer, styles.Get(theme)); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// nonProseRegex matches the math and diagram elements written by the
+// renderer. Their contents are escaped, so they hold no tags.
+var nonProseRegex = regexp.MustCompile(`<(?:span|div) class="math (?:inline|display)">[^<]*</(?:span|div)>|<pre class="mermaid">[^<]*</pre>`)
+
+// stripNonProse removes math and diagrams from rendered HTML, leaving the
+// text worth spell checking
+func stripNonProse(html string) string {
+	return nonProseRegex.ReplaceAllLiteralString(html, " ")
+}
+
+const katexScripts = `<link rel="stylesheet" href="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/katex.min.css">
+<script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/katex.min.js"></script>
+<script defer src="https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/contrib/auto-render.min.js" onload="renderMathInElement(document.body)"></script>
+`
+
+const mermaidScript = `<script type="module">
+import mermaid from "https://cdn.jsdelivr.net/npm/mermaid@11/dist/mermaid.esm.min.mjs";
+mermaid.initialize({ startOnLoad: true });
+</script>
+`
+
+// ClientScripts returns the <head> elements that load KaTeX and Mermaid,
+// for the ones rendered HTML needs
+func ClientScripts(html string) string {
+	scripts := ""
+	if strings.Contains(html, `<span class="math `) || strings.Contains(html, `<div class="math `) {
+		scripts += katexScripts
+	}
+	if strings.Contains(html, `<pre class="mermaid">`) {
+		scripts += mermaidScript
+	}
+
+	return scripts
+}
+
+// ParseRenderExtensions parses a comma separated list of extension names.
+// An empty list, or "none", disables them all.
+func ParseRenderExtensions(list string) (models.RenderOptions, error) {
+	var options models.RenderOptions
+
+	for _, name := range strings.Split(list, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "", "none":
+		case "all":
+			options = AllRenderOptions()
+		case ExtensionGfm:
+			options.Gfm = true
+		case ExtensionFootnotes:
+			options.Footnotes = true
+		case ExtensionDefinitionLists:
+			options.Definition_lists = true
+		case ExtensionHeadingIds:
+			options.Heading_ids = true
+		case ExtensionHighlighting:
+			options.Highlighting = true
+		case ExtensionMath:
+			options.Math = true
+		case ExtensionMermaid:
+			options.Mermaid = true
+		default:
+			return options, fmt.Errorf("unknown markdown extension %q", strings.TrimSpace(name))
+		}
+	}
+
+	return options, nil
+}
+
+// ParseMarkdown parses markdown with the extensions the options enable, for
+// walking its syntax tree
+func ParseMarkdown(source []byte, options models.RenderOptions) ast.Node {
+	return markdownFor(options).Parser().Parse(text.NewReader(source))
+}
+
+// markdownFor returns the goldmark converter for the given options. Raw
+// HTML in the markdown is kept, so convertToHTML must sanitize the output.
+func markdownFor(options models.RenderOptions) goldmark.Markdown {
+	if markdown, ok := renderers.Load(options); ok {
+		return markdown.(goldmark.Markdown)
+	}
+
+	var extensions []goldmark.Extender
+	if options.Gfm {
+		// GFM, with table alignment as attributes rather than the inline
+		// styles strict sanitize policies remove
+		extensions = append(extensions,
+			extension.Linkify,
+			extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+			extension.Strikethrough,
+			extension.TaskList,
+		)
+	}
+	if options.Footnotes {
+		extensions = append(extensions, extension.Footnote)
+	}
+	if options.Definition_lists {
+		extensions = append(extensions, extension.DefinitionList)
+	}
+	if options.Math {
+		extensions = append(extensions, &mathExtension{})
+	}
+	if options.Mermaid {
+		extensions = append(extensions, &mermaidExtension{})
+	}
+	if options.Highlighting {
+		extensions = append(extensions, highlighting.NewHighlighting(
+			highlighting.WithStyle(highlightTheme(options)),
+			// Only blocks tagged with a language are coloured
+			highlighting.WithGuessLanguage(false),
+			highlighting.WithFormatOptions(chromahtml.WithClasses(options.Highlight_classes)),
+		))
+	}
+
+	var parserOptions []parser.Option
+	if options.Heading_ids {
+		parserOptions = append(parserOptions, parser.WithAutoHeadingID())
+	}
+
+	rendererOptions := []renderer.Option{html.WithUnsafe()}
+	if options.Hard_wraps {
+		rendererOptions = append(rendererOptions, html.WithHardWraps())
+	}
+
+	markdown := goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(rendererOptions...),
+	)
+
+	actual, _ := renderers.LoadOrStore(options, markdown)
+	return actual.(goldmark.Markdown)
+}
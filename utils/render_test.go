@@ -0,0 +1,179 @@
+package utils
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-markdown-parser/models"
+)
+
+func TestRenderMarkdownExtensions(t *testing.T) {
+	source := []byte("# Getting Started\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n- [x] done ~~gone~~\n\nSee https://example.com[^1]\n\nTerm\n: Definition\n\n[^1]: A note.\n")
+
+	html, err := RenderMarkdown(source, AllRenderOptions(), DefaultSanitizePolicy())
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	for _, want := range []string{
+		`<h1 id="getting-started">`,
+		"<table>",
+		`<input checked="" disabled="" type="checkbox"/>`,
+		"<del>gone</del>",
+		`<a href="https://example.com">`,
+		`class="footnote-ref"`,
+		"<dl>\n<dt>Term</dt>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected %q in:\n%s", want, html)
+		}
+	}
+
+	html, err = RenderMarkdown(source, models.RenderOptions{}, DefaultSanitizePolicy())
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	for _, unwanted := range []string{"<table>", "<dl>", "footnote", `id="getting-started"`} {
+		if strings.Contains(html, unwanted) {
+			t.Errorf("Expected no %q without extensions in:\n%s", unwanted, html)
+		}
+	}
+}
+
+func TestParseRenderExtensions(t *testing.T) {
+	options, err := ParseRenderExtensions(" gfm, Heading_IDs ")
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+	if options != (models.RenderOptions{Gfm: true, Heading_ids: true}) {
+		t.Errorf("Unexpected options %+v", options)
+	}
+
+	if options, _ := ParseRenderExtensions("none"); options != (models.RenderOptions{}) {
+		t.Errorf("Expected no extensions, got %+v", options)
+	}
+	if _, err := ParseRenderExtensions("gfm,emoji"); err == nil {
+		t.Error("Expected an error for an unknown extension")
+	}
+}
+
+func TestRenderMarkdownHighlighting(t *testing.T) {
+	source := []byte("```go\nfunc main() {}\n```\n\n```\nplain\n```\n")
+
+	html, err := RenderMarkdown(source, AllRenderOptions(), DefaultSanitizePolicy())
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	if !strings.Contains(html, `<span style="color:#000;font-weight:bold">func</span>`) {
+		t.Errorf("Expected inline styled keywords in:\n%s", html)
+	}
+	if !strings.Contains(html, "<pre><code>plain\n</code></pre>") {
+		t.Errorf("Expected the untagged block to stay plain in:\n%s", html)
+	}
+
+	options := AllRenderOptions()
+	options.Highlight_theme = "monokai"
+	options.Highlight_classes = true
+	html, err = RenderMarkdown(source, options, DefaultSanitizePolicy())
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	if !strings.HasPrefix(html, "<style>\n") || !strings.Contains(html, "background-color: #272822") {
+		t.Errorf("Expected the monokai stylesheet first in:\n%s", html)
+	}
+	if !strings.Contains(html, `<span class="kd">func</span>`) {
+		t.Errorf("Expected classed keywords in:\n%s", html)
+	}
+
+	if _, err := ThemeCSS("no-such-theme"); err == nil {
+		t.Error("Expected an error for an unknown theme")
+	}
+}
+
+func TestRenderMarkdownMathAndDiagrams(t *testing.T) {
+	source := []byte("Euler: $e^{i\\pi} + 1 = 0$ costs $5 or $10, and $$\\sum_n x$$ too.\n\n$$\n\\frac{a}{b} < c\n$$\n\n```mermaid\ngraph TD\n  A --> B\n```\n")
+
+	html, err := RenderMarkdown(source, AllRenderOptions(), DefaultSanitizePolicy())
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	for _, want := range []string{
+		`<span class="math inline">\(e^{i\pi} + 1 = 0\)</span>`,
+		"costs $5 or $10",
+		`<span class="math display">\[\sum_n x\]</span>`,
+		"<div class=\"math display\">\\[\n\\frac{a}{b} &lt; c\n\\]</div>",
+		"<pre class=\"mermaid\">graph TD\n  A --&gt; B\n</pre>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected %q in:\n%s", want, html)
+		}
+	}
+	if scripts := ClientScripts(html); !strings.Contains(scripts, "katex") || !strings.Contains(scripts, "mermaid") {
+		t.Errorf("Expected KaTeX and Mermaid scripts, got:\n%s", scripts)
+	}
+
+	html, err = RenderMarkdown(source, models.RenderOptions{}, DefaultSanitizePolicy())
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	if strings.Contains(html, "math") || strings.Contains(html, `class="mermaid"`) || ClientScripts(html) != "" {
+		t.Errorf("Expected no math or diagrams without the extensions in:\n%s", html)
+	}
+}
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestLineBreaksGolden renders the markdown in testdata/linebreaks through
+// the whole pipeline, with soft and hard wraps, and compares it to the
+// .soft.html and .hard.html golden files
+func TestLineBreaksGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "linebreaks", "*.md"))
+	if err != nil || len(sources) == 0 {
+		t.Fatalf("Error finding test data: %v", err)
+	}
+
+	for _, source := range sources {
+		markdown, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatalf("Error reading %s: %v", source, err)
+		}
+
+		for _, hardWraps := range []bool{false, true} {
+			options := AllRenderOptions()
+			options.Highlight_theme = "github"
+			options.Hard_wraps = hardWraps
+
+			golden := strings.TrimSuffix(source, ".md") + ".soft.html"
+			if hardWraps {
+				golden = strings.TrimSuffix(source, ".md") + ".hard.html"
+			}
+
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				html, err := RenderMarkdown(markdown, options, DefaultSanitizePolicy())
+				if err != nil {
+					t.Fatalf("Error rendering: %v", err)
+				}
+				html, err = ProcessHTML(html, nil)
+				if err != nil {
+					t.Fatalf("Error processing: %v", err)
+				}
+
+				if *update {
+					if err := os.WriteFile(golden, []byte(html), 0644); err != nil {
+						t.Fatalf("Error writing %s: %v", golden, err)
+					}
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("Error reading %s: %v", golden, err)
+				}
+				if html != string(want) {
+					t.Errorf("Rendered HTML differs from %s:\n%s", golden, html)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/html"
+)
+
+// SanitizePolicy is an allowlist of the HTML rendered notes may contain.
+// Elements outside it are unwrapped, keeping their text, except for those
+// whose content is never text to show, like scripts, which are dropped.
+type SanitizePolicy struct {
+	// Elements maps each allowed element to the attributes allowed on it
+	// besides the global ones
+	Elements map[string][]string `json:"elements"`
+	// Attributes are allowed on every allowed element
+	Attributes []string `json:"attributes"`
+	// Url_schemes are allowed in href and src attributes. Relative URLs and
+	// fragments are always allowed.
+	Url_schemes []string `json:"url_schemes"`
+	// Link_rel, if set, is the rel of every link
+	Link_rel string `json:"link_rel,omitempty"`
+}
+
+// droppedElements are removed with their content when not allowed
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true,
+	"noscript": true, "template": true, "textarea": true, "select": true,
+	"title": true, "head": true, "frameset": true, "noembed": true,
+	"noframes": true, "xmp": true, "plaintext": true, "svg": true, "math": true,
+}
+
+// urlAttributes hold URLs, checked against the policy's schemes
+var urlAttributes = map[string]bool{
+	"href": true, "src": true, "cite": true, "action": true, "formaction": true,
+	"poster": true, "xlink:href": true,
+}
+
+// noteElements are what rendered markdown is made of
+func noteElements() map[string][]string {
+	return map[string][]string{
+		"a": {"href"}, "abbr": nil, "b": nil, "blockquote": {"cite"}, "br": nil,
+		"code": nil, "dd": nil, "del": nil, "details": {"open"}, "div": nil,
+		"dl": nil, "dt": nil, "em": nil, "figcaption": nil, "figure": nil,
+		"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+		"hr": nil, "i": nil, "img": {"src", "alt", "width", "height"},
+		"input": {"type", "checked", "disabled"}, "ins": nil, "kbd": nil, "li": {"value"}, "mark": nil, "ol": {"start"},
+		"p": nil, "pre": nil, "q": {"cite"}, "s": nil, "samp": nil,
+		"section": nil, "small": nil, "span": nil, "strong": nil, "sub": nil,
+		"summary": nil, "sup": nil, "table": nil, "tbody": nil,
+		"td": {"align", "colspan", "rowspan"}, "tfoot": nil,
+		"th": {"align", "colspan", "rowspan"}, "thead": nil, "tr": nil,
+		"u": nil, "ul": nil, "var": nil,
+	}
+}
+
+// defaultSanitizePolicy is read once from SANITIZE_POLICY
+var defaultSanitizePolicy = sync.OnceValue(func() *SanitizePolicy {
+	path := os.Getenv("SANITIZE_POLICY")
+	if path == "" {
+		return builtinSanitizePolicy()
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var policy SanitizePolicy
+		if err = json.Unmarshal(data, &policy); err == nil {
+			return &policy
+		}
+	}
+
+	log.Printf("Error loading SANITIZE_POLICY %s: %v. Using the built-in policy", path, err)
+	return builtinSanitizePolicy()
+})
+
+// DefaultSanitizePolicy returns the policy for a user's own notes: the
+// JSON file named by SANITIZE_POLICY, or else everything markdown renders
+// to, inline styles included
+func DefaultSanitizePolicy() *SanitizePolicy {
+	return defaultSanitizePolicy()
+}
+
+func builtinSanitizePolicy() *SanitizePolicy {
+	return &SanitizePolicy{
+		Elements:    noteElements(),
+		Attributes:  []string{"id", "class", "title", "lang", "dir", "role", "style"},
+		Url_schemes: []string{"http", "https", "mailto"},
+	}
+}
+
+// strictSanitizePolicy is built once
+var strictSanitizePolicy = sync.OnceValue(func() *SanitizePolicy {
+	return &SanitizePolicy{
+		Elements:    noteElements(),
+		Attributes:  []string{"id", "class", "title", "lang", "dir", "role"},
+		Url_schemes: []string{"https", "mailto"},
+		Link_rel:    "nofollow noopener noreferrer",
+	}
+})
+
+// StrictSanitizePolicy returns the policy for notes shown to others, like
+// shared and public notes: no inline styles, only https links and images,
+// and links marked nofollow
+func StrictSanitizePolicy() *SanitizePolicy {
+	return strictSanitizePolicy()
+}
+
+// AllowsStyles reports whether the policy keeps inline styles
+func (p *SanitizePolicy) AllowsStyles() bool {
+	return slices.Contains(p.Attributes, "style")
+}
+
+// Sanitize removes from an HTML fragment everything the policy doesn't allow
+func Sanitize(fragment string, policy *SanitizePolicy) (string, error) {
+	body, err := parseFragment(fragment)
+	if err != nil {
+		return "", err
+	}
+
+	policy.sanitizeChildren(body)
+
+	return renderChildren(body)
+}
+
+// sanitizeChildren sanitizes the children of a node, in place
+func (p *SanitizePolicy) sanitizeChildren(parent *html.Node) {
+	for node := parent.FirstChild; node != nil; {
+		next := node.NextSibling
+
+		switch node.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			allowed, ok := p.Elements[node.Data]
+			switch {
+			case ok && p.allowedElement(node):
+				p.sanitizeAttributes(node, allowed)
+				p.sanitizeChildren(node)
+			case droppedElements[node.Data]:
+				parent.RemoveChild(node)
+			default:
+				// Keep the text of unknown elements
+				p.sanitizeChildren(node)
+				for child := node.FirstChild; child != nil; {
+					nextChild := child.NextSibling
+					node.RemoveChild(child)
+					parent.InsertBefore(child, node)
+					child = nextChild
+				}
+				parent.RemoveChild(node)
+			}
+		default:
+			// Comments, doctypes and the like
+			parent.RemoveChild(node)
+		}
+
+		node = next
+	}
+}
+
+// allowedElement applies the rules for elements that are only allowed in
+// one form: inputs must be checkboxes, for task lists
+func (p *SanitizePolicy) allowedElement(node *html.Node) bool {
+	if node.Data == "input" {
+		for _, attr := range node.Attr {
+			if attr.Key == "type" && strings.EqualFold(attr.Val, "checkbox") {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// sanitizeAttributes keeps the allowed attributes of an allowed element
+func (p *SanitizePolicy) sanitizeAttributes(node *html.Node, allowed []string) {
+	attrs := node.Attr[:0]
+	for _, attr := range node.Attr {
+		if attr.Namespace != "" {
+			continue
+		}
+		key := strings.ToLower(attr.Key)
+		if !slices.Contains(allowed, key) && !slices.Contains(p.Attributes, key) {
+			continue
+		}
+		if urlAttributes[key] && !p.allowedURL(attr.Val) {
+			continue
+		}
+		if key == "style" && !safeStyle(attr.Val) {
+			continue
+		}
+		attrs = append(attrs, html.Attribute{Key: key, Val: attr.Val})
+	}
+	node.Attr = attrs
+
+	switch node.Data {
+	case "a":
+		if p.Link_rel != "" {
+			node.Attr = append(node.Attr, html.Attribute{Key: "rel", Val: p.Link_rel})
+		}
+	case "input":
+		// Checkboxes are for show only
+		if !slices.ContainsFunc(node.Attr, func(attr html.Attribute) bool { return attr.Key == "disabled" }) {
+			node.Attr = append(node.Attr, html.Attribute{Key: "disabled", Val: ""})
+		}
+	}
+}
+
+// allowedURL reports whether a URL is relative or uses an allowed scheme.
+// Browsers ignore whitespace and control characters in schemes, so they
+// are ignored here too.
+func (p *SanitizePolicy) allowedURL(value string) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+
+	parsed, err := url.Parse(cleaned)
+	if err != nil {
+		return false
+	}
+	if parsed.Scheme == "" {
+		// "//host/path" is absolute, with the page's scheme
+		return parsed.Host == "" || slices.Contains(p.Url_schemes, "https")
+	}
+
+	return slices.Contains(p.Url_schemes, strings.ToLower(parsed.Scheme))
+}
+
+// safeStyle rejects inline styles that load resources or run code
+func safeStyle(style string) bool {
+	lower := strings.ToLower(style)
+	return !strings.Contains(lower, "url(") && !strings.Contains(lower, "expression(") &&
+		!strings.Contains(lower, "javascript:") && !strings.Contains(lower, "@import")
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	source := []byte("<script>alert(1)</script>\n\n" +
+		"<p onclick=\"steal()\" style=\"color: red\">Hi <blink>there</blink></p>\n\n" +
+		"[bad](javascript:alert(1)) <a href=\"java&#9;script:alert(1)\">tabbed</a> [plain](http://example.com) [page](/notes#top)\n\n" +
+		"<details><summary>More</summary>Kept</details>\n\n" +
+		"```go\nfunc main() {}\n```\n")
+
+	html, err := RenderMarkdown(source, AllRenderOptions(), DefaultSanitizePolicy())
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	for _, want := range []string{
+		`<p style="color: red">Hi there</p>`,
+		`<a href="http://example.com">`,
+		`<a href="/notes#top">`,
+		"<details><summary>More</summary>Kept</details>",
+		`<pre style="`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected %q in:\n%s", want, html)
+		}
+	}
+	for _, unwanted := range []string{"<script", "alert", "onclick", "<blink>"} {
+		if strings.Contains(html, unwanted) {
+			t.Errorf("Expected no %q in:\n%s", unwanted, html)
+		}
+	}
+
+	html, err = RenderMarkdown(source, AllRenderOptions(), StrictSanitizePolicy())
+	if err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	for _, want := range []string{
+		"<p>Hi there</p>",
+		`<a rel="nofollow noopener noreferrer">plain</a>`,
+		`<a href="/notes#top" rel="nofollow noopener noreferrer">`,
+		// Code is coloured with classes instead of inline styles
+		`<pre class="chroma">`,
+		"<style>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("Expected %q under the strict policy in:\n%s", want, html)
+		}
+	}
+	if strings.Contains(html, `style="`) {
+		t.Errorf("Expected no inline styles under the strict policy in:\n%s", html)
+	}
+}
+
+func TestWrapMisspelledWordsEscapes(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader("<p>teh <b>teh</b> end</p>"))
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+
+	if findings := WrapMisspelledWordsInNode(doc, map[string][]string{"teh": {"the", `<img src=x onerror="alert(1)">`}}); findings != 2 {
+		t.Errorf("Expected 2 findings, got %d", findings)
+	}
+
+	var buffer strings.Builder
+	if err := html.Render(&buffer, doc); err != nil {
+		t.Fatalf("Error rendering: %v", err)
+	}
+	rendered := buffer.String()
+
+	if !strings.Contains(rendered, `data-finding-id="f1"`) || !strings.Contains(rendered, `data-finding-id="f2"`) {
+		t.Errorf("Expected both words wrapped in:\n%s", rendered)
+	}
+	if !strings.Contains(rendered, `data-suggestions="[&#34;the&#34;,&#34;\u003cimg src=x`) || strings.Contains(rendered, "<img") {
+		t.Errorf("Expected suggestions escaped in:\n%s", rendered)
+	}
+	if !strings.HasSuffix(strings.TrimSuffix(rendered, "</body></html>"), " end</p>") {
+		t.Errorf("Expected the text after the words kept in:\n%s", rendered)
+	}
+}
+
+func TestWrapMisspelledWordsFindsUnicodeWords(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader("<p>un caf\u00e9 tr\u00e8s chaud</p>"))
+	if err != nil {
+		t.Fatalf("Error parsing: %v", err)
+	}
+
+	if findings := WrapMisspelledWordsInNode(doc, map[string][]string{"tr\u00e8s": nil}); findings != 1 {
+		t.Errorf("Expected 1 finding, got %d", findings)
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TextEdit replaces the characters in [Start, End) with Text. Offsets count
+// Unicode characters (runes) in the original text, not bytes.
+type TextEdit struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Text  string `json:"text"`
+}
+
+// ApplyTextEdits applies non-overlapping edits to text. Every edit's offsets
+// refer to the original text, so the order of edits does not matter.
+func ApplyTextEdits(text string, edits []TextEdit) (string, error) {
+	runes := []rune(text)
+
+	sorted := make([]TextEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Start < sorted[j].Start
+	})
+
+	result := make([]rune, 0, len(runes))
+	position := 0
+	for _, edit := range sorted {
+		if edit.Start < 0 || edit.End < edit.Start || edit.End > len(runes) {
+			return "", fmt.Errorf("edit range [%d, %d) is outside the text (length %d)", edit.Start, edit.End, len(runes))
+		}
+		if edit.Start < position {
+			return "", fmt.Errorf("edit range [%d, %d) overlaps a previous edit", edit.Start, edit.End)
+		}
+
+		result = append(result, runes[position:edit.Start]...)
+		result = append(result, []rune(edit.Text)...)
+		position = edit.End
+	}
+	result = append(result, runes[position:]...)
+
+	return string(result), nil
+}
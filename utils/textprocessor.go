@@ -3,13 +3,16 @@ package utils
 import (
 	"bytes"
 	"fmt"
+	"go-markdown-parser/models"
 	"log"
+	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/sajari/fuzzy"
-	"github.com/yuin/goldmark"
+	"golang.org/x/net/html"
 )
 
 // findMisspelledWords finds misspelled words in a text using fuzzy matching
@@ -33,7 +36,7 @@ func findMisspelledWords(tokens []string, dictionary map[string]bool, model *fuz
 		wordLower := strings.ToLower(wordToCheck)
 
 		// Only check words that don't exist in the dictionary
-		_, ok := dictionary[wordLower]
+		_, ok := dictionary[DictionaryWord(wordToCheck)]
 		if !ok {
 			// Get suggestions
 			suggestions := model.Suggestions(wordToCheck, false)
@@ -57,32 +60,68 @@ func findMisspelledWords(tokens []string, dictionary map[string]bool, model *fuz
 	return misspelledWords, nil
 }
 
-// convertToHTML converts markdown to HTML
+// convertToHTML converts markdown to HTML and sanitizes it
 //
 // Parameters:
 //   - contents: The markdown content as a byte slice
+//   - options: The goldmark extensions to enable
+//   - policy: The HTML the output may contain
 //
 // Returns:
 //   - string: The converted HTML content
-func convertToHTML(contents []byte) (string, error) {
+func convertToHTML(contents []byte, options models.RenderOptions, policy *SanitizePolicy) (string, error) {
 
 	var buffer bytes.Buffer
-	err := goldmark.Convert(contents, &buffer)
+	err := markdownFor(options).Convert(contents, &buffer)
 
 	if err != nil {
 		log.Printf("Markdown conversion failed: %v", err.Error())
 		return "", err
 	}
-	return buffer.String(), nil
+
+	sanitized, err := Sanitize(buffer.String(), policy)
+	if err != nil {
+		log.Printf("HTML sanitization failed: %v", err.Error())
+		return "", err
+	}
+	return sanitized, nil
 }
 
-// ProcessMarkdownWithSpellCheck converts markdown content to HTML and highlights misspelled words.
-// It returns the processed HTML content with spell-check markup and any error encountered.
-//
-// The function:
-// 1. Converts markdown to HTML
-// 2. Identifies misspelled words using fuzzy matching
-// 3. Adds visual indicators for misspelled words with suggested corrections
+// RenderMarkdown converts markdown to HTML without spell check markup, for
+// read-only views of a note. The stylesheet of highlighted code comes first
+// when it uses CSS classes, which it always does under policies without
+// inline styles.
+func RenderMarkdown(contents []byte, options models.RenderOptions, policy *SanitizePolicy) (string, error) {
+	if !policy.AllowsStyles() {
+		options.Highlight_classes = true
+	}
+
+	html, err := convertToHTML(contents, options, policy)
+	if err != nil {
+		return "", err
+	}
+
+	stylesheet, err := HighlightStylesheet(options)
+	if err != nil {
+		return "", err
+	}
+
+	return stylesheet + html, nil
+}
+
+// SpellCheckResult holds the outcome of spell checking a markdown document
+type SpellCheckResult struct {
+	// HTML is the document converted to HTML, without spell-check markup
+	HTML string
+	// Tokens are the words found in the document's text
+	Tokens []string
+	// Misspelled maps each misspelled word to its suggested corrections
+	Misspelled map[string][]string
+}
+
+// CheckMarkdownSpelling converts markdown content to HTML and finds the misspelled words in its text.
+// The server's default render options and sanitize policy are used, so the
+// words checked don't depend on who asks.
 //
 // Parameters:
 //   - contents: The markdown content as a byte slice
@@ -90,9 +129,9 @@ func convertToHTML(contents []byte) (string, error) {
 //   - fuzzyModel: A fuzzy matching model
 //
 // Returns:
-//   - string: The processed HTML with spell-check markup
+//   - *SpellCheckResult: The converted HTML, its words and the misspelled words
 //   - error: Any error encountered during processing
-func ProcessMarkdownWithSpellCheck(contents []byte, dictionaryMap map[string]bool, fuzzyModel *fuzzy.Model) (string, error) {
+func CheckMarkdownSpelling(contents []byte, dictionaryMap map[string]bool, fuzzyModel *fuzzy.Model) (*SpellCheckResult, error) {
 	start := time.Now()
 	// logs duration of function.
 	// defer func registers a function to run when the parent function returns
@@ -102,14 +141,14 @@ func ProcessMarkdownWithSpellCheck(contents []byte, dictionaryMap map[string]boo
 	}()
 
 	// Get html contents
-	htmlContents, err := convertToHTML(contents)
+	htmlContents, err := convertToHTML(contents, DefaultRenderOptions(), DefaultSanitizePolicy())
 
 	if err != nil {
-		return "", fmt.Errorf("markdown conversion failed: %w", err)
+		return nil, fmt.Errorf("markdown conversion failed: %w", err)
 	}
 
-	// Strip HTML tags and convert to plain text
-	plainText := StripHTML(htmlContents)
+	// Strip HTML tags and convert to plain text, leaving out math and diagrams
+	plainText := html.UnescapeString(StripHTML(stripNonProse(htmlContents)))
 
 	// // Tokenize text
 	tokenizer := NewTokenizer()
@@ -121,12 +160,118 @@ func ProcessMarkdownWithSpellCheck(contents []byte, dictionaryMap map[string]boo
 	// Make a map of misspelled words
 	misspelledWords := findMisspelledWordsParallel(tokens, dictionaryMap, fuzzyModel)
 
+	return &SpellCheckResult{
+		HTML:       htmlContents,
+		Tokens:     tokens,
+		Misspelled: misspelledWords,
+	}, nil
+}
+
+// Summary reduces the result to the counts and words stored alongside a revision
+func (r *SpellCheckResult) Summary() models.SpellcheckSummary {
+	words := make([]string, 0, len(r.Misspelled))
+	for word := range r.Misspelled {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+
+	return models.SpellcheckSummary{
+		Word_count:       len(r.Tokens),
+		Misspelled_count: len(words),
+		Misspelled_words: words,
+	}
+}
+
+// Ignore drops misspellings of the given words, compared case-insensitively,
+// as when they are in a custom dictionary
+func (r *SpellCheckResult) Ignore(words []string) {
+	if len(words) == 0 {
+		return
+	}
+
+	ignored := make(map[string]bool, len(words))
+	for _, word := range words {
+		ignored[DictionaryWord(word)] = true
+	}
+
+	for word := range r.Misspelled {
+		if ignored[DictionaryWord(word)] {
+			delete(r.Misspelled, word)
+		}
+	}
+}
+
+// Misspelling is an occurrence of a misspelled word in a markdown document.
+// Start and End count Unicode characters (runes).
+type Misspelling struct {
+	Word        string   `json:"word"`
+	Start       int      `json:"start"`
+	End         int      `json:"end"`
+	Suggestions []string `json:"suggestions"`
+}
+
+// Misspellings locates the result's misspelled words in the markdown that
+// was checked, in document order, so editors can underline them in place.
+func (r *SpellCheckResult) Misspellings(markdown string) []Misspelling {
+	misspellings := []Misspelling{}
+	if len(r.Misspelled) == 0 {
+		return misspellings
+	}
+
+	// Convert byte offsets to rune offsets as the matches are walked in order
+	runeOffset, byteOffset := 0, 0
+	for _, match := range tokenRegex.FindAllStringIndex(markdown, -1) {
+		word := markdown[match[0]:match[1]]
+		suggestions, ok := r.Misspelled[word]
+		if !ok {
+			continue
+		}
+
+		runeOffset += utf8.RuneCountInString(markdown[byteOffset:match[0]])
+		byteOffset = match[0]
+		length := utf8.RuneCountInString(word)
+
+		misspellings = append(misspellings, Misspelling{
+			Word:        word,
+			Start:       runeOffset,
+			End:         runeOffset + length,
+			Suggestions: suggestions,
+		})
+	}
+
+	return misspellings
+}
+
+// ProcessMarkdownWithSpellCheck converts markdown content to HTML and highlights misspelled words.
+// It returns the processed HTML content with spell-check markup and any error encountered.
+//
+// The function:
+// 1. Converts markdown to HTML
+// 2. Identifies misspelled words using fuzzy matching
+// 3. Adds visual indicators for misspelled words with suggested corrections
+//
+// Parameters:
+//   - contents: The markdown content as a byte slice
+//   - dictionary: A map of words to check against
+//   - fuzzyModel: A fuzzy matching model
+//
+// Returns:
+//   - string: The processed HTML with spell-check markup
+//   - error: Any error encountered during processing
+func ProcessMarkdownWithSpellCheck(contents []byte, dictionaryMap map[string]bool, fuzzyModel *fuzzy.Model) (string, error) {
+	result, err := CheckMarkdownSpelling(contents, dictionaryMap, fuzzyModel)
+
 	if err != nil {
-		return "", fmt.Errorf("spell check failed: %w", err)
+		return "", err
 	}
 
+	return ProcessSpellCheckResult(result)
+}
+
+// ProcessSpellCheckResult adds spell-check markup to an already checked document.
+func ProcessSpellCheckResult(result *SpellCheckResult) (string, error) {
 	// Process HTML and wrap misspelled words
-	modifiedHTML, err := ProcessHTML(htmlContents, misspelledWords)
+	modifiedHTML, err := ProcessHTML(result.HTML, result.Misspelled)
 
 	if err != nil {
 		// LOG Error
@@ -135,7 +280,7 @@ func ProcessMarkdownWithSpellCheck(contents []byte, dictionaryMap map[string]boo
 	}
 
 	// LOG Success
-	log.Printf("Spell check completed successfully.  %d misspelled words found.", len(misspelledWords))
+	log.Printf("Spell check completed successfully.  %d misspelled words found.", len(result.Misspelled))
 	return modifiedHTML, nil
 }
 
@@ -178,8 +323,7 @@ func findMisspelledWordsParallel(words []string, dictionary map[string]bool, mod
 			localMisspelled := make(map[string][]string)
 
 			for _, word := range words {
-				wordLower := strings.ToLower(word)
-				if !dictionary[wordLower] {
+				if !dictionary[DictionaryWord(word)] {
 					suggestions := model.Suggestions(word, false)
 					if len(suggestions) > 0 {
 						localMisspelled[word] = suggestions
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/sajari/fuzzy"
@@ -98,3 +99,63 @@ func TestFindMisspelledWordsEquivalence(t *testing.T) {
 		}
 	}
 }
+
+func TestSpellCheckResultIgnore(t *testing.T) {
+	result := &SpellCheckResult{
+		Tokens:     []string{"Kubernetes", "teh", "grpc"},
+		Misspelled: map[string][]string{"Kubernetes": {"Kubernetes"}, "teh": {"the"}, "grpc": {"grep"}},
+	}
+
+	result.Ignore([]string{"kubernetes", "GRPC"})
+
+	summary := result.Summary()
+	if summary.Misspelled_count != 1 || summary.Misspelled_words[0] != "teh" {
+		t.Errorf("Expected only teh to stay misspelled, got %+v", summary)
+	}
+}
+
+func TestSpellCheckResultMisspellings(t *testing.T) {
+	result := &SpellCheckResult{
+		Misspelled: map[string][]string{"teh": {"the"}, "qick": {"quick"}},
+	}
+
+	got := result.Misspellings("# Ça\n\nteh qick fox, teh end")
+	want := []Misspelling{
+		{Word: "teh", Start: 6, End: 9, Suggestions: []string{"the"}},
+		{Word: "qick", Start: 10, End: 14, Suggestions: []string{"quick"}},
+		{Word: "teh", Start: 20, End: 23, Suggestions: []string{"the"}},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d misspellings, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i].Word != want[i].Word || got[i].Start != want[i].Start || got[i].End != want[i].End {
+			t.Errorf("Misspelling %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCheckMarkdownSpellingSkipsMathAndDiagrams(t *testing.T) {
+	dictionary := map[string]bool{"the": true, "sum": true, "is": true}
+	model := fuzzy.NewModel()
+	model.Train([]string{"the", "sum", "is"})
+
+	result, err := CheckMarkdownSpelling([]byte("The sum is $\\frac{sume}{x}$\n\n```mermaid\ngraph sume\n```\n\nThe sume"), dictionary, model)
+	if err != nil {
+		t.Fatalf("Error checking spelling: %v", err)
+	}
+	for _, token := range result.Tokens {
+		if token == "frac" || token == "graph" {
+			t.Errorf("Expected math and diagrams to be skipped, got tokens %v", result.Tokens)
+		}
+	}
+
+	html, err := ProcessSpellCheckResult(result)
+	if err != nil {
+		t.Fatalf("Error processing: %v", err)
+	}
+	if strings.Count(html, "data-finding-id") != 1 {
+		t.Errorf("Expected only the prose sume to be marked in:\n%s", html)
+	}
+}
@@ -1,26 +1,21 @@
 package utils
 
 import (
-	"context"
 	"fmt"
-	"go-markdown-parser/database"
-	"go-markdown-parser/models"
-	"log"
 	"os"
 	"sync"
 	"time"
 
 	jwt "github.com/dgrijalva/jwt-go"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var userCollection *mongo.Collection = database.OpenCollection(database.Client, "user")
-
+// JwtSignedDetails are the claims of access and refresh tokens.
+// Workspace_id is the workspace the user is working in, empty for their
+// personal notes.
 type JwtSignedDetails struct {
-	Uid   string
-	Email string
+	Uid          string
+	Email        string
+	Workspace_id string `json:",omitempty"`
 	jwt.StandardClaims
 }
 
@@ -28,9 +23,11 @@ var SECRET_KEY string = os.Getenv("SECRET_KEY")
 var secretKeyBytes = []byte(SECRET_KEY)
 
 // GenerateAllTokens generates a new token and refresh token for a user
+// working in the given workspace, or in their personal space if it is empty
 func GenerateAllTokens(
 	uid string,
 	email string,
+	workspaceId string,
 ) (
 	signedToken string,
 	signedRefreshToken string,
@@ -50,6 +47,7 @@ func GenerateAllTokens(
 	claims := &JwtSignedDetails{
 		Uid:            uid,
 		Email:          email,
+		Workspace_id:   workspaceId,
 		StandardClaims: standardClaims,
 	}
 
@@ -57,6 +55,7 @@ func GenerateAllTokens(
 	refreshClaims := &JwtSignedDetails{
 		Uid:            uid,
 		Email:          email,
+		Workspace_id:   workspaceId,
 		StandardClaims: refreshStandardClaims,
 	}
 
@@ -97,60 +96,6 @@ func GenerateAllTokens(
 	return token, refreshToken, nil
 }
 
-func UpdateTokens(signedToken string, signedRefreshedToken string, userId string) (*models.User, error) {
-	var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-	defer cancel()
-
-	// Initialize the update document
-	updateTokenDocs := bson.D{
-		{
-			Key:   "token",
-			Value: signedToken,
-		},
-		{
-			Key:   "refreshedToken",
-			Value: signedRefreshedToken,
-		},
-		{
-			Key:   "updated_at",
-			Value: time.Now(),
-		},
-	}
-
-	fmt.Println("Updating tokens for user: ", userId)
-	// Define filter based on the userId
-	filter := bson.M{"user_id": userId}
-	returnDocument := options.After
-
-	// Specify options for upsert and to return the updated document
-	upsert := true
-	opt := options.FindOneAndUpdateOptions{
-		Upsert:         &upsert,
-		ReturnDocument: &returnDocument, // Return the updated document
-	}
-
-	// Perform the update operation and get the updated document back
-	var updatedUser models.User
-	err := userCollection.FindOneAndUpdate(
-		ctx,
-		filter,
-		bson.D{
-			{
-				Key:   "$set",
-				Value: updateTokenDocs,
-			},
-		},
-		&opt,
-	).Decode(&updatedUser) // Decode the result into updatedUser
-
-	if err != nil {
-		log.Printf("Error updating token for user %s: %v", userId, err.Error())
-		return nil, err
-	}
-
-	return &updatedUser, nil
-}
-
 func ValidateToken(signedToken string) (claims *JwtSignedDetails, msg string) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
@@ -5,11 +5,14 @@ import (
 	"strings"
 )
 
+// wordPattern matches a word: Unicode letters, with the combining marks of
+// decomposed accents kept in their word, and basic contractions
+const wordPattern = `\p{L}[\p{L}\p{M}]*(?:'\p{L}[\p{L}\p{M}]*)?`
+
 var (
-	// Supports basic contractions and Unicode letters.
 	// Precompiled regexes for performance
-	tokenRegex = regexp.MustCompile(`(?i)([\p{L}]+(?:'[\p{L}]+)?|[.,!?;])`)
-	alphaRegex = regexp.MustCompile(`^[\p{L}]+(?:'[\p{L}]+)?$`)
+	tokenRegex = regexp.MustCompile(`(?i)(` + wordPattern + `|[.,!?;])`)
+	alphaRegex = regexp.MustCompile(`^` + wordPattern + `$`)
 	punctRegex = regexp.MustCompile(`^[.,!?;]$`)
 )
 
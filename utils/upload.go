@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"go-markdown-parser/convert"
+)
+
+// UploadLimits bound uploads. They are checked against the declared sizes
+// before anything is read and enforced while reading.
+type UploadLimits struct {
+	// Max_file_size is the largest file accepted, in bytes
+	Max_file_size int64
+	// Max_request_size bounds the whole request body, form fields and
+	// multipart framing included
+	Max_request_size int64
+}
+
+// uploadLimits are read once from UPLOAD_MAX_FILE_SIZE and
+// UPLOAD_MAX_REQUEST_SIZE
+var uploadLimits = sync.OnceValue(func() UploadLimits {
+	limits := UploadLimits{Max_file_size: 2 << 20}
+	limits.Max_file_size = sizeFromEnv("UPLOAD_MAX_FILE_SIZE", limits.Max_file_size)
+	limits.Max_request_size = sizeFromEnv("UPLOAD_MAX_REQUEST_SIZE", limits.Max_file_size+1<<20)
+	return limits
+})
+
+// DefaultUploadLimits returns the limits of spell check uploads: files up
+// to UPLOAD_MAX_FILE_SIZE bytes (2 MiB by default) in requests up to
+// UPLOAD_MAX_REQUEST_SIZE bytes (1 MiB more by default)
+func DefaultUploadLimits() UploadLimits {
+	return uploadLimits()
+}
+
+func sizeFromEnv(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		log.Printf("Invalid %s %q, using %d bytes", name, value, fallback)
+		return fallback
+	}
+	return size
+}
+
+// genericTypes are declared content types that say nothing about a file,
+// so its extension decides. Browsers send .md files as any of them.
+var genericTypes = map[string]bool{
+	"":                         true,
+	"text/plain":               true,
+	"application/octet-stream": true,
+}
+
+// UploadFormat returns the format of an uploaded file from its name and
+// declared content type, before it is read: from when the client names
+// one, otherwise detected from the extension or, for files without a known
+// one, the declared type. Files declared as something other than text, like
+// an image named notes.md, are rejected.
+func UploadFormat(name string, contentType string, from string) (string, error) {
+	mediaType := ""
+	if contentType != "" {
+		parsed, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return "", ErrInvalidFile.Wrap(fmt.Errorf("malformed content type %q", contentType))
+		}
+		mediaType = parsed
+	}
+
+	declared := convert.Detect("", mediaType)
+	if declared == "" && !genericTypes[mediaType] && !strings.HasPrefix(mediaType, "text/") {
+		return "", ErrUnsupportedType.Wrap(fmt.Errorf("declared as %s", mediaType))
+	}
+
+	if from != "" {
+		for _, format := range convert.Formats() {
+			if from == format {
+				return from, nil
+			}
+		}
+		return "", ErrInvalidFile.Wrap(fmt.Errorf("unknown format %q", from))
+	}
+
+	if format := convert.Detect(name, ""); format != "" {
+		return format, nil
+	}
+	if declared != "" {
+		return declared, nil
+	}
+
+	return "", ErrUnsupportedType
+}
+
+// ReadUpload reads an uploaded file up to the size limit, whatever its
+// declared size, and decodes it to UTF-8 text. It returns the encoding the
+// file was in.
+func ReadUpload(file io.Reader, limits UploadLimits) ([]byte, string, error) {
+	content, err := io.ReadAll(io.LimitReader(file, limits.Max_file_size+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(content)) > limits.Max_file_size {
+		return nil, "", ErrFileTooLarge.Wrap(fmt.Errorf("over %d bytes", limits.Max_file_size))
+	}
+
+	return DecodeText(content)
+}
+
+// SniffText checks that content is UTF-8 text: no NUL bytes, nothing
+// sniffed as a binary format, like an image or archive, and valid UTF-8
+func SniffText(content []byte) error {
+	if err := sniffBinary(content); err != nil {
+		return err
+	}
+
+	if !utf8.Valid(content) {
+		return ErrInvalidEncoding
+	}
+	return nil
+}
+
+// sniffBinary checks that content holds no NUL bytes and isn't sniffed as
+// a binary format
+func sniffBinary(content []byte) error {
+	if bytes.IndexByte(content, 0) >= 0 {
+		return ErrBinaryFile
+	}
+
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+	if !strings.HasPrefix(sniffed, "text/") && sniffed != "application/octet-stream" {
+		return ErrBinaryFile.Wrap(fmt.Errorf("content looks like %s", sniffed))
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go-markdown-parser/convert"
+)
+
+func TestUploadFormat(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		from        string
+		want        string
+		err         error
+	}{
+		{"notes.md", "text/plain", "", convert.FormatMarkdown, nil},
+		{"notes.md", "application/octet-stream", "", convert.FormatMarkdown, nil},
+		{"notes.md", "", "", convert.FormatMarkdown, nil},
+		{"page.html", "text/html; charset=utf-8", "", convert.FormatHTML, nil},
+		{"upload", "text/markdown", "", convert.FormatMarkdown, nil},
+		{"vault.md", "text/plain", "obsidian", convert.FormatObsidian, nil},
+		{"notes.md", "image/png", "", "", ErrUnsupportedType},
+		{"notes.txt", "text/plain", "", "", ErrUnsupportedType},
+		{"notes.md", "text/", "", "", ErrInvalidFile},
+		{"notes.md", "", "docx", "", ErrInvalidFile},
+	}
+
+	for _, test := range tests {
+		got, err := UploadFormat(test.name, test.contentType, test.from)
+		if got != test.want || !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+			t.Errorf("UploadFormat(%q, %q, %q) = %q, %v, want %q, %v", test.name, test.contentType, test.from, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestReadUpload(t *testing.T) {
+	limits := UploadLimits{Max_file_size: 16, Max_request_size: 32}
+
+	tests := []struct {
+		content string
+		err     error
+	}{
+		{"# Hello wörld", nil},
+		{"<p>hi</p>", nil},
+		{"more than sixteen bytes", ErrFileTooLarge},
+		{"a\x00b", ErrBinaryFile},
+		{"\x89PNG\r\n\x1a\nxxxx", ErrBinaryFile},
+		{"PK\x03\x04zip", ErrBinaryFile},
+		{"\xef\xbb\xbfcaf\xe9", ErrInvalidEncoding},
+	}
+
+	for _, test := range tests {
+		content, _, err := ReadUpload(strings.NewReader(test.content), limits)
+		if !errors.Is(err, test.err) || (test.err == nil) != (err == nil) {
+			t.Errorf("ReadUpload(%q) error = %v, want %v", test.content, err, test.err)
+		}
+		if err == nil && string(content) != test.content {
+			t.Errorf("ReadUpload(%q) = %q", test.content, content)
+		}
+	}
+}